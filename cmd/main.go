@@ -6,11 +6,14 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/dotunj/bequest/config"
 	"github.com/dotunj/bequest/internal/pkg/app"
+	"github.com/dotunj/bequest/internal/pkg/auth"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
 	"github.com/dotunj/bequest/internal/pkg/server"
 	"github.com/sirupsen/logrus"
 	prefixed "github.com/x-cray/logrus-prefixed-formatter"
@@ -30,27 +33,67 @@ func main() {
 		ForceFormatting: true,
 	})
 
-	var mongoDsn, redisDsn, port string
+	var store, dsn, boltPath, sqlitePath, redisDsn, port string
 
-	flag.StringVar(&mongoDsn, "mongo-dsn", "", "MongoDB DSN")
+	flag.StringVar(&store, "store", "", "Storage backend (mongo, postgres, memory, bolt, sqlite), inferred from the DSN when empty")
+	flag.StringVar(&dsn, "dsn", "", "Database DSN, mongodb:// or postgres://")
+	flag.StringVar(&dsn, "mongo-dsn", "", "MongoDB DSN (deprecated, use --dsn)")
+	flag.StringVar(&boltPath, "bolt-path", "", "Bolt database file")
+	flag.StringVar(&sqlitePath, "sqlite-path", "", "SQLite database file")
+	flag.StringVar(&redisDsn, "redis-dsn", "", "Redis DSN, enables the answer cache")
 	flag.StringVar(&port, "port", "", "Server Port")
 
+	var apiKeyName, apiKeyTenant, apiKeyScopes, apiKeyRole string
+
+	flag.StringVar(&apiKeyName, "create-api-key", "", "Issue an api key with this name, print it and exit")
+	flag.StringVar(&apiKeyTenant, "api-key-tenant", datastore.DefaultTenant, "Tenant of the issued api key")
+	flag.StringVar(&apiKeyScopes, "api-key-scopes", strings.Join(auth.Scopes, ","), "Comma separated scopes of the issued api key")
+	flag.StringVar(&apiKeyRole, "api-key-role", string(datastore.AdminRole), "Role of the issued api key on every key of its tenant, none when empty")
+
 	flag.Parse()
 
 	//Set up Config
-	cfg, err := config.NewConfig(mongoDsn, redisDsn, port)
+	cfg, err := config.NewConfig(store, dsn, boltPath, sqlitePath, redisDsn, port)
 	if err != nil {
 		logrus.Fatal(err)
 	}
 
 	//Create a new application
-	app, err := app.NewApplication(cfg.Database.Dsn)
+	app, err := app.NewApplication(cfg)
 	if err != nil {
 		logrus.Fatal(err)
 	}
 
-	//close DB connection
-	defer app.DB.DB.Client().Disconnect(context.Background())
+	//stop the outbox dispatcher and close DB connection
+	defer app.Close(context.Background())
+
+	if apiKeyName != "" {
+		if apiKeyRole != "" && !datastore.Role(apiKeyRole).IsValid() {
+			logrus.Fatalf("unknown role %q", apiKeyRole)
+		}
+
+		issued, err := app.IssueAPIKey(context.Background(), apiKeyTenant, &datastore.CreateAPIKey{
+			Name:   apiKeyName,
+			Scopes: strings.Split(apiKeyScopes, ","),
+		})
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		if apiKeyRole != "" {
+			_, err = app.BindRole(context.Background(), apiKeyTenant, &datastore.CreateRoleBinding{
+				Subject: "api_key:" + issued.UID,
+				Role:    datastore.Role(apiKeyRole),
+				Pattern: "*",
+			})
+			if err != nil {
+				logrus.Fatal(err)
+			}
+		}
+
+		fmt.Println(issued.Key)
+		return
+	}
 
 	httpServer := server.New(app.Routes(), cfg.Server.Port)
 
@@ -1,12 +1,28 @@
 package config
 
 import (
+	"net/url"
+	"time"
+
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
+const (
+	MongoStore    = "mongo"
+	MemoryStore   = "memory"
+	BoltStore     = "bolt"
+	SqliteStore   = "sqlite"
+	PostgresStore = "postgres"
+)
+
 type Config struct {
-	Database Database
-	Server   Server
+	Database  Database
+	Redis     Redis
+	Outbox    Outbox
+	Expiry    Expiry
+	Retention Retention
+	Server    Server
+	Auth      Auth
 }
 
 type Server struct {
@@ -14,11 +30,111 @@ type Server struct {
 }
 
 type Database struct {
-	Dsn string `env:"MONGO_DSN"`
+	// Store selects the storage backend. When empty it is
+	// inferred from the scheme of Dsn.
+	Store string `env:"STORE"`
+	Dsn   string `env:"DATABASE_DSN,MONGO_DSN"`
+
+	// BoltPath is the file used by the bolt store.
+	BoltPath string `env:"BOLT_PATH" env-default:"bequest.db"`
+
+	// SqlitePath is the database file, or URI, used by the sqlite store.
+	SqlitePath string `env:"SQLITE_PATH" env-default:"bequest.sqlite"`
+}
+
+// Redis configures the answer cache, which is disabled when Dsn is empty.
+type Redis struct {
+	Dsn string `env:"REDIS_DSN"`
+
+	// TTL is how long a found answer stays cached.
+	TTL time.Duration `env:"REDIS_TTL" env-default:"5m"`
+
+	// NegativeTTL is how long a missing key is remembered,
+	// zero disables negative caching.
+	NegativeTTL time.Duration `env:"REDIS_NEGATIVE_TTL" env-default:"30s"`
+
+	// Timeout bounds every redis call, after which
+	// answers are read from the store instead.
+	Timeout time.Duration `env:"REDIS_TIMEOUT" env-default:"200ms"`
+}
+
+// Outbox configures the dispatcher moving events from the outbox to the
+// events collection.
+type Outbox struct {
+	// PollInterval is how often due events are looked up.
+	PollInterval time.Duration `env:"OUTBOX_POLL_INTERVAL" env-default:"1s"`
+
+	// BatchSize is the number of events read per lookup.
+	BatchSize int `env:"OUTBOX_BATCH_SIZE" env-default:"100"`
+
+	// MaxAttempts is the number of failed deliveries
+	// after which an event is dead-lettered.
+	MaxAttempts int `env:"OUTBOX_MAX_ATTEMPTS" env-default:"10"`
+
+	// MinBackoff and MaxBackoff bound the delay before
+	// a failed delivery is retried.
+	MinBackoff time.Duration `env:"OUTBOX_MIN_BACKOFF" env-default:"1s"`
+	MaxBackoff time.Duration `env:"OUTBOX_MAX_BACKOFF" env-default:"5m"`
+}
+
+// Expiry configures the reaper deleting expired answers, which are
+// read as not found from the moment they expire either way.
+type Expiry struct {
+	// Interval is how often expired answers are looked up,
+	// zero disables the reaper.
+	Interval time.Duration `env:"EXPIRY_INTERVAL" env-default:"10s"`
+}
+
+// Retention configures what is purged, and how often. Nothing is
+// purged unless at least one of the limits is set.
+type Retention struct {
+	// Interval is how often the policy is applied.
+	Interval time.Duration `env:"RETENTION_INTERVAL" env-default:"1h"`
+
+	// DeletedAnswers is how long deleted answers, and
+	// their history, are kept.
+	DeletedAnswers time.Duration `env:"RETENTION_DELETED_ANSWERS"`
+
+	// HistoryAge is how long events are kept, and HistoryVersions
+	// the number of most recent events kept for every key.
+	HistoryAge      time.Duration `env:"RETENTION_HISTORY_AGE"`
+	HistoryVersions int           `env:"RETENTION_HISTORY_VERSIONS"`
+}
+
+// Auth configures how requests are authenticated. Requests may be
+// anonymous unless Required is set, or a secret or a key set is
+// configured. Api keys are accepted either way.
+type Auth struct {
+	// Required rejects anonymous requests, it is implied
+	// when bearer tokens are accepted.
+	Required bool `env:"AUTH_REQUIRED"`
+
+	// HMACSecret verifies HS256 tokens.
+	HMACSecret string `env:"AUTH_HMAC_SECRET"`
+
+	// JWKSFile and JWKSURL locate the key set verifying RS256 and
+	// ES256 tokens, a key set fetched from a URL is refreshed every
+	// JWKSRefresh.
+	JWKSFile    string        `env:"AUTH_JWKS_FILE"`
+	JWKSURL     string        `env:"AUTH_JWKS_URL"`
+	JWKSRefresh time.Duration `env:"AUTH_JWKS_REFRESH" env-default:"15m"`
+
+	// Issuer and Audience, when set, must match the
+	// iss and aud claims of the tokens.
+	Issuer   string `env:"AUTH_ISSUER"`
+	Audience string `env:"AUTH_AUDIENCE"`
+
+	// AdminSubjects are admins on every key of every tenant, so that
+	// the first role bindings can be created.
+	AdminSubjects []string `env:"AUTH_ADMIN_SUBJECTS" env-separator:","`
 }
 
+// Enabled reports whether requests must be authenticated.
+func (a Auth) Enabled() bool {
+	return a.Required || a.HMACSecret != "" || a.JWKSFile != "" || a.JWKSURL != ""
+}
 
-func NewConfig(mongoDsn, redisDsn, port string) (*Config, error) {
+func NewConfig(store, dsn, boltPath, sqlitePath, redisDsn, port string) (*Config, error) {
 	cfg := &Config{}
 
 	err := cleanenv.ReadEnv(cfg)
@@ -26,13 +142,49 @@ func NewConfig(mongoDsn, redisDsn, port string) (*Config, error) {
 		return nil, err
 	}
 
-	if mongoDsn != "" {
-		cfg.Database.Dsn = mongoDsn
+	if store != "" {
+		cfg.Database.Store = store
+	}
+
+	if dsn != "" {
+		cfg.Database.Dsn = dsn
+	}
+
+	if boltPath != "" {
+		cfg.Database.BoltPath = boltPath
+	}
+
+	if sqlitePath != "" {
+		cfg.Database.SqlitePath = sqlitePath
+	}
+
+	if redisDsn != "" {
+		cfg.Redis.Dsn = redisDsn
 	}
 
 	if port != "" {
 		cfg.Server.Port = port
 	}
 
+	if cfg.Database.Store == "" {
+		cfg.Database.Store = storeFromDsn(cfg.Database.Dsn)
+	}
+
 	return cfg, nil
 }
+
+// storeFromDsn picks the store matching the scheme of
+// dsn, falling back to mongo for backwards compatibility.
+func storeFromDsn(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return MongoStore
+	}
+
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		return PostgresStore
+	default:
+		return MongoStore
+	}
+}
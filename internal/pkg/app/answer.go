@@ -1,8 +1,10 @@
 package app
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/dotunj/bequest/internal/pkg/datastore"
 	"github.com/dotunj/bequest/internal/pkg/util"
@@ -17,48 +19,181 @@ func (a *Application) CreateAnswer(c *gin.Context) {
 		return
 	}
 
-	answer, err := a.answerService.CreateAnswer(c.Request.Context(), &createAnswer)
+	if !a.authorize(c, createAnswer.Key, datastore.WriterRole) {
+		return
+	}
+
+	answer, err := a.answerService.CreateAnswer(c.Request.Context(), tenantID(c), &createAnswer)
 	if err != nil {
-		status, message := util.NewServiceErrResponse(err)
-		a.errorResponse(c, status, message)
+		// schema violations are listed in the response data
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	c.Header("ETag", answer.ETag())
+	a.successResponse(c, http.StatusCreated, "answer created successfully", newAnswerResponse(answer))
+}
+
+func (a *Application) ExecuteBatch(c *gin.Context) {
+	var batch datastore.BatchRequest
+
+	if err := c.ShouldBindJSON(&batch); err != nil {
+		a.errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authorized, err := a.roleService.Authorizer(c.Request.Context(), tenantID(c), datastore.WriterRole)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	outcomes, err := a.answerService.ExecuteBatch(c.Request.Context(), tenantID(c), &batch, authorized)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
 		return
 	}
 
-	answerResponse := &datastore.AnswerResponse{
-		UID:       answer.UID,
-		Key:       answer.Key,
-		Value:     answer.Values[0].Value,
-		CreatedAt: answer.CreatedAt,
-		UpdatedAt: answer.UpdatedAt,
+	response := &datastore.BatchResponse{
+		Atomic:  batch.Atomic,
+		Results: make([]datastore.BatchResult, 0, len(outcomes)),
 	}
 
-	a.successResponse(c, http.StatusCreated, "answer created successfully", answerResponse)
+	for i, outcome := range outcomes {
+		op := batch.Operations[i]
+		result := datastore.BatchResult{Op: op.Op, Key: op.Key, Status: http.StatusOK}
+
+		switch {
+		case outcome.Err != nil:
+			result.Status, result.Error = util.NewServiceErrResponse(outcome.Err)
+
+			// schema violations are listed in the details
+			var serviceErr *util.ServiceError
+			if errors.As(outcome.Err, &serviceErr) {
+				result.Details = serviceErr.Data()
+			}
+
+			response.Failed++
+		case outcome.Answer != nil:
+			if op.Op == datastore.CreateBatchOperation {
+				result.Status = http.StatusCreated
+			}
+
+			result.ETag = outcome.Answer.ETag()
+			result.Answer = newAnswerResponse(outcome.Answer)
+			response.Succeeded++
+		default:
+			response.Succeeded++
+		}
+
+		response.Results = append(response.Results, result)
+	}
+
+	a.successResponse(c, http.StatusOK, "batch executed successfully", response)
+}
+
+func (a *Application) FindAnswers(c *gin.Context) {
+	var query datastore.AnswerQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		a.errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authorized, err := a.roleService.Authorizer(c.Request.Context(), tenantID(c), datastore.ReaderRole)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	// answers of keys the principal can't read are left out
+	answers, cursor, err := a.answerService.FindAnswers(c.Request.Context(), tenantID(c), &query, authorized)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	content := make([]*datastore.AnswerResponse, 0, len(answers))
+	for i := range answers {
+		content = append(content, newAnswerResponse(&answers[i]))
+	}
+
+	pagedResponse := &datastore.PagedResponse{
+		Content: content,
+		Cursor:  &cursor,
+	}
+
+	a.successResponse(c, http.StatusOK, "answers retrieved successfully", pagedResponse)
+}
+
+func (a *Application) SearchAnswers(c *gin.Context) {
+	var query datastore.SearchQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		a.errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authorized, err := a.roleService.Authorizer(c.Request.Context(), tenantID(c), datastore.ReaderRole)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	results, paginationData, err := a.answerService.SearchAnswers(c.Request.Context(), tenantID(c), &query, a.pagination(c), authorized)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	pagedResponse := &datastore.PagedResponse{
+		Content:    results,
+		Pagination: &paginationData,
+	}
+
+	a.successResponse(c, http.StatusOK, "answers found successfully", pagedResponse)
 }
 
 func (a *Application) FindAnswerByKey(c *gin.Context) {
-	answer, err := a.answerService.FindAnswerByKey(c.Request.Context(), c.Param("key"))
+	if !a.authorize(c, c.Param("key"), datastore.ReaderRole) {
+		return
+	}
+
+	var answer *datastore.Answer
+	var err error
+
+	if raw := c.Query("at"); raw != "" {
+		at, parseErr := time.Parse(time.RFC3339, raw)
+		if parseErr != nil {
+			a.errorResponse(c, http.StatusBadRequest, "at must be an RFC3339 timestamp")
+			return
+		}
+
+		answer, err = a.answerService.FindAnswerAt(c.Request.Context(), tenantID(c), c.Param("key"), at)
+	} else {
+		answer, err = a.answerService.FindAnswerByKey(c.Request.Context(), tenantID(c), c.Param("key"))
+	}
+
 	if err != nil {
 		status, message := util.NewServiceErrResponse(err)
 		a.errorResponse(c, status, message)
 		return
 	}
 
-	// Gets the index of the most recent answer
-	latestIndex := len(answer.Values) - 1
-
-	answerResponse := &datastore.AnswerResponse{
-		UID:       answer.UID,
-		Key:       answer.Key,
-		Value:     answer.Values[latestIndex].Value,
-		CreatedAt: answer.CreatedAt,
-		UpdatedAt: answer.UpdatedAt,
+	setValidators(c, answer.ETag(), answer.UpdatedAt.Time())
+	if notModified(c, answer.ETag(), answer.UpdatedAt.Time()) {
+		c.Status(http.StatusNotModified)
+		return
 	}
 
-	a.successResponse(c, http.StatusOK, "answer retrieved successfully", answerResponse)
-
+	a.successResponse(c, http.StatusOK, "answer retrieved successfully", newAnswerResponse(answer))
 }
 
 func (a *Application) UpdateAnswer(c *gin.Context) {
+	if !a.authorize(c, c.Param("key"), datastore.WriterRole) {
+		return
+	}
+
 	var updateAnswer datastore.UpdateAnswer
 
 	if err := c.ShouldBindJSON(&updateAnswer); err != nil {
@@ -66,29 +201,46 @@ func (a *Application) UpdateAnswer(c *gin.Context) {
 		return
 	}
 
-	answer, err := a.answerService.UpdateAnswer(c.Request.Context(), c.Param("key"), &updateAnswer)
+	answer, err := a.answerService.UpdateAnswer(c.Request.Context(), tenantID(c), c.Param("key"), &updateAnswer, ifMatch(c))
 	if err != nil {
-		status, message := util.NewServiceErrResponse(err)
-		a.errorResponse(c, status, message)
+		// schema violations are listed in the response data
+		a.serviceErrorResponse(c, err)
 		return
 	}
 
-	// Gets the index of the most recent answer
-	latestIndex := len(answer.Values) - 1
+	c.Header("ETag", answer.ETag())
+	a.successResponse(c, http.StatusOK, "answer updated successfully", newAnswerResponse(answer))
+}
 
-	answerResponse := &datastore.AnswerResponse{
-		UID:       answer.UID,
-		Key:       answer.Key,
-		Value:     answer.Values[latestIndex].Value,
-		CreatedAt: answer.CreatedAt,
-		UpdatedAt: answer.UpdatedAt,
+func (a *Application) RollbackAnswer(c *gin.Context) {
+	if !a.authorize(c, c.Param("key"), datastore.WriterRole) {
+		return
 	}
 
-	a.successResponse(c, http.StatusOK, "answer updated successfully", answerResponse)
+	var rollbackAnswer datastore.RollbackAnswer
+
+	if err := c.ShouldBindJSON(&rollbackAnswer); err != nil {
+		a.errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	answer, err := a.answerService.RollbackAnswer(c.Request.Context(), tenantID(c), c.Param("key"), &rollbackAnswer, ifMatch(c))
+	if err != nil {
+		// schema violations are listed in the response data
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	c.Header("ETag", answer.ETag())
+	a.successResponse(c, http.StatusOK, "answer rolled back successfully", newAnswerResponse(answer))
 }
 
 func (a *Application) DeleteAnswer(c *gin.Context) {
-	err := a.answerService.DeleteAnswer(c.Request.Context(), c.Param("key"))
+	if !a.authorize(c, c.Param("key"), datastore.WriterRole) {
+		return
+	}
+
+	err := a.answerService.DeleteAnswer(c.Request.Context(), tenantID(c), c.Param("key"), ifMatch(c))
 	if err != nil {
 		status, message := util.NewServiceErrResponse(err)
 		a.errorResponse(c, status, message)
@@ -98,23 +250,169 @@ func (a *Application) DeleteAnswer(c *gin.Context) {
 	a.successResponse(c, http.StatusOK, "answer deleted successfully", nil)
 }
 
+func (a *Application) RestoreAnswer(c *gin.Context) {
+	if !a.authorize(c, c.Param("key"), datastore.WriterRole) {
+		return
+	}
+
+	answer, err := a.answerService.RestoreAnswer(c.Request.Context(), tenantID(c), c.Param("key"))
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	c.Header("ETag", answer.ETag())
+	a.successResponse(c, http.StatusOK, "answer restored successfully", newAnswerResponse(answer))
+}
+
 func (a *Application) FindHistoryByKey(c *gin.Context) {
+	if !a.authorize(c, c.Param("key"), datastore.ReaderRole) {
+		return
+	}
+
+	var generation int64
+	if raw := c.Query("generation"); raw != "" {
+		var err error
+		generation, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || generation < 1 {
+			a.errorResponse(c, http.StatusBadRequest, "generation must be a positive number")
+			return
+		}
+	}
+
 	pageable := a.pagination(c)
 
-	events, paginationData, err := a.eventService.FindHistoryByKey(c.Request.Context(), c.Param("key"), pageable)
+	events, paginationData, err := a.eventService.FindHistoryByKey(c.Request.Context(), tenantID(c), c.Param("key"), generation, pageable)
 	if err != nil {
 		status, message := util.NewServiceErrResponse(err)
 		a.errorResponse(c, status, message)
 		return
 	}
 
+	// events added to the history are newer than those it
+	// already holds, so the page is as recent as its newest
+	var lastModified time.Time
+	for _, event := range events {
+		if t := event.CreatedAt.Time(); t.After(lastModified) {
+			lastModified = t
+		}
+	}
+
 	pagedResponse := &datastore.PagedResponse{
 		Content:    events,
 		Pagination: &paginationData,
 	}
 
-	a.successResponse(c, http.StatusOK, "retrieved history", pagedResponse)
+	a.pageResponse(c, "retrieved history", pagedResponse, lastModified)
+}
+
+func (a *Application) FindAnswerVersions(c *gin.Context) {
+	if !a.authorize(c, c.Param("key"), datastore.ReaderRole) {
+		return
+	}
+
+	pageable := a.pagination(c)
+
+	versions, paginationData, err := a.answerService.FindAnswerVersions(c.Request.Context(), tenantID(c), c.Param("key"), pageable)
+	if err != nil {
+		status, message := util.NewServiceErrResponse(err)
+		a.errorResponse(c, status, message)
+		return
+	}
+
+	var lastModified time.Time
+	content := make([]*datastore.VersionResponse, 0, len(versions))
+	for _, value := range versions {
+		if t := value.CreatedAt.Time(); t.After(lastModified) {
+			lastModified = t
+		}
+
+		content = append(content, newVersionResponse(value))
+	}
+
+	pagedResponse := &datastore.PagedResponse{
+		Content:    content,
+		Pagination: &paginationData,
+	}
+
+	a.pageResponse(c, "retrieved versions", pagedResponse, lastModified)
+}
+
+func (a *Application) FindAnswerVersion(c *gin.Context) {
+	if !a.authorize(c, c.Param("key"), datastore.ReaderRole) {
+		return
+	}
+
+	version, err := strconv.ParseInt(c.Param("version"), 10, 64)
+	if err != nil || version < 1 {
+		a.errorResponse(c, http.StatusBadRequest, "version must be a positive number")
+		return
+	}
+
+	answer, err := a.answerService.FindAnswerVersion(c.Request.Context(), tenantID(c), c.Param("key"), version)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
 
+	// a version keeps its tag and time as the answer moves on
+	etag, lastModified := answer.VersionETag(version), answer.UpdatedAt.Time()
+
+	setValidators(c, etag, lastModified)
+	if notModified(c, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "version retrieved successfully", newVersionResponse(answer.Values[len(answer.Values)-1]))
+}
+
+// pageResponse responds with page, which was last modified at
+// lastModified, unless the client already has it.
+func (a *Application) pageResponse(c *gin.Context, message string, page *datastore.PagedResponse, lastModified time.Time) {
+	etag, err := contentTag(page)
+	if err != nil {
+		a.errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	setValidators(c, etag, lastModified)
+	if notModified(c, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, message, page)
+}
+
+// newAnswerResponse describes the most recent value of answer.
+func newAnswerResponse(answer *datastore.Answer) *datastore.AnswerResponse {
+	latest := answer.Values[len(answer.Values)-1]
+
+	return &datastore.AnswerResponse{
+		UID:        answer.UID,
+		Key:        answer.Key,
+		Value:      latest.Value,
+		Type:       latest.ValueType(),
+		Version:    answer.Version,
+		Generation: answer.Generation,
+		CreatedAt:  answer.CreatedAt,
+		UpdatedAt:  answer.UpdatedAt,
+		DeletedAt:  answer.DeletedAt,
+		ExpiresAt:  answer.ExpiresAt,
+	}
+}
+
+// newVersionResponse describes a value of an answer, as
+// returned by Answer.Versions.
+func newVersionResponse(value datastore.Value) *datastore.VersionResponse {
+	return &datastore.VersionResponse{
+		Version:   value.Version,
+		Value:     value.Value,
+		Type:      value.ValueType(),
+		Author:    value.Author,
+		CreatedAt: value.CreatedAt,
+	}
 }
 
 func (a *Application) pagination(c *gin.Context) datastore.Pageable {
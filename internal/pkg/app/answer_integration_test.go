@@ -191,7 +191,7 @@ func (a *AnswerIntegrationTestSuite) Test_DeleteAnswer() {
 	require.Equal(a.T(), http.StatusOK, w.Code)
 
 	// Try to fetch the answer that was deleted
-	_, err = a.DB.AnswerRepo.FindByKey(context.Background(), key)
+	_, err = a.DB.AnswerRepo.FindByKey(context.Background(), datastore.DefaultTenant, key)
 	require.ErrorIs(a.T(), datastore.ErrAnswerNotFound, err)
 
 }
@@ -214,6 +214,7 @@ func TestAnswerIntegrationTestSuite(t *testing.T) {
 
 func (a *AnswerIntegrationTestSuite) seedAnswer(key, value string) error {
 	answer := &datastore.Answer{
+		TenantID:       datastore.DefaultTenant,
 		Key:            key,
 		Values:         []datastore.Value{{Value: value}},
 		DocumentStatus: datastore.ActiveDocumentStatus,
@@ -0,0 +1,926 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dotunj/bequest/config"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AnswerTestSuite exercises the HTTP layer against the in-memory
+// store, so it runs without a MongoDB instance.
+type AnswerTestSuite struct {
+	suite.Suite
+	DB     datastore.Store
+	Router http.Handler
+}
+
+func (a *AnswerTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+}
+
+func (a *AnswerTestSuite) SetupTest() {
+	cfg := &config.Config{
+		Database: config.Database{Store: config.MemoryStore},
+	}
+
+	app, err := NewApplication(cfg)
+	require.Nil(a.T(), err)
+
+	a.T().Cleanup(func() {
+		_ = app.Close(context.Background())
+	})
+
+	a.DB = app.DB
+	a.Router = app.Routes()
+}
+
+func (a *AnswerTestSuite) Test_CreateAnswer() {
+	key := uuid.NewString()
+	value := uuid.NewString()
+
+	body := strings.NewReader(fmt.Sprintf(`{"key": "%s", "value": "%s"}`, key, value))
+	req := createRequest(http.MethodPost, "/api/v1/answers", body)
+
+	w := httptest.NewRecorder()
+	a.Router.ServeHTTP(w, req)
+
+	require.Equal(a.T(), http.StatusCreated, w.Code)
+
+	var answer datastore.AnswerResponse
+	parseResponse(a.T(), w.Result(), &answer)
+
+	require.Equal(a.T(), key, answer.Key)
+	require.Equal(a.T(), value, answer.Value)
+}
+
+func (a *AnswerTestSuite) Test_Does_Not_CreateAnswer_With_Existing_Key() {
+	key := uuid.NewString()
+	value := uuid.NewString()
+
+	err := a.seedAnswer(key, value)
+	require.Nil(a.T(), err)
+
+	body := strings.NewReader(fmt.Sprintf(`{"key": "%s", "value": "%s"}`, key, value))
+	req := createRequest(http.MethodPost, "/api/v1/answers", body)
+
+	w := httptest.NewRecorder()
+	a.Router.ServeHTTP(w, req)
+
+	require.Equal(a.T(), http.StatusForbidden, w.Code)
+}
+
+func (a *AnswerTestSuite) Test_GetAnswer_ExistingKey() {
+	key := uuid.NewString()
+	value := uuid.NewString()
+
+	err := a.seedAnswer(key, value)
+	require.Nil(a.T(), err)
+
+	req := createRequest(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s", key), nil)
+
+	w := httptest.NewRecorder()
+	a.Router.ServeHTTP(w, req)
+
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	var answer datastore.AnswerResponse
+	parseResponse(a.T(), w.Result(), &answer)
+
+	require.Equal(a.T(), key, answer.Key)
+	require.Equal(a.T(), value, answer.Value)
+}
+
+func (a *AnswerTestSuite) Test_GetAnswer_WithNonExistingKey() {
+	req := createRequest(http.MethodGet, "/api/v1/answers/key", nil)
+
+	w := httptest.NewRecorder()
+	a.Router.ServeHTTP(w, req)
+
+	require.Equal(a.T(), http.StatusNotFound, w.Code)
+}
+
+func (a *AnswerTestSuite) Test_GetAnswer_AtTime() {
+	key := uuid.NewString()
+	created := time.Date(2022, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	answer := &datastore.Answer{
+		UID:      uuid.NewString(),
+		TenantID: datastore.DefaultTenant,
+		Key:      key,
+		Values: []datastore.Value{
+			{Value: "first", CreatedAt: primitive.NewDateTimeFromTime(created)},
+			{Value: "second", CreatedAt: primitive.NewDateTimeFromTime(created.Add(time.Hour))},
+		},
+		Version:        2,
+		CreatedAt:      primitive.NewDateTimeFromTime(created),
+		UpdatedAt:      primitive.NewDateTimeFromTime(created.Add(time.Hour)),
+		DocumentStatus: datastore.ActiveDocumentStatus,
+	}
+	require.Nil(a.T(), a.DB.Answers().Create(context.Background(), answer))
+
+	get := func(at string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.Router.ServeHTTP(w, createRequest(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s?at=%s", key, at), nil))
+		return w
+	}
+
+	w := get("2022-03-01T09:30:00Z")
+	require.Equal(a.T(), http.StatusOK, w.Code)
+	require.Equal(a.T(), fmt.Sprintf(`"%s.1"`, answer.UID), w.Header().Get("ETag"))
+
+	var found datastore.AnswerResponse
+	parseResponse(a.T(), w.Result(), &found)
+	require.Equal(a.T(), "first", found.Value)
+
+	w = get("2022-03-01T11:30:00%2B01:00")
+	require.Equal(a.T(), http.StatusOK, w.Code)
+	parseResponse(a.T(), w.Result(), &found)
+	require.Equal(a.T(), "second", found.Value)
+
+	w = get("2022-03-01T08:59:59Z")
+	require.Equal(a.T(), http.StatusNotFound, w.Code)
+
+	w = get("yesterday")
+	require.Equal(a.T(), http.StatusBadRequest, w.Code)
+}
+
+func (a *AnswerTestSuite) Test_FindAnswerVersions() {
+	key := uuid.NewString()
+
+	body := strings.NewReader(fmt.Sprintf(`{"key": "%s", "value": "first"}`, key))
+	w := httptest.NewRecorder()
+	a.Router.ServeHTTP(w, createRequest(http.MethodPost, "/api/v1/answers", body))
+	require.Equal(a.T(), http.StatusCreated, w.Code)
+
+	for _, value := range []string{`"second"`, `3`} {
+		w = httptest.NewRecorder()
+		a.Router.ServeHTTP(w, createRequest(http.MethodPut, fmt.Sprintf("/api/v1/answers/%s", key), strings.NewReader(fmt.Sprintf(`{"value": %s}`, value))))
+		require.Equal(a.T(), http.StatusOK, w.Code)
+	}
+
+	var answer datastore.AnswerResponse
+	parseResponse(a.T(), w.Result(), &answer)
+	require.Equal(a.T(), int64(3), answer.Version)
+
+	w = httptest.NewRecorder()
+	a.Router.ServeHTTP(w, createRequest(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/versions?perPage=2&page=1", key), nil))
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	var versions struct {
+		Content    []datastore.VersionResponse `json:"content"`
+		Pagination *datastore.PaginationData   `json:"pagination"`
+	}
+	parseResponse(a.T(), w.Result(), &versions)
+
+	require.Len(a.T(), versions.Content, 2)
+	require.Equal(a.T(), int64(3), versions.Content[0].Version)
+	require.Equal(a.T(), float64(3), versions.Content[0].Value)
+	require.Equal(a.T(), datastore.NumberValue, versions.Content[0].Type)
+	require.NotZero(a.T(), versions.Content[0].CreatedAt)
+	require.Equal(a.T(), int64(2), versions.Content[1].Version)
+	require.Equal(a.T(), int64(3), versions.Pagination.Total)
+
+	w = httptest.NewRecorder()
+	a.Router.ServeHTTP(w, createRequest(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/versions/1", key), nil))
+	require.Equal(a.T(), http.StatusOK, w.Code)
+	require.Equal(a.T(), fmt.Sprintf(`W/"%s.v1"`, answer.UID), w.Header().Get("ETag"))
+
+	var version datastore.VersionResponse
+	parseResponse(a.T(), w.Result(), &version)
+	require.Equal(a.T(), int64(1), version.Version)
+	require.Equal(a.T(), "first", version.Value)
+
+	// a version has its own tag, apart from the tags of the answer
+	for etag, status := range map[string]int{
+		fmt.Sprintf(`W/"%s.v1"`, answer.UID): http.StatusNotModified,
+		fmt.Sprintf(`"%s.1"`, answer.UID):    http.StatusOK,
+		fmt.Sprintf(`"%s.3"`, answer.UID):    http.StatusOK,
+	} {
+		req := createRequest(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/versions/1", key), nil)
+		req.Header.Set("If-None-Match", etag)
+
+		w = httptest.NewRecorder()
+		a.Router.ServeHTTP(w, req)
+		require.Equal(a.T(), status, w.Code, etag)
+		require.Equal(a.T(), fmt.Sprintf(`W/"%s.v1"`, answer.UID), w.Header().Get("ETag"), etag)
+	}
+
+	// and isn't accepted by conditional writes, even for the latest version
+	req := createRequest(http.MethodPut, fmt.Sprintf("/api/v1/answers/%s", key), strings.NewReader(`{"value": 4}`))
+	req.Header.Set("If-Match", fmt.Sprintf(`W/"%s.v3"`, answer.UID))
+
+	w = httptest.NewRecorder()
+	a.Router.ServeHTTP(w, req)
+	require.Equal(a.T(), http.StatusPreconditionFailed, w.Code)
+
+	for url, status := range map[string]int{
+		fmt.Sprintf("/api/v1/answers/%s/versions/4", key):     http.StatusNotFound,
+		fmt.Sprintf("/api/v1/answers/%s/versions/first", key): http.StatusBadRequest,
+		"/api/v1/answers/missing/versions":                    http.StatusNotFound,
+	} {
+		w = httptest.NewRecorder()
+		a.Router.ServeHTTP(w, createRequest(http.MethodGet, url, nil))
+		require.Equal(a.T(), status, w.Code, url)
+	}
+}
+
+func (a *AnswerTestSuite) Test_RollbackAnswer() {
+	key := uuid.NewString()
+
+	send := func(method, url, body string) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+
+		w := httptest.NewRecorder()
+		a.Router.ServeHTTP(w, createRequest(method, url, reader))
+		return w
+	}
+
+	w := send(http.MethodPost, "/api/v1/answers", fmt.Sprintf(`{"key": "%s", "value": "good-value"}`, key))
+	require.Equal(a.T(), http.StatusCreated, w.Code)
+
+	w = send(http.MethodPut, fmt.Sprintf("/api/v1/answers/%s", key), `{"value": "bad-value"}`)
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	w = send(http.MethodPost, fmt.Sprintf("/api/v1/answers/%s/rollback", key), `{"version": 1}`)
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	var answer datastore.AnswerResponse
+	parseResponse(a.T(), w.Result(), &answer)
+	require.Equal(a.T(), "good-value", answer.Value)
+	require.Equal(a.T(), int64(3), answer.Version)
+	require.Equal(a.T(), fmt.Sprintf(`"%s.3"`, answer.UID), w.Header().Get("ETag"))
+
+	w = send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/history", key), "")
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	var history struct {
+		Content []datastore.Event `json:"content"`
+	}
+	parseResponse(a.T(), w.Result(), &history)
+
+	var rollbacks []datastore.Event
+	for _, event := range history.Content {
+		if event.Type == datastore.RollbackEvent {
+			rollbacks = append(rollbacks, event)
+		}
+	}
+	require.Len(a.T(), rollbacks, 1)
+	require.Equal(a.T(), &datastore.EventData{Key: key, Value: "good-value", Type: datastore.StringValue, Generation: 1, Version: 3, SourceVersion: 1}, rollbacks[0].Data)
+
+	for body, status := range map[string]int{
+		`{"version": 7}`:                 http.StatusNotFound,
+		`{"at": "2000-01-01T00:00:00Z"}`: http.StatusNotFound,
+		`{}`:                             http.StatusBadRequest,
+		`{"at": "yesterday"}`:            http.StatusBadRequest,
+	} {
+		w = send(http.MethodPost, fmt.Sprintf("/api/v1/answers/%s/rollback", key), body)
+		require.Equal(a.T(), status, w.Code, body)
+	}
+}
+
+func (a *AnswerTestSuite) Test_UpdateAnswer() {
+	key := uuid.NewString()
+	value := uuid.NewString()
+
+	err := a.seedAnswer(key, value)
+	require.Nil(a.T(), err)
+
+	newValue := uuid.NewString()
+	body := strings.NewReader(fmt.Sprintf(`{"value": "%s"}`, newValue))
+	req := createRequest(http.MethodPut, fmt.Sprintf("/api/v1/answers/%s", key), body)
+
+	w := httptest.NewRecorder()
+	a.Router.ServeHTTP(w, req)
+
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	var answer datastore.AnswerResponse
+	parseResponse(a.T(), w.Result(), &answer)
+
+	require.Equal(a.T(), key, answer.Key)
+	require.Equal(a.T(), newValue, answer.Value)
+}
+
+func (a *AnswerTestSuite) Test_DeleteAnswer() {
+	key := uuid.NewString()
+	value := uuid.NewString()
+
+	err := a.seedAnswer(key, value)
+	require.Nil(a.T(), err)
+
+	req := createRequest(http.MethodDelete, fmt.Sprintf("/api/v1/answers/%s", key), nil)
+
+	w := httptest.NewRecorder()
+	a.Router.ServeHTTP(w, req)
+
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	_, err = a.DB.Answers().FindByKey(context.Background(), datastore.DefaultTenant, key)
+	require.ErrorIs(a.T(), err, datastore.ErrAnswerNotFound)
+}
+
+func (a *AnswerTestSuite) Test_RestoreAnswer() {
+	key := uuid.NewString()
+
+	send := func(method, url, body string) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+
+		w := httptest.NewRecorder()
+		a.Router.ServeHTTP(w, createRequest(method, url, reader))
+		return w
+	}
+
+	listed := func(status string) map[string]datastore.AnswerResponse {
+		w := send(http.MethodGet, "/api/v1/answers?status="+status, "")
+		require.Equal(a.T(), http.StatusOK, w.Code)
+
+		var answers []datastore.AnswerResponse
+		parseResponse(a.T(), w.Result(), &datastore.PagedResponse{Content: &answers})
+
+		byKey := make(map[string]datastore.AnswerResponse, len(answers))
+		for _, answer := range answers {
+			byKey[answer.Key] = answer
+		}
+		return byKey
+	}
+
+	w := send(http.MethodPost, "/api/v1/answers", fmt.Sprintf(`{"key": "%s", "value": "first"}`, key))
+	require.Equal(a.T(), http.StatusCreated, w.Code)
+
+	w = send(http.MethodPut, fmt.Sprintf("/api/v1/answers/%s", key), `{"value": "second"}`)
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	w = send(http.MethodDelete, fmt.Sprintf("/api/v1/answers/%s", key), "")
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	require.NotContains(a.T(), listed(""), key)
+	require.Contains(a.T(), listed("deleted"), key)
+	require.NotZero(a.T(), listed("deleted")[key].DeletedAt)
+
+	w = send(http.MethodPost, fmt.Sprintf("/api/v1/answers/%s/restore", key), "")
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	var answer datastore.AnswerResponse
+	parseResponse(a.T(), w.Result(), &answer)
+	require.Equal(a.T(), "second", answer.Value)
+	require.Equal(a.T(), int64(2), answer.Version)
+	require.Zero(a.T(), answer.DeletedAt)
+	require.Equal(a.T(), fmt.Sprintf(`"%s.2"`, answer.UID), w.Header().Get("ETag"))
+
+	require.Contains(a.T(), listed("active"), key)
+	require.NotContains(a.T(), listed("deleted"), key)
+
+	w = send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/history", key), "")
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	var history struct {
+		Content []datastore.Event `json:"content"`
+	}
+	parseResponse(a.T(), w.Result(), &history)
+
+	types := make([]datastore.EventType, 0, len(history.Content))
+	for _, event := range history.Content {
+		types = append(types, event.Type)
+	}
+	require.Contains(a.T(), types, datastore.RestoreEvent)
+
+	w = send(http.MethodPost, fmt.Sprintf("/api/v1/answers/%s/restore", key), "")
+	require.Equal(a.T(), http.StatusNotFound, w.Code)
+
+	// a new answer taking the key over blocks the restore
+	w = send(http.MethodDelete, fmt.Sprintf("/api/v1/answers/%s", key), "")
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	w = send(http.MethodPost, "/api/v1/answers", fmt.Sprintf(`{"key": "%s", "value": "third"}`, key))
+	require.Equal(a.T(), http.StatusCreated, w.Code)
+
+	w = send(http.MethodPost, fmt.Sprintf("/api/v1/answers/%s/restore", key), "")
+	require.Equal(a.T(), http.StatusConflict, w.Code)
+	require.Contains(a.T(), w.Body.String(), "an active answer with this key already exists")
+
+	w = send(http.MethodGet, "/api/v1/answers?status=archived", "")
+	require.Equal(a.T(), http.StatusBadRequest, w.Code)
+}
+
+func (a *AnswerTestSuite) Test_Generations() {
+	key := uuid.NewString()
+
+	send := func(method, url, body string) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+
+		w := httptest.NewRecorder()
+		a.Router.ServeHTTP(w, createRequest(method, url, reader))
+		return w
+	}
+
+	history := func(query string) []datastore.Event {
+		w := send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/history?%s", key, query), "")
+		require.Equal(a.T(), http.StatusOK, w.Code)
+
+		var history struct {
+			Content []datastore.Event `json:"content"`
+		}
+		parseResponse(a.T(), w.Result(), &history)
+		return history.Content
+	}
+
+	// the key is deleted twice, leaving two deleted generations behind
+	for i, value := range []string{"first", "second"} {
+		w := send(http.MethodPost, "/api/v1/answers", fmt.Sprintf(`{"key": "%s", "value": "%s"}`, key, value))
+		require.Equal(a.T(), http.StatusCreated, w.Code)
+
+		var answer datastore.AnswerResponse
+		parseResponse(a.T(), w.Result(), &answer)
+		require.Equal(a.T(), int64(i+1), answer.Generation)
+
+		w = send(http.MethodDelete, fmt.Sprintf("/api/v1/answers/%s", key), "")
+		require.Equal(a.T(), http.StatusOK, w.Code)
+	}
+
+	w := send(http.MethodGet, "/api/v1/answers?status=deleted", "")
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	var answers []datastore.AnswerResponse
+	parseResponse(a.T(), w.Result(), &datastore.PagedResponse{Content: &answers})
+
+	generations := map[int64]interface{}{}
+	for _, answer := range answers {
+		if answer.Key == key {
+			generations[answer.Generation] = answer.Value
+		}
+	}
+	require.Equal(a.T(), map[int64]interface{}{1: "first", 2: "second"}, generations)
+
+	require.Len(a.T(), history(""), 4)
+
+	for generation, value := range map[int64]string{1: "first", 2: "second"} {
+		events := history(fmt.Sprintf("generation=%d", generation))
+		require.Len(a.T(), events, 2)
+
+		for _, event := range events {
+			require.Equal(a.T(), generation, event.Data.Generation)
+			require.Equal(a.T(), value, event.Data.Value)
+		}
+	}
+
+	w = send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/history?generation=0", key), "")
+	require.Equal(a.T(), http.StatusBadRequest, w.Code)
+
+	w = send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/history", uuid.NewString()), "")
+	require.Equal(a.T(), http.StatusNotFound, w.Code)
+}
+
+func (a *AnswerTestSuite) Test_ConditionalWrites_HonorIfMatch() {
+	key := uuid.NewString()
+
+	send := func(method, body, etag string) *httptest.ResponseRecorder {
+		url := fmt.Sprintf("/api/v1/answers/%s", key)
+		if method == http.MethodPost {
+			url = "/api/v1/answers"
+		}
+
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+
+		req := createRequest(method, url, reader)
+		if etag != "" {
+			req.Header.Set("If-Match", etag)
+		}
+
+		w := httptest.NewRecorder()
+		a.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodPost, fmt.Sprintf(`{"key": "%s", "value": "first"}`, key), "")
+	require.Equal(a.T(), http.StatusCreated, w.Code)
+	created := w.Header().Get("ETag")
+	require.NotEmpty(a.T(), created)
+
+	w = send(http.MethodGet, "", "")
+	require.Equal(a.T(), created, w.Header().Get("ETag"))
+
+	w = send(http.MethodPut, `{"value": "second"}`, created)
+	require.Equal(a.T(), http.StatusOK, w.Code)
+	updated := w.Header().Get("ETag")
+	require.NotEqual(a.T(), created, updated)
+
+	// the first writer wins, the other one is told to read again
+	w = send(http.MethodPut, `{"value": "lost-update"}`, created)
+	require.Equal(a.T(), http.StatusPreconditionFailed, w.Code)
+
+	var response Response
+	require.Nil(a.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(a.T(), Response{Success: false, Message: datastore.ErrVersionMismatch.Error()}, response)
+
+	w = send(http.MethodDelete, "", created)
+	require.Equal(a.T(), http.StatusPreconditionFailed, w.Code)
+
+	w = send(http.MethodDelete, "", fmt.Sprintf(`"other", %s`, updated))
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	// a new answer for the key doesn't match the tags of the old one
+	w = send(http.MethodPost, fmt.Sprintf(`{"key": "%s", "value": "first"}`, key), "")
+	require.Equal(a.T(), http.StatusCreated, w.Code)
+	require.NotEqual(a.T(), created, w.Header().Get("ETag"))
+
+	w = send(http.MethodPut, `{"value": "second"}`, created)
+	require.Equal(a.T(), http.StatusPreconditionFailed, w.Code)
+}
+
+func (a *AnswerTestSuite) Test_ConditionalReads_ReturnNotModified() {
+	key := uuid.NewString()
+
+	get := func(url string, headers map[string]string) *httptest.ResponseRecorder {
+		req := createRequest(http.MethodGet, url, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+
+		w := httptest.NewRecorder()
+		a.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	body := strings.NewReader(fmt.Sprintf(`{"key": "%s", "value": "first"}`, key))
+	w := httptest.NewRecorder()
+	a.Router.ServeHTTP(w, createRequest(http.MethodPost, "/api/v1/answers", body))
+	require.Equal(a.T(), http.StatusCreated, w.Code)
+
+	for _, url := range []string{fmt.Sprintf("/api/v1/answers/%s", key), fmt.Sprintf("/api/v1/answers/%s/history", key)} {
+		w = get(url, nil)
+		require.Equal(a.T(), http.StatusOK, w.Code, url)
+
+		etag := w.Header().Get("ETag")
+		require.NotEmpty(a.T(), etag, url)
+
+		lastModified, err := http.ParseTime(w.Header().Get("Last-Modified"))
+		require.Nil(a.T(), err, url)
+
+		w = get(url, map[string]string{"If-None-Match": etag})
+		require.Equal(a.T(), http.StatusNotModified, w.Code, url)
+		require.Empty(a.T(), w.Body.String(), url)
+		require.Equal(a.T(), etag, w.Header().Get("ETag"), url)
+
+		w = get(url, map[string]string{"If-None-Match": fmt.Sprintf(`"other", W/%s`, strings.TrimPrefix(etag, "W/"))})
+		require.Equal(a.T(), http.StatusNotModified, w.Code, url)
+
+		w = get(url, map[string]string{"If-Modified-Since": lastModified.Format(http.TimeFormat)})
+		require.Equal(a.T(), http.StatusNotModified, w.Code, url)
+
+		w = get(url, map[string]string{"If-Modified-Since": lastModified.Add(-time.Second).Format(http.TimeFormat)})
+		require.Equal(a.T(), http.StatusOK, w.Code, url)
+
+		// If-None-Match takes precedence over If-Modified-Since
+		w = get(url, map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": lastModified.Format(http.TimeFormat)})
+		require.Equal(a.T(), http.StatusOK, w.Code, url)
+	}
+
+	etag := get(fmt.Sprintf("/api/v1/answers/%s", key), nil).Header().Get("ETag")
+	history := get(fmt.Sprintf("/api/v1/answers/%s/history", key), nil).Header().Get("ETag")
+
+	body = strings.NewReader(`{"value": "second"}`)
+	w = httptest.NewRecorder()
+	a.Router.ServeHTTP(w, createRequest(http.MethodPut, fmt.Sprintf("/api/v1/answers/%s", key), body))
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	// once the answer changes, clients get the new version
+	w = get(fmt.Sprintf("/api/v1/answers/%s", key), map[string]string{"If-None-Match": etag})
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	w = get(fmt.Sprintf("/api/v1/answers/%s/history", key), map[string]string{"If-None-Match": history})
+	require.Equal(a.T(), http.StatusOK, w.Code)
+}
+
+func (a *AnswerTestSuite) Test_FindHistoryByKey() {
+	key := uuid.NewString()
+
+	body := strings.NewReader(fmt.Sprintf(`{"key": "%s", "value": "first"}`, key))
+	w := httptest.NewRecorder()
+	a.Router.ServeHTTP(w, createRequest(http.MethodPost, "/api/v1/answers", body))
+	require.Equal(a.T(), http.StatusCreated, w.Code)
+
+	// events are dispatched from the outbox in the background, wait for the create event to land
+	require.Eventually(a.T(), func() bool {
+		events, _, err := a.DB.Events().FindManyByKey(context.Background(), datastore.DefaultTenant, key, 0, datastore.Pageable{Page: 1, PerPage: 20})
+		return err == nil && len(events) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	req := createRequest(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/history", key), nil)
+
+	w = httptest.NewRecorder()
+	a.Router.ServeHTTP(w, req)
+
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	var history struct {
+		Content    []datastore.Event         `json:"content"`
+		Pagination *datastore.PaginationData `json:"pagination"`
+	}
+	parseResponse(a.T(), w.Result(), &history)
+
+	require.Len(a.T(), history.Content, 1)
+	require.Equal(a.T(), datastore.CreateEvent, history.Content[0].Type)
+	require.Equal(a.T(), "first", history.Content[0].Data.Value)
+	require.Equal(a.T(), int64(1), history.Pagination.Total)
+}
+
+func (a *AnswerTestSuite) Test_CreateAnswer_TypedValues() {
+	tt := []struct {
+		name      string
+		body      string
+		wantValue interface{}
+		wantType  datastore.ValueType
+	}{
+		{name: "string", body: `"some-value"`, wantValue: "some-value", wantType: datastore.StringValue},
+		{name: "number", body: `42`, wantValue: float64(42), wantType: datastore.NumberValue},
+		{name: "boolean", body: `false`, wantValue: false, wantType: datastore.BooleanValue},
+		{name: "object", body: `{"enabled": true}`, wantValue: map[string]interface{}{"enabled": true}, wantType: datastore.ObjectValue},
+		{name: "list", body: `[1, "two"]`, wantValue: []interface{}{float64(1), "two"}, wantType: datastore.ListValue},
+	}
+
+	for _, tc := range tt {
+		a.Run(tc.name, func() {
+			key := uuid.NewString()
+
+			body := strings.NewReader(fmt.Sprintf(`{"key": "%s", "value": %s}`, key, tc.body))
+			w := httptest.NewRecorder()
+			a.Router.ServeHTTP(w, createRequest(http.MethodPost, "/api/v1/answers", body))
+			require.Equal(a.T(), http.StatusCreated, w.Code)
+
+			w = httptest.NewRecorder()
+			a.Router.ServeHTTP(w, createRequest(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s", key), nil))
+			require.Equal(a.T(), http.StatusOK, w.Code)
+
+			var answer datastore.AnswerResponse
+			parseResponse(a.T(), w.Result(), &answer)
+
+			require.Equal(a.T(), tc.wantValue, answer.Value)
+			require.Equal(a.T(), tc.wantType, answer.Type)
+		})
+	}
+}
+
+func (a *AnswerTestSuite) Test_CreateAnswer_WithMismatchedType() {
+	body := strings.NewReader(`{"key": "some-key", "value": "42", "type": "number"}`)
+	req := createRequest(http.MethodPost, "/api/v1/answers", body)
+
+	w := httptest.NewRecorder()
+	a.Router.ServeHTTP(w, req)
+
+	require.Equal(a.T(), http.StatusBadRequest, w.Code)
+}
+
+func (a *AnswerTestSuite) Test_FindHistoryByKey_IncludesEveryChange() {
+	key := uuid.NewString()
+
+	body := strings.NewReader(fmt.Sprintf(`{"key": "%s", "value": "first"}`, key))
+	w := httptest.NewRecorder()
+	a.Router.ServeHTTP(w, createRequest(http.MethodPost, "/api/v1/answers", body))
+	require.Equal(a.T(), http.StatusCreated, w.Code)
+
+	body = strings.NewReader(`{"value": "second"}`)
+	w = httptest.NewRecorder()
+	a.Router.ServeHTTP(w, createRequest(http.MethodPut, fmt.Sprintf("/api/v1/answers/%s", key), body))
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	// events still in the outbox are delivered before the history is read
+	req := createRequest(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/history", key), nil)
+
+	w = httptest.NewRecorder()
+	a.Router.ServeHTTP(w, req)
+
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	var history struct {
+		Content []datastore.Event `json:"content"`
+	}
+	parseResponse(a.T(), w.Result(), &history)
+
+	values := make([]interface{}, 0)
+	for _, event := range history.Content {
+		values = append(values, event.Data.Value)
+	}
+	require.ElementsMatch(a.T(), []interface{}{"first", "second"}, values)
+
+	messages, err := a.DB.Outbox().FindPendingByKey(context.Background(), datastore.DefaultTenant, key)
+	require.Nil(a.T(), err)
+	require.Empty(a.T(), messages)
+}
+
+func (a *AnswerTestSuite) Test_Tenants_AreIsolated() {
+	key := uuid.NewString()
+
+	send := func(method, url, tenant, body string) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+
+		req := createRequest(method, url, reader)
+		if tenant != "" {
+			req.Header.Set(TenantHeader, tenant)
+		}
+
+		w := httptest.NewRecorder()
+		a.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// the same key is used independently by each tenant
+	w := send(http.MethodPost, "/api/v1/answers", "", fmt.Sprintf(`{"key": "%s", "value": "default-value"}`, key))
+	require.Equal(a.T(), http.StatusCreated, w.Code)
+
+	w = send(http.MethodPost, "/api/v1/answers", "acme", fmt.Sprintf(`{"key": "%s", "value": "acme-value"}`, key))
+	require.Equal(a.T(), http.StatusCreated, w.Code)
+
+	w = send(http.MethodPut, fmt.Sprintf("/api/v1/answers/%s", key), "acme", `{"value": "acme-update"}`)
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	w = send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s", key), datastore.DefaultTenant, "")
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	var answer datastore.AnswerResponse
+	parseResponse(a.T(), w.Result(), &answer)
+	require.Equal(a.T(), "default-value", answer.Value)
+
+	// and its history only lists the tenant's own changes
+	w = send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/history", key), "acme", "")
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	var history struct {
+		Content []datastore.Event `json:"content"`
+	}
+	parseResponse(a.T(), w.Result(), &history)
+
+	values := make([]interface{}, 0)
+	for _, event := range history.Content {
+		require.Equal(a.T(), "acme", event.TenantID)
+		values = append(values, event.Data.Value)
+	}
+	require.ElementsMatch(a.T(), []interface{}{"acme-value", "acme-update"}, values)
+
+	w = send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s", key), "other", "")
+	require.Equal(a.T(), http.StatusNotFound, w.Code)
+
+	w = send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s", key), "not:valid", "")
+	require.Equal(a.T(), http.StatusBadRequest, w.Code)
+}
+
+func (a *AnswerTestSuite) Test_FindAnswers_WalksPagesWithCursor() {
+	prefix := uuid.NewString() + "."
+
+	list := func(query string) ([]datastore.AnswerResponse, *datastore.CursorData) {
+		w := httptest.NewRecorder()
+		a.Router.ServeHTTP(w, createRequest(http.MethodGet, "/api/v1/answers?"+query, nil))
+		require.Equal(a.T(), http.StatusOK, w.Code, query)
+
+		var answers []datastore.AnswerResponse
+		page := datastore.PagedResponse{Content: &answers}
+		parseResponse(a.T(), w.Result(), &page)
+
+		return answers, page.Cursor
+	}
+
+	for _, key := range []string{"e", "d", "c", "b", "a"} {
+		require.Nil(a.T(), a.seedAnswer(prefix+key, key))
+	}
+
+	var keys []string
+	query := "perPage=2&prefix=" + prefix
+	for {
+		answers, cursor := list(query)
+		require.Equal(a.T(), int64(2), cursor.PerPage)
+
+		for _, answer := range answers {
+			keys = append(keys, strings.TrimPrefix(answer.Key, prefix))
+		}
+
+		if cursor.Next == "" {
+			break
+		}
+
+		query = "perPage=2&prefix=" + prefix + "&cursor=" + cursor.Next
+	}
+
+	require.Equal(a.T(), []string{"a", "b", "c", "d", "e"}, keys)
+
+	answers, _ := list("sort=-key&regex=" + url.QueryEscape("^"+regexp.QuoteMeta(prefix)+"[a-c]$"))
+	require.Len(a.T(), answers, 3)
+	require.Equal(a.T(), prefix+"c", answers[0].Key)
+
+	for _, query := range []string{"sort=value", "regex=(", "updated_since=yesterday", "perPage=1000", "cursor=abc"} {
+		w := httptest.NewRecorder()
+		a.Router.ServeHTTP(w, createRequest(http.MethodGet, "/api/v1/answers?"+query, nil))
+		require.Equal(a.T(), http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func (a *AnswerTestSuite) Test_SearchAnswers() {
+	word := strings.ReplaceAll(uuid.NewString(), "-", "")
+
+	send := func(method, url, body string) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+
+		w := httptest.NewRecorder()
+		a.Router.ServeHTTP(w, createRequest(method, url, reader))
+		return w
+	}
+
+	search := func(query string) ([]datastore.SearchResult, *datastore.PaginationData) {
+		w := send(http.MethodGet, "/api/v1/search?"+query, "")
+		require.Equal(a.T(), http.StatusOK, w.Code, query)
+
+		var results []datastore.SearchResult
+		page := datastore.PagedResponse{Content: &results}
+		parseResponse(a.T(), w.Result(), &page)
+
+		return results, page.Pagination
+	}
+
+	current, past := uuid.NewString(), uuid.NewString()
+
+	w := send(http.MethodPost, "/api/v1/answers", fmt.Sprintf(`{"key": "%s", "value": "Refunds take 14 days, ask %s for details"}`, current, word))
+	require.Equal(a.T(), http.StatusCreated, w.Code)
+
+	w = send(http.MethodPost, "/api/v1/answers", fmt.Sprintf(`{"key": "%s", "value": "%s"}`, past, word))
+	require.Equal(a.T(), http.StatusCreated, w.Code)
+
+	w = send(http.MethodPut, "/api/v1/answers/"+past, `{"value": "no longer"}`)
+	require.Equal(a.T(), http.StatusOK, w.Code)
+
+	results, pagination := search("q=" + strings.ToUpper(word))
+	require.Len(a.T(), results, 1)
+	require.Equal(a.T(), int64(1), pagination.Total)
+	require.Equal(a.T(), current, results[0].Key)
+	require.True(a.T(), results[0].Current)
+	require.Equal(a.T(), fmt.Sprintf("Refunds take 14 days, ask <em>%s</em> for details", word), results[0].Highlight)
+
+	// the value mentioning the word most densely ranks first
+	results, _ = search("history=true&q=" + word)
+	require.Len(a.T(), results, 2)
+	require.Equal(a.T(), past, results[0].Key)
+	require.False(a.T(), results[0].Current)
+	require.Equal(a.T(), int64(1), results[0].Version)
+	require.Equal(a.T(), word, results[0].Value)
+	require.Greater(a.T(), results[0].Score, results[1].Score)
+
+	// values are escaped, only the marks of the highlight are markup
+	markup := strings.ReplaceAll(uuid.NewString(), "-", "")
+	w = send(http.MethodPost, "/api/v1/answers", fmt.Sprintf(`{"key": "%s", "value": "<img src=x onerror=alert(1)> %s & co"}`, uuid.NewString(), markup))
+	require.Equal(a.T(), http.StatusCreated, w.Code)
+
+	results, _ = search("q=" + markup)
+	require.Len(a.T(), results, 1)
+	require.Equal(a.T(), fmt.Sprintf("&lt;img src=x onerror=alert(1)&gt; <em>%s</em> &amp; co", markup), results[0].Highlight)
+
+	w = send(http.MethodGet, "/api/v1/search?q=%20", "")
+	require.Equal(a.T(), http.StatusBadRequest, w.Code)
+}
+
+func TestAnswerTestSuite(t *testing.T) {
+	suite.Run(t, new(AnswerTestSuite))
+}
+
+func (a *AnswerTestSuite) seedAnswer(key, value string) error {
+	answer := &datastore.Answer{
+		UID:            uuid.NewString(),
+		TenantID:       datastore.DefaultTenant,
+		Key:            key,
+		Values:         []datastore.Value{{Value: value}},
+		Version:        1,
+		DocumentStatus: datastore.ActiveDocumentStatus,
+	}
+
+	return a.DB.Answers().Create(context.Background(), answer)
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/gin-gonic/gin"
+)
+
+func (a *Application) CreateAPIKey(c *gin.Context) {
+	var createAPIKey datastore.CreateAPIKey
+
+	if err := c.ShouldBindJSON(&createAPIKey); err != nil {
+		a.errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	apiKey, err := a.apiKeyService.CreateAPIKey(c.Request.Context(), tenantID(c), &createAPIKey)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusCreated, "api key created successfully, it won't be shown again", apiKey)
+}
+
+func (a *Application) FindAPIKeys(c *gin.Context) {
+	apiKeys, err := a.apiKeyService.FindAPIKeys(c.Request.Context(), tenantID(c))
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "api keys retrieved successfully", apiKeys)
+}
+
+func (a *Application) FindAPIKeyByUID(c *gin.Context) {
+	apiKey, err := a.apiKeyService.FindAPIKeyByUID(c.Request.Context(), tenantID(c), c.Param("uid"))
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "api key retrieved successfully", apiKey)
+}
+
+func (a *Application) RotateAPIKey(c *gin.Context) {
+	apiKey, err := a.apiKeyService.RotateAPIKey(c.Request.Context(), tenantID(c), c.Param("uid"))
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "api key rotated successfully, it won't be shown again", apiKey)
+}
+
+func (a *Application) RevokeAPIKey(c *gin.Context) {
+	apiKey, err := a.apiKeyService.RevokeAPIKey(c.Request.Context(), tenantID(c), c.Param("uid"))
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "api key revoked successfully", apiKey)
+}
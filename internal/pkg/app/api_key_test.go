@@ -0,0 +1,265 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dotunj/bequest/config"
+	"github.com/dotunj/bequest/internal/pkg/auth"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// APIKeyTestSuite exercises api keys over HTTP with anonymous requests
+// disallowed. Two applications share a sqlite file, standing for two
+// instances of the service.
+type APIKeyTestSuite struct {
+	suite.Suite
+	App      *Application
+	Router   http.Handler
+	Other    http.Handler
+	AdminKey string
+}
+
+func (s *APIKeyTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+}
+
+func (s *APIKeyTestSuite) SetupTest() {
+	cfg := &config.Config{
+		Database: config.Database{Store: config.SqliteStore, SqlitePath: filepath.Join(s.T().TempDir(), "bequest.sqlite")},
+		Auth:     config.Auth{Required: true},
+	}
+
+	routers := make([]http.Handler, 0, 2)
+	for i := 0; i < 2; i++ {
+		app, err := NewApplication(cfg)
+		require.Nil(s.T(), err)
+
+		s.T().Cleanup(func() {
+			_ = app.Close(context.Background())
+		})
+
+		s.App = app
+		routers = append(routers, app.Routes())
+	}
+
+	s.Router, s.Other = routers[0], routers[1]
+
+	issued, err := s.App.IssueAPIKey(context.Background(), datastore.DefaultTenant, &datastore.CreateAPIKey{
+		Name:   "admin",
+		Scopes: auth.Scopes,
+	})
+	require.Nil(s.T(), err)
+
+	_, err = s.App.BindRole(context.Background(), datastore.DefaultTenant, &datastore.CreateRoleBinding{
+		Subject: "api_key:" + issued.UID,
+		Role:    datastore.AdminRole,
+		Pattern: "*",
+	})
+	require.Nil(s.T(), err)
+
+	s.AdminKey = issued.Key
+}
+
+func (s *APIKeyTestSuite) Test_RequiresAuthentication() {
+	w := s.send(s.Router, http.MethodGet, "/api/v1/answers/some-key", "", "")
+	require.Equal(s.T(), http.StatusUnauthorized, w.Code)
+
+	w = s.send(s.Router, http.MethodGet, "/api/v1/answers/some-key", "bq_0123456789ab_wrong", "")
+	require.Equal(s.T(), http.StatusUnauthorized, w.Code)
+	require.Contains(s.T(), w.Body.String(), "invalid api key")
+
+	w = s.send(s.Router, http.MethodGet, "/api/v1/answers/some-key", s.AdminKey, "")
+	require.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
+func (s *APIKeyTestSuite) Test_EnforcesScopes() {
+	reader := s.createKey(datastore.ReaderRole, auth.ScopeAnswersRead)
+	key := uuid.NewString()
+
+	w := s.send(s.Router, http.MethodPost, "/api/v1/answers", reader.Key, fmt.Sprintf(`{"key": "%s", "value": "some-value"}`, key))
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+	require.Contains(s.T(), w.Body.String(), "the answers:write scope is required")
+
+	w = s.send(s.Router, http.MethodPost, "/api/v1/answers", s.AdminKey, fmt.Sprintf(`{"key": "%s", "value": "some-value"}`, key))
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	w = s.send(s.Router, http.MethodGet, fmt.Sprintf("/api/v1/answers/%s", key), reader.Key, "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	// the use of the key is recorded
+	w = s.send(s.Router, http.MethodGet, fmt.Sprintf("/api/v1/api-keys/%s", reader.UID), s.AdminKey, "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var found datastore.APIKey
+	parseResponse(s.T(), w.Result(), &found)
+	require.NotZero(s.T(), found.LastUsedAt)
+	require.Empty(s.T(), found.Hash)
+
+	// and it can't issue keys, let alone more powerful ones
+	w = s.send(s.Router, http.MethodPost, "/api/v1/api-keys", reader.Key, `{"name": "escalated", "scopes": ["answers:write"]}`)
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+}
+
+func (s *APIKeyTestSuite) Test_RecordsTheActor() {
+	writer := s.createKey(datastore.WriterRole, auth.ScopeAnswersRead, auth.ScopeAnswersWrite)
+	key := uuid.NewString()
+
+	w := s.send(s.Router, http.MethodPost, "/api/v1/answers", writer.Key, fmt.Sprintf(`{"key": "%s", "value": "some-value"}`, key))
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	w = s.send(s.Router, http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/history", key), writer.Key, "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var history struct {
+		Content []datastore.Event `json:"content"`
+	}
+	parseResponse(s.T(), w.Result(), &history)
+
+	require.Len(s.T(), history.Content, 1)
+	require.Equal(s.T(), "api_key:"+writer.UID, history.Content[0].Actor)
+}
+
+func (s *APIKeyTestSuite) Test_RevokedKey_IsRejectedByEveryInstance() {
+	reader := s.createKey(datastore.ReaderRole, auth.ScopeAnswersRead)
+
+	w := s.send(s.Other, http.MethodGet, "/api/v1/answers/some-key", reader.Key, "")
+	require.Equal(s.T(), http.StatusNotFound, w.Code)
+
+	w = s.send(s.Router, http.MethodDelete, fmt.Sprintf("/api/v1/api-keys/%s", reader.UID), s.AdminKey, "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var revoked datastore.APIKey
+	parseResponse(s.T(), w.Result(), &revoked)
+	require.NotZero(s.T(), revoked.RevokedAt)
+
+	w = s.send(s.Other, http.MethodGet, "/api/v1/answers/some-key", reader.Key, "")
+	require.Equal(s.T(), http.StatusUnauthorized, w.Code)
+
+	// revoked keys are still listed
+	w = s.send(s.Other, http.MethodGet, "/api/v1/api-keys", s.AdminKey, "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var keys []datastore.APIKey
+	parseResponse(s.T(), w.Result(), &keys)
+	require.Len(s.T(), keys, 2)
+	require.Equal(s.T(), reader.UID, keys[1].UID)
+}
+
+func (s *APIKeyTestSuite) Test_RotateAPIKey() {
+	reader := s.createKey(datastore.ReaderRole, auth.ScopeAnswersRead)
+
+	w := s.send(s.Router, http.MethodPost, fmt.Sprintf("/api/v1/api-keys/%s/rotate", reader.UID), s.AdminKey, "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var rotated datastore.IssuedAPIKey
+	parseResponse(s.T(), w.Result(), &rotated)
+	require.Equal(s.T(), reader.UID, rotated.UID)
+	require.NotEqual(s.T(), reader.Key, rotated.Key)
+
+	w = s.send(s.Other, http.MethodGet, "/api/v1/answers/some-key", reader.Key, "")
+	require.Equal(s.T(), http.StatusUnauthorized, w.Code)
+
+	w = s.send(s.Other, http.MethodGet, "/api/v1/answers/some-key", rotated.Key, "")
+	require.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
+func (s *APIKeyTestSuite) Test_ManagingKeys_RequiresTenantAdmin() {
+	manager := s.createKey(datastore.WriterRole, auth.ScopeAnswersRead, auth.ScopeAPIKeys)
+	reader := s.createKey(datastore.ReaderRole, auth.ScopeAnswersRead)
+
+	// the scope isn't enough without the admin role on every key
+	for _, req := range []struct{ method, url, body string }{
+		{http.MethodPost, "/api/v1/api-keys", `{"name": "escalated", "scopes": ["answers:read"]}`},
+		{http.MethodGet, "/api/v1/api-keys", ""},
+		{http.MethodGet, fmt.Sprintf("/api/v1/api-keys/%s", reader.UID), ""},
+		{http.MethodPost, fmt.Sprintf("/api/v1/api-keys/%s/rotate", reader.UID), ""},
+		{http.MethodDelete, fmt.Sprintf("/api/v1/api-keys/%s", reader.UID), ""},
+	} {
+		w := s.send(s.Router, req.method, req.url, manager.Key, req.body)
+		require.Equal(s.T(), http.StatusForbidden, w.Code, req.url)
+	}
+
+	w := s.send(s.Router, http.MethodGet, "/api/v1/answers/some-key", reader.Key, "")
+	require.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
+func (s *APIKeyTestSuite) Test_KeysActForTheirTenant() {
+	issued, err := s.App.IssueAPIKey(context.Background(), "acme", &datastore.CreateAPIKey{
+		Name:   "acme",
+		Scopes: []string{auth.ScopeAnswersRead, auth.ScopeAnswersWrite},
+	})
+	require.Nil(s.T(), err)
+
+	_, err = s.App.BindRole(context.Background(), "acme", &datastore.CreateRoleBinding{
+		Subject: "api_key:" + issued.UID,
+		Role:    datastore.WriterRole,
+		Pattern: "*",
+	})
+	require.Nil(s.T(), err)
+
+	key := uuid.NewString()
+
+	w := s.send(s.Router, http.MethodPost, "/api/v1/answers", issued.Key, fmt.Sprintf(`{"key": "%s", "value": "some-value"}`, key))
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	w = s.send(s.Router, http.MethodGet, fmt.Sprintf("/api/v1/answers/%s", key), s.AdminKey, "")
+	require.Equal(s.T(), http.StatusNotFound, w.Code)
+
+	req := createRequest(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s", key), nil)
+	req.Header.Set(APIKeyHeader, issued.Key)
+	req.Header.Set(TenantHeader, datastore.DefaultTenant)
+
+	w = httptest.NewRecorder()
+	s.Router.ServeHTTP(w, req)
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+}
+
+func TestAPIKeyTestSuite(t *testing.T) {
+	suite.Run(t, new(APIKeyTestSuite))
+}
+
+// createKey issues a key with scopes, bound to role on every key.
+func (s *APIKeyTestSuite) createKey(role datastore.Role, scopes ...string) *datastore.IssuedAPIKey {
+	body := fmt.Sprintf(`{"name": "some-service", "scopes": ["%s"]}`, strings.Join(scopes, `", "`))
+
+	w := s.send(s.Router, http.MethodPost, "/api/v1/api-keys", s.AdminKey, body)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	var issued datastore.IssuedAPIKey
+	parseResponse(s.T(), w.Result(), &issued)
+	require.NotEmpty(s.T(), issued.Key)
+
+	body = fmt.Sprintf(`{"subject": "api_key:%s", "role": "%s", "pattern": "*"}`, issued.UID, role)
+
+	w = s.send(s.Router, http.MethodPost, "/api/v1/role-bindings", s.AdminKey, body)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	return &issued
+}
+
+func (s *APIKeyTestSuite) send(router http.Handler, method, url, key, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req := createRequest(method, url, reader)
+	if key != "" {
+		req.Header.Set(APIKeyHeader, key)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
@@ -1,30 +1,188 @@
 package app
 
 import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/dotunj/bequest/config"
+	"github.com/dotunj/bequest/internal/pkg/auth"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/datastore/bolt"
+	"github.com/dotunj/bequest/internal/pkg/datastore/memory"
 	"github.com/dotunj/bequest/internal/pkg/datastore/mongo"
+	"github.com/dotunj/bequest/internal/pkg/datastore/postgres"
+	"github.com/dotunj/bequest/internal/pkg/datastore/redis"
+	"github.com/dotunj/bequest/internal/pkg/datastore/sqlite"
 	"github.com/dotunj/bequest/internal/pkg/services"
 )
 
 type Application struct {
-	DB            *mongo.Client
-	answerService *services.AnswerService
-	eventService  *services.EventService
+	DB               datastore.Store
+	answerService    *services.AnswerService
+	eventService     *services.EventService
+	schemaService    *services.SchemaService
+	apiKeyService    *services.APIKeyService
+	roleService      *services.RoleService
+	retentionService *services.RetentionService
+	transferService  *services.TransferService
+	verifier         *auth.JWTVerifier
+	authRequired     bool
+
+	// stopWorkers stops the outbox dispatcher, the expiry reaper and
+	// the retention worker, workersDone is closed once all have returned.
+	stopWorkers context.CancelFunc
+	workersDone chan struct{}
 }
 
-func NewApplication(dsn string) (*Application, error) {
-	db, err := mongo.NewMongoRepository(dsn)
+func NewApplication(cfg *config.Config) (*Application, error) {
+	verifier, err := newVerifier(cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := newStore(cfg.Database)
 	if err != nil {
 		return nil, err
 	}
 
-	eventService := services.NewEventService(db.AnswerRepo, db.EventRepo)
-	answerService := services.NewAnswerService(db.AnswerRepo, eventService)
+	if cfg.Redis.Dsn != "" {
+		client, err := redis.NewClient(cfg.Redis.Dsn, cfg.Redis.Timeout)
+		if err != nil {
+			return nil, err
+		}
+
+		db = redis.NewCachedStore(db, client, redis.Options{
+			TTL:         cfg.Redis.TTL,
+			NegativeTTL: cfg.Redis.NegativeTTL,
+		})
+	}
+
+	// Stores that support transactions read and write
+	// an answer in a single transaction
+	transactor, _ := db.(datastore.Transactor)
+
+	dispatcher := services.NewOutboxDispatcher(db.Outbox(), db.Events(), services.OutboxOptions{
+		PollInterval: cfg.Outbox.PollInterval,
+		BatchSize:    cfg.Outbox.BatchSize,
+		MaxAttempts:  cfg.Outbox.MaxAttempts,
+		MinBackoff:   cfg.Outbox.MinBackoff,
+		MaxBackoff:   cfg.Outbox.MaxBackoff,
+	})
+
+	eventService := services.NewEventService(db.Answers(), db.Events(), dispatcher)
+	schemaService := services.NewSchemaService(db.Schemas(), db.Answers(), transactor)
+	answerService := services.NewAnswerService(db.Answers(), schemaService, dispatcher, transactor)
+	apiKeyService := services.NewAPIKeyService(db.APIKeys())
+	roleService := services.NewRoleService(db.RoleBindings(), cfg.Auth.AdminSubjects)
+
+	policy := services.RetentionPolicy{
+		DeletedAnswers:  cfg.Retention.DeletedAnswers,
+		HistoryAge:      cfg.Retention.HistoryAge,
+		HistoryVersions: cfg.Retention.HistoryVersions,
+	}
+	retention := services.NewRetentionService(db.Answers(), db.Events(), db.LegalHolds(), dispatcher, transactor, policy)
+
+	ctx, cancel := context.WithCancel(context.Background())
 
 	a := &Application{
-		DB:            db,
-		eventService:  eventService,
-		answerService: answerService,
+		DB:               db,
+		eventService:     eventService,
+		answerService:    answerService,
+		schemaService:    schemaService,
+		apiKeyService:    apiKeyService,
+		roleService:      roleService,
+		retentionService: retention,
+		transferService:  services.NewTransferService(answerService, eventService, db.Events()),
+		verifier:         verifier,
+		authRequired:     cfg.Auth.Enabled(),
+		stopWorkers:      cancel,
+		workersDone:      make(chan struct{}),
+	}
+
+	var workers sync.WaitGroup
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		dispatcher.Run(ctx)
+	}()
+
+	if cfg.Expiry.Interval > 0 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			answerService.Reap(ctx, cfg.Expiry.Interval)
+		}()
+	}
+
+	if policy.Enabled() && cfg.Retention.Interval > 0 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			retention.Run(ctx, cfg.Retention.Interval)
+		}()
 	}
-	
+
+	go func() {
+		workers.Wait()
+		close(a.workersDone)
+	}()
+
 	return a, nil
 }
+
+// IssueAPIKey issues an api key outside of any request, which is how
+// the first key is created when anonymous requests aren't allowed.
+func (a *Application) IssueAPIKey(ctx context.Context, tenantID string, req *datastore.CreateAPIKey) (*datastore.IssuedAPIKey, error) {
+	if !tenantPattern.MatchString(tenantID) {
+		return nil, fmt.Errorf("invalid tenant id %q", tenantID)
+	}
+
+	return a.apiKeyService.CreateAPIKey(ctx, tenantID, req)
+}
+
+// BindRole binds a role outside of any request, which is how the
+// first key is made an admin when anonymous requests aren't allowed.
+func (a *Application) BindRole(ctx context.Context, tenantID string, req *datastore.CreateRoleBinding) (*datastore.RoleBinding, error) {
+	if !tenantPattern.MatchString(tenantID) {
+		return nil, fmt.Errorf("invalid tenant id %q", tenantID)
+	}
+
+	return a.roleService.CreateRoleBinding(ctx, tenantID, req)
+}
+
+// Close stops the outbox dispatcher, waiting for it to deliver
+// the pending events, and the other workers, then closes the store.
+func (a *Application) Close(ctx context.Context) error {
+	a.stopWorkers()
+
+	select {
+	case <-a.workersDone:
+	case <-ctx.Done():
+	}
+
+	return a.DB.Close(ctx)
+}
+
+func newStore(cfg config.Database) (datastore.Store, error) {
+	switch cfg.Store {
+	case config.MongoStore:
+		db, err := mongo.NewMongoRepository(cfg.Dsn)
+		if err != nil {
+			return nil, err
+		}
+
+		return db.Store(), nil
+	case config.MemoryStore:
+		return memory.NewMemoryRepository(), nil
+	case config.BoltStore:
+		return bolt.NewBoltRepository(cfg.BoltPath)
+	case config.SqliteStore:
+		return sqlite.NewSqliteRepository(cfg.SqlitePath)
+	case config.PostgresStore:
+		return postgres.NewPostgresRepository(cfg.Dsn)
+	default:
+		return nil, fmt.Errorf("unsupported store %q", cfg.Store)
+	}
+}
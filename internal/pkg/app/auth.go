@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dotunj/bequest/config"
+	"github.com/dotunj/bequest/internal/pkg/auth"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/util"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// APIKeyHeader carries the api key of service-to-service requests.
+const APIKeyHeader = "X-API-Key"
+
+func newVerifier(cfg config.Auth) (*auth.JWTVerifier, error) {
+	if !cfg.Enabled() {
+		logrus.Warn("authentication is disabled, set AUTH_REQUIRED, AUTH_HMAC_SECRET, AUTH_JWKS_FILE or AUTH_JWKS_URL to enable it")
+		return nil, nil
+	}
+
+	if cfg.HMACSecret == "" && cfg.JWKSFile == "" && cfg.JWKSURL == "" {
+		// only api keys are accepted
+		return nil, nil
+	}
+
+	opts := auth.JWTOptions{
+		Issuer:   cfg.Issuer,
+		Audience: cfg.Audience,
+	}
+
+	if cfg.HMACSecret != "" {
+		opts.Secret = []byte(cfg.HMACSecret)
+	}
+
+	switch {
+	case cfg.JWKSFile != "":
+		keys, err := auth.NewFileKeySet(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.Keys = keys
+	case cfg.JWKSURL != "":
+		opts.Keys = auth.NewURLKeySet(context.Background(), cfg.JWKSURL, cfg.JWKSRefresh)
+	}
+
+	return auth.NewJWTVerifier(opts)
+}
+
+// authenticate verifies the api key or the bearer token of the request
+// and stores its principal in the request context. Requests without
+// either are let through anonymously when authentication is disabled.
+func (a *Application) authenticate(c *gin.Context) {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		principal, err := a.apiKeyService.Authenticate(c.Request.Context(), key)
+		if err != nil {
+			var serviceErr *util.ServiceError
+			if errors.As(err, &serviceErr) && serviceErr.ErrCode() == http.StatusUnauthorized {
+				a.unauthorized(c, "invalid api key")
+				return
+			}
+
+			a.serviceErrorResponse(c, err)
+			c.Abort()
+			return
+		}
+
+		a.withPrincipal(c, principal)
+		return
+	}
+
+	token, ok := bearerToken(c.GetHeader("Authorization"))
+	if !ok || a.verifier == nil {
+		if a.authRequired {
+			a.unauthorized(c, "authentication required")
+			return
+		}
+
+		c.Next()
+		return
+	}
+
+	principal, err := a.verifier.Verify(c.Request.Context(), token)
+	if err != nil {
+		logrus.WithError(err).Debug("rejected bearer token")
+		a.unauthorized(c, "invalid bearer token")
+		return
+	}
+
+	a.withPrincipal(c, principal)
+}
+
+func (a *Application) withPrincipal(c *gin.Context, principal *auth.Principal) {
+	c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
+	c.Next()
+}
+
+func (a *Application) unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="bequest"`)
+	a.errorResponse(c, http.StatusUnauthorized, message)
+	c.Abort()
+}
+
+// requireScope rejects the requests of principals limited to
+// other scopes. Anonymous requests are let through, they only
+// reach it when authentication is disabled.
+func (a *Application) requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := auth.PrincipalFrom(c.Request.Context())
+		if ok && !principal.HasScope(scope) {
+			a.errorResponse(c, http.StatusForbidden, fmt.Sprintf("the %s scope is required", scope))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// requireTenantAdmin rejects the requests of principals that aren't
+// admins of every key of the tenant, whatever their scopes.
+func (a *Application) requireTenantAdmin(c *gin.Context) {
+	if err := a.roleService.AuthorizePattern(c.Request.Context(), tenantID(c), "*"); err != nil {
+		a.serviceErrorResponse(c, err)
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
+
+// authorize writes a 403 and returns false unless the principal
+// of the request has role on key.
+func (a *Application) authorize(c *gin.Context, key string, role datastore.Role) bool {
+	if err := a.roleService.Authorize(c.Request.Context(), tenantID(c), key, role); err != nil {
+		a.serviceErrorResponse(c, err)
+		return false
+	}
+
+	return true
+}
+
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dotunj/bequest/config"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+const testSecret = "some-secret"
+
+// AuthTestSuite exercises the HTTP layer with
+// authentication enabled, against the in-memory store.
+type AuthTestSuite struct {
+	suite.Suite
+	Router http.Handler
+}
+
+func (s *AuthTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+}
+
+func (s *AuthTestSuite) SetupTest() {
+	cfg := &config.Config{
+		Database: config.Database{Store: config.MemoryStore},
+		// roles are left to RoleBindingTestSuite
+		Auth: config.Auth{HMACSecret: testSecret, AdminSubjects: []string{"some-user", "other-user"}},
+	}
+
+	app, err := NewApplication(cfg)
+	require.Nil(s.T(), err)
+
+	s.T().Cleanup(func() {
+		_ = app.Close(context.Background())
+	})
+
+	s.Router = app.Routes()
+}
+
+func (s *AuthTestSuite) Test_RejectsUnauthenticatedRequests() {
+	expired := s.token(jwt.MapClaims{"sub": "some-user", "exp": time.Now().Add(-time.Minute).Unix()})
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantMessage   string
+	}{
+		{name: "missing_header", wantMessage: "authentication required"},
+		{name: "other_scheme", authorization: "Basic c29tZTp1c2Vy", wantMessage: "authentication required"},
+		{name: "empty_token", authorization: "Bearer ", wantMessage: "authentication required"},
+		{name: "malformed_token", authorization: "Bearer not-a-token", wantMessage: "invalid bearer token"},
+		{name: "expired_token", authorization: "Bearer " + expired, wantMessage: "invalid bearer token"},
+	}
+
+	for _, tc := range tests {
+		s.Run(tc.name, func() {
+			req := createRequest(http.MethodGet, "/api/v1/answers/some-key", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			s.Router.ServeHTTP(w, req)
+
+			require.Equal(s.T(), http.StatusUnauthorized, w.Code)
+			require.Contains(s.T(), w.Header().Get("WWW-Authenticate"), "Bearer")
+
+			var response Response
+			require.Nil(s.T(), json.Unmarshal(w.Body.Bytes(), &response))
+			require.Equal(s.T(), Response{Success: false, Message: tc.wantMessage}, response)
+		})
+	}
+}
+
+func (s *AuthTestSuite) Test_RecordsTheActor() {
+	key := uuid.NewString()
+	token := s.token(jwt.MapClaims{"sub": "some-user"})
+
+	w := s.send(http.MethodPost, "/api/v1/answers", token, "", fmt.Sprintf(`{"key": "%s", "value": "some-value"}`, key))
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	w = s.send(http.MethodPut, fmt.Sprintf("/api/v1/answers/%s", key), s.token(jwt.MapClaims{"sub": "other-user"}), "", `{"value": "new-value"}`)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	w = s.send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/history?sort=1", key), token, "", "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var history struct {
+		Content []datastore.Event `json:"content"`
+	}
+	parseResponse(s.T(), w.Result(), &history)
+
+	actors := make([]string, 0)
+	for _, event := range history.Content {
+		actors = append(actors, event.Actor)
+	}
+	require.ElementsMatch(s.T(), []string{"some-user", "other-user"}, actors)
+
+	// each version records its author too
+	w = s.send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/versions", key), token, "", "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var versions struct {
+		Content []datastore.VersionResponse `json:"content"`
+	}
+	parseResponse(s.T(), w.Result(), &versions)
+
+	require.Len(s.T(), versions.Content, 2)
+	require.Equal(s.T(), "other-user", versions.Content[0].Author)
+	require.Equal(s.T(), "some-user", versions.Content[1].Author)
+}
+
+func (s *AuthTestSuite) Test_TenantClaim_SelectsTheTenant() {
+	key := uuid.NewString()
+	token := s.token(jwt.MapClaims{"sub": "some-user", "tenant_id": "acme"})
+
+	w := s.send(http.MethodPost, "/api/v1/answers", token, "", fmt.Sprintf(`{"key": "%s", "value": "some-value"}`, key))
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	w = s.send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s", key), token, "acme", "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	w = s.send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s", key), token, "other", "")
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+
+	// an admin's token without the claim acts for the tenant of the header
+	w = s.send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s", key), s.token(jwt.MapClaims{"sub": "some-user"}), "acme", "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+}
+
+func (s *AuthTestSuite) Test_TokenWithoutTenant_CantCrossTenants() {
+	key := uuid.NewString()
+	acme := s.token(jwt.MapClaims{"sub": "some-user", "tenant_id": "acme"})
+	token := s.token(jwt.MapClaims{"sub": "third-user"})
+
+	w := s.send(http.MethodPost, "/api/v1/answers", acme, "", fmt.Sprintf(`{"key": "%s", "value": "some-value"}`, key))
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	// other principals are bound to the default tenant
+	w = s.send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s", key), token, "acme", "")
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+	require.Contains(s.T(), w.Body.String(), "the tenant id doesn't match the bearer token")
+
+	// where, without roles, they are refused by key instead
+	for _, tenant := range []string{"", datastore.DefaultTenant} {
+		w = s.send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s", key), token, tenant, "")
+		require.Equal(s.T(), http.StatusForbidden, w.Code, tenant)
+		require.Contains(s.T(), w.Body.String(), "the reader role is required on this key", tenant)
+	}
+}
+
+func TestAuthTestSuite(t *testing.T) {
+	suite.Run(t, new(AuthTestSuite))
+}
+
+func (s *AuthTestSuite) token(claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	require.Nil(s.T(), err)
+
+	return token
+}
+
+func (s *AuthTestSuite) send(method, url, token, tenant, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req := createRequest(method, url, reader)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if tenant != "" {
+		req.Header.Set(TenantHeader, tenant)
+	}
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dotunj/bequest/config"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// BatchTestSuite exercises batches over HTTP, against a sqlite
+// store so that atomic batches run in a transaction.
+type BatchTestSuite struct {
+	suite.Suite
+	Router http.Handler
+}
+
+func (s *BatchTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+}
+
+func (s *BatchTestSuite) SetupTest() {
+	cfg := &config.Config{
+		Database: config.Database{
+			Store:      config.SqliteStore,
+			SqlitePath: filepath.Join(s.T().TempDir(), "bequest.sqlite"),
+		},
+	}
+
+	app, err := NewApplication(cfg)
+	require.Nil(s.T(), err)
+
+	s.T().Cleanup(func() {
+		_ = app.Close(context.Background())
+	})
+
+	s.Router = app.Routes()
+}
+
+func (s *BatchTestSuite) Test_ExecuteBatch() {
+	w := s.send(http.MethodPost, "/api/v1/answers", `{"key": "limits.daily", "value": 10}`)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	etag := w.Header().Get("ETag")
+
+	w = s.send(http.MethodPost, "/api/v1/answers:batch", fmt.Sprintf(`{"operations": [
+		{"op": "create", "key": "limits.weekly", "value": 70, "ttl": 3600},
+		{"op": "create", "key": "limits.daily", "value": 20},
+		{"op": "update", "key": "limits.daily", "value": 20, "if_match": %q},
+		{"op": "delete", "key": "limits.weekly"},
+		{"op": "upsert", "key": "limits.monthly", "value": 300}
+	]}`, etag))
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var batch datastore.BatchResponse
+	parseResponse(s.T(), w.Result(), &batch)
+
+	require.False(s.T(), batch.Atomic)
+	require.Equal(s.T(), 3, batch.Succeeded)
+	require.Equal(s.T(), 2, batch.Failed)
+
+	statuses := make([]int, 0, len(batch.Results))
+	for _, result := range batch.Results {
+		statuses = append(statuses, result.Status)
+	}
+	require.Equal(s.T(), []int{http.StatusCreated, http.StatusForbidden, http.StatusOK, http.StatusOK, http.StatusBadRequest}, statuses)
+
+	require.Equal(s.T(), float64(70), batch.Results[0].Answer.Value)
+	require.NotZero(s.T(), batch.Results[0].Answer.ExpiresAt)
+	require.NotEmpty(s.T(), batch.Results[1].Error)
+	require.Equal(s.T(), float64(20), batch.Results[2].Answer.Value)
+	require.Equal(s.T(), int64(2), batch.Results[2].Answer.Version)
+	require.NotEqual(s.T(), etag, batch.Results[2].ETag)
+	require.Nil(s.T(), batch.Results[3].Answer)
+
+	// every mutation is recorded in the history
+	require.Eventually(s.T(), func() bool {
+		return len(s.history("limits.weekly")) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	w = s.send(http.MethodGet, "/api/v1/answers/limits.weekly", "")
+	require.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
+func (s *BatchTestSuite) Test_ExecuteBatch_Atomic() {
+	w := s.send(http.MethodPost, "/api/v1/answers", `{"key": "limits.daily", "value": 10}`)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	w = s.send(http.MethodPost, "/api/v1/answers:batch", `{"atomic": true, "operations": [
+		{"op": "create", "key": "limits.weekly", "value": 70},
+		{"op": "update", "key": "limits.daily", "value": 20, "if_match": "\"stale.1\""},
+		{"op": "delete", "key": "limits.daily"}
+	]}`)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var batch datastore.BatchResponse
+	parseResponse(s.T(), w.Result(), &batch)
+
+	require.True(s.T(), batch.Atomic)
+	require.Equal(s.T(), 0, batch.Succeeded)
+	require.Equal(s.T(), 3, batch.Failed)
+	require.Equal(s.T(), http.StatusFailedDependency, batch.Results[0].Status)
+	require.Equal(s.T(), http.StatusPreconditionFailed, batch.Results[1].Status)
+	require.Equal(s.T(), http.StatusFailedDependency, batch.Results[2].Status)
+
+	// the answer created before the failure was rolled back
+	w = s.send(http.MethodGet, "/api/v1/answers/limits.weekly", "")
+	require.Equal(s.T(), http.StatusNotFound, w.Code)
+
+	w = s.send(http.MethodPost, "/api/v1/answers:batch", `{"atomic": true, "operations": [
+		{"op": "create", "key": "limits.weekly", "value": 70},
+		{"op": "update", "key": "limits.daily", "value": 20}
+	]}`)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	parseResponse(s.T(), w.Result(), &batch)
+	require.Equal(s.T(), 2, batch.Succeeded)
+	require.Equal(s.T(), 0, batch.Failed)
+
+	w = s.send(http.MethodGet, "/api/v1/answers/limits.weekly", "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+}
+
+func (s *BatchTestSuite) Test_ExecuteBatch_WithInvalidRequest() {
+	for _, body := range []string{`{}`, `{"operations": []}`, `{"operations": {}}`} {
+		w := s.send(http.MethodPost, "/api/v1/answers:batch", body)
+		require.Equal(s.T(), http.StatusBadRequest, w.Code, body)
+	}
+
+	// only the batch suffix is routed to batches
+	w := s.send(http.MethodPost, "/api/v1/answers:unknown", `{"operations": [{"op": "delete", "key": "some-key"}]}`)
+	require.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
+func TestBatchTestSuite(t *testing.T) {
+	suite.Run(t, new(BatchTestSuite))
+}
+
+func (s *BatchTestSuite) history(key string) []datastore.Event {
+	w := s.send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/history", key), "")
+	if w.Code != http.StatusOK {
+		return nil
+	}
+
+	var history struct {
+		Content []datastore.Event `json:"content"`
+	}
+	parseResponse(s.T(), w.Result(), &history)
+	return history.Content
+}
+
+func (s *BatchTestSuite) send(method, url, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, createRequest(method, url, reader))
+	return w
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ifMatch returns the entity tags listed in the If-Match headers of
+// the request. Weak tags are kept as sent, so they never match, as
+// If-Match compares tags strongly.
+func ifMatch(c *gin.Context) []string {
+	return listTags(c, "If-Match")
+}
+
+// setValidators sets the ETag and Last-Modified headers clients
+// revalidate their copy of a representation with.
+func setValidators(c *gin.Context, etag string, lastModified time.Time) {
+	c.Header("ETag", etag)
+
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified reports whether the client already has the representation
+// identified by etag and lastModified, going by the If-None-Match headers
+// of the request, or by If-Modified-Since when there are none.
+func notModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	if tags := listTags(c, "If-None-Match"); len(tags) > 0 {
+		for _, tag := range tags {
+			// If-None-Match compares tags weakly
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	since, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+
+	// Last-Modified only has a precision of a second
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// contentTag returns a weak entity tag derived from the JSON encoding
+// of v, for representations without a version of their own.
+func contentTag(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf(`W/"%x"`, sum[:16]), nil
+}
+
+// listTags returns the entity tags listed in the header of the
+// request, which may be repeated or hold comma separated lists.
+func listTags(c *gin.Context, header string) []string {
+	var tags []string
+
+	for _, value := range c.Request.Header.Values(header) {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return tags
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dotunj/bequest/config"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// ExpiryTestSuite exercises answer expiry over HTTP, against the
+// in-memory store, with the reaper running every few milliseconds.
+type ExpiryTestSuite struct {
+	suite.Suite
+	Router http.Handler
+}
+
+func (s *ExpiryTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+}
+
+func (s *ExpiryTestSuite) SetupTest() {
+	cfg := &config.Config{
+		Database: config.Database{Store: config.MemoryStore},
+		Expiry:   config.Expiry{Interval: 10 * time.Millisecond},
+	}
+
+	app, err := NewApplication(cfg)
+	require.Nil(s.T(), err)
+
+	s.T().Cleanup(func() {
+		_ = app.Close(context.Background())
+	})
+
+	s.Router = app.Routes()
+}
+
+func (s *ExpiryTestSuite) Test_CreateAnswer_WithTTL() {
+	key := uuid.NewString()
+
+	w := s.send(http.MethodPost, "/api/v1/answers", fmt.Sprintf(`{"key": "%s", "value": 10, "ttl": 3600}`, key))
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	var answer datastore.AnswerResponse
+	parseResponse(s.T(), w.Result(), &answer)
+
+	require.WithinDuration(s.T(), time.Now().Add(time.Hour), answer.ExpiresAt.Time(), time.Minute)
+
+	// updates keep the expiry unless told otherwise
+	w = s.send(http.MethodPut, "/api/v1/answers/"+key, `{"value": 20}`)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	parseResponse(s.T(), w.Result(), &answer)
+	require.WithinDuration(s.T(), time.Now().Add(time.Hour), answer.ExpiresAt.Time(), time.Minute)
+
+	w = s.send(http.MethodPut, "/api/v1/answers/"+key, `{"value": 30, "persist": true}`)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	answer = datastore.AnswerResponse{}
+	parseResponse(s.T(), w.Result(), &answer)
+	require.Zero(s.T(), answer.ExpiresAt)
+}
+
+func (s *ExpiryTestSuite) Test_CreateAnswer_WithInvalidExpiry() {
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+
+	for _, expiry := range []string{
+		`"ttl": -1`,
+		fmt.Sprintf(`"expires_at": "%s"`, past),
+		fmt.Sprintf(`"ttl": 60, "expires_at": "%s"`, future),
+	} {
+		w := s.send(http.MethodPost, "/api/v1/answers", fmt.Sprintf(`{"key": "%s", "value": 10, %s}`, uuid.NewString(), expiry))
+		require.Equal(s.T(), http.StatusBadRequest, w.Code, expiry)
+	}
+
+	key := uuid.NewString()
+
+	w := s.send(http.MethodPost, "/api/v1/answers", fmt.Sprintf(`{"key": "%s", "value": 10}`, key))
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	w = s.send(http.MethodPut, "/api/v1/answers/"+key, `{"value": 20, "ttl": 60, "persist": true}`)
+	require.Equal(s.T(), http.StatusBadRequest, w.Code)
+}
+
+func (s *ExpiryTestSuite) Test_ExpiredAnswer_IsReaped() {
+	key := uuid.NewString()
+	expiresAt := time.Now().Add(50 * time.Millisecond).Format(time.RFC3339Nano)
+
+	w := s.send(http.MethodPost, "/api/v1/answers", fmt.Sprintf(`{"key": "%s", "value": 10, "expires_at": "%s"}`, key, expiresAt))
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	w = s.send(http.MethodGet, "/api/v1/answers/"+key, "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	require.Eventually(s.T(), func() bool {
+		return s.send(http.MethodGet, "/api/v1/answers/"+key, "").Code == http.StatusNotFound
+	}, time.Second, 10*time.Millisecond)
+
+	// the reaper deletes the answer, recording why in its history
+	var history []datastore.Event
+	require.Eventually(s.T(), func() bool {
+		history = s.history(key)
+		return len(history) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(s.T(), datastore.ExpireEvent, history[0].Type)
+	require.Equal(s.T(), float64(10), history[0].Data.Value)
+	require.Equal(s.T(), datastore.CreateEvent, history[1].Type)
+
+	w = s.send(http.MethodGet, "/api/v1/answers?status=deleted", "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var deleted []datastore.AnswerResponse
+	parseResponse(s.T(), w.Result(), &datastore.PagedResponse{Content: &deleted})
+	require.Len(s.T(), deleted, 1)
+	require.Equal(s.T(), key, deleted[0].Key)
+
+	// the key is free for a new answer
+	w = s.send(http.MethodPost, "/api/v1/answers", fmt.Sprintf(`{"key": "%s", "value": 20}`, key))
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	var answer datastore.AnswerResponse
+	parseResponse(s.T(), w.Result(), &answer)
+	require.Equal(s.T(), int64(2), answer.Generation)
+}
+
+func TestExpiryTestSuite(t *testing.T) {
+	suite.Run(t, new(ExpiryTestSuite))
+}
+
+func (s *ExpiryTestSuite) history(key string) []datastore.Event {
+	w := s.send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/history", key), "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var history struct {
+		Content []datastore.Event `json:"content"`
+	}
+	parseResponse(s.T(), w.Result(), &history)
+	return history.Content
+}
+
+func (s *ExpiryTestSuite) send(method, url, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, createRequest(method, url, reader))
+	return w
+}
@@ -0,0 +1,39 @@
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func createRequest(method, url string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, url, body)
+	req.Header.Add("Content-Type", "application/json")
+
+	return req
+}
+
+func parseResponse(t *testing.T, w *http.Response, response interface{}) {
+	body, err := io.ReadAll(w.Body)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	sR := struct {
+		Success bool            `json:"success"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}{}
+
+	err = json.Unmarshal(body, &sR)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = json.Unmarshal(sR.Data, response)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
@@ -0,0 +1,296 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+	csvContentType    = "text/csv"
+)
+
+// csvColumns are the columns of exported CSV files, followed by
+// versions and events when they are exported. Imported files may
+// hold any of them, in any order, as long as key is one of them.
+var csvColumns = []string{"key", "type", "value", "version", "created_at", "updated_at", "expires_at"}
+
+// recordWriter encodes the records of an export.
+type recordWriter interface {
+	Write(record *datastore.AnswerRecord) error
+	// Flush writes out whatever is buffered, along with
+	// the header of the format if no record was written.
+	Flush() error
+}
+
+func newRecordWriter(format datastore.TransferFormat, w io.Writer, query *datastore.ExportQuery) recordWriter {
+	if format == datastore.CSVFormat {
+		columns := append([]string{}, csvColumns...)
+		if query.History {
+			columns = append(columns, "versions")
+		}
+
+		if query.Events {
+			columns = append(columns, "events")
+		}
+
+		return &csvRecordWriter{w: csv.NewWriter(w), columns: columns}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	return &ndjsonRecordWriter{encoder: encoder}
+}
+
+// ndjsonRecordWriter writes a record per line, as a JSON object.
+type ndjsonRecordWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonRecordWriter) Write(record *datastore.AnswerRecord) error {
+	return w.encoder.Encode(record)
+}
+
+func (w *ndjsonRecordWriter) Flush() error {
+	return nil
+}
+
+// csvRecordWriter writes a record per row, after a header row naming
+// the columns. Values are written as JSON, except for strings which are
+// written as they are, and so are the versions and events of a record.
+type csvRecordWriter struct {
+	w           *csv.Writer
+	columns     []string
+	wroteHeader bool
+}
+
+func (w *csvRecordWriter) Write(record *datastore.AnswerRecord) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	row := make([]string, 0, len(w.columns))
+	for _, column := range w.columns {
+		cell, err := csvCell(record, column)
+		if err != nil {
+			return err
+		}
+
+		row = append(row, cell)
+	}
+
+	return w.w.Write(row)
+}
+
+func (w *csvRecordWriter) Flush() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *csvRecordWriter) writeHeader() error {
+	if w.wroteHeader {
+		return nil
+	}
+
+	w.wroteHeader = true
+	return w.w.Write(w.columns)
+}
+
+func csvCell(record *datastore.AnswerRecord, column string) (string, error) {
+	switch column {
+	case "key":
+		return record.Key, nil
+	case "type":
+		return string(record.Type), nil
+	case "value":
+		if record.Type == datastore.StringValue {
+			var s string
+			err := json.Unmarshal(record.Value, &s)
+			return s, err
+		}
+		return string(record.Value), nil
+	case "version":
+		return strconv.FormatInt(record.Version, 10), nil
+	case "created_at":
+		return csvTime(record.CreatedAt), nil
+	case "updated_at":
+		return csvTime(record.UpdatedAt), nil
+	case "expires_at":
+		return csvTime(record.ExpiresAt), nil
+	case "versions":
+		return csvJSON(record.Versions)
+	case "events":
+		return csvJSON(record.Events)
+	default:
+		return "", fmt.Errorf("unknown column %q", column)
+	}
+}
+
+func csvTime(t primitive.DateTime) string {
+	if t == 0 {
+		return ""
+	}
+
+	return t.Time().UTC().Format(time.RFC3339Nano)
+}
+
+func csvJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// newRecordReader returns the reader of the records of an import read
+// from r. It fails when the header of a CSV file can't be read.
+func newRecordReader(format datastore.TransferFormat, r io.Reader) (services.RecordReader, error) {
+	if format != datastore.CSVFormat {
+		return &ndjsonRecordReader{r: bufio.NewReader(r)}, nil
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the csv file has no header")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[column] = i
+	}
+
+	if _, ok := columns["key"]; !ok {
+		return nil, errors.New("the csv file has no key column")
+	}
+
+	return &csvRecordReader{r: reader, columns: columns}, nil
+}
+
+// ndjsonRecordReader reads a record per line, skipping blank lines.
+type ndjsonRecordReader struct {
+	r *bufio.Reader
+}
+
+func (r *ndjsonRecordReader) Read() (*datastore.AnswerRecord, error) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// the last line may not end with a newline
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		var record datastore.AnswerRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("%w: %v", services.ErrMalformedRecord, err)
+		}
+
+		return &record, nil
+	}
+}
+
+// csvRecordReader reads a record per row, the way csvRecordWriter
+// writes them. A value without a type is read as JSON, or as a
+// string when it isn't valid JSON.
+type csvRecordReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func (r *csvRecordReader) Read() (*datastore.AnswerRecord, error) {
+	row, err := r.r.Read()
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, fmt.Errorf("%w: %v", services.ErrMalformedRecord, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	cell := func(column string) string {
+		if i, ok := r.columns[column]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	record := &datastore.AnswerRecord{
+		Key:  cell("key"),
+		Type: datastore.ValueType(cell("type")),
+	}
+
+	// an empty string is the only value written as an empty cell
+	if value := cell("value"); value != "" || record.Type == datastore.StringValue {
+		if record.Type == datastore.StringValue || (record.Type == "" && !json.Valid([]byte(value))) {
+			record.Value, _ = json.Marshal(value)
+		} else {
+			record.Value = json.RawMessage(value)
+		}
+	}
+
+	times := []struct {
+		column string
+		t      *primitive.DateTime
+	}{
+		{"created_at", &record.CreatedAt},
+		{"updated_at", &record.UpdatedAt},
+		{"expires_at", &record.ExpiresAt},
+	}
+
+	for _, field := range times {
+		if value := cell(field.column); value != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return record, fmt.Errorf("%w: %s must be an RFC3339 time", services.ErrMalformedRecord, field.column)
+			}
+
+			*field.t = primitive.NewDateTimeFromTime(parsed)
+		}
+	}
+
+	if value := cell("versions"); value != "" {
+		if err := json.Unmarshal([]byte(value), &record.Versions); err != nil {
+			return record, fmt.Errorf("%w: versions: %v", services.ErrMalformedRecord, err)
+		}
+	}
+
+	if value := cell("events"); value != "" {
+		if err := json.Unmarshal([]byte(value), &record.Events); err != nil {
+			return record, fmt.Errorf("%w: events: %v", services.ErrMalformedRecord, err)
+		}
+	}
+
+	return record, nil
+}
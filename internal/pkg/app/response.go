@@ -1,6 +1,9 @@
 package app
 
 import (
+	"errors"
+
+	"github.com/dotunj/bequest/internal/pkg/util"
 	"github.com/gin-gonic/gin"
 )
 
@@ -17,6 +20,24 @@ func (app *Application) errorResponse(c *gin.Context, status int, message string
 	})
 }
 
+// serviceErrorResponse responds with the status and message of a
+// service error, along with the details it carries, if any.
+func (app *Application) serviceErrorResponse(c *gin.Context, err error) {
+	status, message := util.NewServiceErrResponse(err)
+
+	var data interface{}
+	var serviceErr *util.ServiceError
+	if errors.As(err, &serviceErr) {
+		data = serviceErr.Data()
+	}
+
+	c.JSON(status, &Response{
+		Success: false,
+		Message: message,
+		Data:    data,
+	})
+}
+
 func (app *Application) successResponse(c *gin.Context, status int, message string, data interface{}) {
 	c.JSON(status, &Response{
 		Success: true,
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/gin-gonic/gin"
+)
+
+// RetentionReport reports what the next run of the retention policy
+// would purge from the tenant, which only tenant admins may see.
+func (a *Application) RetentionReport(c *gin.Context) {
+	if err := a.roleService.AuthorizePattern(c.Request.Context(), tenantID(c), "*"); err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	report, err := a.retentionService.Report(c.Request.Context(), tenantID(c))
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "retention report retrieved successfully", report)
+}
+
+func (a *Application) CreateLegalHold(c *gin.Context) {
+	if !a.authorize(c, c.Param("key"), datastore.AdminRole) {
+		return
+	}
+
+	var createLegalHold datastore.CreateLegalHold
+
+	if err := c.ShouldBindJSON(&createLegalHold); err != nil {
+		a.errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hold, err := a.retentionService.CreateLegalHold(c.Request.Context(), tenantID(c), c.Param("key"), &createLegalHold)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusCreated, "legal hold created successfully", hold)
+}
+
+func (a *Application) DeleteLegalHold(c *gin.Context) {
+	if !a.authorize(c, c.Param("key"), datastore.AdminRole) {
+		return
+	}
+
+	err := a.retentionService.DeleteLegalHold(c.Request.Context(), tenantID(c), c.Param("key"))
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "legal hold deleted successfully", nil)
+}
+
+// FindLegalHolds returns the holds on the keys the caller administers.
+func (a *Application) FindLegalHolds(c *gin.Context) {
+	authorized, err := a.roleService.Authorizer(c.Request.Context(), tenantID(c), datastore.AdminRole)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	holds, err := a.retentionService.FindLegalHolds(c.Request.Context(), tenantID(c))
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	found := make([]datastore.LegalHold, 0, len(holds))
+	for _, hold := range holds {
+		if authorized(hold.Key) {
+			found = append(found, hold)
+		}
+	}
+
+	a.successResponse(c, http.StatusOK, "legal holds retrieved successfully", found)
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dotunj/bequest/config"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// RetentionTestSuite exercises the retention report and legal holds
+// over HTTP, against the in-memory store. Deleted answers are past
+// retention right away, and a single event is kept for every key.
+type RetentionTestSuite struct {
+	suite.Suite
+	App    *Application
+	Router http.Handler
+}
+
+func (s *RetentionTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+}
+
+func (s *RetentionTestSuite) SetupTest() {
+	cfg := &config.Config{
+		Database:  config.Database{Store: config.MemoryStore},
+		Auth:      config.Auth{HMACSecret: testSecret, AdminSubjects: []string{"root"}},
+		Retention: config.Retention{DeletedAnswers: time.Nanosecond, HistoryVersions: 1},
+	}
+
+	app, err := NewApplication(cfg)
+	require.Nil(s.T(), err)
+
+	s.T().Cleanup(func() {
+		_ = app.Close(context.Background())
+	})
+
+	s.App = app
+	s.Router = app.Routes()
+}
+
+func (s *RetentionTestSuite) Test_PurgesEverythingButHeldKeys() {
+	root := s.token("root")
+	admin := s.token("billing-admin")
+
+	w := s.send(http.MethodPost, "/api/v1/role-bindings", root, `{"subject": "billing-admin", "role": "admin", "pattern": "billing.*"}`)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	for _, key := range []string{"billing.limit", "billing.held"} {
+		w = s.send(http.MethodPost, "/api/v1/answers", root, fmt.Sprintf(`{"key": "%s", "value": 10}`, key))
+		require.Equal(s.T(), http.StatusCreated, w.Code)
+
+		w = s.send(http.MethodDelete, fmt.Sprintf("/api/v1/answers/%s", key), root, "")
+		require.Equal(s.T(), http.StatusOK, w.Code)
+	}
+
+	w = s.send(http.MethodPost, "/api/v1/answers", root, `{"key": "billing.kept", "value": 10}`)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	w = s.send(http.MethodPut, "/api/v1/answers/billing.kept", root, `{"value": 20}`)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	w = s.send(http.MethodPost, "/api/v1/answers/billing.held/legal-hold", admin, `{"reason": "litigation"}`)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	var hold datastore.LegalHold
+	parseResponse(s.T(), w.Result(), &hold)
+	require.Equal(s.T(), "billing-admin", hold.CreatedBy)
+
+	w = s.send(http.MethodPost, "/api/v1/answers/billing.held/legal-hold", admin, `{"reason": "litigation"}`)
+	require.Equal(s.T(), http.StatusConflict, w.Code)
+
+	w = s.send(http.MethodPost, "/api/v1/answers/billing.held/legal-hold", admin, `{}`)
+	require.Equal(s.T(), http.StatusBadRequest, w.Code)
+
+	w = s.send(http.MethodPost, "/api/v1/answers/accounts.limit/legal-hold", admin, `{"reason": "litigation"}`)
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+
+	w = s.send(http.MethodGet, "/api/v1/legal-holds", admin, "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var holds []datastore.LegalHold
+	parseResponse(s.T(), w.Result(), &holds)
+	require.Len(s.T(), holds, 1)
+	require.Equal(s.T(), "billing.held", holds[0].Key)
+
+	// the report covers the whole tenant, which only tenant admins see
+	w = s.send(http.MethodGet, "/api/v1/retention/report", admin, "")
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+
+	// deleted_at is stored to the millisecond
+	time.Sleep(2 * time.Millisecond)
+
+	w = s.send(http.MethodGet, "/api/v1/retention/report", root, "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var report datastore.RetentionReport
+	parseResponse(s.T(), w.Result(), &report)
+
+	require.True(s.T(), report.DryRun)
+	require.Len(s.T(), report.Answers, 1)
+	require.Equal(s.T(), "billing.limit", report.Answers[0].Key)
+	require.Equal(s.T(), int64(2), report.Answers[0].Events)
+	require.Len(s.T(), report.HeldAnswers, 1)
+	require.Equal(s.T(), "billing.held", report.HeldAnswers[0].Key)
+	require.Equal(s.T(), int64(1), report.Events)
+	require.Equal(s.T(), int64(1), report.HeldEvents)
+
+	// the report purges nothing
+	require.Len(s.T(), s.history(root, "billing.limit"), 2)
+
+	purged, err := s.App.retentionService.Purge(context.Background(), "")
+	require.Nil(s.T(), err)
+	require.False(s.T(), purged.DryRun)
+	require.Equal(s.T(), report.Events, purged.Events)
+
+	w = s.send(http.MethodGet, "/api/v1/answers/billing.limit/history", root, "")
+	require.Equal(s.T(), http.StatusNotFound, w.Code)
+
+	require.Len(s.T(), s.history(root, "billing.held"), 2)
+	require.Len(s.T(), s.history(root, "billing.kept"), 1)
+
+	// lifting the hold leaves the key to the next run
+	w = s.send(http.MethodDelete, "/api/v1/answers/billing.held/legal-hold", admin, "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	w = s.send(http.MethodDelete, "/api/v1/answers/billing.held/legal-hold", admin, "")
+	require.Equal(s.T(), http.StatusNotFound, w.Code)
+
+	_, err = s.App.retentionService.Purge(context.Background(), "")
+	require.Nil(s.T(), err)
+
+	w = s.send(http.MethodGet, "/api/v1/answers/billing.held/history", root, "")
+	require.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
+func TestRetentionTestSuite(t *testing.T) {
+	suite.Run(t, new(RetentionTestSuite))
+}
+
+func (s *RetentionTestSuite) history(token, key string) []datastore.Event {
+	w := s.send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/history", key), token, "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var history struct {
+		Content []datastore.Event `json:"content"`
+	}
+	parseResponse(s.T(), w.Result(), &history)
+	return history.Content
+}
+
+func (s *RetentionTestSuite) token(subject string) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": subject}).SignedString([]byte(testSecret))
+	require.Nil(s.T(), err)
+
+	return token
+}
+
+func (s *RetentionTestSuite) send(method, url, token, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req := createRequest(method, url, reader)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/gin-gonic/gin"
+)
+
+func (a *Application) CreateRoleBinding(c *gin.Context) {
+	var createRoleBinding datastore.CreateRoleBinding
+
+	if err := c.ShouldBindJSON(&createRoleBinding); err != nil {
+		a.errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	binding, err := a.roleService.CreateRoleBinding(c.Request.Context(), tenantID(c), &createRoleBinding)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusCreated, "role binding created successfully", binding)
+}
+
+func (a *Application) FindRoleBindings(c *gin.Context) {
+	bindings, err := a.roleService.FindRoleBindings(c.Request.Context(), tenantID(c), c.Query("subject"))
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "role bindings retrieved successfully", bindings)
+}
+
+func (a *Application) FindRoleBindingByUID(c *gin.Context) {
+	binding, err := a.roleService.FindRoleBindingByUID(c.Request.Context(), tenantID(c), c.Param("uid"))
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "role binding retrieved successfully", binding)
+}
+
+func (a *Application) DeleteRoleBinding(c *gin.Context) {
+	binding, err := a.roleService.DeleteRoleBinding(c.Request.Context(), tenantID(c), c.Param("uid"))
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "role binding deleted successfully", binding)
+}
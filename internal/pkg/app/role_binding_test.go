@@ -0,0 +1,220 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dotunj/bequest/config"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// RoleBindingTestSuite exercises role based authorization over HTTP,
+// against the in-memory store. The root user is an admin everywhere.
+type RoleBindingTestSuite struct {
+	suite.Suite
+	Router http.Handler
+}
+
+func (s *RoleBindingTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+}
+
+func (s *RoleBindingTestSuite) SetupTest() {
+	cfg := &config.Config{
+		Database: config.Database{Store: config.MemoryStore},
+		Auth:     config.Auth{HMACSecret: testSecret, AdminSubjects: []string{"root"}},
+	}
+
+	app, err := NewApplication(cfg)
+	require.Nil(s.T(), err)
+
+	s.T().Cleanup(func() {
+		_ = app.Close(context.Background())
+	})
+
+	s.Router = app.Routes()
+}
+
+func (s *RoleBindingTestSuite) Test_EnforcesRolesOnKeyPatterns() {
+	root := s.token("root")
+	billing := s.token("some-user", "billing")
+	reader := s.token("reader")
+
+	s.bind(root, "group:billing", datastore.WriterRole, "billing/*")
+	s.bind(root, "reader", datastore.ReaderRole, "*")
+
+	w := s.send(http.MethodPost, "/api/v1/answers", billing, `{"key": "billing/limit", "value": 10}`)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	w = s.send(http.MethodPost, "/api/v1/answers", billing, `{"key": "accounts/limit", "value": 10}`)
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+
+	var response Response
+	require.Nil(s.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(s.T(), Response{Success: false, Message: "the writer role is required on this key"}, response)
+
+	w = s.send(http.MethodPost, "/api/v1/answers", root, `{"key": "accounts.limit", "value": 10}`)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	for _, url := range []string{"/api/v1/answers/accounts.limit", "/api/v1/answers/accounts.limit/history"} {
+		w = s.send(http.MethodGet, url, reader, "")
+		require.Equal(s.T(), http.StatusOK, w.Code, url)
+
+		w = s.send(http.MethodGet, url, billing, "")
+		require.Equal(s.T(), http.StatusForbidden, w.Code, url)
+	}
+
+	// listed answers are limited to the keys the principal can read
+	w = s.send(http.MethodGet, "/api/v1/answers", billing, "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var answers []datastore.AnswerResponse
+	parseResponse(s.T(), w.Result(), &datastore.PagedResponse{Content: &answers})
+	require.Len(s.T(), answers, 1)
+	require.Equal(s.T(), "billing/limit", answers[0].Key)
+
+	w = s.send(http.MethodPut, "/api/v1/answers/accounts.limit", reader, `{"value": 20}`)
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+
+	w = s.send(http.MethodDelete, "/api/v1/answers/accounts.limit", reader, "")
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+}
+
+func (s *RoleBindingTestSuite) Test_AdminsManageTheBindingsOfTheirKeys() {
+	root := s.token("root")
+	admin := s.token("billing-admin")
+
+	s.bind(root, "billing-admin", datastore.AdminRole, "billing.*")
+	other := s.bind(root, "some-user", datastore.ReaderRole, "*")
+
+	body := `{"subject": "some-user", "role": "writer", "pattern": "billing.invoices.*"}`
+
+	w := s.send(http.MethodPost, "/api/v1/role-bindings", admin, body)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	var created datastore.RoleBinding
+	parseResponse(s.T(), w.Result(), &created)
+
+	w = s.send(http.MethodPost, "/api/v1/role-bindings", admin, body)
+	require.Equal(s.T(), http.StatusConflict, w.Code)
+
+	w = s.send(http.MethodPost, "/api/v1/role-bindings", admin, `{"subject": "billing-admin", "role": "admin", "pattern": "*"}`)
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+
+	// bindings on other keys are hidden
+	w = s.send(http.MethodGet, "/api/v1/role-bindings?subject=some-user", admin, "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var bindings []datastore.RoleBinding
+	parseResponse(s.T(), w.Result(), &bindings)
+	require.Len(s.T(), bindings, 1)
+	require.Equal(s.T(), created.UID, bindings[0].UID)
+
+	w = s.send(http.MethodGet, fmt.Sprintf("/api/v1/role-bindings/%s", other.UID), admin, "")
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+
+	w = s.send(http.MethodPost, "/api/v1/answers", s.token("some-user"), `{"key": "billing.invoices.limit", "value": 10}`)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	// deleting the binding revokes the role right away
+	w = s.send(http.MethodDelete, fmt.Sprintf("/api/v1/role-bindings/%s", created.UID), admin, "")
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	w = s.send(http.MethodPut, "/api/v1/answers/billing.invoices.limit", s.token("some-user"), `{"value": 20}`)
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+
+	w = s.send(http.MethodDelete, fmt.Sprintf("/api/v1/role-bindings/%s", created.UID), admin, "")
+	require.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
+func (s *RoleBindingTestSuite) Test_AdminsManageTheSchemasOfTheirNamespaces() {
+	root := s.token("root")
+	admin := s.token("billing-admin")
+	writer := s.token("billing-writer")
+
+	s.bind(root, "billing-admin", datastore.AdminRole, "billing.*")
+	s.bind(root, "billing-writer", datastore.WriterRole, "billing.*")
+
+	body := `{"namespace": "billing.", "definition": {"type": "number"}}`
+
+	w := s.send(http.MethodPost, "/api/v1/schemas", writer, body)
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+
+	var response Response
+	require.Nil(s.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(s.T(), Response{Success: false, Message: "the admin role is required on billing.*"}, response)
+
+	w = s.send(http.MethodPost, "/api/v1/schemas", admin, `{"namespace": "accounts.", "definition": {"type": "number"}}`)
+	require.Equal(s.T(), http.StatusForbidden, w.Code)
+
+	w = s.send(http.MethodPost, "/api/v1/schemas", admin, body)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	var schema datastore.Schema
+	parseResponse(s.T(), w.Result(), &schema)
+
+	for _, action := range []string{"activate", "deactivate"} {
+		url := fmt.Sprintf("/api/v1/schemas/%s/%s", schema.UID, action)
+
+		w = s.send(http.MethodPost, url, writer, "")
+		require.Equal(s.T(), http.StatusForbidden, w.Code, url)
+
+		w = s.send(http.MethodPost, url, admin, "")
+		require.Equal(s.T(), http.StatusOK, w.Code, url)
+	}
+
+	w = s.send(http.MethodPost, "/api/v1/schemas/unknown/activate", admin, "")
+	require.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
+func TestRoleBindingTestSuite(t *testing.T) {
+	suite.Run(t, new(RoleBindingTestSuite))
+}
+
+func (s *RoleBindingTestSuite) bind(token, subject string, role datastore.Role, pattern string) *datastore.RoleBinding {
+	body := fmt.Sprintf(`{"subject": "%s", "role": "%s", "pattern": "%s"}`, subject, role, pattern)
+
+	w := s.send(http.MethodPost, "/api/v1/role-bindings", token, body)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	var binding datastore.RoleBinding
+	parseResponse(s.T(), w.Result(), &binding)
+
+	return &binding
+}
+
+func (s *RoleBindingTestSuite) token(subject string, groups ...string) string {
+	claims := jwt.MapClaims{"sub": subject}
+	if len(groups) > 0 {
+		claims["groups"] = groups
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	require.Nil(s.T(), err)
+
+	return token
+}
+
+func (s *RoleBindingTestSuite) send(method, url, token, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req := createRequest(method, url, reader)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, req)
+	return w
+}
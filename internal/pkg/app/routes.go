@@ -3,6 +3,7 @@ package app
 import (
 	"net/http"
 
+	"github.com/dotunj/bequest/internal/pkg/auth"
 	"github.com/gin-gonic/gin"
 )
 
@@ -10,13 +11,64 @@ func (a *Application) Routes() http.Handler {
 	e := gin.Default()
 	e.Use(gin.Recovery())
 
-	v1 := e.Group("/api/v1")
+	v1 := e.Group("/api/v1", a.authenticate, a.resolveTenant)
 	{
-		v1.POST("/answers", a.CreateAnswer)
-		v1.GET("/answers/:key", a.FindAnswerByKey)
-		v1.PUT("/answers/:key", a.UpdateAnswer)
-		v1.DELETE("/answers/:key", a.DeleteAnswer)
-		v1.GET("/answers/:key/history", a.FindHistoryByKey)
+		read, write := a.requireScope(auth.ScopeAnswersRead), a.requireScope(auth.ScopeAnswersWrite)
+
+		v1.POST("/answers", write, a.CreateAnswer)
+		v1.GET("/answers", read, a.FindAnswers)
+		v1.GET("/answers:method", read, a.customMethods(map[string]gin.HandlerFunc{
+			"export": a.ExportAnswers,
+		}))
+		v1.POST("/answers:method", write, a.customMethods(map[string]gin.HandlerFunc{
+			"batch":  a.ExecuteBatch,
+			"import": a.ImportAnswers,
+		}))
+		v1.GET("/search", read, a.SearchAnswers)
+		v1.GET("/answers/:key", read, a.FindAnswerByKey)
+		v1.PUT("/answers/:key", write, a.UpdateAnswer)
+		v1.DELETE("/answers/:key", write, a.DeleteAnswer)
+		v1.POST("/answers/:key/rollback", write, a.RollbackAnswer)
+		v1.POST("/answers/:key/restore", write, a.RestoreAnswer)
+		v1.GET("/answers/:key/history", read, a.FindHistoryByKey)
+		v1.GET("/answers/:key/versions", read, a.FindAnswerVersions)
+		v1.GET("/answers/:key/versions/:version", read, a.FindAnswerVersion)
+	}
+	{
+		read, write := a.requireScope(auth.ScopeSchemasRead), a.requireScope(auth.ScopeSchemasWrite)
+
+		v1.POST("/schemas", write, a.CreateSchema)
+		v1.GET("/schemas", read, a.FindSchemas)
+		v1.GET("/schemas/:uid", read, a.FindSchemaByUID)
+		v1.POST("/schemas/:uid/test", read, a.TestSchema)
+		v1.POST("/schemas/:uid/activate", write, a.ActivateSchema)
+		v1.POST("/schemas/:uid/deactivate", write, a.DeactivateSchema)
+	}
+	{
+		// api keys act for the whole tenant, only its admins manage them
+		manage, admin := a.requireScope(auth.ScopeAPIKeys), a.requireTenantAdmin
+
+		v1.POST("/api-keys", manage, admin, a.CreateAPIKey)
+		v1.GET("/api-keys", manage, admin, a.FindAPIKeys)
+		v1.GET("/api-keys/:uid", manage, admin, a.FindAPIKeyByUID)
+		v1.POST("/api-keys/:uid/rotate", manage, admin, a.RotateAPIKey)
+		v1.DELETE("/api-keys/:uid", manage, admin, a.RevokeAPIKey)
+	}
+	{
+		manage := a.requireScope(auth.ScopeRoles)
+
+		v1.POST("/role-bindings", manage, a.CreateRoleBinding)
+		v1.GET("/role-bindings", manage, a.FindRoleBindings)
+		v1.GET("/role-bindings/:uid", manage, a.FindRoleBindingByUID)
+		v1.DELETE("/role-bindings/:uid", manage, a.DeleteRoleBinding)
+	}
+	{
+		manage := a.requireScope(auth.ScopeRetention)
+
+		v1.GET("/retention/report", manage, a.RetentionReport)
+		v1.GET("/legal-holds", manage, a.FindLegalHolds)
+		v1.POST("/answers/:key/legal-hold", manage, a.CreateLegalHold)
+		v1.DELETE("/answers/:key/legal-hold", manage, a.DeleteLegalHold)
 	}
 
 	return e
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/gin-gonic/gin"
+)
+
+func (a *Application) CreateSchema(c *gin.Context) {
+	var createSchema datastore.CreateSchema
+
+	if err := c.ShouldBindJSON(&createSchema); err != nil {
+		a.errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !a.authorizeNamespace(c, createSchema.Namespace) {
+		return
+	}
+
+	schema, err := a.schemaService.CreateSchema(c.Request.Context(), tenantID(c), &createSchema)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusCreated, "schema created successfully", schema)
+}
+
+func (a *Application) FindSchemas(c *gin.Context) {
+	schemas, err := a.schemaService.FindSchemas(c.Request.Context(), tenantID(c), c.Query("namespace"))
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "schemas retrieved successfully", schemas)
+}
+
+func (a *Application) FindSchemaByUID(c *gin.Context) {
+	schema, err := a.schemaService.FindSchemaByUID(c.Request.Context(), tenantID(c), c.Param("uid"))
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "schema retrieved successfully", schema)
+}
+
+func (a *Application) TestSchema(c *gin.Context) {
+	result, err := a.schemaService.TestSchema(c.Request.Context(), tenantID(c), c.Param("uid"))
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "schema tested successfully", result)
+}
+
+func (a *Application) ActivateSchema(c *gin.Context) {
+	force := false
+	if raw := c.Query("force"); raw != "" {
+		var err error
+		if force, err = strconv.ParseBool(raw); err != nil {
+			a.errorResponse(c, http.StatusBadRequest, "force must be a boolean")
+			return
+		}
+	}
+
+	if !a.authorizeSchema(c, c.Param("uid")) {
+		return
+	}
+
+	schema, err := a.schemaService.ActivateSchema(c.Request.Context(), tenantID(c), c.Param("uid"), force)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "schema activated successfully", schema)
+}
+
+func (a *Application) DeactivateSchema(c *gin.Context) {
+	if !a.authorizeSchema(c, c.Param("uid")) {
+		return
+	}
+
+	schema, err := a.schemaService.DeactivateSchema(c.Request.Context(), tenantID(c), c.Param("uid"))
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "schema deactivated successfully", schema)
+}
+
+// authorizeSchema writes an error and returns false unless the principal
+// of the request may manage the schema identified by uid.
+func (a *Application) authorizeSchema(c *gin.Context, uid string) bool {
+	schema, err := a.schemaService.FindSchemaByUID(c.Request.Context(), tenantID(c), uid)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return false
+	}
+
+	return a.authorizeNamespace(c, schema.Namespace)
+}
+
+// authorizeNamespace writes a 403 and returns false unless the principal
+// of the request is an admin of every key namespace governs.
+func (a *Application) authorizeNamespace(c *gin.Context, namespace string) bool {
+	if err := a.roleService.AuthorizePattern(c.Request.Context(), tenantID(c), namespace+"*"); err != nil {
+		a.serviceErrorResponse(c, err)
+		return false
+	}
+
+	return true
+}
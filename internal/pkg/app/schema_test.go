@@ -0,0 +1,199 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dotunj/bequest/config"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// SchemaTestSuite exercises the schema registry
+// over HTTP against the in-memory store.
+type SchemaTestSuite struct {
+	suite.Suite
+	DB     datastore.Store
+	Router http.Handler
+}
+
+func (s *SchemaTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+}
+
+func (s *SchemaTestSuite) SetupTest() {
+	cfg := &config.Config{
+		Database: config.Database{Store: config.MemoryStore},
+	}
+
+	app, err := NewApplication(cfg)
+	require.Nil(s.T(), err)
+
+	s.T().Cleanup(func() {
+		_ = app.Close(context.Background())
+	})
+
+	s.DB = app.DB
+	s.Router = app.Routes()
+}
+
+func (s *SchemaTestSuite) Test_CreateSchema_Versions() {
+	first := s.createSchema("billing.", `{"type": "object"}`)
+	second := s.createSchema("billing.", `{"type": "array"}`)
+
+	require.Equal(s.T(), 1, first.Version)
+	require.Equal(s.T(), 2, second.Version)
+	require.Equal(s.T(), datastore.DraftSchemaStatus, second.Status)
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, createRequest(http.MethodGet, "/api/v1/schemas?namespace=billing.", nil))
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var schemas []datastore.Schema
+	parseResponse(s.T(), w.Result(), &schemas)
+
+	require.Len(s.T(), schemas, 2)
+	require.JSONEq(s.T(), `{"type": "array"}`, string(schemas[1].Definition))
+}
+
+func (s *SchemaTestSuite) Test_CreateSchema_WithInvalidDefinition() {
+	body := strings.NewReader(`{"namespace": "billing.", "definition": {"type": "decimal"}}`)
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, createRequest(http.MethodPost, "/api/v1/schemas", body))
+
+	require.Equal(s.T(), http.StatusBadRequest, w.Code)
+}
+
+func (s *SchemaTestSuite) Test_ActivateSchema_EnforcesSchema() {
+	s.createAnswer("billing.limits", `{"limit": "10"}`, http.StatusCreated)
+
+	schema := s.createSchema("billing.", `{"type": "object", "properties": {"limit": {"type": "integer"}}}`)
+
+	// existing answers are tested before activation
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, createRequest(http.MethodPost, fmt.Sprintf("/api/v1/schemas/%s/test", schema.UID), nil))
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var result datastore.SchemaTestResult
+	parseResponse(s.T(), w.Result(), &result)
+
+	require.Equal(s.T(), 1, result.Checked)
+	require.Equal(s.T(), []datastore.SchemaViolation{{Key: "billing.limits", Path: "/limit", Message: "expected integer, but got string"}}, result.Violations)
+
+	w = httptest.NewRecorder()
+	s.Router.ServeHTTP(w, createRequest(http.MethodPost, fmt.Sprintf("/api/v1/schemas/%s/activate", schema.UID), nil))
+	require.Equal(s.T(), http.StatusUnprocessableEntity, w.Code)
+
+	s.updateAnswer("billing.limits", `{"limit": 10}`, http.StatusOK)
+
+	w = httptest.NewRecorder()
+	s.Router.ServeHTTP(w, createRequest(http.MethodPost, fmt.Sprintf("/api/v1/schemas/%s/activate", schema.UID), nil))
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	// values are now validated, listing every violation
+	w = s.updateAnswer("billing.limits", `{"limit": 1.5}`, http.StatusUnprocessableEntity)
+
+	var validationErr struct {
+		Namespace  string                      `json:"namespace"`
+		Version    int                         `json:"version"`
+		Violations []datastore.SchemaViolation `json:"violations"`
+	}
+	parseResponse(s.T(), w.Result(), &validationErr)
+
+	require.Equal(s.T(), "billing.", validationErr.Namespace)
+	require.Equal(s.T(), 1, validationErr.Version)
+	require.Equal(s.T(), []datastore.SchemaViolation{{Path: "/limit", Message: "expected integer, but got number"}}, validationErr.Violations)
+
+	s.createAnswer("billing.other", `"not an object"`, http.StatusUnprocessableEntity)
+	s.createAnswer("shipping.other", `"outside the namespace"`, http.StatusCreated)
+
+	w = httptest.NewRecorder()
+	s.Router.ServeHTTP(w, createRequest(http.MethodPost, fmt.Sprintf("/api/v1/schemas/%s/deactivate", schema.UID), nil))
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	s.createAnswer("billing.other", `"not an object"`, http.StatusCreated)
+}
+
+func (s *SchemaTestSuite) Test_ActivateSchema_WithForce() {
+	s.createAnswer("billing.limits", `"not an object"`, http.StatusCreated)
+
+	schema := s.createSchema("billing.", `{"type": "object"}`)
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, createRequest(http.MethodPost, fmt.Sprintf("/api/v1/schemas/%s/activate?force=true", schema.UID), nil))
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var activated datastore.Schema
+	parseResponse(s.T(), w.Result(), &activated)
+
+	require.Equal(s.T(), datastore.ActiveSchemaStatus, activated.Status)
+}
+
+func (s *SchemaTestSuite) Test_ActivateSchema_OnlyAppliesToItsTenant() {
+	schema := s.createSchema("billing.", `{"type": "object"}`)
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, createRequest(http.MethodPost, fmt.Sprintf("/api/v1/schemas/%s/activate", schema.UID), nil))
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	s.createAnswer("billing.limits", `"not an object"`, http.StatusUnprocessableEntity)
+
+	body := strings.NewReader(`{"key": "billing.limits", "value": "not an object"}`)
+	req := createRequest(http.MethodPost, "/api/v1/answers", body)
+	req.Header.Set(TenantHeader, "acme")
+
+	w = httptest.NewRecorder()
+	s.Router.ServeHTTP(w, req)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	req = createRequest(http.MethodGet, fmt.Sprintf("/api/v1/schemas/%s", schema.UID), nil)
+	req.Header.Set(TenantHeader, "acme")
+
+	w = httptest.NewRecorder()
+	s.Router.ServeHTTP(w, req)
+	require.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
+func TestSchemaTestSuite(t *testing.T) {
+	suite.Run(t, new(SchemaTestSuite))
+}
+
+func (s *SchemaTestSuite) createSchema(namespace, definition string) *datastore.Schema {
+	body := strings.NewReader(fmt.Sprintf(`{"namespace": "%s", "definition": %s}`, namespace, definition))
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, createRequest(http.MethodPost, "/api/v1/schemas", body))
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	var schema datastore.Schema
+	parseResponse(s.T(), w.Result(), &schema)
+
+	return &schema
+}
+
+func (s *SchemaTestSuite) createAnswer(key, value string, wantStatus int) *httptest.ResponseRecorder {
+	body := strings.NewReader(fmt.Sprintf(`{"key": "%s", "value": %s}`, key, value))
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, createRequest(http.MethodPost, "/api/v1/answers", body))
+	require.Equal(s.T(), wantStatus, w.Code)
+
+	return w
+}
+
+func (s *SchemaTestSuite) updateAnswer(key, value string, wantStatus int) *httptest.ResponseRecorder {
+	body := strings.NewReader(fmt.Sprintf(`{"value": %s}`, value))
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, createRequest(http.MethodPut, fmt.Sprintf("/api/v1/answers/%s", key), body))
+	require.Equal(s.T(), wantStatus, w.Code)
+
+	return w
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/dotunj/bequest/internal/pkg/auth"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/gin-gonic/gin"
+)
+
+// TenantHeader selects the tenant a request acts for. Requests
+// without it act for datastore.DefaultTenant.
+const TenantHeader = "X-Tenant-ID"
+
+const tenantContextKey = "tenant_id"
+
+// tenantPattern keeps tenant ids safe to use in cache keys and bucket
+// names, which is why colons and slashes aren't allowed.
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// resolveTenant stores the tenant of the request in the gin context.
+// Principals bound to a tenant can only act for it, those whose token
+// doesn't name one act for datastore.DefaultTenant, unless they are
+// admins of every tenant.
+func (a *Application) resolveTenant(c *gin.Context) {
+	tenantID := c.GetHeader(TenantHeader)
+
+	if principal, ok := auth.PrincipalFrom(c.Request.Context()); ok && (principal.TenantID != "" || !a.roleService.IsAdmin(principal)) {
+		bound := principal.TenantID
+		if bound == "" {
+			bound = datastore.DefaultTenant
+		}
+
+		if tenantID != "" && tenantID != bound {
+			a.errorResponse(c, http.StatusForbidden, "the tenant id doesn't match the bearer token")
+			c.Abort()
+			return
+		}
+
+		tenantID = bound
+	}
+
+	if tenantID == "" {
+		tenantID = datastore.DefaultTenant
+	}
+
+	if !tenantPattern.MatchString(tenantID) {
+		a.errorResponse(c, http.StatusBadRequest, "invalid tenant id, use up to 64 letters, digits, '.', '_' or '-'")
+		c.Abort()
+		return
+	}
+
+	c.Set(tenantContextKey, tenantID)
+	c.Next()
+}
+
+// tenantID returns the tenant resolved for the request.
+func tenantID(c *gin.Context) string {
+	return c.GetString(tenantContextKey)
+}
@@ -0,0 +1,169 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ExportAnswers streams the answers the principal can read, a record at
+// a time, so that exports of large tenants aren't held in memory.
+func (a *Application) ExportAnswers(c *gin.Context) {
+	var query datastore.ExportQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		a.errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	format, ok := transferFormat(query.Format, datastore.NDJSONFormat)
+	if !ok {
+		a.errorResponse(c, http.StatusBadRequest, "format must be ndjson or csv")
+		return
+	}
+
+	authorized, err := a.roleService.Authorizer(c.Request.Context(), tenantID(c), datastore.ReaderRole)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	writer := newRecordWriter(format, c.Writer, &query)
+
+	// the response starts with the first record, errors
+	// returned before it can still be responded with
+	started := false
+	start := func() {
+		if !started {
+			started = true
+			c.Header("Content-Type", transferContentType(format))
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"answers.%s\"", format))
+			c.Status(http.StatusOK)
+		}
+	}
+
+	err = a.transferService.ExportAnswers(c.Request.Context(), tenantID(c), &query, authorized, func(record *datastore.AnswerRecord) error {
+		start()
+		return writer.Write(record)
+	})
+	if err != nil && !started {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	if err != nil {
+		// the client finds the export cut short
+		logrus.WithError(err).Error("failed to export answers")
+		return
+	}
+
+	start()
+	if err := writer.Flush(); err != nil {
+		logrus.WithError(err).Error("failed to export answers")
+	}
+}
+
+// ImportAnswers imports the records of the request body. Clients
+// accepting application/x-ndjson are streamed the progress of the
+// import, a report per line, the last one being the final report.
+func (a *Application) ImportAnswers(c *gin.Context) {
+	var query datastore.ImportQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		a.errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// the format of the body defaults to its content type
+	fallback := datastore.NDJSONFormat
+	if c.ContentType() == csvContentType {
+		fallback = datastore.CSVFormat
+	}
+
+	format, ok := transferFormat(query.Format, fallback)
+	if !ok {
+		a.errorResponse(c, http.StatusBadRequest, "format must be ndjson or csv")
+		return
+	}
+
+	records, err := newRecordReader(format, c.Request.Body)
+	if err != nil {
+		a.errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	authorized, err := a.roleService.Authorizer(c.Request.Context(), tenantID(c), datastore.WriterRole)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	var progress func(report *datastore.ImportReport)
+	if strings.Contains(c.GetHeader("Accept"), ndjsonContentType) {
+		progress = func(report *datastore.ImportReport) {
+			if !c.Writer.Written() {
+				c.Header("Content-Type", ndjsonContentType)
+				c.Status(http.StatusOK)
+			}
+
+			if err := json.NewEncoder(c.Writer).Encode(report); err != nil {
+				logrus.WithError(err).Error("failed to report import progress")
+			}
+			c.Writer.Flush()
+		}
+	}
+
+	report, err := a.transferService.ImportAnswers(c.Request.Context(), tenantID(c), datastore.ConflictPolicy(query.OnConflict), records, authorized, progress)
+	if err != nil {
+		a.serviceErrorResponse(c, err)
+		return
+	}
+
+	if progress != nil {
+		progress(report)
+		return
+	}
+
+	a.successResponse(c, http.StatusOK, "answers imported successfully", report)
+}
+
+// customMethods routes the custom methods of a collection, such as
+// /answers:batch, by the suffix gin passes as the method parameter.
+func (a *Application) customMethods(handlers map[string]gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// gin takes /answers:batch for /answers followed by a parameter,
+		// which matches any suffix, the colon included
+		method := c.Param("method")
+		handler := handlers[strings.TrimPrefix(method, ":")]
+		if !strings.HasPrefix(method, ":") || handler == nil {
+			a.errorResponse(c, http.StatusNotFound, "page not found")
+			return
+		}
+
+		handler(c)
+	}
+}
+
+func transferFormat(format string, fallback datastore.TransferFormat) (datastore.TransferFormat, bool) {
+	switch datastore.TransferFormat(format) {
+	case "":
+		return fallback, true
+	case datastore.NDJSONFormat, datastore.CSVFormat:
+		return datastore.TransferFormat(format), true
+	default:
+		return "", false
+	}
+}
+
+func transferContentType(format datastore.TransferFormat) string {
+	if format == datastore.CSVFormat {
+		return csvContentType
+	}
+
+	return ndjsonContentType
+}
@@ -0,0 +1,300 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dotunj/bequest/config"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// TransferTestSuite exports answers over HTTP and imports them back,
+// into another tenant, against a sqlite store.
+type TransferTestSuite struct {
+	suite.Suite
+	Router http.Handler
+}
+
+func (s *TransferTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+}
+
+func (s *TransferTestSuite) SetupTest() {
+	cfg := &config.Config{
+		Database: config.Database{
+			Store:      config.SqliteStore,
+			SqlitePath: filepath.Join(s.T().TempDir(), "bequest.sqlite"),
+		},
+	}
+
+	app, err := NewApplication(cfg)
+	require.Nil(s.T(), err)
+
+	s.T().Cleanup(func() {
+		_ = app.Close(context.Background())
+	})
+
+	s.Router = app.Routes()
+
+	w := s.send(http.MethodPost, "/api/v1/answers", "", `{"key": "limits.daily", "value": 10}`, nil)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+
+	w = s.send(http.MethodPut, "/api/v1/answers/limits.daily", "", `{"value": 20}`, nil)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	w = s.send(http.MethodPost, "/api/v1/answers", "", `{"key": "greeting", "value": "hello, \"world\"", "ttl": 3600}`, nil)
+	require.Equal(s.T(), http.StatusCreated, w.Code)
+}
+
+func (s *TransferTestSuite) Test_ExportAnswers() {
+	w := s.send(http.MethodGet, "/api/v1/answers:export?history=true&events=true", "", "", nil)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+	require.Equal(s.T(), ndjsonContentType, w.Header().Get("Content-Type"))
+	require.Equal(s.T(), `attachment; filename="answers.ndjson"`, w.Header().Get("Content-Disposition"))
+
+	records := s.records(w.Body)
+	require.Len(s.T(), records, 2)
+
+	// answers are exported in key order
+	require.Equal(s.T(), "greeting", records[0].Key)
+	require.Equal(s.T(), datastore.StringValue, records[0].Type)
+	require.NotZero(s.T(), records[0].ExpiresAt)
+
+	require.Equal(s.T(), "limits.daily", records[1].Key)
+	require.JSONEq(s.T(), `20`, string(records[1].Value))
+	require.Equal(s.T(), int64(2), records[1].Version)
+	require.Len(s.T(), records[1].Versions, 2)
+	require.JSONEq(s.T(), `10`, string(records[1].Versions[0].Value))
+	require.Len(s.T(), records[1].Events, 2)
+	require.Equal(s.T(), datastore.CreateEvent, records[1].Events[0].Type)
+
+	w = s.send(http.MethodGet, "/api/v1/answers:export?format=csv&prefix=limits.", "", "", nil)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+	require.Equal(s.T(), csvContentType, w.Header().Get("Content-Type"))
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Equal(s.T(), "key,type,value,version,created_at,updated_at,expires_at", lines[0])
+	require.Len(s.T(), lines, 2)
+	require.True(s.T(), strings.HasPrefix(lines[1], "limits.daily,number,20,2,"))
+
+	// the header is written even when nothing is exported
+	w = s.send(http.MethodGet, "/api/v1/answers:export?format=csv&prefix=missing.", "", "", nil)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+	require.Equal(s.T(), "key,type,value,version,created_at,updated_at,expires_at\n", w.Body.String())
+}
+
+func (s *TransferTestSuite) Test_ExportAnswers_WithInvalidQuery() {
+	w := s.send(http.MethodGet, "/api/v1/answers:export?format=xml", "", "", nil)
+	require.Equal(s.T(), http.StatusBadRequest, w.Code)
+
+	w = s.send(http.MethodGet, "/api/v1/answers:export?regex=(", "", "", nil)
+	require.Equal(s.T(), http.StatusBadRequest, w.Code)
+
+	w = s.send(http.MethodGet, "/api/v1/answers:batch", "", "", nil)
+	require.Equal(s.T(), http.StatusNotFound, w.Code)
+}
+
+func (s *TransferTestSuite) Test_ImportAnswers_RoundTrip() {
+	for _, format := range []datastore.TransferFormat{datastore.NDJSONFormat, datastore.CSVFormat} {
+		tenant := fmt.Sprintf("imported-%s", format)
+
+		w := s.send(http.MethodGet, fmt.Sprintf("/api/v1/answers:export?format=%s&history=true&events=true", format), "", "", nil)
+		require.Equal(s.T(), http.StatusOK, w.Code)
+		exported := w.Body.String()
+
+		w = s.send(http.MethodPost, "/api/v1/answers:import", tenant, exported, map[string]string{"Content-Type": transferContentType(format)})
+		require.Equal(s.T(), http.StatusOK, w.Code, exported)
+
+		var report datastore.ImportReport
+		parseResponse(s.T(), w.Result(), &report)
+
+		require.True(s.T(), report.Done, format)
+		require.Equal(s.T(), 2, report.Records, format)
+		require.Equal(s.T(), 2, report.Created, format)
+		require.Empty(s.T(), report.Failures, format)
+
+		// the answers, their versions and their history are the same
+		w = s.send(http.MethodGet, "/api/v1/answers/greeting", tenant, "", nil)
+		require.Equal(s.T(), http.StatusOK, w.Code)
+
+		var answer datastore.AnswerResponse
+		parseResponse(s.T(), w.Result(), &answer)
+		require.Equal(s.T(), `hello, "world"`, answer.Value)
+		require.NotZero(s.T(), answer.ExpiresAt)
+
+		w = s.send(http.MethodGet, "/api/v1/answers/limits.daily/versions", tenant, "", nil)
+		require.Equal(s.T(), http.StatusOK, w.Code)
+		require.Contains(s.T(), w.Body.String(), `"version":2`)
+
+		history := s.history(tenant, "limits.daily")
+		require.Len(s.T(), history, 3, format)
+		require.Equal(s.T(), datastore.ImportEvent, history[0].Type)
+		require.Equal(s.T(), datastore.UpdateEvent, history[1].Type)
+		require.Equal(s.T(), datastore.CreateEvent, history[2].Type)
+	}
+}
+
+func (s *TransferTestSuite) Test_ImportAnswers_WithConflictPolicy() {
+	body := `{"key": "limits.daily", "value": 30}
+{"key": "limits.weekly", "value": 70}
+`
+
+	w := s.send(http.MethodPost, "/api/v1/answers:import", "", body, nil)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var report datastore.ImportReport
+	parseResponse(s.T(), w.Result(), &report)
+	require.Equal(s.T(), 1, report.Skipped)
+	require.Equal(s.T(), 1, report.Created)
+	require.Equal(s.T(), float64(20), s.value("limits.daily"))
+
+	w = s.send(http.MethodPost, "/api/v1/answers:import?on_conflict=fail", "", body, nil)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	parseResponse(s.T(), w.Result(), &report)
+	require.False(s.T(), report.Done)
+	require.Equal(s.T(), 1, report.Records)
+	require.Equal(s.T(), http.StatusConflict, report.Failures[0].Status)
+	require.NotEmpty(s.T(), report.Error)
+
+	w = s.send(http.MethodPost, "/api/v1/answers:import?on_conflict=overwrite", "", body, nil)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	parseResponse(s.T(), w.Result(), &report)
+	require.True(s.T(), report.Done)
+	require.Equal(s.T(), 2, report.Overwritten)
+	require.Equal(s.T(), float64(30), s.value("limits.daily"))
+
+	// the overwritten answer is deleted, then imported, newest first
+	require.Eventually(s.T(), func() bool {
+		history := s.history("", "limits.daily")
+		return len(history) == 4 && history[0].Type == datastore.ImportEvent && history[1].Type == datastore.DeleteEvent
+	}, time.Second, 10*time.Millisecond)
+
+	w = s.send(http.MethodPost, "/api/v1/answers:import?on_conflict=merge", "", body, nil)
+	require.Equal(s.T(), http.StatusBadRequest, w.Code)
+}
+
+func (s *TransferTestSuite) Test_ImportAnswers_WithInvalidRecords() {
+	body := `key,type,value
+limits.weekly,number,70
+limits.monthly,number,many
+,string,no key
+"limits.yearly,number,365
+`
+
+	w := s.send(http.MethodPost, "/api/v1/answers:import?format=csv", "", body, nil)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var report datastore.ImportReport
+	parseResponse(s.T(), w.Result(), &report)
+
+	require.True(s.T(), report.Done)
+	require.Equal(s.T(), 4, report.Records)
+	require.Equal(s.T(), 1, report.Created)
+	require.Equal(s.T(), 3, report.Failed)
+
+	for i, failure := range report.Failures {
+		require.Equal(s.T(), http.StatusBadRequest, failure.Status, i)
+		require.Equal(s.T(), i+2, failure.Record, i)
+	}
+
+	w = s.send(http.MethodPost, "/api/v1/answers:import?format=csv", "", "value\n1\n", nil)
+	require.Equal(s.T(), http.StatusBadRequest, w.Code)
+}
+
+func (s *TransferTestSuite) Test_ImportAnswers_StreamsProgress() {
+	var body strings.Builder
+	for i := 0; i < 501; i++ {
+		fmt.Fprintf(&body, "{\"key\": \"imported.%d\", \"value\": %d}\n", i, i)
+	}
+
+	w := s.send(http.MethodPost, "/api/v1/answers:import", "", body.String(), map[string]string{"Accept": ndjsonContentType})
+	require.Equal(s.T(), http.StatusOK, w.Code)
+	require.Equal(s.T(), ndjsonContentType, w.Header().Get("Content-Type"))
+
+	var reports []datastore.ImportReport
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var report datastore.ImportReport
+		require.Nil(s.T(), json.Unmarshal(scanner.Bytes(), &report))
+		reports = append(reports, report)
+	}
+
+	require.Len(s.T(), reports, 2)
+	require.Equal(s.T(), 500, reports[0].Records)
+	require.False(s.T(), reports[0].Done)
+	require.Equal(s.T(), 501, reports[1].Created)
+	require.True(s.T(), reports[1].Done)
+}
+
+func TestTransferTestSuite(t *testing.T) {
+	suite.Run(t, new(TransferTestSuite))
+}
+
+func (s *TransferTestSuite) records(r io.Reader) []datastore.AnswerRecord {
+	var records []datastore.AnswerRecord
+
+	decoder := json.NewDecoder(r)
+	for decoder.More() {
+		var record datastore.AnswerRecord
+		require.Nil(s.T(), decoder.Decode(&record))
+		records = append(records, record)
+	}
+
+	return records
+}
+
+func (s *TransferTestSuite) value(key string) interface{} {
+	w := s.send(http.MethodGet, "/api/v1/answers/"+key, "", "", nil)
+	require.Equal(s.T(), http.StatusOK, w.Code)
+
+	var answer datastore.AnswerResponse
+	parseResponse(s.T(), w.Result(), &answer)
+	return answer.Value
+}
+
+func (s *TransferTestSuite) history(tenant, key string) []datastore.Event {
+	w := s.send(http.MethodGet, fmt.Sprintf("/api/v1/answers/%s/history", key), tenant, "", nil)
+	if w.Code != http.StatusOK {
+		return nil
+	}
+
+	var history struct {
+		Content []datastore.Event `json:"content"`
+	}
+	parseResponse(s.T(), w.Result(), &history)
+	return history.Content
+}
+
+func (s *TransferTestSuite) send(method, url, tenant, body string, headers map[string]string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req := createRequest(method, url, reader)
+	if tenant != "" {
+		req.Header.Set(TenantHeader, tenant)
+	}
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// apiKeyPrefix starts every api key, so that leaked
+// keys are easy to recognize in logs and repositories.
+const apiKeyPrefix = "bq_"
+
+// NewAPIKey returns a random api key along with its prefix, which
+// identifies the key and can be shown, unlike the key itself.
+func NewAPIKey() (key, prefix string, err error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	prefix = apiKeyPrefix + hex.EncodeToString(id)
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(secret), prefix, nil
+}
+
+// APIKeyPrefix returns the prefix of key, or false when key
+// isn't shaped like the keys returned by NewAPIKey.
+func APIKeyPrefix(key string) (string, bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", false
+	}
+
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), "_")
+	if !ok || len(prefix) != 12 || secret == "" {
+		return "", false
+	}
+
+	return apiKeyPrefix + prefix, true
+}
+
+// HashAPIKey returns the hash stored in place of key. Keys are random,
+// so a plain SHA-256 is enough to make a leaked hash useless.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// MatchAPIKey reports whether key hashes to hash, in constant time.
+func MatchAPIKey(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKey(key)), []byte(hash)) == 1
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	key, prefix, err := NewAPIKey()
+	require.Nil(t, err)
+	require.Regexp(t, `^bq_[0-9a-f]{12}_[A-Za-z0-9_-]{43}$`, key)
+
+	parsed, ok := APIKeyPrefix(key)
+	require.True(t, ok)
+	require.Equal(t, prefix, parsed)
+
+	other, _, err := NewAPIKey()
+	require.Nil(t, err)
+	require.NotEqual(t, key, other)
+
+	hash := HashAPIKey(key)
+	require.NotContains(t, hash, key)
+	require.True(t, MatchAPIKey(key, hash))
+	require.False(t, MatchAPIKey(other, hash))
+}
+
+func TestAPIKeyPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		ok   bool
+	}{
+		{name: "should_parse_key", key: "bq_0123456789ab_secret", ok: true},
+		{name: "should_reject_missing_secret", key: "bq_0123456789ab_"},
+		{name: "should_reject_short_prefix", key: "bq_0123_secret"},
+		{name: "should_reject_other_scheme", key: "sk_0123456789ab_secret"},
+		{name: "should_reject_empty_key", key: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			prefix, ok := APIKeyPrefix(tc.key)
+			require.Equal(t, tc.ok, ok)
+			if ok {
+				require.Equal(t, "bq_0123456789ab", prefix)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrKeyNotFound = errors.New("signing key not found")
+
+// minRefreshInterval bounds how often an unknown key id can make
+// the key set fetch its URL again, so that tokens signed with
+// made up key ids can't be used to flood the identity provider.
+const minRefreshInterval = time.Minute
+
+// KeySet holds the public keys of a JSON Web Key Set, read from a
+// file or fetched from a URL. Keys fetched from a URL are refreshed
+// once they are older than the refresh interval, or when a token is
+// signed with a key the set doesn't know about yet.
+type KeySet struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewFileKeySet reads the key set stored in file.
+func NewFileKeySet(file string) (*KeySet, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := parseKeySet(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	return &KeySet{keys: keys}, nil
+}
+
+// NewURLKeySet returns a key set fetched from url. The first fetch
+// happens right away, a failure is logged and retried on first use.
+func NewURLKeySet(ctx context.Context, url string, refresh time.Duration) *KeySet {
+	s := &KeySet{
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		keys:    make(map[string]crypto.PublicKey),
+	}
+
+	if err := s.fetch(ctx); err != nil {
+		logrus.WithError(err).Warnf("failed to fetch the key set from %s", url)
+	}
+
+	return s
+}
+
+// Key returns the key named kid. When kid is empty, the only key of
+// the set is returned, as tokens don't need to name it.
+func (s *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	key, fresh := s.lookup(kid)
+	if key != nil && fresh {
+		return key, nil
+	}
+
+	if s.url == "" || !s.shouldFetch(key == nil) {
+		if key == nil {
+			return nil, ErrKeyNotFound
+		}
+		return key, nil
+	}
+
+	if err := s.fetch(ctx); err != nil {
+		logrus.WithError(err).Warnf("failed to refresh the key set from %s", s.url)
+
+		// stale keys are still better than none
+		if key != nil {
+			return key, nil
+		}
+		return nil, ErrKeyNotFound
+	}
+
+	if key, _ = s.lookup(kid); key == nil {
+		return nil, ErrKeyNotFound
+	}
+
+	return key, nil
+}
+
+// lookup returns the key named kid, and whether the set is fresh.
+func (s *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	fresh := s.url == "" || time.Since(s.fetchedAt) < s.refresh
+
+	if kid == "" {
+		if len(s.keys) != 1 {
+			return nil, fresh
+		}
+
+		for _, key := range s.keys {
+			return key, fresh
+		}
+	}
+
+	return s.keys[kid], fresh
+}
+
+// shouldFetch reports whether the set may be fetched again, which
+// happens once it is stale, or sooner when a key is missing.
+func (s *KeySet) shouldFetch(missing bool) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	age := time.Since(s.fetchedAt)
+	return age >= s.refresh || (missing && age >= minRefreshInterval)
+}
+
+func (s *KeySet) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return err
+	}
+
+	// failed fetches count too, so an unreachable
+	// provider isn't called on every request
+	s.mu.Lock()
+	s.fetchedAt = time.Now()
+	s.mu.Unlock()
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseKeySet(raw)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	return nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC keys
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseKeySet returns the signing keys of a key set by id. Keys
+// of unsupported types, or meant for encryption, are skipped.
+func parseKeySet(raw []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("invalid key set: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		var err error
+
+		switch jwk.Kty {
+		case "RSA":
+			key, err = jwk.rsaKey()
+		case "EC":
+			key, err = jwk.ecKey()
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", jwk.Kid, err)
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k jsonWebKey) rsaKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, errors.New("exponent is too large")
+	}
+
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k jsonWebKey) ecKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	if !curve.IsOnCurve(x, y) {
+		return nil, errors.New("point isn't on the curve")
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) == 0 {
+		return nil, errors.New("missing value")
+	}
+
+	return new(big.Int).SetBytes(raw), nil
+}
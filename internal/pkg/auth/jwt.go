@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// JWTOptions configures how bearer tokens are verified. At least one
+// of Secret and Keys must be set.
+type JWTOptions struct {
+	// Secret verifies HS256 tokens.
+	Secret []byte
+
+	// Keys verifies RS256 and ES256 tokens.
+	Keys *KeySet
+
+	// Issuer and Audience, when set, must match the
+	// iss and aud claims of the tokens.
+	Issuer   string
+	Audience string
+}
+
+// JWTVerifier authenticates callers from their bearer tokens.
+type JWTVerifier struct {
+	opts   JWTOptions
+	parser *jwt.Parser
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	TenantID string   `json:"tenant_id,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+func NewJWTVerifier(opts JWTOptions) (*JWTVerifier, error) {
+	var methods []string
+	if len(opts.Secret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	if opts.Keys != nil {
+		methods = append(methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+	}
+
+	if len(methods) == 0 {
+		return nil, errors.New("jwt: a secret or a key set is required")
+	}
+
+	return &JWTVerifier{
+		opts:   opts,
+		parser: jwt.NewParser(jwt.WithValidMethods(methods)),
+	}, nil
+}
+
+// Verify checks the signature and the claims of token, and returns
+// the principal it was issued to.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	var c claims
+
+	_, err := v.parser.ParseWithClaims(token, &c, func(t *jwt.Token) (interface{}, error) {
+		return v.key(ctx, t)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if v.opts.Issuer != "" && !c.VerifyIssuer(v.opts.Issuer, true) {
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+
+	if v.opts.Audience != "" && !c.VerifyAudience(v.opts.Audience, true) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+
+	if c.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+
+	return &Principal{Subject: c.Subject, TenantID: c.TenantID, Groups: c.Groups}, nil
+}
+
+func (v *JWTVerifier) key(ctx context.Context, t *jwt.Token) (interface{}, error) {
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+		return v.opts.Secret, nil
+	}
+
+	kid, _ := t.Header["kid"].(string)
+	return v.opts.Keys.Key(ctx, kid)
+}
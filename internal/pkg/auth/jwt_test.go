@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTVerifier_HS256(t *testing.T) {
+	secret := []byte("some-secret")
+
+	verifier, err := NewJWTVerifier(JWTOptions{Secret: secret, Issuer: "some-issuer", Audience: "bequest"})
+	require.Nil(t, err)
+
+	valid := jwt.MapClaims{
+		"sub":       "some-user",
+		"tenant_id": "some-tenant",
+		"groups":    []string{"billing"},
+		"iss":       "some-issuer",
+		"aud":       "bequest",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{
+			name:  "should_accept_valid_token",
+			token: sign(t, jwt.SigningMethodHS256, secret, valid),
+		},
+		{
+			name:    "should_reject_expired_token",
+			token:   sign(t, jwt.SigningMethodHS256, secret, with(valid, "exp", time.Now().Add(-time.Minute).Unix())),
+			wantErr: true,
+		},
+		{
+			name:    "should_reject_wrong_secret",
+			token:   sign(t, jwt.SigningMethodHS256, []byte("other-secret"), valid),
+			wantErr: true,
+		},
+		{
+			name:    "should_reject_unsigned_token",
+			token:   sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, valid),
+			wantErr: true,
+		},
+		{
+			name:    "should_reject_other_issuer",
+			token:   sign(t, jwt.SigningMethodHS256, secret, with(valid, "iss", "other-issuer")),
+			wantErr: true,
+		},
+		{
+			name:    "should_reject_other_audience",
+			token:   sign(t, jwt.SigningMethodHS256, secret, with(valid, "aud", "other-audience")),
+			wantErr: true,
+		},
+		{
+			name:    "should_reject_missing_subject",
+			token:   sign(t, jwt.SigningMethodHS256, secret, with(valid, "sub", "")),
+			wantErr: true,
+		},
+		{
+			name:    "should_reject_malformed_token",
+			token:   "not-a-token",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			principal, err := verifier.Verify(context.Background(), tc.token)
+
+			if tc.wantErr {
+				require.ErrorIs(t, err, ErrInvalidToken)
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, &Principal{Subject: "some-user", TenantID: "some-tenant", Groups: []string{"billing"}}, principal)
+		})
+	}
+}
+
+func TestJWTVerifier_RS256_FromFile(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	require.Nil(t, os.WriteFile(file, keySet(t, map[string]crypto.PublicKey{"rsa-1": &key.PublicKey}), 0o600))
+
+	keys, err := NewFileKeySet(file)
+	require.Nil(t, err)
+
+	verifier, err := NewJWTVerifier(JWTOptions{Keys: keys})
+	require.Nil(t, err)
+
+	claims := jwt.MapClaims{"sub": "some-user"}
+
+	principal, err := verifier.Verify(context.Background(), signWithKid(t, jwt.SigningMethodRS256, key, "rsa-1", claims))
+	require.Nil(t, err)
+	require.Equal(t, "some-user", principal.Subject)
+
+	// the only key of a set doesn't need to be named
+	_, err = verifier.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, key, claims))
+	require.Nil(t, err)
+
+	_, err = verifier.Verify(context.Background(), signWithKid(t, jwt.SigningMethodRS256, key, "rsa-2", claims))
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	// a token signed with the public key as an HMAC secret
+	// must not pass for an RS256 token
+	_, err = verifier.Verify(context.Background(), sign(t, jwt.SigningMethodHS256, []byte("rsa-1"), claims))
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestJWTVerifier_ES256_FromURL(t *testing.T) {
+	first, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	second, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	var rotated, fetches int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+
+		keys := map[string]crypto.PublicKey{"ec-1": &first.PublicKey}
+		if atomic.LoadInt32(&rotated) == 1 {
+			keys = map[string]crypto.PublicKey{"ec-2": &second.PublicKey}
+		}
+
+		_, _ = w.Write(keySet(t, keys))
+	}))
+	defer server.Close()
+
+	keys := NewURLKeySet(context.Background(), server.URL, time.Hour)
+
+	verifier, err := NewJWTVerifier(JWTOptions{Keys: keys})
+	require.Nil(t, err)
+
+	claims := jwt.MapClaims{"sub": "some-user"}
+
+	_, err = verifier.Verify(context.Background(), signWithKid(t, jwt.SigningMethodES256, first, "ec-1", claims))
+	require.Nil(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	// an unknown key id doesn't fetch the set again right away
+	atomic.StoreInt32(&rotated, 1)
+
+	_, err = verifier.Verify(context.Background(), signWithKid(t, jwt.SigningMethodES256, second, "ec-2", claims))
+	require.ErrorIs(t, err, ErrInvalidToken)
+	require.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	// but it does once the set is old enough
+	keys.mu.Lock()
+	keys.fetchedAt = time.Now().Add(-minRefreshInterval)
+	keys.mu.Unlock()
+
+	_, err = verifier.Verify(context.Background(), signWithKid(t, jwt.SigningMethodES256, second, "ec-2", claims))
+	require.Nil(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+
+	_, err = verifier.Verify(context.Background(), signWithKid(t, jwt.SigningMethodES256, first, "ec-1", claims))
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestNewJWTVerifier_RequiresAKey(t *testing.T) {
+	_, err := NewJWTVerifier(JWTOptions{Issuer: "some-issuer"})
+	require.NotNil(t, err)
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	return signWithKid(t, method, key, "", claims)
+}
+
+func signWithKid(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	require.Nil(t, err)
+
+	return signed
+}
+
+func with(claims jwt.MapClaims, name string, value interface{}) jwt.MapClaims {
+	copied := jwt.MapClaims{}
+	for k, v := range claims {
+		copied[k] = v
+	}
+
+	copied[name] = value
+	return copied
+}
+
+func keySet(t *testing.T, keys map[string]crypto.PublicKey) []byte {
+	encode := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+
+	for kid, key := range keys {
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, jsonWebKey{Kty: "RSA", Kid: kid, Use: "sig", N: encode(key.N), E: encode(big.NewInt(int64(key.E)))})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, jsonWebKey{Kty: "EC", Kid: kid, Crv: "P-256", X: encode(key.X), Y: encode(key.Y)})
+		}
+	}
+
+	raw, err := json.Marshal(set)
+	require.Nil(t, err)
+
+	return raw
+}
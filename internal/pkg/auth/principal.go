@@ -0,0 +1,77 @@
+// Package auth authenticates the callers of the API.
+package auth
+
+import "context"
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// Subject identifies the caller, it is the sub claim of a
+	// token, or api_key:<uid> for api keys.
+	Subject string
+
+	// TenantID is the tenant the caller belongs to. It is empty
+	// when the token doesn't name one, the caller then acts for the
+	// default tenant, or for that of the request header when it is
+	// an admin of every tenant.
+	TenantID string
+
+	// Scopes are the scopes the principal is limited to,
+	// it is nil when the principal isn't restricted.
+	Scopes []string
+
+	// Groups are the groups the caller belongs to, taken from
+	// the groups claim of a token.
+	Groups []string
+}
+
+// Subjects returns the subjects roles can be bound to for the
+// principal, its own followed by group:<name> for its groups.
+func (p *Principal) Subjects() []string {
+	subjects := make([]string, 0, len(p.Groups)+1)
+	subjects = append(subjects, p.Subject)
+
+	for _, group := range p.Groups {
+		subjects = append(subjects, "group:"+group)
+	}
+
+	return subjects
+}
+
+// HasScope reports whether the principal may act within scope.
+func (p *Principal) HasScope(scope string) bool {
+	if p.Scopes == nil {
+		return true
+	}
+
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying principal.
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal carried by ctx, if any.
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// Actor returns the subject of the principal carried by ctx, or an
+// empty string for anonymous requests. Services record it as the
+// author of the changes they make.
+func Actor(ctx context.Context) string {
+	if principal, ok := PrincipalFrom(ctx); ok {
+		return principal.Subject
+	}
+
+	return ""
+}
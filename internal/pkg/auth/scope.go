@@ -0,0 +1,28 @@
+package auth
+
+// Scopes restrict what a principal can do. Principals authenticated
+// with a bearer token aren't restricted, api keys are limited to the
+// scopes they were issued with.
+const (
+	ScopeAnswersRead  = "answers:read"
+	ScopeAnswersWrite = "answers:write"
+	ScopeSchemasRead  = "schemas:read"
+	ScopeSchemasWrite = "schemas:write"
+	ScopeAPIKeys      = "api_keys:manage"
+	ScopeRoles        = "roles:manage"
+	ScopeRetention    = "retention:manage"
+)
+
+// Scopes lists every scope, in the order they are documented.
+var Scopes = []string{ScopeAnswersRead, ScopeAnswersWrite, ScopeSchemasRead, ScopeSchemasWrite, ScopeAPIKeys, ScopeRoles, ScopeRetention}
+
+// IsScope reports whether scope is one of Scopes.
+func IsScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
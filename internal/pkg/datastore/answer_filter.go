@@ -0,0 +1,99 @@
+package datastore
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// NewAnswerCursor returns the position of answer in
+// a listing of answers sorted by sortBy.
+func NewAnswerCursor(answer *Answer, sortBy AnswerSort) *AnswerCursor {
+	cursor := &AnswerCursor{Key: answer.Key, Generation: answer.Generation}
+
+	switch sortBy {
+	case CreatedAtAnswerSort:
+		cursor.Time = answer.CreatedAt
+	case UpdatedAtAnswerSort:
+		cursor.Time = answer.UpdatedAt
+	}
+
+	return cursor
+}
+
+// compare returns -1, 0 or 1 as c is sorted before, with
+// or after other in a listing sorted in ascending order.
+func (c *AnswerCursor) compare(other *AnswerCursor) int {
+	switch {
+	case c.Time != other.Time:
+		return sign(int64(c.Time) - int64(other.Time))
+	case c.Key != other.Key:
+		return strings.Compare(c.Key, other.Key)
+	default:
+		return sign(c.Generation - other.Generation)
+	}
+}
+
+// Apply returns the answers selected by the filter, in order and up to
+// its limit. It serves the backends that can't run the filter as a query.
+func (f AnswerFilter) Apply(answers []Answer) ([]Answer, error) {
+	var pattern *regexp.Regexp
+	if f.Regex != "" {
+		var err error
+		if pattern, err = regexp.Compile(f.Regex); err != nil {
+			return nil, err
+		}
+	}
+
+	status := f.Status
+	if status == "" {
+		status = ActiveDocumentStatus
+	}
+
+	selected := make([]Answer, 0)
+	for _, answer := range answers {
+		switch {
+		case answer.DocumentStatus != status,
+			!strings.HasPrefix(answer.Key, f.Prefix),
+			pattern != nil && !pattern.MatchString(answer.Key),
+			f.UpdatedSince != 0 && answer.UpdatedAt < f.UpdatedSince,
+			f.CreatedBefore != 0 && answer.CreatedAt >= f.CreatedBefore,
+			f.ExpiresAfter != 0 && answer.ExpiresAt != 0 && answer.ExpiresAt <= f.ExpiresAfter,
+			f.After != nil && !f.after(&answer, f.After):
+			continue
+		}
+
+		selected = append(selected, answer)
+	}
+
+	sort.Slice(selected, func(i, j int) bool {
+		return f.after(&selected[j], NewAnswerCursor(&selected[i], f.SortBy))
+	})
+
+	if f.Limit > 0 && len(selected) > f.Limit {
+		selected = selected[:f.Limit]
+	}
+
+	return selected, nil
+}
+
+// after reports whether answer is sorted after cursor.
+func (f AnswerFilter) after(answer *Answer, cursor *AnswerCursor) bool {
+	c := NewAnswerCursor(answer, f.SortBy).compare(cursor)
+	if f.Descending {
+		return c < 0
+	}
+
+	return c > 0
+}
+
+func sign(n int64) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,602 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AnswerRepo struct {
+	db *bbolt.DB
+}
+
+func NewAnswerRepo(db *bbolt.DB) *AnswerRepo {
+	return &AnswerRepo{db: db}
+}
+
+func (a *AnswerRepo) Create(ctx context.Context, answer *datastore.Answer) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		b, err := statusBucket(tx, answer.TenantID, answer.DocumentStatus)
+		if err != nil {
+			return err
+		}
+
+		if b.Get(answerKey(answer)) != nil {
+			return datastore.ErrDuplicateKey
+		}
+
+		if err := putOutbox(tx, answer.Outbox); err != nil {
+			return err
+		}
+
+		return putAnswer(b, answer)
+	})
+}
+
+func (a *AnswerRepo) FindByKey(ctx context.Context, tenantID, key string) (*datastore.Answer, error) {
+	answer := &datastore.Answer{}
+
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		b := activeView(tx, tenantID)
+		if b == nil {
+			return datastore.ErrAnswerNotFound
+		}
+
+		return getAnswer(b, key, answer)
+	})
+
+	return answer, err
+}
+
+func (a *AnswerRepo) FindManyByPrefix(ctx context.Context, tenantID, prefix string) ([]datastore.Answer, error) {
+	answers := make([]datastore.Answer, 0)
+
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		b := activeView(tx, tenantID)
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			var answer datastore.Answer
+			if err := decodeAnswer(v, &answer); err != nil {
+				return err
+			}
+
+			answers = append(answers, answer)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return answers, nil
+}
+
+// FindMany seeks to the prefix of the filter in the bucket of its
+// status, keys of deleted answers starting with the key too.
+func (a *AnswerRepo) FindMany(ctx context.Context, tenantID string, filter datastore.AnswerFilter) ([]datastore.Answer, error) {
+	answers := make([]datastore.Answer, 0)
+
+	status := filter.Status
+	if status == "" {
+		status = datastore.ActiveDocumentStatus
+	}
+
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		tenant := tenantView(tx, AnswerBucket, tenantID)
+		if tenant == nil {
+			return nil
+		}
+
+		b := tenant.Bucket([]byte(status))
+		if b == nil {
+			return nil
+		}
+
+		prefix := []byte(filter.Prefix)
+
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var answer datastore.Answer
+			if err := decodeAnswer(v, &answer); err != nil {
+				return err
+			}
+
+			answers = append(answers, answer)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return filter.Apply(answers)
+}
+
+func (a *AnswerRepo) Search(ctx context.Context, tenantID string, terms []string, limit int) ([]datastore.ScoredAnswer, error) {
+	ranking := datastore.NewSearchRanking(terms, limit)
+
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		b := activeView(tx, tenantID)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(_, v []byte) error {
+			var answer datastore.Answer
+			if err := decodeAnswer(v, &answer); err != nil {
+				return err
+			}
+
+			ranking.Add(answer)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ranking.Answers(), nil
+}
+
+func (a *AnswerRepo) Update(ctx context.Context, answer *datastore.Answer, value *datastore.Value, version int64) (*datastore.Answer, error) {
+	updated := &datastore.Answer{}
+
+	err := a.db.Update(func(tx *bbolt.Tx) error {
+		b, err := statusBucket(tx, answer.TenantID, datastore.ActiveDocumentStatus)
+		if err != nil {
+			return err
+		}
+
+		err = getAnswer(b, answer.Key, updated)
+		if err := checkVersion(updated, err, answer, version); err != nil {
+			return err
+		}
+
+		if err != nil {
+			return err
+		}
+
+		updated.Version++
+		updated.Values = append(updated.Values, *value)
+		updated.Values[len(updated.Values)-1].Version = updated.Version
+		updated.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+		updated.ExpiresAt = answer.ExpiresAt
+
+		if err := putOutbox(tx, answer.Outbox); err != nil {
+			return err
+		}
+
+		return putAnswer(b, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (a *AnswerRepo) Delete(ctx context.Context, answer *datastore.Answer, version int64) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		active, err := statusBucket(tx, answer.TenantID, datastore.ActiveDocumentStatus)
+		if err != nil {
+			return err
+		}
+
+		existing := &datastore.Answer{}
+		err = getAnswer(active, answer.Key, existing)
+		if err := checkVersion(existing, err, answer, version); err != nil {
+			return err
+		}
+
+		if err == datastore.ErrAnswerNotFound {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		deleted, err := statusBucket(tx, answer.TenantID, datastore.DeletedDocumentStatus)
+		if err != nil {
+			return err
+		}
+
+		existing.DocumentStatus = datastore.DeletedDocumentStatus
+		existing.DeletedAt = primitive.NewDateTimeFromTime(time.Now())
+
+		if err := active.Delete([]byte(answer.Key)); err != nil {
+			return err
+		}
+
+		if err := putOutbox(tx, answer.Outbox); err != nil {
+			return err
+		}
+
+		return putAnswer(deleted, existing)
+	})
+}
+
+func (a *AnswerRepo) FindDeleted(ctx context.Context, tenantID, key string) ([]datastore.Answer, error) {
+	answers := make([]datastore.Answer, 0)
+
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		tenant := tenantView(tx, AnswerBucket, tenantID)
+		if tenant == nil {
+			return nil
+		}
+
+		b := tenant.Bucket([]byte(datastore.DeletedDocumentStatus))
+		if b == nil {
+			return nil
+		}
+
+		var prefix []byte
+		if key != "" {
+			prefix = deletedKey(key, "")
+		}
+
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var answer datastore.Answer
+			if err := decodeAnswer(v, &answer); err != nil {
+				return err
+			}
+
+			answers = append(answers, answer)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the cursor walks keys in order, and the answers
+	// of each key in the order of their uids
+	sort.SliceStable(answers, func(i, j int) bool {
+		if answers[i].Key != answers[j].Key {
+			return answers[i].Key < answers[j].Key
+		}
+
+		return answers[i].DeletedAt > answers[j].DeletedAt
+	})
+
+	return answers, nil
+}
+
+func (a *AnswerRepo) Restore(ctx context.Context, answer *datastore.Answer) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		deleted, err := statusBucket(tx, answer.TenantID, datastore.DeletedDocumentStatus)
+		if err != nil {
+			return err
+		}
+
+		k := deletedKey(answer.Key, answer.UID)
+
+		raw := deleted.Get(k)
+		if raw == nil {
+			return datastore.ErrAnswerNotFound
+		}
+
+		existing := &datastore.Answer{}
+		if err := decodeAnswer(raw, existing); err != nil {
+			return err
+		}
+
+		active, err := statusBucket(tx, answer.TenantID, datastore.ActiveDocumentStatus)
+		if err != nil {
+			return err
+		}
+
+		if active.Get([]byte(answer.Key)) != nil {
+			return datastore.ErrDuplicateKey
+		}
+
+		existing.DocumentStatus = datastore.ActiveDocumentStatus
+		existing.DeletedAt = 0
+		existing.ExpiresAt = 0
+
+		if err := deleted.Delete(k); err != nil {
+			return err
+		}
+
+		if err := putOutbox(tx, answer.Outbox); err != nil {
+			return err
+		}
+
+		return putAnswer(active, existing)
+	})
+}
+
+func (a *AnswerRepo) FindDeletedBefore(ctx context.Context, tenantID string, before primitive.DateTime) ([]datastore.Answer, error) {
+	answers := make([]datastore.Answer, 0)
+
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		tenants := [][]byte{[]byte(tenantID)}
+		if tenantID == "" {
+			tenants = bucketNames(tx.Bucket(AnswerBucket))
+		}
+
+		for _, name := range tenants {
+			tenant := tx.Bucket(AnswerBucket).Bucket(name)
+			if tenant == nil {
+				continue
+			}
+
+			b := tenant.Bucket([]byte(datastore.DeletedDocumentStatus))
+			if b == nil {
+				continue
+			}
+
+			err := b.ForEach(func(_, v []byte) error {
+				var answer datastore.Answer
+				if err := decodeAnswer(v, &answer); err != nil {
+					return err
+				}
+
+				if answer.DeletedAt < before {
+					answers = append(answers, answer)
+				}
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return answers, nil
+}
+
+func (a *AnswerRepo) Purge(ctx context.Context, answer *datastore.Answer) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		tenant := tenantView(tx, AnswerBucket, answer.TenantID)
+		if tenant == nil {
+			return datastore.ErrAnswerNotFound
+		}
+
+		deleted := tenant.Bucket([]byte(datastore.DeletedDocumentStatus))
+		if deleted == nil {
+			return datastore.ErrAnswerNotFound
+		}
+
+		k := deletedKey(answer.Key, answer.UID)
+		raw := deleted.Get(k)
+		if raw == nil {
+			return datastore.ErrAnswerNotFound
+		}
+
+		var purged datastore.Answer
+		if err := decodeAnswer(raw, &purged); err != nil {
+			return err
+		}
+
+		generations, err := tenantBucket(tx, GenerationBucket, answer.TenantID)
+		if err != nil {
+			return err
+		}
+
+		if purged.Generation > purgedGeneration(generations, answer.Key) {
+			v := make([]byte, 8)
+			binary.BigEndian.PutUint64(v, uint64(purged.Generation))
+
+			if err := generations.Put([]byte(answer.Key), v); err != nil {
+				return err
+			}
+		}
+
+		return deleted.Delete(k)
+	})
+}
+
+func (a *AnswerRepo) LastGeneration(ctx context.Context, tenantID, key string) (int64, error) {
+	var generation int64
+
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		if generations := tenantView(tx, GenerationBucket, tenantID); generations != nil {
+			generation = purgedGeneration(generations, key)
+		}
+
+		if b := activeView(tx, tenantID); b != nil && b.Get([]byte(key)) != nil {
+			var answer datastore.Answer
+			if err := getAnswer(b, key, &answer); err != nil {
+				return err
+			}
+
+			if answer.Generation > generation {
+				generation = answer.Generation
+			}
+		}
+
+		tenant := tenantView(tx, AnswerBucket, tenantID)
+		if tenant == nil {
+			return nil
+		}
+
+		b := tenant.Bucket([]byte(datastore.DeletedDocumentStatus))
+		if b == nil {
+			return nil
+		}
+
+		prefix := deletedKey(key, "")
+
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var answer datastore.Answer
+			if err := decodeAnswer(v, &answer); err != nil {
+				return err
+			}
+
+			if answer.Generation > generation {
+				generation = answer.Generation
+			}
+		}
+
+		return nil
+	})
+
+	return generation, err
+}
+
+// FindExpired scans the active answers of every tenant, bolt
+// having no index on their expiry.
+func (a *AnswerRepo) FindExpired(ctx context.Context, before primitive.DateTime, limit int) ([]datastore.Answer, error) {
+	answers := make([]datastore.Answer, 0)
+
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		for _, name := range bucketNames(tx.Bucket(AnswerBucket)) {
+			b := activeView(tx, string(name))
+			if b == nil {
+				continue
+			}
+
+			err := b.ForEach(func(_, v []byte) error {
+				var answer datastore.Answer
+				if err := decodeAnswer(v, &answer); err != nil {
+					return err
+				}
+
+				if answer.ExpiresAt != 0 && answer.ExpiresAt <= before {
+					answers = append(answers, answer)
+				}
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(answers, func(i, j int) bool {
+		return answers[i].ExpiresAt < answers[j].ExpiresAt
+	})
+
+	if len(answers) > limit {
+		answers = answers[:limit]
+	}
+
+	return answers, nil
+}
+
+func purgedGeneration(b *bbolt.Bucket, key string) int64 {
+	raw := b.Get([]byte(key))
+	if raw == nil {
+		return 0
+	}
+
+	return int64(binary.BigEndian.Uint64(raw))
+}
+
+func statusBucket(tx *bbolt.Tx, tenantID string, status datastore.DocumentStatus) (*bbolt.Bucket, error) {
+	tenant, err := tenantBucket(tx, AnswerBucket, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return tenant.CreateBucketIfNotExists([]byte(status))
+}
+
+func activeView(tx *bbolt.Tx, tenantID string) *bbolt.Bucket {
+	tenant := tenantView(tx, AnswerBucket, tenantID)
+	if tenant == nil {
+		return nil
+	}
+
+	return tenant.Bucket([]byte(datastore.ActiveDocumentStatus))
+}
+
+func getAnswer(b *bbolt.Bucket, key string, answer *datastore.Answer) error {
+	raw := b.Get([]byte(key))
+	if raw == nil {
+		return datastore.ErrAnswerNotFound
+	}
+
+	return decodeAnswer(raw, answer)
+}
+
+func decodeAnswer(raw []byte, answer *datastore.Answer) error {
+	if err := bson.Unmarshal(raw, answer); err != nil {
+		return err
+	}
+
+	// answers written before versions were recorded
+	// have had a version per value
+	if answer.Version == 0 {
+		answer.Version = int64(len(answer.Values))
+	}
+
+	datastore.NumberValues(answer.Values)
+
+	return nil
+}
+
+// checkVersion fails with ErrVersionMismatch when version is set and
+// existing, read with err, isn't the generation of answer at that
+// version.
+func checkVersion(existing *datastore.Answer, err error, answer *datastore.Answer, version int64) error {
+	if version == 0 || (err != nil && err != datastore.ErrAnswerNotFound) {
+		return nil
+	}
+
+	if err != nil || existing.UID != answer.UID || existing.Version != version {
+		return datastore.ErrVersionMismatch
+	}
+
+	return nil
+}
+
+// putAnswer stores answer without its outbox, which
+// lives in its own bucket so it can be scanned cheaply.
+func putAnswer(b *bbolt.Bucket, answer *datastore.Answer) error {
+	stored := *answer
+	stored.Outbox = nil
+
+	raw, err := bson.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(answerKey(answer), raw)
+}
+
+// answerKey returns the key answer is stored under in the bucket of
+// its status. Active answers are keyed by their key, which they are
+// the only one to have, deleted ones by their key and uid.
+func answerKey(answer *datastore.Answer) []byte {
+	if answer.DocumentStatus == datastore.DeletedDocumentStatus {
+		return deletedKey(answer.Key, answer.UID)
+	}
+
+	return []byte(answer.Key)
+}
+
+// deletedKey separates key and uid with a zero byte, which sorts the
+// deleted answers of a key together, and before those of longer keys.
+func deletedKey(key, uid string) []byte {
+	return append(append([]byte(key), 0), uid...)
+}
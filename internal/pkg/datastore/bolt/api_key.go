@@ -0,0 +1,176 @@
+package bolt
+
+import (
+	"context"
+	"sort"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type APIKeyRepo struct {
+	db *bbolt.DB
+}
+
+func NewAPIKeyRepo(db *bbolt.DB) *APIKeyRepo {
+	return &APIKeyRepo{db: db}
+}
+
+func (a *APIKeyRepo) Create(ctx context.Context, key *datastore.APIKey) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(APIKeyBucket)
+		if b.Get([]byte(key.Prefix)) != nil {
+			return datastore.ErrDuplicateKey
+		}
+
+		return putAPIKey(b, key)
+	})
+}
+
+func (a *APIKeyRepo) FindByUID(ctx context.Context, tenantID, uid string) (*datastore.APIKey, error) {
+	var found *datastore.APIKey
+
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		found, err = findAPIKeyByUID(tx.Bucket(APIKeyBucket), uid)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if found == nil || found.TenantID != tenantID {
+		return nil, datastore.ErrAPIKeyNotFound
+	}
+
+	return found, nil
+}
+
+func (a *APIKeyRepo) FindByPrefix(ctx context.Context, prefix string) (*datastore.APIKey, error) {
+	var found *datastore.APIKey
+
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		raw := tx.Bucket(APIKeyBucket).Get([]byte(prefix))
+		if raw == nil {
+			return datastore.ErrAPIKeyNotFound
+		}
+
+		found = &datastore.APIKey{}
+		return bson.Unmarshal(raw, found)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+func (a *APIKeyRepo) FindMany(ctx context.Context, tenantID string) ([]datastore.APIKey, error) {
+	keys := make([]datastore.APIKey, 0)
+
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(APIKeyBucket).ForEach(func(_, v []byte) error {
+			var key datastore.APIKey
+			if err := bson.Unmarshal(v, &key); err != nil {
+				return err
+			}
+
+			if key.TenantID == tenantID {
+				keys = append(keys, key)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// keys are stored by prefix, which is random
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt != keys[j].CreatedAt {
+			return keys[i].CreatedAt < keys[j].CreatedAt
+		}
+		return keys[i].UID < keys[j].UID
+	})
+
+	return keys, nil
+}
+
+func (a *APIKeyRepo) Update(ctx context.Context, key *datastore.APIKey) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(APIKeyBucket)
+
+		existing, err := findAPIKeyByUID(b, key.UID)
+		if err != nil {
+			return err
+		}
+
+		if existing == nil || existing.TenantID != key.TenantID {
+			return datastore.ErrAPIKeyNotFound
+		}
+
+		if existing.Prefix != key.Prefix {
+			if b.Get([]byte(key.Prefix)) != nil {
+				return datastore.ErrDuplicateKey
+			}
+
+			if err := b.Delete([]byte(existing.Prefix)); err != nil {
+				return err
+			}
+		}
+
+		return putAPIKey(b, key)
+	})
+}
+
+func (a *APIKeyRepo) TouchLastUsed(ctx context.Context, uid string, at primitive.DateTime) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(APIKeyBucket)
+
+		key, err := findAPIKeyByUID(b, uid)
+		if err != nil {
+			return err
+		}
+
+		if key == nil {
+			return datastore.ErrAPIKeyNotFound
+		}
+
+		key.LastUsedAt = at
+		return putAPIKey(b, key)
+	})
+}
+
+func findAPIKeyByUID(b *bbolt.Bucket, uid string) (*datastore.APIKey, error) {
+	var found *datastore.APIKey
+
+	err := b.ForEach(func(_, v []byte) error {
+		var key datastore.APIKey
+		if err := bson.Unmarshal(v, &key); err != nil {
+			return err
+		}
+
+		if key.UID == uid {
+			found = &key
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+func putAPIKey(b *bbolt.Bucket, key *datastore.APIKey) error {
+	raw, err := bson.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte(key.Prefix), raw)
+}
@@ -0,0 +1,126 @@
+package bolt
+
+import (
+	"context"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	// AnswerBucket holds one nested bucket per tenant, then per document
+	// status. Active answers are keyed by answer key, which mirrors the
+	// unique index on the key of active answers used by the mongo
+	// backend, deleted ones by answer key and uid, see answerKey.
+	AnswerBucket = []byte("answers")
+
+	// EventBucket holds one nested bucket per tenant, then per answer key,
+	// with events keyed by their creation time so cursors walk them in order.
+	EventBucket = []byte("events")
+
+	// OutboxBucket holds the outbox messages keyed by the id of their
+	// event, which starts with a timestamp, so cursors walk them in order.
+	OutboxBucket = []byte("outbox")
+
+	// SchemaBucket holds one nested bucket per tenant, then per namespace,
+	// with schemas keyed by their big endian version so cursors walk them
+	// in order.
+	SchemaBucket = []byte("schemas")
+
+	// APIKeyBucket holds the api keys of every tenant keyed by their
+	// prefix, which is unique across tenants.
+	APIKeyBucket = []byte("api_keys")
+
+	// RoleBindingBucket holds one nested bucket per tenant, with role
+	// bindings keyed by their subject and pattern, which are unique.
+	RoleBindingBucket = []byte("role_bindings")
+
+	// LegalHoldBucket holds one nested bucket per tenant, with
+	// legal holds keyed by the answer key they hold.
+	LegalHoldBucket = []byte("legal_holds")
+
+	// GenerationBucket holds one nested bucket per tenant, with the
+	// big endian generation of the latest purged answer of a key keyed
+	// by that key, so that its generations aren't numbered again.
+	GenerationBucket = []byte("generations")
+)
+
+// Client is a storage backend that persists every document
+// to a single bbolt file on the local disk.
+type Client struct {
+	DB         *bbolt.DB
+	AnswerRepo datastore.AnswerRepository
+	EventRepo  datastore.EventRepository
+	OutboxRepo datastore.OutboxRepository
+	SchemaRepo datastore.SchemaRepository
+	APIKeyRepo datastore.APIKeyRepository
+	RoleRepo   datastore.RoleBindingRepository
+	HoldRepo   datastore.LegalHoldRepository
+}
+
+func NewBoltRepository(path string) (*Client, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{AnswerBucket, EventBucket, OutboxBucket, SchemaBucket, APIKeyBucket, RoleBindingBucket, LegalHoldBucket, GenerationBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return migrate(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	c := &Client{
+		DB:         db,
+		AnswerRepo: NewAnswerRepo(db),
+		EventRepo:  NewEventRepo(db),
+		OutboxRepo: NewOutboxRepo(db),
+		SchemaRepo: NewSchemaRepo(db),
+		APIKeyRepo: NewAPIKeyRepo(db),
+		RoleRepo:   NewRoleBindingRepo(db),
+		HoldRepo:   NewLegalHoldRepo(db),
+	}
+
+	return c, nil
+}
+
+func (c *Client) Answers() datastore.AnswerRepository {
+	return c.AnswerRepo
+}
+
+func (c *Client) Events() datastore.EventRepository {
+	return c.EventRepo
+}
+
+func (c *Client) Outbox() datastore.OutboxRepository {
+	return c.OutboxRepo
+}
+
+func (c *Client) Schemas() datastore.SchemaRepository {
+	return c.SchemaRepo
+}
+
+func (c *Client) APIKeys() datastore.APIKeyRepository {
+	return c.APIKeyRepo
+}
+
+func (c *Client) RoleBindings() datastore.RoleBindingRepository {
+	return c.RoleRepo
+}
+
+func (c *Client) LegalHolds() datastore.LegalHoldRepository {
+	return c.HoldRepo
+}
+
+func (c *Client) Close(ctx context.Context) error {
+	return c.DB.Close()
+}
@@ -0,0 +1,225 @@
+package bolt
+
+import (
+	"context"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/datastore/storetest"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestStore(t *testing.T, path string) *Client {
+	db, err := NewBoltRepository(path)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = db.Close(context.Background())
+	})
+
+	return db
+}
+
+func TestBoltStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) datastore.Store {
+		return newTestStore(t, filepath.Join(t.TempDir(), "bequest.db"))
+	})
+}
+
+func TestBoltStore_SurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bequest.db")
+
+	db, err := NewBoltRepository(path)
+	require.Nil(t, err)
+
+	answer := storetest.NewAnswer("some-key", "some-value")
+	require.Nil(t, db.AnswerRepo.Create(ctx, answer))
+
+	_, err = db.AnswerRepo.Update(ctx, answer, &datastore.Value{Value: "new-value"}, 0)
+	require.Nil(t, err)
+	require.Nil(t, db.Close(ctx))
+
+	reopened := newTestStore(t, path)
+
+	answer, err = reopened.AnswerRepo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Equal(t, []datastore.Value{{Value: "some-value", Version: 1}, {Value: "new-value", Version: 2}}, answer.Values)
+}
+
+func TestBoltStore_MigratesLegacyLayout(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bequest.db")
+
+	// files written before tenants nest answers directly under their status,
+	// and here the legacy key happens to be named after the default tenant
+	answer := storetest.NewAnswer(datastore.DefaultTenant, "some-value")
+	answer.TenantID = ""
+
+	message := storetest.NewOutboxMessage(datastore.CreateEvent, datastore.DefaultTenant, "some-value", time.Now())
+	message.Event.TenantID = ""
+
+	legacy, err := bbolt.Open(path, 0600, nil)
+	require.Nil(t, err)
+
+	err = legacy.Update(func(tx *bbolt.Tx) error {
+		answers, err := tx.CreateBucket(AnswerBucket)
+		require.Nil(t, err)
+
+		active, err := answers.CreateBucket([]byte(datastore.ActiveDocumentStatus))
+		require.Nil(t, err)
+		require.Nil(t, putAnswer(active, answer))
+
+		events, err := tx.CreateBucket(EventBucket)
+		require.Nil(t, err)
+
+		key, err := events.CreateBucket([]byte(datastore.DefaultTenant))
+		require.Nil(t, err)
+
+		raw, err := bson.Marshal(message.Event)
+		require.Nil(t, err)
+		require.Nil(t, key.Put(eventKey(message.Event), raw))
+
+		_, err = tx.CreateBucket(OutboxBucket)
+		require.Nil(t, err)
+
+		return putOutbox(tx, []datastore.OutboxMessage{message})
+	})
+	require.Nil(t, err)
+	require.Nil(t, legacy.Close())
+
+	for i := 0; i < 2; i++ {
+		db, err := NewBoltRepository(path)
+		require.Nil(t, err)
+
+		found, err := db.AnswerRepo.FindByKey(ctx, datastore.DefaultTenant, datastore.DefaultTenant)
+		require.Nil(t, err)
+		require.Equal(t, datastore.DefaultTenant, found.TenantID)
+		require.Equal(t, []datastore.Value{{Value: "some-value", Version: 1}}, found.Values)
+
+		events, _, err := db.EventRepo.FindManyByKey(ctx, datastore.DefaultTenant, datastore.DefaultTenant, 0, datastore.Pageable{Page: 1, PerPage: 10})
+		require.Nil(t, err)
+		require.Len(t, events, 1)
+		require.Equal(t, datastore.DefaultTenant, events[0].TenantID)
+
+		messages, err := db.OutboxRepo.FindPendingByKey(ctx, datastore.DefaultTenant, datastore.DefaultTenant)
+		require.Nil(t, err)
+		require.Len(t, messages, 1)
+
+		require.Nil(t, db.Close(ctx))
+	}
+}
+
+func TestBoltStore_NumbersLegacyGenerations(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bequest.db")
+	now := time.Now()
+
+	// files written before generations key deleted answers by key alone,
+	// here with the key deleted once and created again since
+	deleted := storetest.NewAnswer("some-key", "first")
+	deleted.UID = "first-uid"
+	deleted.CreatedAt = primitive.NewDateTimeFromTime(now.Add(-time.Hour))
+	deleted.DocumentStatus = datastore.DeletedDocumentStatus
+
+	active := storetest.NewAnswer("some-key", "second")
+	active.UID = "second-uid"
+
+	var events []*datastore.Event
+	for i, eventType := range []datastore.EventType{datastore.CreateEvent, datastore.DeleteEvent, datastore.CreateEvent, datastore.UpdateEvent} {
+		event := storetest.NewOutboxMessage(eventType, "some-key", "some-value", now.Add(time.Duration(i)*time.Second)).Event
+		events = append(events, event)
+	}
+
+	message := storetest.NewOutboxMessage(datastore.UpdateEvent, "some-key", "third", now)
+
+	legacy, err := bbolt.Open(path, 0600, nil)
+	require.Nil(t, err)
+
+	err = legacy.Update(func(tx *bbolt.Tx) error {
+		answers, err := tx.CreateBucket(AnswerBucket)
+		require.Nil(t, err)
+
+		tenant, err := answers.CreateBucket([]byte(datastore.DefaultTenant))
+		require.Nil(t, err)
+
+		for _, answer := range []*datastore.Answer{deleted, active} {
+			b, err := tenant.CreateBucket([]byte(answer.DocumentStatus))
+			require.Nil(t, err)
+
+			raw, err := bson.Marshal(answer)
+			require.Nil(t, err)
+			require.Nil(t, b.Put([]byte(answer.Key), raw))
+		}
+
+		root, err := tx.CreateBucket(EventBucket)
+		require.Nil(t, err)
+
+		key, err := root.CreateBucket([]byte(datastore.DefaultTenant))
+		require.Nil(t, err)
+
+		key, err = key.CreateBucket([]byte("some-key"))
+		require.Nil(t, err)
+
+		for _, event := range events {
+			raw, err := bson.Marshal(event)
+			require.Nil(t, err)
+			require.Nil(t, key.Put(eventKey(event), raw))
+		}
+
+		_, err = tx.CreateBucket(OutboxBucket)
+		require.Nil(t, err)
+
+		meta, err := tx.CreateBucket(MetaBucket)
+		require.Nil(t, err)
+
+		raw := make([]byte, 8)
+		binary.BigEndian.PutUint64(raw, tenantLayout)
+		require.Nil(t, meta.Put(layoutKey, raw))
+
+		return putOutbox(tx, []datastore.OutboxMessage{message})
+	})
+	require.Nil(t, err)
+	require.Nil(t, legacy.Close())
+
+	for i := 0; i < 2; i++ {
+		db, err := NewBoltRepository(path)
+		require.Nil(t, err)
+
+		found, err := db.AnswerRepo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+		require.Nil(t, err)
+		require.Equal(t, "second-uid", found.UID)
+		require.Equal(t, int64(2), found.Generation)
+
+		gone, err := db.AnswerRepo.FindDeleted(ctx, datastore.DefaultTenant, "some-key")
+		require.Nil(t, err)
+		require.Len(t, gone, 1)
+		require.Equal(t, "first-uid", gone[0].UID)
+		require.Equal(t, int64(1), gone[0].Generation)
+
+		for generation, want := range map[int64][]datastore.EventType{
+			1: {datastore.CreateEvent, datastore.DeleteEvent},
+			2: {datastore.CreateEvent, datastore.UpdateEvent},
+		} {
+			numbered, _, err := db.EventRepo.FindManyByKey(ctx, datastore.DefaultTenant, "some-key", generation, datastore.Pageable{Page: 1, PerPage: 10, Sort: 1})
+			require.Nil(t, err)
+			require.Len(t, numbered, 2)
+			require.Equal(t, want, []datastore.EventType{numbered[0].Type, numbered[1].Type})
+		}
+
+		messages, err := db.OutboxRepo.FindPendingByKey(ctx, datastore.DefaultTenant, "some-key")
+		require.Nil(t, err)
+		require.Len(t, messages, 1)
+		require.Equal(t, int64(2), messages[0].Event.Data.Generation)
+
+		require.Nil(t, db.Close(ctx))
+	}
+}
@@ -0,0 +1,237 @@
+package bolt
+
+import (
+	"context"
+	"encoding/binary"
+	"sort"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EventRepo struct {
+	db *bbolt.DB
+}
+
+func NewEventRepo(db *bbolt.DB) *EventRepo {
+	return &EventRepo{db: db}
+}
+
+func (e *EventRepo) Create(ctx context.Context, event *datastore.Event) error {
+	raw, err := bson.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var key string
+	if event.Data != nil {
+		key = event.Data.Key
+	}
+
+	return e.db.Update(func(tx *bbolt.Tx) error {
+		tenant, err := tenantBucket(tx, EventBucket, event.TenantID)
+		if err != nil {
+			return err
+		}
+
+		b, err := tenant.CreateBucketIfNotExists([]byte(key))
+		if err != nil {
+			return err
+		}
+
+		k := eventKey(event)
+		if b.Get(k) != nil {
+			return datastore.ErrDuplicateKey
+		}
+
+		return b.Put(k, raw)
+	})
+}
+
+func (e *EventRepo) FindManyByKey(ctx context.Context, tenantID, key string, generation int64, pageable datastore.Pageable) ([]datastore.Event, datastore.PaginationData, error) {
+	events := make([]datastore.Event, 0)
+
+	if err := pageable.Validate(); err != nil {
+		return events, datastore.PaginationData{}, err
+	}
+
+	err := e.db.View(func(tx *bbolt.Tx) error {
+		tenant := tenantView(tx, EventBucket, tenantID)
+		if tenant == nil {
+			return nil
+		}
+
+		b := tenant.Bucket([]byte(key))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		first, next := c.First, c.Next
+		if pageable.Sort < 0 {
+			first, next = c.Last, c.Prev
+		}
+
+		for k, v := first(); k != nil; k, v = next() {
+			var event datastore.Event
+			if err := bson.Unmarshal(v, &event); err != nil {
+				return err
+			}
+
+			if event.DocumentStatus != datastore.ActiveDocumentStatus {
+				continue
+			}
+
+			if generation != 0 && (event.Data == nil || event.Data.Generation != generation) {
+				continue
+			}
+
+			events = append(events, event)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return make([]datastore.Event, 0), datastore.PaginationData{}, err
+	}
+
+	pagination := datastore.NewPaginationData(int64(len(events)), pageable)
+
+	start, end := pageable.Window(len(events))
+	return events[start:end], pagination, nil
+}
+
+func (e *EventRepo) FindExpired(ctx context.Context, tenantID string, before primitive.DateTime, keep int) ([]datastore.Event, error) {
+	expired := make([]datastore.Event, 0)
+
+	err := e.db.View(func(tx *bbolt.Tx) error {
+		tenants := [][]byte{[]byte(tenantID)}
+		if tenantID == "" {
+			tenants = bucketNames(tx.Bucket(EventBucket))
+		}
+
+		for _, name := range tenants {
+			tenant := tx.Bucket(EventBucket).Bucket(name)
+			if tenant == nil {
+				continue
+			}
+
+			for _, key := range bucketNames(tenant) {
+				// most recent first, so that the events past
+				// keep are the last ones the cursor walks
+				c := tenant.Bucket(key).Cursor()
+
+				kept := 0
+				for k, v := c.Last(); k != nil; k, v = c.Prev() {
+					var event datastore.Event
+					if err := bson.Unmarshal(v, &event); err != nil {
+						return err
+					}
+
+					if event.DocumentStatus != datastore.ActiveDocumentStatus {
+						continue
+					}
+
+					kept++
+					if (before != 0 && event.CreatedAt < before) || (keep != 0 && kept > keep) {
+						expired = append(expired, event)
+					}
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].CreatedAt < expired[j].CreatedAt
+	})
+
+	return expired, nil
+}
+
+func (e *EventRepo) DeleteByKey(ctx context.Context, tenantID, key string, generation int64) (int64, error) {
+	var deleted int64
+
+	err := e.db.Update(func(tx *bbolt.Tx) error {
+		tenant := tenantView(tx, EventBucket, tenantID)
+		if tenant == nil {
+			return nil
+		}
+
+		b := tenant.Bucket([]byte(key))
+		if b == nil {
+			return nil
+		}
+
+		var keys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var event datastore.Event
+			if err := bson.Unmarshal(v, &event); err != nil {
+				return err
+			}
+
+			if generation == 0 || (event.Data != nil && event.Data.Generation == generation) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// buckets can't be written to while iterating over them
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		deleted = int64(len(keys))
+		return nil
+	})
+
+	return deleted, err
+}
+
+func (e *EventRepo) Delete(ctx context.Context, events []datastore.Event) error {
+	return e.db.Update(func(tx *bbolt.Tx) error {
+		for i := range events {
+			tenant := tenantView(tx, EventBucket, events[i].TenantID)
+			if tenant == nil {
+				continue
+			}
+
+			var key string
+			if events[i].Data != nil {
+				key = events[i].Data.Key
+			}
+
+			b := tenant.Bucket([]byte(key))
+			if b == nil {
+				continue
+			}
+
+			if err := b.Delete(eventKey(&events[i])); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// eventKey orders events by creation time, using the object id
+// to keep events created within the same millisecond apart.
+func eventKey(event *datastore.Event) []byte {
+	key := make([]byte, 8, 8+len(event.ID))
+	binary.BigEndian.PutUint64(key, uint64(event.CreatedAt))
+
+	return append(key, event.ID[:]...)
+}
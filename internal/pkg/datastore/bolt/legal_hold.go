@@ -0,0 +1,87 @@
+package bolt
+
+import (
+	"context"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type LegalHoldRepo struct {
+	db *bbolt.DB
+}
+
+func NewLegalHoldRepo(db *bbolt.DB) *LegalHoldRepo {
+	return &LegalHoldRepo{db: db}
+}
+
+func (l *LegalHoldRepo) Create(ctx context.Context, hold *datastore.LegalHold) error {
+	return l.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tenantBucket(tx, LegalHoldBucket, hold.TenantID)
+		if err != nil {
+			return err
+		}
+
+		if b.Get([]byte(hold.Key)) != nil {
+			return datastore.ErrDuplicateKey
+		}
+
+		raw, err := bson.Marshal(hold)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(hold.Key), raw)
+	})
+}
+
+func (l *LegalHoldRepo) FindMany(ctx context.Context, tenantID string) ([]datastore.LegalHold, error) {
+	holds := make([]datastore.LegalHold, 0)
+
+	err := l.db.View(func(tx *bbolt.Tx) error {
+		tenants := [][]byte{[]byte(tenantID)}
+		if tenantID == "" {
+			tenants = bucketNames(tx.Bucket(LegalHoldBucket))
+		}
+
+		// tenants and keys are walked in order
+		for _, name := range tenants {
+			b := tx.Bucket(LegalHoldBucket).Bucket(name)
+			if b == nil {
+				continue
+			}
+
+			err := b.ForEach(func(_, v []byte) error {
+				var hold datastore.LegalHold
+				if err := bson.Unmarshal(v, &hold); err != nil {
+					return err
+				}
+
+				holds = append(holds, hold)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return holds, nil
+}
+
+func (l *LegalHoldRepo) Delete(ctx context.Context, tenantID, key string) error {
+	return l.db.Update(func(tx *bbolt.Tx) error {
+		b := tenantView(tx, LegalHoldBucket, tenantID)
+		if b == nil || b.Get([]byte(key)) == nil {
+			return datastore.ErrLegalHoldNotFound
+		}
+
+		return b.Delete([]byte(key))
+	})
+}
@@ -0,0 +1,338 @@
+package bolt
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MetaBucket records the layout version of the file.
+var MetaBucket = []byte("meta")
+
+var layoutKey = []byte("layout")
+
+const (
+	// tenantLayout is the layout where answers, events and schemas
+	// are nested under one bucket per tenant.
+	tenantLayout = 1
+
+	// generationLayout is the layout where answers and events record
+	// their generation, and deleted answers are keyed by key and uid.
+	generationLayout = 2
+)
+
+// migrate upgrades files written by earlier releases, moving their
+// answers, events and schemas under the default tenant, then
+// numbering the generations of their keys.
+func migrate(tx *bbolt.Tx) error {
+	meta, err := tx.CreateBucketIfNotExists(MetaBucket)
+	if err != nil {
+		return err
+	}
+
+	var layout uint64
+	if raw := meta.Get(layoutKey); raw != nil {
+		layout = binary.BigEndian.Uint64(raw)
+	}
+
+	if layout >= generationLayout {
+		return nil
+	}
+
+	if layout < tenantLayout {
+		for _, name := range [][]byte{AnswerBucket, EventBucket, SchemaBucket} {
+			if err := nestUnderDefaultTenant(tx, name); err != nil {
+				return err
+			}
+		}
+
+		if err := assignOutboxTenant(tx); err != nil {
+			return err
+		}
+	}
+
+	if err := numberGenerations(tx); err != nil {
+		return err
+	}
+
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, generationLayout)
+
+	return meta.Put(layoutKey, raw)
+}
+
+// nestUnderDefaultTenant moves the content of the named bucket one level
+// down. It goes through a temporary bucket, since a legacy key, status
+// or namespace may itself be named after the default tenant.
+func nestUnderDefaultTenant(tx *bbolt.Tx, name []byte) error {
+	legacy := tx.Bucket(name)
+	if legacy == nil {
+		return nil
+	}
+
+	tmpName := append(append([]byte{}, name...), ".legacy"...)
+
+	tmp, err := tx.CreateBucket(tmpName)
+	if err != nil {
+		return err
+	}
+
+	if err := copyBucket(tmp, legacy); err != nil {
+		return err
+	}
+
+	if err := tx.DeleteBucket(name); err != nil {
+		return err
+	}
+
+	root, err := tx.CreateBucket(name)
+	if err != nil {
+		return err
+	}
+
+	tenant, err := root.CreateBucket([]byte(datastore.DefaultTenant))
+	if err != nil {
+		return err
+	}
+
+	if err := copyBucket(tenant, tmp); err != nil {
+		return err
+	}
+
+	return tx.DeleteBucket(tmpName)
+}
+
+// copyBucket copies src into dst recursively, setting the tenant on
+// the documents it finds at the leaves.
+func copyBucket(dst, src *bbolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			raw, err := withDefaultTenant(v)
+			if err != nil {
+				return err
+			}
+
+			return dst.Put(k, raw)
+		}
+
+		nested, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+
+		return copyBucket(nested, src.Bucket(k))
+	})
+}
+
+func withDefaultTenant(raw []byte) ([]byte, error) {
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	for i, e := range doc {
+		if e.Key != "tenant_id" {
+			continue
+		}
+
+		if e.Value != "" {
+			return raw, nil
+		}
+
+		doc[i].Value = datastore.DefaultTenant
+		return bson.Marshal(doc)
+	}
+
+	return bson.Marshal(append(doc, bson.E{Key: "tenant_id", Value: datastore.DefaultTenant}))
+}
+
+func assignOutboxTenant(tx *bbolt.Tx) error {
+	b := tx.Bucket(OutboxBucket)
+	if b == nil {
+		return nil
+	}
+
+	var messages []datastore.OutboxMessage
+	err := b.ForEach(func(_, v []byte) error {
+		var message datastore.OutboxMessage
+		if err := bson.Unmarshal(v, &message); err != nil {
+			return err
+		}
+
+		if message.Event != nil && message.Event.TenantID == "" {
+			message.Event.TenantID = datastore.DefaultTenant
+			messages = append(messages, message)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// buckets can't be written to while iterating over them
+	return putOutbox(tx, messages)
+}
+
+// numberGenerations numbers the answers of every key in the order they
+// were created, and their events from the create events preceding them.
+// Pending outbox messages belong to the latest generation of their key.
+func numberGenerations(tx *bbolt.Tx) error {
+	latest := make(map[[2]string]int64)
+
+	for _, tenantID := range bucketNames(tx.Bucket(AnswerBucket)) {
+		tenant := tx.Bucket(AnswerBucket).Bucket(tenantID)
+
+		var answers []datastore.Answer
+		for _, status := range []datastore.DocumentStatus{datastore.DeletedDocumentStatus, datastore.ActiveDocumentStatus} {
+			b := tenant.Bucket([]byte(status))
+			if b == nil {
+				continue
+			}
+
+			err := b.ForEach(func(_, v []byte) error {
+				var answer datastore.Answer
+				if err := decodeAnswer(v, &answer); err != nil {
+					return err
+				}
+
+				answers = append(answers, answer)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			// deleted answers were keyed by key alone, they
+			// are put back under their new keys below
+			if err := tenant.DeleteBucket([]byte(status)); err != nil {
+				return err
+			}
+		}
+
+		// the active answer of a key is its latest
+		sort.SliceStable(answers, func(i, j int) bool {
+			if answers[i].Key != answers[j].Key {
+				return answers[i].Key < answers[j].Key
+			}
+
+			iActive := answers[i].DocumentStatus == datastore.ActiveDocumentStatus
+			if jActive := answers[j].DocumentStatus == datastore.ActiveDocumentStatus; iActive != jActive {
+				return jActive
+			}
+
+			return answers[i].CreatedAt < answers[j].CreatedAt
+		})
+
+		for i := range answers {
+			k := [2]string{string(tenantID), answers[i].Key}
+			latest[k]++
+			answers[i].Generation = latest[k]
+
+			b, err := tenant.CreateBucketIfNotExists([]byte(answers[i].DocumentStatus))
+			if err != nil {
+				return err
+			}
+
+			if err := putAnswer(b, &answers[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, tenantID := range bucketNames(tx.Bucket(EventBucket)) {
+		tenant := tx.Bucket(EventBucket).Bucket(tenantID)
+
+		for _, key := range bucketNames(tenant) {
+			b := tenant.Bucket(key)
+
+			var generation int64
+			numbered := make(map[string][]byte)
+
+			err := b.ForEach(func(k, v []byte) error {
+				var event datastore.Event
+				if err := bson.Unmarshal(v, &event); err != nil {
+					return err
+				}
+
+				if event.Type == datastore.CreateEvent || generation == 0 {
+					generation++
+				}
+
+				if event.Data == nil {
+					return nil
+				}
+
+				event.Data.Generation = generation
+
+				raw, err := bson.Marshal(&event)
+				if err != nil {
+					return err
+				}
+
+				numbered[string(k)] = raw
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			// buckets can't be written to while iterating over them
+			for k, raw := range numbered {
+				if err := b.Put([]byte(k), raw); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	var messages []datastore.OutboxMessage
+	err := tx.Bucket(OutboxBucket).ForEach(func(_, v []byte) error {
+		var message datastore.OutboxMessage
+		if err := bson.Unmarshal(v, &message); err != nil {
+			return err
+		}
+
+		if message.Event != nil && message.Event.Data != nil {
+			message.Event.Data.Generation = latest[[2]string{message.Event.TenantID, message.Event.Data.Key}]
+			messages = append(messages, message)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return putOutbox(tx, messages)
+}
+
+// bucketNames returns the names of the buckets nested in b, so that
+// they can be written to without iterating over b at the same time.
+func bucketNames(b *bbolt.Bucket) [][]byte {
+	var names [][]byte
+	_ = b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			names = append(names, append([]byte{}, k...))
+		}
+
+		return nil
+	})
+
+	return names
+}
+
+// tenantBucket returns the bucket of tenantID under the named root,
+// creating it when missing.
+func tenantBucket(tx *bbolt.Tx, root []byte, tenantID string) (*bbolt.Bucket, error) {
+	return tx.Bucket(root).CreateBucketIfNotExists([]byte(tenantID))
+}
+
+// tenantView returns the bucket of tenantID under the named root,
+// or nil when the tenant never wrote to it.
+func tenantView(tx *bbolt.Tx, root []byte, tenantID string) *bbolt.Bucket {
+	return tx.Bucket(root).Bucket([]byte(tenantID))
+}
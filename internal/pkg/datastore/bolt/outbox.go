@@ -0,0 +1,95 @@
+package bolt
+
+import (
+	"context"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OutboxRepo struct {
+	db *bbolt.DB
+}
+
+func NewOutboxRepo(db *bbolt.DB) *OutboxRepo {
+	return &OutboxRepo{db: db}
+}
+
+func (o *OutboxRepo) FindDue(ctx context.Context, now primitive.DateTime, limit int) ([]datastore.OutboxMessage, error) {
+	return o.find(limit, func(message *datastore.OutboxMessage) bool {
+		return message.Status == datastore.PendingOutboxStatus && message.NextAttemptAt <= now
+	})
+}
+
+func (o *OutboxRepo) FindPendingByKey(ctx context.Context, tenantID, key string) ([]datastore.OutboxMessage, error) {
+	return o.find(0, func(message *datastore.OutboxMessage) bool {
+		return message.Status == datastore.PendingOutboxStatus && message.Event.TenantID == tenantID &&
+			message.Event.Data != nil && message.Event.Data.Key == key
+	})
+}
+
+func (o *OutboxRepo) Update(ctx context.Context, message *datastore.OutboxMessage) error {
+	return o.db.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket(OutboxBucket).Get(message.Event.ID[:]) == nil {
+			return nil
+		}
+
+		return putOutbox(tx, []datastore.OutboxMessage{*message})
+	})
+}
+
+func (o *OutboxRepo) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return o.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(OutboxBucket).Delete(id[:])
+	})
+}
+
+func (o *OutboxRepo) find(limit int, match func(message *datastore.OutboxMessage) bool) ([]datastore.OutboxMessage, error) {
+	messages := make([]datastore.OutboxMessage, 0)
+
+	err := o.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(OutboxBucket).Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var message datastore.OutboxMessage
+			if err := bson.Unmarshal(v, &message); err != nil {
+				return err
+			}
+
+			if !match(&message) {
+				continue
+			}
+
+			messages = append(messages, message)
+			if limit > 0 && len(messages) == limit {
+				return nil
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return make([]datastore.OutboxMessage, 0), err
+	}
+
+	return messages, nil
+}
+
+func putOutbox(tx *bbolt.Tx, messages []datastore.OutboxMessage) error {
+	b := tx.Bucket(OutboxBucket)
+
+	for i := range messages {
+		raw, err := bson.Marshal(&messages[i])
+		if err != nil {
+			return err
+		}
+
+		if err := b.Put(messages[i].Event.ID[:], raw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
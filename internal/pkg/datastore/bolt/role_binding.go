@@ -0,0 +1,140 @@
+package bolt
+
+import (
+	"context"
+	"sort"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type RoleBindingRepo struct {
+	db *bbolt.DB
+}
+
+func NewRoleBindingRepo(db *bbolt.DB) *RoleBindingRepo {
+	return &RoleBindingRepo{db: db}
+}
+
+func (r *RoleBindingRepo) Create(ctx context.Context, binding *datastore.RoleBinding) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tenantBucket(tx, RoleBindingBucket, binding.TenantID)
+		if err != nil {
+			return err
+		}
+
+		k := roleBindingKey(binding.Subject, binding.Pattern)
+		if b.Get(k) != nil {
+			return datastore.ErrDuplicateKey
+		}
+
+		raw, err := bson.Marshal(binding)
+		if err != nil {
+			return err
+		}
+
+		return b.Put(k, raw)
+	})
+}
+
+func (r *RoleBindingRepo) FindByUID(ctx context.Context, tenantID, uid string) (*datastore.RoleBinding, error) {
+	bindings, err := r.find(tenantID, func(binding *datastore.RoleBinding) bool {
+		return binding.UID == uid
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bindings) == 0 {
+		return nil, datastore.ErrRoleBindingNotFound
+	}
+
+	return &bindings[0], nil
+}
+
+func (r *RoleBindingRepo) FindMany(ctx context.Context, tenantID string, subjects []string) ([]datastore.RoleBinding, error) {
+	wanted := make(map[string]bool, len(subjects))
+	for _, subject := range subjects {
+		wanted[subject] = true
+	}
+
+	return r.find(tenantID, func(binding *datastore.RoleBinding) bool {
+		return len(subjects) == 0 || wanted[binding.Subject]
+	})
+}
+
+func (r *RoleBindingRepo) Delete(ctx context.Context, tenantID, uid string) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tenantView(tx, RoleBindingBucket, tenantID)
+		if b == nil {
+			return datastore.ErrRoleBindingNotFound
+		}
+
+		var found []byte
+		err := b.ForEach(func(k, v []byte) error {
+			var binding datastore.RoleBinding
+			if err := bson.Unmarshal(v, &binding); err != nil {
+				return err
+			}
+
+			if binding.UID == uid {
+				found = append([]byte(nil), k...)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if found == nil {
+			return datastore.ErrRoleBindingNotFound
+		}
+
+		// buckets can't be written to while iterating over them
+		return b.Delete(found)
+	})
+}
+
+func (r *RoleBindingRepo) find(tenantID string, match func(binding *datastore.RoleBinding) bool) ([]datastore.RoleBinding, error) {
+	bindings := make([]datastore.RoleBinding, 0)
+
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		b := tenantView(tx, RoleBindingBucket, tenantID)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(_, v []byte) error {
+			var binding datastore.RoleBinding
+			if err := bson.Unmarshal(v, &binding); err != nil {
+				return err
+			}
+
+			if match(&binding) {
+				bindings = append(bindings, binding)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(bindings, func(i, j int) bool {
+		if bindings[i].CreatedAt != bindings[j].CreatedAt {
+			return bindings[i].CreatedAt < bindings[j].CreatedAt
+		}
+		return bindings[i].UID < bindings[j].UID
+	})
+
+	return bindings, nil
+}
+
+// roleBindingKey joins subject and pattern with a byte
+// that can't appear in either, keeping the pair unique.
+func roleBindingKey(subject, pattern string) []byte {
+	return []byte(subject + "\x00" + pattern)
+}
@@ -0,0 +1,154 @@
+package bolt
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SchemaRepo struct {
+	db *bbolt.DB
+}
+
+func NewSchemaRepo(db *bbolt.DB) *SchemaRepo {
+	return &SchemaRepo{db: db}
+}
+
+func (s *SchemaRepo) Create(ctx context.Context, schema *datastore.Schema) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		tenant, err := tenantBucket(tx, SchemaBucket, schema.TenantID)
+		if err != nil {
+			return err
+		}
+
+		b, err := tenant.CreateBucketIfNotExists([]byte(schema.Namespace))
+		if err != nil {
+			return err
+		}
+
+		if b.Get(versionKey(schema.Version)) != nil {
+			return datastore.ErrDuplicateKey
+		}
+
+		return putSchema(b, schema)
+	})
+}
+
+func (s *SchemaRepo) FindByUID(ctx context.Context, tenantID, uid string) (*datastore.Schema, error) {
+	schemas, err := s.find(tenantID, func(schema *datastore.Schema) bool {
+		return schema.UID == uid
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(schemas) == 0 {
+		return nil, datastore.ErrSchemaNotFound
+	}
+
+	return &schemas[0], nil
+}
+
+func (s *SchemaRepo) FindMany(ctx context.Context, tenantID, namespace string) ([]datastore.Schema, error) {
+	return s.find(tenantID, func(schema *datastore.Schema) bool {
+		return namespace == "" || schema.Namespace == namespace
+	})
+}
+
+func (s *SchemaRepo) FindActive(ctx context.Context, tenantID string) ([]datastore.Schema, error) {
+	return s.find(tenantID, func(schema *datastore.Schema) bool {
+		return schema.Status == datastore.ActiveSchemaStatus
+	})
+}
+
+func (s *SchemaRepo) UpdateStatus(ctx context.Context, tenantID, uid string, status datastore.SchemaStatus) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		namespaces := tenantView(tx, SchemaBucket, tenantID)
+		if namespaces == nil {
+			return datastore.ErrSchemaNotFound
+		}
+
+		var found *datastore.Schema
+		err := namespaces.ForEach(func(namespace, _ []byte) error {
+			return namespaces.Bucket(namespace).ForEach(func(_, v []byte) error {
+				var schema datastore.Schema
+				if err := bson.Unmarshal(v, &schema); err != nil {
+					return err
+				}
+
+				if schema.UID == uid {
+					found = &schema
+				}
+
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		if found == nil {
+			return datastore.ErrSchemaNotFound
+		}
+
+		found.Status = status
+		found.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+		// buckets can't be written to while iterating over them
+		return putSchema(namespaces.Bucket([]byte(found.Namespace)), found)
+	})
+}
+
+// find walks the namespaces then their versions in order,
+// which is the order every SchemaRepository read returns.
+func (s *SchemaRepo) find(tenantID string, match func(schema *datastore.Schema) bool) ([]datastore.Schema, error) {
+	schemas := make([]datastore.Schema, 0)
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		namespaces := tenantView(tx, SchemaBucket, tenantID)
+		if namespaces == nil {
+			return nil
+		}
+
+		return namespaces.ForEach(func(namespace, _ []byte) error {
+			return namespaces.Bucket(namespace).ForEach(func(_, v []byte) error {
+				var schema datastore.Schema
+				if err := bson.Unmarshal(v, &schema); err != nil {
+					return err
+				}
+
+				if match(&schema) {
+					schemas = append(schemas, schema)
+				}
+
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schemas, nil
+}
+
+func putSchema(b *bbolt.Bucket, schema *datastore.Schema) error {
+	raw, err := bson.Marshal(schema)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(versionKey(schema.Version), raw)
+}
+
+func versionKey(version int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(version))
+
+	return key
+}
@@ -0,0 +1,346 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// answerIndex mirrors the unique index on the key of active answers
+// that the mongo backend creates on the answers collection. Deleted
+// answers are told apart by their uid, which is empty for active ones.
+type answerIndex struct {
+	tenantID string
+	key      string
+	status   datastore.DocumentStatus
+	uid      string
+}
+
+// generationIndex identifies a key of a tenant, whose purged
+// answers leave their generation behind.
+type generationIndex struct {
+	tenantID string
+	key      string
+}
+
+type AnswerRepo struct {
+	mu      sync.RWMutex
+	answers map[answerIndex]*datastore.Answer
+	purged  map[generationIndex]int64
+}
+
+func NewAnswerRepo() *AnswerRepo {
+	return &AnswerRepo{
+		answers: make(map[answerIndex]*datastore.Answer),
+		purged:  make(map[generationIndex]int64),
+	}
+}
+
+func (a *AnswerRepo) Create(ctx context.Context, answer *datastore.Answer) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	idx := answerIndex{tenantID: answer.TenantID, key: answer.Key, status: answer.DocumentStatus}
+	if answer.DocumentStatus == datastore.DeletedDocumentStatus {
+		idx.uid = answer.UID
+	}
+
+	if _, ok := a.answers[idx]; ok {
+		return datastore.ErrDuplicateKey
+	}
+
+	created := cloneAnswer(answer)
+	datastore.NumberValues(created.Values)
+
+	a.answers[idx] = created
+	return nil
+}
+
+func (a *AnswerRepo) FindByKey(ctx context.Context, tenantID, key string) (*datastore.Answer, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	answer, ok := a.answers[answerIndex{tenantID: tenantID, key: key, status: datastore.ActiveDocumentStatus}]
+	if !ok {
+		return &datastore.Answer{}, datastore.ErrAnswerNotFound
+	}
+
+	found := cloneAnswer(answer)
+	found.Outbox = nil
+
+	return found, nil
+}
+
+func (a *AnswerRepo) FindManyByPrefix(ctx context.Context, tenantID, prefix string) ([]datastore.Answer, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	answers := make([]datastore.Answer, 0)
+	for idx, answer := range a.answers {
+		if idx.tenantID != tenantID || idx.status != datastore.ActiveDocumentStatus || !strings.HasPrefix(idx.key, prefix) {
+			continue
+		}
+
+		found := cloneAnswer(answer)
+		found.Outbox = nil
+		answers = append(answers, *found)
+	}
+
+	sort.Slice(answers, func(i, j int) bool {
+		return answers[i].Key < answers[j].Key
+	})
+
+	return answers, nil
+}
+
+func (a *AnswerRepo) FindMany(ctx context.Context, tenantID string, filter datastore.AnswerFilter) ([]datastore.Answer, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	answers := make([]datastore.Answer, 0)
+	for idx, answer := range a.answers {
+		if idx.tenantID != tenantID || !strings.HasPrefix(idx.key, filter.Prefix) {
+			continue
+		}
+
+		found := cloneAnswer(answer)
+		found.Outbox = nil
+		answers = append(answers, *found)
+	}
+
+	return filter.Apply(answers)
+}
+
+func (a *AnswerRepo) Search(ctx context.Context, tenantID string, terms []string, limit int) ([]datastore.ScoredAnswer, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	ranking := datastore.NewSearchRanking(terms, limit)
+	for idx, answer := range a.answers {
+		if idx.tenantID == tenantID && idx.status == datastore.ActiveDocumentStatus {
+			ranking.Add(*answer)
+		}
+	}
+
+	// only the answers found are copied out of the store
+	found := ranking.Answers()
+	for i := range found {
+		answer := cloneAnswer(&found[i].Answer)
+		answer.Outbox = nil
+		found[i].Answer = *answer
+	}
+
+	return found, nil
+}
+
+func (a *AnswerRepo) Update(ctx context.Context, answer *datastore.Answer, value *datastore.Value, version int64) (*datastore.Answer, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	existing, ok := a.answers[answerIndex{tenantID: answer.TenantID, key: answer.Key, status: datastore.ActiveDocumentStatus}]
+	if err := checkVersion(existing, ok, answer, version); err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, datastore.ErrAnswerNotFound
+	}
+
+	existing.Version++
+	existing.Values = append(existing.Values, *value)
+	existing.Values[len(existing.Values)-1].Version = existing.Version
+	existing.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+	existing.ExpiresAt = answer.ExpiresAt
+	existing.Outbox = append(existing.Outbox, cloneOutbox(answer.Outbox)...)
+
+	updated := cloneAnswer(existing)
+	updated.Outbox = nil
+
+	return updated, nil
+}
+
+func (a *AnswerRepo) Delete(ctx context.Context, answer *datastore.Answer, version int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	active := answerIndex{tenantID: answer.TenantID, key: answer.Key, status: datastore.ActiveDocumentStatus}
+	existing, ok := a.answers[active]
+	if err := checkVersion(existing, ok, answer, version); err != nil {
+		return err
+	}
+
+	if !ok {
+		return nil
+	}
+
+	deleted := answerIndex{tenantID: answer.TenantID, key: answer.Key, status: datastore.DeletedDocumentStatus, uid: existing.UID}
+
+	existing.DocumentStatus = datastore.DeletedDocumentStatus
+	existing.DeletedAt = primitive.NewDateTimeFromTime(time.Now())
+	existing.Outbox = append(existing.Outbox, cloneOutbox(answer.Outbox)...)
+
+	delete(a.answers, active)
+	a.answers[deleted] = existing
+
+	return nil
+}
+
+func (a *AnswerRepo) FindDeleted(ctx context.Context, tenantID, key string) ([]datastore.Answer, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	answers := make([]datastore.Answer, 0)
+	for idx, answer := range a.answers {
+		if idx.tenantID != tenantID || idx.status != datastore.DeletedDocumentStatus || (key != "" && idx.key != key) {
+			continue
+		}
+
+		found := cloneAnswer(answer)
+		found.Outbox = nil
+		answers = append(answers, *found)
+	}
+
+	sort.Slice(answers, func(i, j int) bool {
+		if answers[i].Key != answers[j].Key {
+			return answers[i].Key < answers[j].Key
+		}
+
+		return answers[i].DeletedAt > answers[j].DeletedAt
+	})
+
+	return answers, nil
+}
+
+func (a *AnswerRepo) Restore(ctx context.Context, answer *datastore.Answer) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	deleted := answerIndex{tenantID: answer.TenantID, key: answer.Key, status: datastore.DeletedDocumentStatus, uid: answer.UID}
+	existing, ok := a.answers[deleted]
+	if !ok {
+		return datastore.ErrAnswerNotFound
+	}
+
+	active := answerIndex{tenantID: answer.TenantID, key: answer.Key, status: datastore.ActiveDocumentStatus}
+	if _, ok := a.answers[active]; ok {
+		return datastore.ErrDuplicateKey
+	}
+
+	existing.DocumentStatus = datastore.ActiveDocumentStatus
+	existing.DeletedAt = 0
+	existing.ExpiresAt = 0
+	existing.Outbox = append(existing.Outbox, cloneOutbox(answer.Outbox)...)
+
+	delete(a.answers, deleted)
+	a.answers[active] = existing
+
+	return nil
+}
+
+func (a *AnswerRepo) FindDeletedBefore(ctx context.Context, tenantID string, before primitive.DateTime) ([]datastore.Answer, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	answers := make([]datastore.Answer, 0)
+	for idx, answer := range a.answers {
+		if (tenantID != "" && idx.tenantID != tenantID) || idx.status != datastore.DeletedDocumentStatus || answer.DeletedAt >= before {
+			continue
+		}
+
+		found := cloneAnswer(answer)
+		found.Outbox = nil
+		answers = append(answers, *found)
+	}
+
+	sort.Slice(answers, func(i, j int) bool {
+		if answers[i].TenantID != answers[j].TenantID {
+			return answers[i].TenantID < answers[j].TenantID
+		}
+
+		if answers[i].Key != answers[j].Key {
+			return answers[i].Key < answers[j].Key
+		}
+
+		return answers[i].DeletedAt > answers[j].DeletedAt
+	})
+
+	return answers, nil
+}
+
+func (a *AnswerRepo) Purge(ctx context.Context, answer *datastore.Answer) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	deleted := answerIndex{tenantID: answer.TenantID, key: answer.Key, status: datastore.DeletedDocumentStatus, uid: answer.UID}
+	existing, ok := a.answers[deleted]
+	if !ok {
+		return datastore.ErrAnswerNotFound
+	}
+
+	gen := generationIndex{tenantID: answer.TenantID, key: answer.Key}
+	if existing.Generation > a.purged[gen] {
+		a.purged[gen] = existing.Generation
+	}
+
+	delete(a.answers, deleted)
+	return nil
+}
+
+func (a *AnswerRepo) LastGeneration(ctx context.Context, tenantID, key string) (int64, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	generation := a.purged[generationIndex{tenantID: tenantID, key: key}]
+	for idx, answer := range a.answers {
+		if idx.tenantID == tenantID && idx.key == key && answer.Generation > generation {
+			generation = answer.Generation
+		}
+	}
+
+	return generation, nil
+}
+
+func (a *AnswerRepo) FindExpired(ctx context.Context, before primitive.DateTime, limit int) ([]datastore.Answer, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	answers := make([]datastore.Answer, 0)
+	for idx, answer := range a.answers {
+		if idx.status != datastore.ActiveDocumentStatus || answer.ExpiresAt == 0 || answer.ExpiresAt > before {
+			continue
+		}
+
+		found := cloneAnswer(answer)
+		found.Outbox = nil
+		answers = append(answers, *found)
+	}
+
+	sort.Slice(answers, func(i, j int) bool {
+		return answers[i].ExpiresAt < answers[j].ExpiresAt
+	})
+
+	if len(answers) > limit {
+		answers = answers[:limit]
+	}
+
+	return answers, nil
+}
+
+// checkVersion fails with ErrVersionMismatch when version is set and
+// the active answer isn't the generation of answer at that version.
+func checkVersion(existing *datastore.Answer, found bool, answer *datastore.Answer, version int64) error {
+	if version == 0 {
+		return nil
+	}
+
+	if !found || existing.UID != answer.UID || existing.Version != version {
+		return datastore.ErrVersionMismatch
+	}
+
+	return nil
+}
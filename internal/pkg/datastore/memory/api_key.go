@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKeyRepo indexes keys by their prefix, which the
+// mongo backend keeps unique across tenants.
+type APIKeyRepo struct {
+	mu   sync.RWMutex
+	keys map[string]*datastore.APIKey
+}
+
+func NewAPIKeyRepo() *APIKeyRepo {
+	return &APIKeyRepo{
+		keys: make(map[string]*datastore.APIKey),
+	}
+}
+
+func (a *APIKeyRepo) Create(ctx context.Context, key *datastore.APIKey) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.keys[key.Prefix]; ok {
+		return datastore.ErrDuplicateKey
+	}
+
+	a.keys[key.Prefix] = cloneAPIKey(key)
+	return nil
+}
+
+func (a *APIKeyRepo) FindByUID(ctx context.Context, tenantID, uid string) (*datastore.APIKey, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if key := a.findByUID(uid); key != nil && key.TenantID == tenantID {
+		return cloneAPIKey(key), nil
+	}
+
+	return nil, datastore.ErrAPIKeyNotFound
+}
+
+func (a *APIKeyRepo) FindByPrefix(ctx context.Context, prefix string) (*datastore.APIKey, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	key, ok := a.keys[prefix]
+	if !ok {
+		return nil, datastore.ErrAPIKeyNotFound
+	}
+
+	return cloneAPIKey(key), nil
+}
+
+func (a *APIKeyRepo) FindMany(ctx context.Context, tenantID string) ([]datastore.APIKey, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	keys := make([]datastore.APIKey, 0)
+	for _, key := range a.keys {
+		if key.TenantID == tenantID {
+			keys = append(keys, *cloneAPIKey(key))
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt != keys[j].CreatedAt {
+			return keys[i].CreatedAt < keys[j].CreatedAt
+		}
+		return keys[i].UID < keys[j].UID
+	})
+
+	return keys, nil
+}
+
+func (a *APIKeyRepo) Update(ctx context.Context, key *datastore.APIKey) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	existing := a.findByUID(key.UID)
+	if existing == nil || existing.TenantID != key.TenantID {
+		return datastore.ErrAPIKeyNotFound
+	}
+
+	if other, ok := a.keys[key.Prefix]; ok && other.UID != key.UID {
+		return datastore.ErrDuplicateKey
+	}
+
+	delete(a.keys, existing.Prefix)
+	a.keys[key.Prefix] = cloneAPIKey(key)
+
+	return nil
+}
+
+func (a *APIKeyRepo) TouchLastUsed(ctx context.Context, uid string, at primitive.DateTime) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := a.findByUID(uid)
+	if key == nil {
+		return datastore.ErrAPIKeyNotFound
+	}
+
+	key.LastUsedAt = at
+	return nil
+}
+
+func (a *APIKeyRepo) findByUID(uid string) *datastore.APIKey {
+	for _, key := range a.keys {
+		if key.UID == uid {
+			return key
+		}
+	}
+
+	return nil
+}
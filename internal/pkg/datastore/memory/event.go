@@ -0,0 +1,149 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EventRepo struct {
+	mu     sync.RWMutex
+	events []*datastore.Event
+}
+
+func NewEventRepo() *EventRepo {
+	return &EventRepo{}
+}
+
+func (e *EventRepo) Create(ctx context.Context, event *datastore.Event) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, existing := range e.events {
+		if existing.ID == event.ID {
+			return datastore.ErrDuplicateKey
+		}
+	}
+
+	e.events = append(e.events, cloneEvent(event))
+	return nil
+}
+
+func (e *EventRepo) FindManyByKey(ctx context.Context, tenantID, key string, generation int64, pageable datastore.Pageable) ([]datastore.Event, datastore.PaginationData, error) {
+	if err := pageable.Validate(); err != nil {
+		return make([]datastore.Event, 0), datastore.PaginationData{}, err
+	}
+
+	e.mu.RLock()
+	matches := make([]datastore.Event, 0)
+	for _, event := range e.events {
+		if event.TenantID != tenantID || event.DocumentStatus != datastore.ActiveDocumentStatus || event.Data == nil || event.Data.Key != key {
+			continue
+		}
+
+		if generation != 0 && event.Data.Generation != generation {
+			continue
+		}
+
+		matches = append(matches, *cloneEvent(event))
+	}
+	e.mu.RUnlock()
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if pageable.Sort < 0 {
+			return matches[i].CreatedAt > matches[j].CreatedAt
+		}
+
+		return matches[i].CreatedAt < matches[j].CreatedAt
+	})
+
+	pagination := datastore.NewPaginationData(int64(len(matches)), pageable)
+
+	start, end := pageable.Window(len(matches))
+	return matches[start:end], pagination, nil
+}
+
+func (e *EventRepo) FindExpired(ctx context.Context, tenantID string, before primitive.DateTime, keep int) ([]datastore.Event, error) {
+	e.mu.RLock()
+	byKey := make(map[[2]string][]datastore.Event)
+	for _, event := range e.events {
+		if (tenantID != "" && event.TenantID != tenantID) || event.DocumentStatus != datastore.ActiveDocumentStatus {
+			continue
+		}
+
+		k := [2]string{event.TenantID, eventDataKey(event)}
+		byKey[k] = append(byKey[k], *cloneEvent(event))
+	}
+	e.mu.RUnlock()
+
+	expired := make([]datastore.Event, 0)
+	for _, events := range byKey {
+		// most recent first, so that the events
+		// past keep are at the end
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].CreatedAt > events[j].CreatedAt
+		})
+
+		for i, event := range events {
+			if (before != 0 && event.CreatedAt < before) || (keep != 0 && i >= keep) {
+				expired = append(expired, event)
+			}
+		}
+	}
+
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].CreatedAt < expired[j].CreatedAt
+	})
+
+	return expired, nil
+}
+
+func (e *EventRepo) DeleteByKey(ctx context.Context, tenantID, key string, generation int64) (int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	kept := e.events[:0]
+	var deleted int64
+	for _, event := range e.events {
+		if event.TenantID == tenantID && eventDataKey(event) == key && (generation == 0 || (event.Data != nil && event.Data.Generation == generation)) {
+			deleted++
+			continue
+		}
+
+		kept = append(kept, event)
+	}
+	e.events = kept
+
+	return deleted, nil
+}
+
+func (e *EventRepo) Delete(ctx context.Context, events []datastore.Event) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ids := make(map[primitive.ObjectID]bool, len(events))
+	for _, event := range events {
+		ids[event.ID] = true
+	}
+
+	kept := e.events[:0]
+	for _, event := range e.events {
+		if !ids[event.ID] {
+			kept = append(kept, event)
+		}
+	}
+	e.events = kept
+
+	return nil
+}
+
+func eventDataKey(event *datastore.Event) string {
+	if event.Data == nil {
+		return ""
+	}
+
+	return event.Data.Key
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+)
+
+// legalHoldIndex mirrors the unique (tenant_id, key) index that
+// the mongo backend creates on the legal_holds collection.
+type legalHoldIndex struct {
+	tenantID string
+	key      string
+}
+
+type LegalHoldRepo struct {
+	mu    sync.RWMutex
+	holds map[legalHoldIndex]*datastore.LegalHold
+}
+
+func NewLegalHoldRepo() *LegalHoldRepo {
+	return &LegalHoldRepo{
+		holds: make(map[legalHoldIndex]*datastore.LegalHold),
+	}
+}
+
+func (l *LegalHoldRepo) Create(ctx context.Context, hold *datastore.LegalHold) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	idx := legalHoldIndex{tenantID: hold.TenantID, key: hold.Key}
+	if _, ok := l.holds[idx]; ok {
+		return datastore.ErrDuplicateKey
+	}
+
+	c := *hold
+	l.holds[idx] = &c
+
+	return nil
+}
+
+func (l *LegalHoldRepo) FindMany(ctx context.Context, tenantID string) ([]datastore.LegalHold, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	holds := make([]datastore.LegalHold, 0)
+	for idx, hold := range l.holds {
+		if tenantID == "" || idx.tenantID == tenantID {
+			holds = append(holds, *hold)
+		}
+	}
+
+	sort.Slice(holds, func(i, j int) bool {
+		if holds[i].TenantID != holds[j].TenantID {
+			return holds[i].TenantID < holds[j].TenantID
+		}
+		return holds[i].Key < holds[j].Key
+	})
+
+	return holds, nil
+}
+
+func (l *LegalHoldRepo) Delete(ctx context.Context, tenantID, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	idx := legalHoldIndex{tenantID: tenantID, key: key}
+	if _, ok := l.holds[idx]; !ok {
+		return datastore.ErrLegalHoldNotFound
+	}
+
+	delete(l.holds, idx)
+	return nil
+}
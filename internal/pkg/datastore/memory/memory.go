@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+)
+
+// Client is an in-memory storage backend. It keeps every document in
+// process memory and is meant for local development and tests, where
+// running MongoDB is not desirable.
+type Client struct {
+	AnswerRepo datastore.AnswerRepository
+	EventRepo  datastore.EventRepository
+	OutboxRepo datastore.OutboxRepository
+	SchemaRepo datastore.SchemaRepository
+	APIKeyRepo datastore.APIKeyRepository
+	RoleRepo   datastore.RoleBindingRepository
+	HoldRepo   datastore.LegalHoldRepository
+}
+
+func NewMemoryRepository() *Client {
+	answerRepo := NewAnswerRepo()
+
+	return &Client{
+		AnswerRepo: answerRepo,
+		EventRepo:  NewEventRepo(),
+		OutboxRepo: NewOutboxRepo(answerRepo),
+		SchemaRepo: NewSchemaRepo(),
+		APIKeyRepo: NewAPIKeyRepo(),
+		RoleRepo:   NewRoleBindingRepo(),
+		HoldRepo:   NewLegalHoldRepo(),
+	}
+}
+
+func (c *Client) Answers() datastore.AnswerRepository {
+	return c.AnswerRepo
+}
+
+func (c *Client) Events() datastore.EventRepository {
+	return c.EventRepo
+}
+
+func (c *Client) Outbox() datastore.OutboxRepository {
+	return c.OutboxRepo
+}
+
+func (c *Client) Schemas() datastore.SchemaRepository {
+	return c.SchemaRepo
+}
+
+func (c *Client) APIKeys() datastore.APIKeyRepository {
+	return c.APIKeyRepo
+}
+
+func (c *Client) RoleBindings() datastore.RoleBindingRepository {
+	return c.RoleRepo
+}
+
+func (c *Client) LegalHolds() datastore.LegalHoldRepository {
+	return c.HoldRepo
+}
+
+func (c *Client) Close(ctx context.Context) error {
+	return nil
+}
+
+func cloneAnswer(answer *datastore.Answer) *datastore.Answer {
+	c := *answer
+	c.Values = append([]datastore.Value(nil), answer.Values...)
+	c.Outbox = cloneOutbox(answer.Outbox)
+
+	return &c
+}
+
+func cloneOutbox(outbox []datastore.OutboxMessage) []datastore.OutboxMessage {
+	if outbox == nil {
+		return nil
+	}
+
+	c := make([]datastore.OutboxMessage, 0, len(outbox))
+	for _, message := range outbox {
+		if message.Event != nil {
+			message.Event = cloneEvent(message.Event)
+		}
+
+		c = append(c, message)
+	}
+
+	return c
+}
+
+func cloneEvent(event *datastore.Event) *datastore.Event {
+	c := *event
+	if event.Data != nil {
+		data := *event.Data
+		c.Data = &data
+	}
+
+	return &c
+}
+
+func cloneSchema(schema *datastore.Schema) *datastore.Schema {
+	c := *schema
+	c.Definition = append([]byte(nil), schema.Definition...)
+
+	return &c
+}
+
+func cloneAPIKey(key *datastore.APIKey) *datastore.APIKey {
+	c := *key
+	c.Scopes = append([]string(nil), key.Scopes...)
+
+	return &c
+}
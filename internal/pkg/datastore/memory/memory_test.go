@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/datastore/storetest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) datastore.Store {
+		return NewMemoryRepository()
+	})
+}
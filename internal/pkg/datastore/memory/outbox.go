@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxRepo reads the outbox messages kept on the answers of an
+// AnswerRepo, the same way the mongo backend embeds them.
+type OutboxRepo struct {
+	answers *AnswerRepo
+}
+
+func NewOutboxRepo(answers *AnswerRepo) *OutboxRepo {
+	return &OutboxRepo{answers: answers}
+}
+
+func (o *OutboxRepo) FindDue(ctx context.Context, now primitive.DateTime, limit int) ([]datastore.OutboxMessage, error) {
+	messages := o.find(func(message *datastore.OutboxMessage) bool {
+		return message.Status == datastore.PendingOutboxStatus && message.NextAttemptAt <= now
+	})
+
+	if limit > 0 && len(messages) > limit {
+		messages = messages[:limit]
+	}
+
+	return messages, nil
+}
+
+func (o *OutboxRepo) FindPendingByKey(ctx context.Context, tenantID, key string) ([]datastore.OutboxMessage, error) {
+	messages := o.find(func(message *datastore.OutboxMessage) bool {
+		return message.Status == datastore.PendingOutboxStatus && message.Event.TenantID == tenantID &&
+			message.Event.Data != nil && message.Event.Data.Key == key
+	})
+
+	return messages, nil
+}
+
+func (o *OutboxRepo) Update(ctx context.Context, message *datastore.OutboxMessage) error {
+	o.answers.mu.Lock()
+	defer o.answers.mu.Unlock()
+
+	for _, answer := range o.answers.answers {
+		for i := range answer.Outbox {
+			if answer.Outbox[i].Event.ID == message.Event.ID {
+				answer.Outbox[i] = cloneOutbox([]datastore.OutboxMessage{*message})[0]
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+func (o *OutboxRepo) Delete(ctx context.Context, id primitive.ObjectID) error {
+	o.answers.mu.Lock()
+	defer o.answers.mu.Unlock()
+
+	for _, answer := range o.answers.answers {
+		for i := range answer.Outbox {
+			if answer.Outbox[i].Event.ID == id {
+				answer.Outbox = append(answer.Outbox[:i], answer.Outbox[i+1:]...)
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+func (o *OutboxRepo) find(match func(message *datastore.OutboxMessage) bool) []datastore.OutboxMessage {
+	o.answers.mu.RLock()
+	messages := make([]datastore.OutboxMessage, 0)
+	for _, answer := range o.answers.answers {
+		for i := range answer.Outbox {
+			if match(&answer.Outbox[i]) {
+				messages = append(messages, answer.Outbox[i])
+			}
+		}
+	}
+	messages = cloneOutbox(messages)
+	o.answers.mu.RUnlock()
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		if messages[i].CreatedAt != messages[j].CreatedAt {
+			return messages[i].CreatedAt < messages[j].CreatedAt
+		}
+
+		return messages[i].Event.ID.Hex() < messages[j].Event.ID.Hex()
+	})
+
+	return messages
+}
@@ -0,0 +1,97 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+)
+
+// roleBindingIndex mirrors the unique (tenant_id, subject, pattern)
+// index that the mongo backend creates on the role_bindings collection.
+type roleBindingIndex struct {
+	tenantID string
+	subject  string
+	pattern  string
+}
+
+type RoleBindingRepo struct {
+	mu       sync.RWMutex
+	bindings map[roleBindingIndex]*datastore.RoleBinding
+}
+
+func NewRoleBindingRepo() *RoleBindingRepo {
+	return &RoleBindingRepo{
+		bindings: make(map[roleBindingIndex]*datastore.RoleBinding),
+	}
+}
+
+func (r *RoleBindingRepo) Create(ctx context.Context, binding *datastore.RoleBinding) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	idx := roleBindingIndex{tenantID: binding.TenantID, subject: binding.Subject, pattern: binding.Pattern}
+	if _, ok := r.bindings[idx]; ok {
+		return datastore.ErrDuplicateKey
+	}
+
+	c := *binding
+	r.bindings[idx] = &c
+
+	return nil
+}
+
+func (r *RoleBindingRepo) FindByUID(ctx context.Context, tenantID, uid string) (*datastore.RoleBinding, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, binding := range r.bindings {
+		if binding.TenantID == tenantID && binding.UID == uid {
+			c := *binding
+			return &c, nil
+		}
+	}
+
+	return nil, datastore.ErrRoleBindingNotFound
+}
+
+func (r *RoleBindingRepo) FindMany(ctx context.Context, tenantID string, subjects []string) ([]datastore.RoleBinding, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(subjects))
+	for _, subject := range subjects {
+		wanted[subject] = true
+	}
+
+	bindings := make([]datastore.RoleBinding, 0)
+	for _, binding := range r.bindings {
+		if binding.TenantID == tenantID && (len(subjects) == 0 || wanted[binding.Subject]) {
+			bindings = append(bindings, *binding)
+		}
+	}
+
+	sort.Slice(bindings, func(i, j int) bool {
+		if bindings[i].CreatedAt != bindings[j].CreatedAt {
+			return bindings[i].CreatedAt < bindings[j].CreatedAt
+		}
+		return bindings[i].UID < bindings[j].UID
+	})
+
+	return bindings, nil
+}
+
+func (r *RoleBindingRepo) Delete(ctx context.Context, tenantID, uid string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for idx, binding := range r.bindings {
+		if binding.TenantID == tenantID && binding.UID == uid {
+			delete(r.bindings, idx)
+			return nil
+		}
+	}
+
+	return datastore.ErrRoleBindingNotFound
+}
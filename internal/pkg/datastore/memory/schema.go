@@ -0,0 +1,104 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// schemaIndex mirrors the unique (tenant_id, namespace, version)
+// index that the mongo backend creates on the schemas collection.
+type schemaIndex struct {
+	tenantID  string
+	namespace string
+	version   int
+}
+
+type SchemaRepo struct {
+	mu      sync.RWMutex
+	schemas map[schemaIndex]*datastore.Schema
+}
+
+func NewSchemaRepo() *SchemaRepo {
+	return &SchemaRepo{
+		schemas: make(map[schemaIndex]*datastore.Schema),
+	}
+}
+
+func (s *SchemaRepo) Create(ctx context.Context, schema *datastore.Schema) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := schemaIndex{tenantID: schema.TenantID, namespace: schema.Namespace, version: schema.Version}
+	if _, ok := s.schemas[idx]; ok {
+		return datastore.ErrDuplicateKey
+	}
+
+	s.schemas[idx] = cloneSchema(schema)
+	return nil
+}
+
+func (s *SchemaRepo) FindByUID(ctx context.Context, tenantID, uid string) (*datastore.Schema, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, schema := range s.schemas {
+		if schema.TenantID == tenantID && schema.UID == uid {
+			return cloneSchema(schema), nil
+		}
+	}
+
+	return nil, datastore.ErrSchemaNotFound
+}
+
+func (s *SchemaRepo) FindMany(ctx context.Context, tenantID, namespace string) ([]datastore.Schema, error) {
+	return s.find(func(schema *datastore.Schema) bool {
+		return schema.TenantID == tenantID && (namespace == "" || schema.Namespace == namespace)
+	}), nil
+}
+
+func (s *SchemaRepo) FindActive(ctx context.Context, tenantID string) ([]datastore.Schema, error) {
+	return s.find(func(schema *datastore.Schema) bool {
+		return schema.TenantID == tenantID && schema.Status == datastore.ActiveSchemaStatus
+	}), nil
+}
+
+func (s *SchemaRepo) UpdateStatus(ctx context.Context, tenantID, uid string, status datastore.SchemaStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, schema := range s.schemas {
+		if schema.TenantID == tenantID && schema.UID == uid {
+			schema.Status = status
+			schema.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+			return nil
+		}
+	}
+
+	return datastore.ErrSchemaNotFound
+}
+
+func (s *SchemaRepo) find(match func(schema *datastore.Schema) bool) []datastore.Schema {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schemas := make([]datastore.Schema, 0)
+	for _, schema := range s.schemas {
+		if match(schema) {
+			schemas = append(schemas, *cloneSchema(schema))
+		}
+	}
+
+	sort.Slice(schemas, func(i, j int) bool {
+		if schemas[i].Namespace != schemas[j].Namespace {
+			return schemas[i].Namespace < schemas[j].Namespace
+		}
+		return schemas[i].Version < schemas[j].Version
+	})
+
+	return schemas
+}
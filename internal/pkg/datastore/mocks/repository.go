@@ -10,6 +10,7 @@ import (
 
 	datastore "github.com/dotunj/bequest/internal/pkg/datastore"
 	gomock "github.com/golang/mock/gomock"
+	primitive "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // MockAnswerRepository is a mock of AnswerRepository interface.
@@ -50,47 +51,180 @@ func (mr *MockAnswerRepositoryMockRecorder) Create(ctx, answer interface{}) *gom
 }
 
 // Delete mocks base method.
-func (m *MockAnswerRepository) Delete(ctx context.Context, answer *datastore.Answer) error {
+func (m *MockAnswerRepository) Delete(ctx context.Context, answer *datastore.Answer, version int64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Delete", ctx, answer)
+	ret := m.ctrl.Call(m, "Delete", ctx, answer, version)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Delete indicates an expected call of Delete.
-func (mr *MockAnswerRepositoryMockRecorder) Delete(ctx, answer interface{}) *gomock.Call {
+func (mr *MockAnswerRepositoryMockRecorder) Delete(ctx, answer, version interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockAnswerRepository)(nil).Delete), ctx, answer)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockAnswerRepository)(nil).Delete), ctx, answer, version)
 }
 
 // FindByKey mocks base method.
-func (m *MockAnswerRepository) FindByKey(ctx context.Context, key string) (*datastore.Answer, error) {
+func (m *MockAnswerRepository) FindByKey(ctx context.Context, tenantID, key string) (*datastore.Answer, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindByKey", ctx, key)
+	ret := m.ctrl.Call(m, "FindByKey", ctx, tenantID, key)
 	ret0, _ := ret[0].(*datastore.Answer)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // FindByKey indicates an expected call of FindByKey.
-func (mr *MockAnswerRepositoryMockRecorder) FindByKey(ctx, key interface{}) *gomock.Call {
+func (mr *MockAnswerRepositoryMockRecorder) FindByKey(ctx, tenantID, key interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByKey", reflect.TypeOf((*MockAnswerRepository)(nil).FindByKey), ctx, key)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByKey", reflect.TypeOf((*MockAnswerRepository)(nil).FindByKey), ctx, tenantID, key)
+}
+
+// FindDeleted mocks base method.
+func (m *MockAnswerRepository) FindDeleted(ctx context.Context, tenantID, key string) ([]datastore.Answer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDeleted", ctx, tenantID, key)
+	ret0, _ := ret[0].([]datastore.Answer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDeleted indicates an expected call of FindDeleted.
+func (mr *MockAnswerRepositoryMockRecorder) FindDeleted(ctx, tenantID, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDeleted", reflect.TypeOf((*MockAnswerRepository)(nil).FindDeleted), ctx, tenantID, key)
+}
+
+// FindDeletedBefore mocks base method.
+func (m *MockAnswerRepository) FindDeletedBefore(ctx context.Context, tenantID string, before primitive.DateTime) ([]datastore.Answer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDeletedBefore", ctx, tenantID, before)
+	ret0, _ := ret[0].([]datastore.Answer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDeletedBefore indicates an expected call of FindDeletedBefore.
+func (mr *MockAnswerRepositoryMockRecorder) FindDeletedBefore(ctx, tenantID, before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDeletedBefore", reflect.TypeOf((*MockAnswerRepository)(nil).FindDeletedBefore), ctx, tenantID, before)
+}
+
+// FindExpired mocks base method.
+func (m *MockAnswerRepository) FindExpired(ctx context.Context, before primitive.DateTime, limit int) ([]datastore.Answer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindExpired", ctx, before, limit)
+	ret0, _ := ret[0].([]datastore.Answer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindExpired indicates an expected call of FindExpired.
+func (mr *MockAnswerRepositoryMockRecorder) FindExpired(ctx, before, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindExpired", reflect.TypeOf((*MockAnswerRepository)(nil).FindExpired), ctx, before, limit)
+}
+
+// FindMany mocks base method.
+func (m *MockAnswerRepository) FindMany(ctx context.Context, tenantID string, filter datastore.AnswerFilter) ([]datastore.Answer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindMany", ctx, tenantID, filter)
+	ret0, _ := ret[0].([]datastore.Answer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindMany indicates an expected call of FindMany.
+func (mr *MockAnswerRepositoryMockRecorder) FindMany(ctx, tenantID, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindMany", reflect.TypeOf((*MockAnswerRepository)(nil).FindMany), ctx, tenantID, filter)
+}
+
+// FindManyByPrefix mocks base method.
+func (m *MockAnswerRepository) FindManyByPrefix(ctx context.Context, tenantID, prefix string) ([]datastore.Answer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindManyByPrefix", ctx, tenantID, prefix)
+	ret0, _ := ret[0].([]datastore.Answer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindManyByPrefix indicates an expected call of FindManyByPrefix.
+func (mr *MockAnswerRepositoryMockRecorder) FindManyByPrefix(ctx, tenantID, prefix interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindManyByPrefix", reflect.TypeOf((*MockAnswerRepository)(nil).FindManyByPrefix), ctx, tenantID, prefix)
+}
+
+// LastGeneration mocks base method.
+func (m *MockAnswerRepository) LastGeneration(ctx context.Context, tenantID, key string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LastGeneration", ctx, tenantID, key)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LastGeneration indicates an expected call of LastGeneration.
+func (mr *MockAnswerRepositoryMockRecorder) LastGeneration(ctx, tenantID, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LastGeneration", reflect.TypeOf((*MockAnswerRepository)(nil).LastGeneration), ctx, tenantID, key)
+}
+
+// Purge mocks base method.
+func (m *MockAnswerRepository) Purge(ctx context.Context, answer *datastore.Answer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Purge", ctx, answer)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Purge indicates an expected call of Purge.
+func (mr *MockAnswerRepositoryMockRecorder) Purge(ctx, answer interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockAnswerRepository)(nil).Purge), ctx, answer)
+}
+
+// Restore mocks base method.
+func (m *MockAnswerRepository) Restore(ctx context.Context, answer *datastore.Answer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Restore", ctx, answer)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Restore indicates an expected call of Restore.
+func (mr *MockAnswerRepositoryMockRecorder) Restore(ctx, answer interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restore", reflect.TypeOf((*MockAnswerRepository)(nil).Restore), ctx, answer)
+}
+
+// Search mocks base method.
+func (m *MockAnswerRepository) Search(ctx context.Context, tenantID string, terms []string, limit int) ([]datastore.ScoredAnswer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", ctx, tenantID, terms, limit)
+	ret0, _ := ret[0].([]datastore.ScoredAnswer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockAnswerRepositoryMockRecorder) Search(ctx, tenantID, terms, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockAnswerRepository)(nil).Search), ctx, tenantID, terms, limit)
 }
 
 // Update mocks base method.
-func (m *MockAnswerRepository) Update(ctx context.Context, answer *datastore.Answer, value *datastore.Value) (*datastore.Answer, error) {
+func (m *MockAnswerRepository) Update(ctx context.Context, answer *datastore.Answer, value *datastore.Value, version int64) (*datastore.Answer, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Update", ctx, answer, value)
+	ret := m.ctrl.Call(m, "Update", ctx, answer, value, version)
 	ret0, _ := ret[0].(*datastore.Answer)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Update indicates an expected call of Update.
-func (mr *MockAnswerRepositoryMockRecorder) Update(ctx, answer, value interface{}) *gomock.Call {
+func (mr *MockAnswerRepositoryMockRecorder) Update(ctx, answer, value, version interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockAnswerRepository)(nil).Update), ctx, answer, value)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockAnswerRepository)(nil).Update), ctx, answer, value, version)
 }
 
 // MockEventRepository is a mock of EventRepository interface.
@@ -130,10 +264,54 @@ func (mr *MockEventRepositoryMockRecorder) Create(ctx, event interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockEventRepository)(nil).Create), ctx, event)
 }
 
+// Delete mocks base method.
+func (m *MockEventRepository) Delete(ctx context.Context, events []datastore.Event) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, events)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockEventRepositoryMockRecorder) Delete(ctx, events interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockEventRepository)(nil).Delete), ctx, events)
+}
+
+// DeleteByKey mocks base method.
+func (m *MockEventRepository) DeleteByKey(ctx context.Context, tenantID, key string, generation int64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteByKey", ctx, tenantID, key, generation)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteByKey indicates an expected call of DeleteByKey.
+func (mr *MockEventRepositoryMockRecorder) DeleteByKey(ctx, tenantID, key, generation interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteByKey", reflect.TypeOf((*MockEventRepository)(nil).DeleteByKey), ctx, tenantID, key, generation)
+}
+
+// FindExpired mocks base method.
+func (m *MockEventRepository) FindExpired(ctx context.Context, tenantID string, before primitive.DateTime, keep int) ([]datastore.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindExpired", ctx, tenantID, before, keep)
+	ret0, _ := ret[0].([]datastore.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindExpired indicates an expected call of FindExpired.
+func (mr *MockEventRepositoryMockRecorder) FindExpired(ctx, tenantID, before, keep interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindExpired", reflect.TypeOf((*MockEventRepository)(nil).FindExpired), ctx, tenantID, before, keep)
+}
+
 // FindManyByKey mocks base method.
-func (m *MockEventRepository) FindManyByKey(ctx context.Context, key string, pageable datastore.Pageable) ([]datastore.Event, datastore.PaginationData, error) {
+func (m *MockEventRepository) FindManyByKey(ctx context.Context, tenantID, key string, generation int64, pageable datastore.Pageable) ([]datastore.Event, datastore.PaginationData, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindManyByKey", ctx, key, pageable)
+	ret := m.ctrl.Call(m, "FindManyByKey", ctx, tenantID, key, generation, pageable)
 	ret0, _ := ret[0].([]datastore.Event)
 	ret1, _ := ret[1].(datastore.PaginationData)
 	ret2, _ := ret[2].(error)
@@ -141,7 +319,613 @@ func (m *MockEventRepository) FindManyByKey(ctx context.Context, key string, pag
 }
 
 // FindManyByKey indicates an expected call of FindManyByKey.
-func (mr *MockEventRepositoryMockRecorder) FindManyByKey(ctx, key, pageable interface{}) *gomock.Call {
+func (mr *MockEventRepositoryMockRecorder) FindManyByKey(ctx, tenantID, key, generation, pageable interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindManyByKey", reflect.TypeOf((*MockEventRepository)(nil).FindManyByKey), ctx, tenantID, key, generation, pageable)
+}
+
+// MockOutboxRepository is a mock of OutboxRepository interface.
+type MockOutboxRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockOutboxRepositoryMockRecorder
+}
+
+// MockOutboxRepositoryMockRecorder is the mock recorder for MockOutboxRepository.
+type MockOutboxRepositoryMockRecorder struct {
+	mock *MockOutboxRepository
+}
+
+// NewMockOutboxRepository creates a new mock instance.
+func NewMockOutboxRepository(ctrl *gomock.Controller) *MockOutboxRepository {
+	mock := &MockOutboxRepository{ctrl: ctrl}
+	mock.recorder = &MockOutboxRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOutboxRepository) EXPECT() *MockOutboxRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockOutboxRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockOutboxRepositoryMockRecorder) Delete(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockOutboxRepository)(nil).Delete), ctx, id)
+}
+
+// FindDue mocks base method.
+func (m *MockOutboxRepository) FindDue(ctx context.Context, now primitive.DateTime, limit int) ([]datastore.OutboxMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDue", ctx, now, limit)
+	ret0, _ := ret[0].([]datastore.OutboxMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDue indicates an expected call of FindDue.
+func (mr *MockOutboxRepositoryMockRecorder) FindDue(ctx, now, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDue", reflect.TypeOf((*MockOutboxRepository)(nil).FindDue), ctx, now, limit)
+}
+
+// FindPendingByKey mocks base method.
+func (m *MockOutboxRepository) FindPendingByKey(ctx context.Context, tenantID, key string) ([]datastore.OutboxMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindPendingByKey", ctx, tenantID, key)
+	ret0, _ := ret[0].([]datastore.OutboxMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindPendingByKey indicates an expected call of FindPendingByKey.
+func (mr *MockOutboxRepositoryMockRecorder) FindPendingByKey(ctx, tenantID, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindPendingByKey", reflect.TypeOf((*MockOutboxRepository)(nil).FindPendingByKey), ctx, tenantID, key)
+}
+
+// Update mocks base method.
+func (m *MockOutboxRepository) Update(ctx context.Context, message *datastore.OutboxMessage) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, message)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockOutboxRepositoryMockRecorder) Update(ctx, message interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockOutboxRepository)(nil).Update), ctx, message)
+}
+
+// MockSchemaRepository is a mock of SchemaRepository interface.
+type MockSchemaRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockSchemaRepositoryMockRecorder
+}
+
+// MockSchemaRepositoryMockRecorder is the mock recorder for MockSchemaRepository.
+type MockSchemaRepositoryMockRecorder struct {
+	mock *MockSchemaRepository
+}
+
+// NewMockSchemaRepository creates a new mock instance.
+func NewMockSchemaRepository(ctrl *gomock.Controller) *MockSchemaRepository {
+	mock := &MockSchemaRepository{ctrl: ctrl}
+	mock.recorder = &MockSchemaRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSchemaRepository) EXPECT() *MockSchemaRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockSchemaRepository) Create(ctx context.Context, schema *datastore.Schema) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, schema)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockSchemaRepositoryMockRecorder) Create(ctx, schema interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockSchemaRepository)(nil).Create), ctx, schema)
+}
+
+// FindActive mocks base method.
+func (m *MockSchemaRepository) FindActive(ctx context.Context, tenantID string) ([]datastore.Schema, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindActive", ctx, tenantID)
+	ret0, _ := ret[0].([]datastore.Schema)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindActive indicates an expected call of FindActive.
+func (mr *MockSchemaRepositoryMockRecorder) FindActive(ctx, tenantID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindActive", reflect.TypeOf((*MockSchemaRepository)(nil).FindActive), ctx, tenantID)
+}
+
+// FindByUID mocks base method.
+func (m *MockSchemaRepository) FindByUID(ctx context.Context, tenantID, uid string) (*datastore.Schema, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByUID", ctx, tenantID, uid)
+	ret0, _ := ret[0].(*datastore.Schema)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByUID indicates an expected call of FindByUID.
+func (mr *MockSchemaRepositoryMockRecorder) FindByUID(ctx, tenantID, uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByUID", reflect.TypeOf((*MockSchemaRepository)(nil).FindByUID), ctx, tenantID, uid)
+}
+
+// FindMany mocks base method.
+func (m *MockSchemaRepository) FindMany(ctx context.Context, tenantID, namespace string) ([]datastore.Schema, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindMany", ctx, tenantID, namespace)
+	ret0, _ := ret[0].([]datastore.Schema)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindMany indicates an expected call of FindMany.
+func (mr *MockSchemaRepositoryMockRecorder) FindMany(ctx, tenantID, namespace interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindMany", reflect.TypeOf((*MockSchemaRepository)(nil).FindMany), ctx, tenantID, namespace)
+}
+
+// UpdateStatus mocks base method.
+func (m *MockSchemaRepository) UpdateStatus(ctx context.Context, tenantID, uid string, status datastore.SchemaStatus) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateStatus", ctx, tenantID, uid, status)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateStatus indicates an expected call of UpdateStatus.
+func (mr *MockSchemaRepositoryMockRecorder) UpdateStatus(ctx, tenantID, uid, status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateStatus", reflect.TypeOf((*MockSchemaRepository)(nil).UpdateStatus), ctx, tenantID, uid, status)
+}
+
+// MockAPIKeyRepository is a mock of APIKeyRepository interface.
+type MockAPIKeyRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockAPIKeyRepositoryMockRecorder
+}
+
+// MockAPIKeyRepositoryMockRecorder is the mock recorder for MockAPIKeyRepository.
+type MockAPIKeyRepositoryMockRecorder struct {
+	mock *MockAPIKeyRepository
+}
+
+// NewMockAPIKeyRepository creates a new mock instance.
+func NewMockAPIKeyRepository(ctrl *gomock.Controller) *MockAPIKeyRepository {
+	mock := &MockAPIKeyRepository{ctrl: ctrl}
+	mock.recorder = &MockAPIKeyRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAPIKeyRepository) EXPECT() *MockAPIKeyRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockAPIKeyRepository) Create(ctx context.Context, key *datastore.APIKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockAPIKeyRepositoryMockRecorder) Create(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockAPIKeyRepository)(nil).Create), ctx, key)
+}
+
+// FindByPrefix mocks base method.
+func (m *MockAPIKeyRepository) FindByPrefix(ctx context.Context, prefix string) (*datastore.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByPrefix", ctx, prefix)
+	ret0, _ := ret[0].(*datastore.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByPrefix indicates an expected call of FindByPrefix.
+func (mr *MockAPIKeyRepositoryMockRecorder) FindByPrefix(ctx, prefix interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByPrefix", reflect.TypeOf((*MockAPIKeyRepository)(nil).FindByPrefix), ctx, prefix)
+}
+
+// FindByUID mocks base method.
+func (m *MockAPIKeyRepository) FindByUID(ctx context.Context, tenantID, uid string) (*datastore.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByUID", ctx, tenantID, uid)
+	ret0, _ := ret[0].(*datastore.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByUID indicates an expected call of FindByUID.
+func (mr *MockAPIKeyRepositoryMockRecorder) FindByUID(ctx, tenantID, uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByUID", reflect.TypeOf((*MockAPIKeyRepository)(nil).FindByUID), ctx, tenantID, uid)
+}
+
+// FindMany mocks base method.
+func (m *MockAPIKeyRepository) FindMany(ctx context.Context, tenantID string) ([]datastore.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindMany", ctx, tenantID)
+	ret0, _ := ret[0].([]datastore.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindMany indicates an expected call of FindMany.
+func (mr *MockAPIKeyRepositoryMockRecorder) FindMany(ctx, tenantID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindMany", reflect.TypeOf((*MockAPIKeyRepository)(nil).FindMany), ctx, tenantID)
+}
+
+// TouchLastUsed mocks base method.
+func (m *MockAPIKeyRepository) TouchLastUsed(ctx context.Context, uid string, at primitive.DateTime) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchLastUsed", ctx, uid, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchLastUsed indicates an expected call of TouchLastUsed.
+func (mr *MockAPIKeyRepositoryMockRecorder) TouchLastUsed(ctx, uid, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchLastUsed", reflect.TypeOf((*MockAPIKeyRepository)(nil).TouchLastUsed), ctx, uid, at)
+}
+
+// Update mocks base method.
+func (m *MockAPIKeyRepository) Update(ctx context.Context, key *datastore.APIKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockAPIKeyRepositoryMockRecorder) Update(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockAPIKeyRepository)(nil).Update), ctx, key)
+}
+
+// MockRoleBindingRepository is a mock of RoleBindingRepository interface.
+type MockRoleBindingRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockRoleBindingRepositoryMockRecorder
+}
+
+// MockRoleBindingRepositoryMockRecorder is the mock recorder for MockRoleBindingRepository.
+type MockRoleBindingRepositoryMockRecorder struct {
+	mock *MockRoleBindingRepository
+}
+
+// NewMockRoleBindingRepository creates a new mock instance.
+func NewMockRoleBindingRepository(ctrl *gomock.Controller) *MockRoleBindingRepository {
+	mock := &MockRoleBindingRepository{ctrl: ctrl}
+	mock.recorder = &MockRoleBindingRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRoleBindingRepository) EXPECT() *MockRoleBindingRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockRoleBindingRepository) Create(ctx context.Context, binding *datastore.RoleBinding) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, binding)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockRoleBindingRepositoryMockRecorder) Create(ctx, binding interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRoleBindingRepository)(nil).Create), ctx, binding)
+}
+
+// Delete mocks base method.
+func (m *MockRoleBindingRepository) Delete(ctx context.Context, tenantID, uid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, tenantID, uid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockRoleBindingRepositoryMockRecorder) Delete(ctx, tenantID, uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockRoleBindingRepository)(nil).Delete), ctx, tenantID, uid)
+}
+
+// FindByUID mocks base method.
+func (m *MockRoleBindingRepository) FindByUID(ctx context.Context, tenantID, uid string) (*datastore.RoleBinding, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByUID", ctx, tenantID, uid)
+	ret0, _ := ret[0].(*datastore.RoleBinding)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByUID indicates an expected call of FindByUID.
+func (mr *MockRoleBindingRepositoryMockRecorder) FindByUID(ctx, tenantID, uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByUID", reflect.TypeOf((*MockRoleBindingRepository)(nil).FindByUID), ctx, tenantID, uid)
+}
+
+// FindMany mocks base method.
+func (m *MockRoleBindingRepository) FindMany(ctx context.Context, tenantID string, subjects []string) ([]datastore.RoleBinding, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindMany", ctx, tenantID, subjects)
+	ret0, _ := ret[0].([]datastore.RoleBinding)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindMany indicates an expected call of FindMany.
+func (mr *MockRoleBindingRepositoryMockRecorder) FindMany(ctx, tenantID, subjects interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindMany", reflect.TypeOf((*MockRoleBindingRepository)(nil).FindMany), ctx, tenantID, subjects)
+}
+
+// MockLegalHoldRepository is a mock of LegalHoldRepository interface.
+type MockLegalHoldRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockLegalHoldRepositoryMockRecorder
+}
+
+// MockLegalHoldRepositoryMockRecorder is the mock recorder for MockLegalHoldRepository.
+type MockLegalHoldRepositoryMockRecorder struct {
+	mock *MockLegalHoldRepository
+}
+
+// NewMockLegalHoldRepository creates a new mock instance.
+func NewMockLegalHoldRepository(ctrl *gomock.Controller) *MockLegalHoldRepository {
+	mock := &MockLegalHoldRepository{ctrl: ctrl}
+	mock.recorder = &MockLegalHoldRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLegalHoldRepository) EXPECT() *MockLegalHoldRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockLegalHoldRepository) Create(ctx context.Context, hold *datastore.LegalHold) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, hold)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockLegalHoldRepositoryMockRecorder) Create(ctx, hold interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockLegalHoldRepository)(nil).Create), ctx, hold)
+}
+
+// Delete mocks base method.
+func (m *MockLegalHoldRepository) Delete(ctx context.Context, tenantID, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, tenantID, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockLegalHoldRepositoryMockRecorder) Delete(ctx, tenantID, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockLegalHoldRepository)(nil).Delete), ctx, tenantID, key)
+}
+
+// FindMany mocks base method.
+func (m *MockLegalHoldRepository) FindMany(ctx context.Context, tenantID string) ([]datastore.LegalHold, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindMany", ctx, tenantID)
+	ret0, _ := ret[0].([]datastore.LegalHold)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindMany indicates an expected call of FindMany.
+func (mr *MockLegalHoldRepositoryMockRecorder) FindMany(ctx, tenantID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindMany", reflect.TypeOf((*MockLegalHoldRepository)(nil).FindMany), ctx, tenantID)
+}
+
+// MockStore is a mock of Store interface.
+type MockStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockStoreMockRecorder
+}
+
+// MockStoreMockRecorder is the mock recorder for MockStore.
+type MockStoreMockRecorder struct {
+	mock *MockStore
+}
+
+// NewMockStore creates a new mock instance.
+func NewMockStore(ctrl *gomock.Controller) *MockStore {
+	mock := &MockStore{ctrl: ctrl}
+	mock.recorder = &MockStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStore) EXPECT() *MockStoreMockRecorder {
+	return m.recorder
+}
+
+// APIKeys mocks base method.
+func (m *MockStore) APIKeys() datastore.APIKeyRepository {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "APIKeys")
+	ret0, _ := ret[0].(datastore.APIKeyRepository)
+	return ret0
+}
+
+// APIKeys indicates an expected call of APIKeys.
+func (mr *MockStoreMockRecorder) APIKeys() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "APIKeys", reflect.TypeOf((*MockStore)(nil).APIKeys))
+}
+
+// Answers mocks base method.
+func (m *MockStore) Answers() datastore.AnswerRepository {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Answers")
+	ret0, _ := ret[0].(datastore.AnswerRepository)
+	return ret0
+}
+
+// Answers indicates an expected call of Answers.
+func (mr *MockStoreMockRecorder) Answers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Answers", reflect.TypeOf((*MockStore)(nil).Answers))
+}
+
+// Close mocks base method.
+func (m *MockStore) Close(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockStoreMockRecorder) Close(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStore)(nil).Close), ctx)
+}
+
+// Events mocks base method.
+func (m *MockStore) Events() datastore.EventRepository {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Events")
+	ret0, _ := ret[0].(datastore.EventRepository)
+	return ret0
+}
+
+// Events indicates an expected call of Events.
+func (mr *MockStoreMockRecorder) Events() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Events", reflect.TypeOf((*MockStore)(nil).Events))
+}
+
+// LegalHolds mocks base method.
+func (m *MockStore) LegalHolds() datastore.LegalHoldRepository {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LegalHolds")
+	ret0, _ := ret[0].(datastore.LegalHoldRepository)
+	return ret0
+}
+
+// LegalHolds indicates an expected call of LegalHolds.
+func (mr *MockStoreMockRecorder) LegalHolds() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LegalHolds", reflect.TypeOf((*MockStore)(nil).LegalHolds))
+}
+
+// Outbox mocks base method.
+func (m *MockStore) Outbox() datastore.OutboxRepository {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Outbox")
+	ret0, _ := ret[0].(datastore.OutboxRepository)
+	return ret0
+}
+
+// Outbox indicates an expected call of Outbox.
+func (mr *MockStoreMockRecorder) Outbox() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Outbox", reflect.TypeOf((*MockStore)(nil).Outbox))
+}
+
+// RoleBindings mocks base method.
+func (m *MockStore) RoleBindings() datastore.RoleBindingRepository {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RoleBindings")
+	ret0, _ := ret[0].(datastore.RoleBindingRepository)
+	return ret0
+}
+
+// RoleBindings indicates an expected call of RoleBindings.
+func (mr *MockStoreMockRecorder) RoleBindings() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RoleBindings", reflect.TypeOf((*MockStore)(nil).RoleBindings))
+}
+
+// Schemas mocks base method.
+func (m *MockStore) Schemas() datastore.SchemaRepository {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Schemas")
+	ret0, _ := ret[0].(datastore.SchemaRepository)
+	return ret0
+}
+
+// Schemas indicates an expected call of Schemas.
+func (mr *MockStoreMockRecorder) Schemas() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Schemas", reflect.TypeOf((*MockStore)(nil).Schemas))
+}
+
+// MockTransactor is a mock of Transactor interface.
+type MockTransactor struct {
+	ctrl     *gomock.Controller
+	recorder *MockTransactorMockRecorder
+}
+
+// MockTransactorMockRecorder is the mock recorder for MockTransactor.
+type MockTransactorMockRecorder struct {
+	mock *MockTransactor
+}
+
+// NewMockTransactor creates a new mock instance.
+func NewMockTransactor(ctrl *gomock.Controller) *MockTransactor {
+	mock := &MockTransactor{ctrl: ctrl}
+	mock.recorder = &MockTransactorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTransactor) EXPECT() *MockTransactorMockRecorder {
+	return m.recorder
+}
+
+// WithTransaction mocks base method.
+func (m *MockTransactor) WithTransaction(ctx context.Context, fn func(context.Context) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithTransaction", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithTransaction indicates an expected call of WithTransaction.
+func (mr *MockTransactorMockRecorder) WithTransaction(ctx, fn interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindManyByKey", reflect.TypeOf((*MockEventRepository)(nil).FindManyByKey), ctx, key, pageable)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithTransaction", reflect.TypeOf((*MockTransactor)(nil).WithTransaction), ctx, fn)
 }
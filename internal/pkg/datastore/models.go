@@ -1,7 +1,10 @@
 package datastore
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -9,10 +12,26 @@ import (
 var (
 	ErrAnswerNotFound = errors.New("answer not found")
 	ErrDuplicateKey   = errors.New("an answer with this key already exists")
+	ErrSchemaNotFound = errors.New("schema not found")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+
+	// ErrVersionMismatch is returned by conditional writes
+	// when the answer is no longer at the expected version.
+	ErrVersionMismatch = errors.New("the answer has been modified since it was read")
+
+	ErrRoleBindingNotFound = errors.New("role binding not found")
+	ErrLegalHoldNotFound   = errors.New("legal hold not found")
 )
 
+// DefaultTenant owns the answers written without a tenant, including
+// every answer stored before answers were scoped to tenants.
+const DefaultTenant = "default"
+
 type DocumentStatus string
 type EventType string
+type OutboxStatus string
+type SchemaStatus string
+type Role string
 
 const (
 	ActiveDocumentStatus  DocumentStatus = "Active"
@@ -23,25 +42,193 @@ const (
 	CreateEvent EventType = "create"
 	UpdateEvent EventType = "update"
 	DeleteEvent EventType = "delete"
+
+	// RollbackEvent records a value written back from an
+	// earlier version of the answer.
+	RollbackEvent EventType = "rollback"
+	// RestoreEvent records a deleted answer made active again.
+	RestoreEvent EventType = "restore"
+	// ExpireEvent records an answer deleted once its expiry passed.
+	ExpireEvent EventType = "expire"
+	// ImportEvent records an answer created by an import.
+	ImportEvent EventType = "import"
+)
+
+const (
+	PendingOutboxStatus OutboxStatus = "pending"
+	DeadOutboxStatus    OutboxStatus = "dead"
+)
+
+const (
+	DraftSchemaStatus    SchemaStatus = "draft"
+	ActiveSchemaStatus   SchemaStatus = "active"
+	InactiveSchemaStatus SchemaStatus = "inactive"
 )
 
+// Roles are ordered, each one allowing what the previous one does.
+// Readers read answers and their history, writers also create, update
+// and delete them, and admins also manage the role bindings of the
+// keys they administer.
+const (
+	ReaderRole Role = "reader"
+	WriterRole Role = "writer"
+	AdminRole  Role = "admin"
+)
+
+var roleRanks = map[Role]int{ReaderRole: 1, WriterRole: 2, AdminRole: 3}
+
+func (r Role) IsValid() bool {
+	return roleRanks[r] > 0
+}
+
+// Includes reports whether r allows everything other does.
+func (r Role) Includes(other Role) bool {
+	return r.IsValid() && roleRanks[r] >= roleRanks[other]
+}
+
+// Answer is identified by its key within the tenant owning it, two
+// tenants using the same key own two unrelated answers.
 type Answer struct {
-	ID     primitive.ObjectID `json:"-" bson:"_id"`
-	UID    string             `json:"uid" bson:"uid"`
-	Key    string             `json:"key" bson:"key"`
-	Values []Value            `json:"values" bson:"values"`
+	ID       primitive.ObjectID `json:"-" bson:"_id"`
+	UID      string             `json:"uid" bson:"uid"`
+	TenantID string             `json:"tenant_id" bson:"tenant_id"`
+	Key      string             `json:"key" bson:"key"`
+	Values   []Value            `json:"values" bson:"values"`
+
+	// Version counts the values the answer had, it starts at 1 and is
+	// incremented by every update. Along with UID, which changes when
+	// a deleted key is created again, it identifies a value of the key.
+	Version int64 `json:"version" bson:"version"`
+
+	// Generation numbers the answers a key had, from 1. Each time the
+	// key is created again it gets the next generation, deleted answers
+	// keeping theirs, so any number of them can exist for the key.
+	Generation int64 `json:"generation" bson:"generation"`
 
 	CreatedAt      primitive.DateTime `json:"created_at" bson:"created_at"`
 	UpdatedAt      primitive.DateTime `json:"updated_at" bson:"updated_at"`
 	DeletedAt      primitive.DateTime `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
 	DocumentStatus DocumentStatus     `json:"document_status" bson:"document_status"`
+
+	// ExpiresAt is when the answer expires, zero for answers that
+	// never do. Expired answers are read as not found until they
+	// are deleted by the reaper.
+	ExpiresAt primitive.DateTime `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+
+	// Outbox holds the events describing changes to the answer that are
+	// yet to be dispatched. Repositories persist the messages set on the
+	// answer handed to Create, Update and Delete in the same write as the
+	// mutation, and never return them from reads.
+	Outbox []OutboxMessage `json:"-" bson:"outbox,omitempty"`
+}
+
+// ETag is the entity tag of the current value of the answer, it
+// changes with every update and when the key is created again.
+func (a *Answer) ETag() string {
+	return fmt.Sprintf(`"%s.%d"`, a.UID, a.Version)
+}
+
+// VersionETag is the entity tag of the value of the answer at version,
+// which never changes, values being written once. It is weak, so that
+// it is never taken for the tag of the answer by If-Match.
+func (a *Answer) VersionETag(version int64) string {
+	return fmt.Sprintf(`W/"%s.v%d"`, a.UID, version)
+}
+
+// Expired reports whether the expiry of the answer has passed at t.
+func (a *Answer) Expired(t time.Time) bool {
+	return a.ExpiresAt != 0 && a.ExpiresAt <= primitive.NewDateTimeFromTime(t)
+}
+
+// At returns the answer as it was at t, holding the values written up
+// to then, or false when it didn't exist yet.
+func (a *Answer) At(t time.Time) (*Answer, bool) {
+	at := primitive.NewDateTimeFromTime(t)
+	versions := a.Versions()
+
+	n := 0
+	for n < len(versions) && versions[n].CreatedAt <= at {
+		n++
+	}
+
+	return a.past(versions, n)
+}
+
+// AtVersion returns the answer as it was at version, or false when
+// it never had that version.
+func (a *Answer) AtVersion(version int64) (*Answer, bool) {
+	versions := a.Versions()
+
+	for i, value := range versions {
+		if value.Version == version {
+			return a.past(versions, i+1)
+		}
+	}
+
+	return nil, false
+}
+
+// Versions returns a copy of the values of the answer, oldest first,
+// each with its version and the time it was written.
+func (a *Answer) Versions() []Value {
+	versions := make([]Value, len(a.Values))
+	copy(versions, a.Values)
+
+	NumberValues(versions)
+	for i, t := range a.valueTimes() {
+		versions[i].CreatedAt = t
+	}
+
+	return versions
+}
+
+// past returns the answer as it was when it had the first n versions.
+func (a *Answer) past(versions []Value, n int) (*Answer, bool) {
+	if n == 0 {
+		return nil, false
+	}
+
+	past := *a
+	past.Values = versions[:n:n]
+	past.Version = versions[n-1].Version
+	past.UpdatedAt = versions[n-1].CreatedAt
+
+	return &past, true
+}
+
+// valueTimes returns when each value of the answer was written. Values
+// written before their time was recorded are dated from the answer: the
+// first one from its creation, the latest one from its last update, and
+// the others, whose time is unknown, from the value before them.
+func (a *Answer) valueTimes() []primitive.DateTime {
+	times := make([]primitive.DateTime, len(a.Values))
+
+	for i, value := range a.Values {
+		switch {
+		case value.CreatedAt != 0:
+			times[i] = value.CreatedAt
+		case i == 0:
+			times[i] = a.CreatedAt
+		case i == len(a.Values)-1:
+			times[i] = a.UpdatedAt
+		default:
+			times[i] = times[i-1]
+		}
+	}
+
+	return times
 }
 
 type Event struct {
-	ID   primitive.ObjectID `json:"-" bson:"_id"`
-	UID  string             `json:"uid" bson:"uid"`
-	Type EventType          `json:"event" bson:"event"`
-	Data *EventData         `json:"data" bson:"data"`
+	ID       primitive.ObjectID `json:"-" bson:"_id"`
+	UID      string             `json:"uid" bson:"uid"`
+	TenantID string             `json:"tenant_id" bson:"tenant_id"`
+	Type     EventType          `json:"event" bson:"event"`
+	Data     *EventData         `json:"data" bson:"data"`
+
+	// Actor is the subject of the principal who caused
+	// the event, empty when auth is disabled.
+	Actor string `json:"actor,omitempty" bson:"actor,omitempty"`
 
 	CreatedAt      primitive.DateTime `json:"created_at" bson:"created_at"`
 	UpdatedAt      primitive.DateTime `json:"updated_at" bson:"updated_at"`
@@ -49,9 +236,89 @@ type Event struct {
 	DocumentStatus DocumentStatus     `json:"document_status" bson:"document_status"`
 }
 
-type AnswerEvent struct {
-	Answer *Answer   `json:"answer"`
-	Type   EventType `json:"event"`
+// OutboxMessage is an event waiting to be moved to the events
+// collection. It is identified by the id of the event it carries.
+type OutboxMessage struct {
+	Event         *Event             `json:"event" bson:"event"`
+	Status        OutboxStatus       `json:"status" bson:"status"`
+	Attempts      int                `json:"attempts" bson:"attempts"`
+	LastError     string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	NextAttemptAt primitive.DateTime `json:"next_attempt_at" bson:"next_attempt_at"`
+	CreatedAt     primitive.DateTime `json:"created_at" bson:"created_at"`
+}
+
+// Schema is a version of the JSON Schema that answer values must match
+// when their key starts with Namespace. Definitions never change, a new
+// version is created instead, and at most one version of a namespace
+// is active at a time. Namespaces are scoped to a tenant.
+type Schema struct {
+	ID         primitive.ObjectID `json:"-" bson:"_id"`
+	UID        string             `json:"uid" bson:"uid"`
+	TenantID   string             `json:"tenant_id" bson:"tenant_id"`
+	Namespace  string             `json:"namespace" bson:"namespace"`
+	Version    int                `json:"version" bson:"version"`
+	Definition json.RawMessage    `json:"definition" bson:"definition"`
+	Status     SchemaStatus       `json:"status" bson:"status"`
+
+	CreatedAt primitive.DateTime `json:"created_at" bson:"created_at"`
+	UpdatedAt primitive.DateTime `json:"updated_at" bson:"updated_at"`
+}
+
+// SchemaViolation describes a part of an answer value that doesn't
+// match a schema. Path is a JSON pointer to it within the value.
+type SchemaViolation struct {
+	Key     string `json:"key,omitempty"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// APIKey authenticates a service calling the API on behalf of a
+// tenant. Only the hash of the key is stored, Prefix identifies it
+// so that it can be looked up when a request presents it.
+type APIKey struct {
+	ID       primitive.ObjectID `json:"-" bson:"_id"`
+	UID      string             `json:"uid" bson:"uid"`
+	TenantID string             `json:"tenant_id" bson:"tenant_id"`
+	Name     string             `json:"name" bson:"name"`
+	Prefix   string             `json:"prefix" bson:"prefix"`
+	Hash     string             `json:"-" bson:"hash"`
+	Scopes   []string           `json:"scopes" bson:"scopes"`
+
+	ExpiresAt  primitive.DateTime `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	LastUsedAt primitive.DateTime `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	RevokedAt  primitive.DateTime `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	CreatedAt  primitive.DateTime `json:"created_at" bson:"created_at"`
+	UpdatedAt  primitive.DateTime `json:"updated_at" bson:"updated_at"`
+}
+
+// RoleBinding grants Role to Subject on the answers whose key matches
+// Pattern, which is either a key or a prefix followed by '*', such as
+// billing/*. Subject is the subject of a principal, such as the sub
+// claim of a token, or group:<name> for the members of a group.
+type RoleBinding struct {
+	ID       primitive.ObjectID `json:"-" bson:"_id"`
+	UID      string             `json:"uid" bson:"uid"`
+	TenantID string             `json:"tenant_id" bson:"tenant_id"`
+	Subject  string             `json:"subject" bson:"subject"`
+	Role     Role               `json:"role" bson:"role"`
+	Pattern  string             `json:"pattern" bson:"pattern"`
+
+	CreatedAt primitive.DateTime `json:"created_at" bson:"created_at"`
+	UpdatedAt primitive.DateTime `json:"updated_at" bson:"updated_at"`
+}
+
+// LegalHold keeps every generation of an answer, and its history, from
+// being purged by the retention policy until the hold is lifted.
+type LegalHold struct {
+	ID       primitive.ObjectID `json:"-" bson:"_id"`
+	TenantID string             `json:"tenant_id" bson:"tenant_id"`
+	Key      string             `json:"key" bson:"key"`
+	Reason   string             `json:"reason" bson:"reason"`
+
+	// CreatedBy is the subject of the principal that placed
+	// the hold, empty when it was placed anonymously.
+	CreatedBy string             `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt primitive.DateTime `json:"created_at" bson:"created_at"`
 }
 
 type Pageable struct {
@@ -69,33 +336,423 @@ type PaginationData struct {
 	TotalPage int64 `json:"totalPage"`
 }
 
+// AnswerSort is the field answers are listed by. Answers sharing the
+// same value are listed by key, then generation, in the same direction.
+type AnswerSort string
+
+const (
+	KeyAnswerSort       AnswerSort = "key"
+	CreatedAtAnswerSort AnswerSort = "created_at"
+	UpdatedAtAnswerSort AnswerSort = "updated_at"
+)
+
+func (s AnswerSort) IsValid() bool {
+	switch s {
+	case KeyAnswerSort, CreatedAtAnswerSort, UpdatedAtAnswerSort:
+		return true
+	}
+
+	return false
+}
+
+// AnswerFilter selects the answers of a tenant that are listed, every
+// condition being ignored when zero. Its zero value lists every active
+// answer by key.
+type AnswerFilter struct {
+	// Status is the status of the answers listed, active when empty.
+	Status DocumentStatus
+
+	// Prefix and Regex match the key, Regex being in RE2 syntax.
+	Prefix string
+	Regex  string
+
+	// UpdatedSince is the earliest last update of the answers
+	// listed, and CreatedBefore the time they were created before.
+	UpdatedSince  primitive.DateTime
+	CreatedBefore primitive.DateTime
+
+	// ExpiresAfter leaves out the answers expiring at or before it.
+	ExpiresAfter primitive.DateTime
+
+	SortBy     AnswerSort
+	Descending bool
+
+	// After lists the answers sorted after the cursor, which
+	// must have been taken with the same sort.
+	After *AnswerCursor
+
+	// Limit is the maximum number of answers listed.
+	Limit int
+}
+
+// AnswerCursor is the position of an answer in a listing: the time it
+// is sorted by, unless it is sorted by key, then its key and generation.
+type AnswerCursor struct {
+	Time       primitive.DateTime `json:"time,omitempty"`
+	Key        string             `json:"key"`
+	Generation int64              `json:"generation"`
+}
+
 type EventData struct {
-	Key   string `json:"key" bson:"key"`
-	Value string `json:"value" bson:"value"`
+	Key   string      `json:"key" bson:"key"`
+	Value interface{} `json:"value" bson:"value"`
+	Type  ValueType   `json:"type,omitempty" bson:"type,omitempty"`
+
+	// Generation is the generation of the answer the event changed,
+	// see Answer.Generation.
+	Generation int64 `json:"generation,omitempty" bson:"generation,omitempty"`
+
+	// Version and SourceVersion are set by rollbacks, to the version
+	// written and to the version whose value was written back.
+	Version       int64 `json:"version,omitempty" bson:"version,omitempty"`
+	SourceVersion int64 `json:"source_version,omitempty" bson:"source_version,omitempty"`
 }
 
+// Value holds any JSON value, see ParseValue for the Go types
+// it is made of. Type is empty for values stored before types
+// were recorded, which are all strings.
 type Value struct {
-	Value string `json:"value" bson:"value"`
+	Value interface{} `json:"value" bson:"value"`
+	Type  ValueType   `json:"type,omitempty" bson:"type,omitempty"`
+
+	// Version numbers the value within its answer, from 1. Stores
+	// that don't record it number values from the one before them.
+	Version int64 `json:"version,omitempty" bson:"version,omitempty"`
+
+	// Author is the subject of the principal who wrote the value,
+	// empty when auth is disabled or for older values.
+	Author string `json:"author,omitempty" bson:"author,omitempty"`
+
+	// CreatedAt is when the value was written, it is zero for
+	// values written before their time was recorded.
+	CreatedAt primitive.DateTime `json:"created_at,omitempty" bson:"created_at,omitempty"`
+}
+
+// NumberValues sets the version of values stored without one, each
+// following the value before it, the first value being version 1.
+func NumberValues(values []Value) {
+	var previous int64
+	for i := range values {
+		if values[i].Version == 0 {
+			values[i].Version = previous + 1
+		}
+
+		previous = values[i].Version
+	}
 }
 
+// CreateAnswer accepts any JSON value. Type is
+// inferred from the value when it isn't declared.
 type CreateAnswer struct {
-	Key   string `json:"key" binding:"required"`
-	Value string `json:"value" binding:"required"`
+	Key   string          `json:"key" binding:"required"`
+	Value json.RawMessage `json:"value"`
+	Type  ValueType       `json:"type"`
+	Expiry
 }
 
+// UpdateAnswer keeps the expiry of the answer unless a new one is
+// set, or Persist is set to remove it.
 type UpdateAnswer struct {
-	Value string `json:"value" binding:"required"`
+	Value   json.RawMessage `json:"value"`
+	Type    ValueType       `json:"type"`
+	Persist bool            `json:"persist"`
+	Expiry
+}
+
+// Expiry makes an answer expire TTL seconds from now, or at
+// ExpiresAt. The answer never expires when neither is set.
+type Expiry struct {
+	TTL       int64      `json:"ttl"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// AnswerQuery requests a page of the answer listing. Sort is the field
+// answers are sorted by, prefixed with '-' for a descending sort, and
+// Cursor continues a listing from the page it was returned with.
+type AnswerQuery struct {
+	Status        string    `form:"status"`
+	Prefix        string    `form:"prefix"`
+	Regex         string    `form:"regex"`
+	UpdatedSince  time.Time `form:"updated_since" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	Sort          string    `form:"sort"`
+	Cursor        string    `form:"cursor"`
+	PerPage       int       `form:"perPage"`
+}
+
+// SearchQuery looks for the answers whose current value mentions
+// any word of Text, or any of their values when History is set.
+type SearchQuery struct {
+	Text    string `form:"q"`
+	History bool   `form:"history"`
+}
+
+// BatchOperationType is what an operation of a batch does to its key.
+type BatchOperationType string
+
+const (
+	CreateBatchOperation BatchOperationType = "create"
+	UpdateBatchOperation BatchOperationType = "update"
+	DeleteBatchOperation BatchOperationType = "delete"
+)
+
+// BatchRequest applies Operations in order. When Atomic is set
+// either all of them are applied or, if one fails, none is.
+type BatchRequest struct {
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations" binding:"required"`
+}
+
+// BatchOperation creates, updates or deletes the answer of Key, taking
+// the fields of CreateAnswer or UpdateAnswer. IfMatch makes an update
+// or a delete conditional, like the If-Match header.
+type BatchOperation struct {
+	Op      BatchOperationType `json:"op"`
+	Key     string             `json:"key"`
+	Value   json.RawMessage    `json:"value"`
+	Type    ValueType          `json:"type"`
+	Persist bool               `json:"persist"`
+	IfMatch string             `json:"if_match"`
+	Expiry
+}
+
+// TransferFormat is the encoding answers are exported and imported in.
+type TransferFormat string
+
+const (
+	NDJSONFormat TransferFormat = "ndjson"
+	CSVFormat    TransferFormat = "csv"
+)
+
+// ConflictPolicy decides what an import does with the records
+// of keys that already have an active answer.
+type ConflictPolicy string
+
+const (
+	// SkipConflictPolicy leaves the existing answer alone.
+	SkipConflictPolicy ConflictPolicy = "skip"
+	// OverwriteConflictPolicy deletes the existing answer, which
+	// is kept like any deleted answer, before importing the record.
+	OverwriteConflictPolicy ConflictPolicy = "overwrite"
+	// FailConflictPolicy stops the import at the record.
+	FailConflictPolicy ConflictPolicy = "fail"
+)
+
+// IsValid reports whether p is a known conflict policy.
+func (p ConflictPolicy) IsValid() bool {
+	switch p {
+	case SkipConflictPolicy, OverwriteConflictPolicy, FailConflictPolicy:
+		return true
+	default:
+		return false
+	}
+}
+
+// ExportQuery selects the answers exported, like AnswerQuery, and
+// whether their versions and history are exported along with them.
+type ExportQuery struct {
+	Format  string `form:"format"`
+	Prefix  string `form:"prefix"`
+	Regex   string `form:"regex"`
+	History bool   `form:"history"`
+	Events  bool   `form:"events"`
+}
+
+// ImportQuery sets the encoding of an import, inferred from its
+// content type when empty, and its conflict policy, skip by default.
+type ImportQuery struct {
+	Format     string `form:"format"`
+	OnConflict string `form:"on_conflict"`
+}
+
+// AnswerRecord is an active answer as it is exported and imported. An
+// imported answer gets the values of Versions when there are any, in
+// the order they are listed, and Value otherwise. Events are imported
+// into the history of the answer.
+type AnswerRecord struct {
+	Key       string             `json:"key"`
+	Value     json.RawMessage    `json:"value"`
+	Type      ValueType          `json:"type,omitempty"`
+	Version   int64              `json:"version,omitempty"`
+	CreatedAt primitive.DateTime `json:"created_at,omitempty"`
+	UpdatedAt primitive.DateTime `json:"updated_at,omitempty"`
+	ExpiresAt primitive.DateTime `json:"expires_at,omitempty"`
+	Versions  []VersionRecord    `json:"versions,omitempty"`
+	Events    []Event            `json:"events,omitempty"`
+}
+
+// VersionRecord is a value of an answer as it is exported and imported.
+type VersionRecord struct {
+	Version   int64              `json:"version,omitempty"`
+	Value     json.RawMessage    `json:"value"`
+	Type      ValueType          `json:"type,omitempty"`
+	Author    string             `json:"author,omitempty"`
+	CreatedAt primitive.DateTime `json:"created_at,omitempty"`
+}
+
+// RollbackAnswer selects the version to write back, either
+// by number or as the version current at a point in time.
+type RollbackAnswer struct {
+	Version int64      `json:"version"`
+	At      *time.Time `json:"at"`
+}
+
+type CreateSchema struct {
+	Namespace  string          `json:"namespace" binding:"required"`
+	Definition json.RawMessage `json:"definition" binding:"required"`
+}
+
+// CreateAPIKey issues a key allowed to use scopes. The
+// key never expires when ExpiresAt is omitted.
+type CreateAPIKey struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// IssuedAPIKey is returned when a key is issued or rotated, the
+// only time the key itself is known.
+type IssuedAPIKey struct {
+	*APIKey
+	Key string `json:"key"`
+}
+
+type CreateRoleBinding struct {
+	Subject string `json:"subject" binding:"required"`
+	Role    Role   `json:"role" binding:"required"`
+	Pattern string `json:"pattern" binding:"required"`
+}
+
+type CreateLegalHold struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// RetentionReport lists what applying the retention policy purged,
+// or would purge when DryRun is set, and what legal holds kept.
+type RetentionReport struct {
+	DryRun bool `json:"dry_run"`
+
+	// Answers are the deleted answers purged along with their history,
+	// Events the events purged from the history of the other answers.
+	Answers []PurgedAnswer `json:"answers"`
+	Events  int64          `json:"events"`
+
+	// HeldAnswers and HeldEvents would have been
+	// purged if their key wasn't on legal hold.
+	HeldAnswers []PurgedAnswer `json:"held_answers"`
+	HeldEvents  int64          `json:"held_events"`
+}
+
+// PurgedAnswer identifies a deleted answer, with the
+// number of events in its history.
+type PurgedAnswer struct {
+	TenantID   string             `json:"tenant_id"`
+	Key        string             `json:"key"`
+	UID        string             `json:"uid"`
+	Generation int64              `json:"generation"`
+	DeletedAt  primitive.DateTime `json:"deleted_at"`
+	Events     int64              `json:"events"`
+}
+
+// SchemaTestResult reports the existing answers that
+// don't match a schema version.
+type SchemaTestResult struct {
+	Checked    int               `json:"checked"`
+	Violations []SchemaViolation `json:"violations"`
 }
 
 type AnswerResponse struct {
-	UID       string             `json:"uid"`
-	Key       string             `jsn:"key"`
-	Value     string             `json:"value"`
+	UID        string             `json:"uid"`
+	Key        string             `jsn:"key"`
+	Value      interface{}        `json:"value"`
+	Type       ValueType          `json:"type"`
+	Version    int64              `json:"version"`
+	Generation int64              `json:"generation"`
+	CreatedAt  primitive.DateTime `json:"created_at"`
+	UpdatedAt  primitive.DateTime `json:"updated_at"`
+	DeletedAt  primitive.DateTime `json:"deleted_at,omitempty"`
+	ExpiresAt  primitive.DateTime `json:"expires_at,omitempty"`
+}
+
+// SearchResult is an answer with a value mentioning the words searched
+// for, Version being the version of that value and Current whether it
+// is the current one.
+type SearchResult struct {
+	UID        string             `json:"uid"`
+	Key        string             `json:"key"`
+	Generation int64              `json:"generation"`
+	Version    int64              `json:"version"`
+	Current    bool               `json:"current"`
+	Value      interface{}        `json:"value"`
+	Type       ValueType          `json:"type"`
+	Highlight  string             `json:"highlight"`
+	Score      float64            `json:"score"`
+	UpdatedAt  primitive.DateTime `json:"updated_at"`
+}
+
+// BatchResult is the outcome of an operation of a batch, with the
+// answer it wrote and its ETag, or the error it failed with.
+type BatchResult struct {
+	Op      BatchOperationType `json:"op"`
+	Key     string             `json:"key"`
+	Status  int                `json:"status"`
+	Error   string             `json:"error,omitempty"`
+	Details interface{}        `json:"details,omitempty"`
+	ETag    string             `json:"etag,omitempty"`
+	Answer  *AnswerResponse    `json:"answer,omitempty"`
+}
+
+// BatchResponse holds the results of the operations of a batch, in
+// the order they were sent, along with how many succeeded and failed.
+type BatchResponse struct {
+	Atomic    bool          `json:"atomic"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
+
+// ImportReport counts the records an import has read so far and what
+// became of them, listing the failures. Error is set when the import
+// stopped before reading every record.
+type ImportReport struct {
+	Records     int           `json:"records"`
+	Created     int           `json:"created"`
+	Overwritten int           `json:"overwritten"`
+	Skipped     int           `json:"skipped"`
+	Failed      int           `json:"failed"`
+	Failures    []ImportError `json:"failures"`
+	Done        bool          `json:"done"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// ImportError is the failure of the record numbered Record, from 1.
+type ImportError struct {
+	Record int    `json:"record"`
+	Key    string `json:"key,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+// VersionResponse describes a value an answer had.
+type VersionResponse struct {
+	Version   int64              `json:"version"`
+	Value     interface{}        `json:"value"`
+	Type      ValueType          `json:"type"`
+	Author    string             `json:"author,omitempty"`
 	CreatedAt primitive.DateTime `json:"created_at"`
-	UpdatedAt primitive.DateTime `json:"updated_at"`
 }
 
+// PagedResponse holds a page of a listing, described by Pagination
+// for numbered pages and by Cursor for pages walked with a cursor.
 type PagedResponse struct {
 	Content    interface{}     `json:"content"`
-	Pagination *PaginationData `json:"pagination"`
+	Pagination *PaginationData `json:"pagination,omitempty"`
+	Cursor     *CursorData     `json:"cursor,omitempty"`
+}
+
+// CursorData describes a page walked with a cursor. Next is the cursor
+// of the following page, empty on the last one.
+type CursorData struct {
+	PerPage int64  `json:"perPage"`
+	Next    string `json:"next,omitempty"`
 }
@@ -3,21 +3,26 @@ package mongo
 import (
 	"context"
 	"errors"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/dotunj/bequest/internal/pkg/datastore"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type AnswerRepo struct {
-	client *mongo.Collection
+	client      *mongo.Collection
+	generations *mongo.Collection
 }
 
 func NewAnswerRepo(db *mongo.Database) *AnswerRepo {
 	return &AnswerRepo{
-		client: db.Collection(AnswerCollection),
+		client:      db.Collection(AnswerCollection),
+		generations: db.Collection(GenerationCollection),
 	}
 }
 
@@ -30,51 +35,456 @@ func (a *AnswerRepo) Create(ctx context.Context, answer *datastore.Answer) error
 	return err
 }
 
-func (a *AnswerRepo) FindByKey(ctx context.Context, key string) (*datastore.Answer, error) {
+func (a *AnswerRepo) FindByKey(ctx context.Context, tenantID, key string) (*datastore.Answer, error) {
 	answer := &datastore.Answer{}
-	filter := bson.M{"key": key, "document_status": datastore.ActiveDocumentStatus}
+	filter := bson.M{"tenant_id": tenantID, "key": key, "document_status": datastore.ActiveDocumentStatus}
 
-	err := a.client.FindOne(ctx, filter).Decode(answer)
+	opts := options.FindOne().SetProjection(bson.M{"outbox": 0})
+
+	err := a.client.FindOne(ctx, filter, opts).Decode(answer)
 	if errors.Is(err, mongo.ErrNoDocuments) {
 		return answer, datastore.ErrAnswerNotFound
 	}
 
+	datastore.NumberValues(answer.Values)
 	return answer, err
 }
 
-func (a *AnswerRepo) Update(ctx context.Context, answer *datastore.Answer, value *datastore.Value) (*datastore.Answer, error) {
-	filter := bson.M{"key": answer.Key, "document_status": datastore.ActiveDocumentStatus}
+func (a *AnswerRepo) FindManyByPrefix(ctx context.Context, tenantID, prefix string) ([]datastore.Answer, error) {
+	filter := bson.M{
+		"tenant_id":       tenantID,
+		"key":             primitive.Regex{Pattern: "^" + regexp.QuoteMeta(prefix)},
+		"document_status": datastore.ActiveDocumentStatus,
+	}
+
+	opts := options.Find().SetProjection(bson.M{"outbox": 0}).SetSort(bson.M{"key": 1})
+
+	cursor, err := a.client.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	answers := make([]datastore.Answer, 0)
+	if err := cursor.All(ctx, &answers); err != nil {
+		return nil, err
+	}
+
+	for i := range answers {
+		datastore.NumberValues(answers[i].Values)
+	}
+
+	return answers, nil
+}
+
+// FindMany matches the regex of the filter in Go, like the other stores,
+// rather than handing it to the server: it is checked as RE2, which runs
+// in linear time, while the server would run it as PCRE, which backtracks.
+func (a *AnswerRepo) FindMany(ctx context.Context, tenantID string, filter datastore.AnswerFilter) ([]datastore.Answer, error) {
+	var pattern *regexp.Regexp
+	if filter.Regex != "" {
+		var err error
+		if pattern, err = regexp.Compile(filter.Regex); err != nil {
+			return nil, err
+		}
+	}
+
+	status := filter.Status
+	if status == "" {
+		status = datastore.ActiveDocumentStatus
+	}
+
+	query := bson.M{"tenant_id": tenantID, "document_status": status}
+
+	var and bson.A
+	if filter.Prefix != "" {
+		and = append(and, bson.M{"key": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(filter.Prefix)}})
+	}
+
+	if filter.UpdatedSince != 0 {
+		and = append(and, bson.M{"updated_at": bson.M{"$gte": filter.UpdatedSince}})
+	}
+
+	if filter.CreatedBefore != 0 {
+		and = append(and, bson.M{"created_at": bson.M{"$lt": filter.CreatedBefore}})
+	}
+
+	if filter.ExpiresAfter != 0 {
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"expires_at": bson.M{"$exists": false}},
+			bson.M{"expires_at": bson.M{"$gt": filter.ExpiresAfter}},
+		}})
+	}
+
+	order, op := 1, "$gt"
+	if filter.Descending {
+		order, op = -1, "$lt"
+	}
+
+	sort := bson.D{{Key: "key", Value: order}, {Key: "generation", Value: order}}
+	if filter.SortBy == datastore.CreatedAtAnswerSort || filter.SortBy == datastore.UpdatedAtAnswerSort {
+		sort = append(bson.D{{Key: string(filter.SortBy), Value: order}}, sort...)
+	}
+
+	if after := filter.After; after != nil {
+		// answers past the cursor on the first field they differ by
+		values := bson.A{after.Key, after.Generation}
+		if len(sort) == 3 {
+			values = append(bson.A{after.Time}, values...)
+		}
+
+		past := make(bson.A, 0, len(sort))
+		for i := range sort {
+			cond := bson.M{sort[i].Key: bson.M{op: values[i]}}
+			for j := 0; j < i; j++ {
+				cond[sort[j].Key] = values[j]
+			}
+
+			past = append(past, cond)
+		}
+
+		and = append(and, bson.M{"$or": past})
+	}
+
+	if len(and) > 0 {
+		query["$and"] = and
+	}
+
+	opts := options.Find().SetProjection(bson.M{"outbox": 0}).SetSort(sort)
+	if filter.Limit > 0 && pattern == nil {
+		opts.SetLimit(int64(filter.Limit))
+	}
+
+	cursor, err := a.client.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	answers := make([]datastore.Answer, 0)
+	for (filter.Limit <= 0 || len(answers) < filter.Limit) && cursor.Next(ctx) {
+		// the key is matched before the rest of the answer is decoded
+		if pattern != nil {
+			key, _ := cursor.Current.Lookup("key").StringValueOK()
+			if !pattern.MatchString(key) {
+				continue
+			}
+		}
+
+		var answer datastore.Answer
+		if err := cursor.Decode(&answer); err != nil {
+			return nil, err
+		}
+
+		datastore.NumberValues(answer.Values)
+		answers = append(answers, answer)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return answers, nil
+}
+
+// Search ranks the answers by the score of the text index, which
+// covers every value of an answer.
+func (a *AnswerRepo) Search(ctx context.Context, tenantID string, terms []string, limit int) ([]datastore.ScoredAnswer, error) {
+	filter := bson.M{
+		"tenant_id":       tenantID,
+		"document_status": datastore.ActiveDocumentStatus,
+		"$text":           bson.M{"$search": strings.Join(terms, " ")},
+	}
+
+	score := bson.M{"$meta": "textScore"}
+	opts := options.Find().SetProjection(bson.M{"outbox": 0, "score": score}).SetSort(bson.M{"score": score})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	cursor, err := a.client.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []struct {
+		datastore.Answer `bson:",inline"`
+		Score            float64 `bson:"score"`
+	}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	answers := make([]datastore.ScoredAnswer, len(found))
+	for i := range found {
+		datastore.NumberValues(found[i].Values)
+		answers[i] = datastore.ScoredAnswer{Answer: found[i].Answer, Score: found[i].Score}
+	}
+
+	return answers, nil
+}
+
+func (a *AnswerRepo) Update(ctx context.Context, answer *datastore.Answer, value *datastore.Value, version int64) (*datastore.Answer, error) {
+	// the version of the value is only known up front for conditional
+	// updates, values pushed without one are numbered when read
+	pushed := *value
+	if version != 0 {
+		pushed.Version = version + 1
+	}
+
+	filter := activeFilter(answer, version)
 	update := bson.M{
 		"$push": bson.M{
-			"values": value,
+			"values": pushed,
+			"outbox": bson.M{"$each": outbox(answer)},
 		},
 		"$set": bson.M{
 			"updated_at": primitive.NewDateTimeFromTime(time.Now()),
 		},
+		"$inc": bson.M{"version": 1},
 	}
 
-	_, err := a.client.UpdateOne(ctx, filter, update)
-	if err != nil {
-		return nil, err
+	if answer.ExpiresAt != 0 {
+		update["$set"].(bson.M)["expires_at"] = answer.ExpiresAt
+	} else {
+		update["$unset"] = bson.M{"expires_at": ""}
+	}
+
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"outbox": 0})
+
+	updated := &datastore.Answer{}
+
+	err := a.client.FindOneAndUpdate(ctx, filter, update, opts).Decode(updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if version != 0 {
+			return nil, datastore.ErrVersionMismatch
+		}
+		return nil, datastore.ErrAnswerNotFound
 	}
 
-	answer, err = a.FindByKey(ctx, answer.Key)
 	if err != nil {
 		return nil, err
 	}
 
-	return answer, nil
+	datastore.NumberValues(updated.Values)
+	return updated, nil
 }
 
-func (a *AnswerRepo) Delete(ctx context.Context, answer *datastore.Answer) error {
-	filter := bson.M{"key": answer.Key, "document_status": datastore.ActiveDocumentStatus}
+func (a *AnswerRepo) Delete(ctx context.Context, answer *datastore.Answer, version int64) error {
+	filter := activeFilter(answer, version)
 	update := bson.M{
 		"$set": bson.M{
 			"document_status": datastore.DeletedDocumentStatus,
 			"deleted_at":      primitive.NewDateTimeFromTime(time.Now()),
 		},
+		"$push": bson.M{
+			"outbox": bson.M{"$each": outbox(answer)},
+		},
 	}
 
-	_, err := a.client.UpdateOne(ctx, filter, update)
-	return err
+	result, err := a.client.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 && version != 0 {
+		return datastore.ErrVersionMismatch
+	}
+
+	return nil
+}
+
+func (a *AnswerRepo) FindDeleted(ctx context.Context, tenantID, key string) ([]datastore.Answer, error) {
+	filter := bson.M{"tenant_id": tenantID, "document_status": datastore.DeletedDocumentStatus}
+	if key != "" {
+		filter["key"] = key
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"outbox": 0}).
+		SetSort(bson.D{{Key: "key", Value: 1}, {Key: "deleted_at", Value: -1}})
+
+	cursor, err := a.client.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	answers := make([]datastore.Answer, 0)
+	if err := cursor.All(ctx, &answers); err != nil {
+		return nil, err
+	}
+
+	for i := range answers {
+		datastore.NumberValues(answers[i].Values)
+	}
+
+	return answers, nil
+}
+
+func (a *AnswerRepo) Restore(ctx context.Context, answer *datastore.Answer) error {
+	filter := bson.M{
+		"tenant_id":       answer.TenantID,
+		"key":             answer.Key,
+		"uid":             answer.UID,
+		"document_status": datastore.DeletedDocumentStatus,
+	}
+	update := bson.M{
+		"$set":   bson.M{"document_status": datastore.ActiveDocumentStatus},
+		"$unset": bson.M{"deleted_at": "", "expires_at": ""},
+		"$push": bson.M{
+			"outbox": bson.M{"$each": outbox(answer)},
+		},
+	}
+
+	result, err := a.client.UpdateOne(ctx, filter, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return datastore.ErrDuplicateKey
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return datastore.ErrAnswerNotFound
+	}
+
+	return nil
+}
+
+func (a *AnswerRepo) FindDeletedBefore(ctx context.Context, tenantID string, before primitive.DateTime) ([]datastore.Answer, error) {
+	filter := bson.M{"document_status": datastore.DeletedDocumentStatus, "deleted_at": bson.M{"$lt": before}}
+	if tenantID != "" {
+		filter["tenant_id"] = tenantID
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"outbox": 0}).
+		SetSort(bson.D{{Key: "tenant_id", Value: 1}, {Key: "key", Value: 1}, {Key: "deleted_at", Value: -1}})
+
+	cursor, err := a.client.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	answers := make([]datastore.Answer, 0)
+	if err := cursor.All(ctx, &answers); err != nil {
+		return nil, err
+	}
+
+	for i := range answers {
+		datastore.NumberValues(answers[i].Values)
+	}
+
+	return answers, nil
+}
+
+// Purge records the generation of answer in the generations collection
+// before deleting it, so that it is kept when the delete fails.
+func (a *AnswerRepo) Purge(ctx context.Context, answer *datastore.Answer) error {
+	_, err := a.generations.UpdateOne(ctx,
+		bson.M{"tenant_id": answer.TenantID, "key": answer.Key},
+		bson.M{"$max": bson.M{"generation": answer.Generation}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+
+	result, err := a.client.DeleteOne(ctx, bson.M{
+		"tenant_id":       answer.TenantID,
+		"key":             answer.Key,
+		"uid":             answer.UID,
+		"document_status": datastore.DeletedDocumentStatus,
+	})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return datastore.ErrAnswerNotFound
+	}
+
+	return nil
+}
+
+func (a *AnswerRepo) LastGeneration(ctx context.Context, tenantID, key string) (int64, error) {
+	filter := bson.M{"tenant_id": tenantID, "key": key}
+
+	var latest struct {
+		Generation int64 `bson:"generation"`
+	}
+
+	var generation int64
+
+	for _, collection := range []*mongo.Collection{a.client, a.generations} {
+		opts := options.FindOne().
+			SetProjection(bson.M{"generation": 1}).
+			SetSort(bson.M{"generation": -1})
+
+		err := collection.FindOne(ctx, filter, opts).Decode(&latest)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		if latest.Generation > generation {
+			generation = latest.Generation
+		}
+	}
+
+	return generation, nil
+}
+
+func (a *AnswerRepo) FindExpired(ctx context.Context, before primitive.DateTime, limit int) ([]datastore.Answer, error) {
+	filter := bson.M{
+		"document_status": datastore.ActiveDocumentStatus,
+		"expires_at":      bson.M{"$gt": primitive.DateTime(0), "$lte": before},
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"outbox": 0}).
+		SetSort(bson.M{"expires_at": 1}).
+		SetLimit(int64(limit))
+
+	cursor, err := a.client.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	answers := make([]datastore.Answer, 0)
+	if err := cursor.All(ctx, &answers); err != nil {
+		return nil, err
+	}
+
+	for i := range answers {
+		datastore.NumberValues(answers[i].Values)
+	}
+
+	return answers, nil
+}
+
+// activeFilter matches the active answer of the key of answer, only
+// when it is the same generation at version if version isn't zero.
+func activeFilter(answer *datastore.Answer, version int64) bson.M {
+	filter := bson.M{"tenant_id": answer.TenantID, "key": answer.Key, "document_status": datastore.ActiveDocumentStatus}
+	if version != 0 {
+		filter["uid"] = answer.UID
+		filter["version"] = version
+	}
+
+	return filter
+}
+
+// outbox returns the messages to push along with a mutation
+// of answer, $each rejects a nil slice.
+func outbox(answer *datastore.Answer) []datastore.OutboxMessage {
+	if answer.Outbox == nil {
+		return []datastore.OutboxMessage{}
+	}
+
+	return answer.Outbox
 }
@@ -0,0 +1,100 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type APIKeyRepo struct {
+	client *mongo.Collection
+}
+
+func NewAPIKeyRepo(db *mongo.Database) *APIKeyRepo {
+	return &APIKeyRepo{
+		client: db.Collection(APIKeyCollection),
+	}
+}
+
+func (a *APIKeyRepo) Create(ctx context.Context, key *datastore.APIKey) error {
+	_, err := a.client.InsertOne(ctx, key)
+	if mongo.IsDuplicateKeyError(err) {
+		return datastore.ErrDuplicateKey
+	}
+
+	return err
+}
+
+func (a *APIKeyRepo) FindByUID(ctx context.Context, tenantID, uid string) (*datastore.APIKey, error) {
+	return a.findOne(ctx, bson.M{"tenant_id": tenantID, "uid": uid})
+}
+
+func (a *APIKeyRepo) FindByPrefix(ctx context.Context, prefix string) (*datastore.APIKey, error) {
+	return a.findOne(ctx, bson.M{"prefix": prefix})
+}
+
+func (a *APIKeyRepo) FindMany(ctx context.Context, tenantID string) ([]datastore.APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "uid", Value: 1}})
+
+	cursor, err := a.client.Find(ctx, bson.M{"tenant_id": tenantID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]datastore.APIKey, 0)
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (a *APIKeyRepo) Update(ctx context.Context, key *datastore.APIKey) error {
+	result, err := a.client.ReplaceOne(ctx, bson.M{"tenant_id": key.TenantID, "uid": key.UID}, key)
+	if mongo.IsDuplicateKeyError(err) {
+		return datastore.ErrDuplicateKey
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return datastore.ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (a *APIKeyRepo) TouchLastUsed(ctx context.Context, uid string, at primitive.DateTime) error {
+	result, err := a.client.UpdateOne(ctx, bson.M{"uid": uid}, bson.M{"$set": bson.M{"last_used_at": at}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return datastore.ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (a *APIKeyRepo) findOne(ctx context.Context, filter bson.M) (*datastore.APIKey, error) {
+	key := &datastore.APIKey{}
+
+	err := a.client.FindOne(ctx, filter).Decode(key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, datastore.ErrAPIKeyNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
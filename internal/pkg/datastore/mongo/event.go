@@ -2,11 +2,14 @@ package mongo
 
 import (
 	"context"
+	"sort"
 
 	"github.com/dotunj/bequest/internal/pkg/datastore"
 	pager "github.com/gobeam/mongo-go-pagination"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type EventRepo struct {
@@ -21,17 +24,30 @@ func NewEventRepo(db *mongo.Database) *EventRepo {
 
 func (e *EventRepo) Create(ctx context.Context, event *datastore.Event) error {
 	_, err := e.client.InsertOne(ctx, event)
+	if mongo.IsDuplicateKeyError(err) {
+		return datastore.ErrDuplicateKey
+	}
+
 	return err
 }
 
-func (e *EventRepo) FindManyByKey(ctx context.Context, key string, pageable datastore.Pageable) ([]datastore.Event, datastore.PaginationData, error) {
+func (e *EventRepo) FindManyByKey(ctx context.Context, tenantID, key string, generation int64, pageable datastore.Pageable) ([]datastore.Event, datastore.PaginationData, error) {
 	var events []datastore.Event
 
+	if err := pageable.Validate(); err != nil {
+		return events, datastore.PaginationData{}, err
+	}
+
 	filter := bson.M{
+		"tenant_id":       tenantID,
 		"document_status": datastore.ActiveDocumentStatus,
 		"data.key":        key,
 	}
 
+	if generation != 0 {
+		filter["data.generation"] = generation
+	}
+
 	paginatedData, err := pager.New(e.client).Context(ctx).Limit(int64(pageable.PerPage)).Page(int64(pageable.Page)).Sort("created_at", pageable.Sort).Filter(filter).Decode(&events).Find()
 	if err != nil {
 		return events, datastore.PaginationData{}, err
@@ -43,3 +59,98 @@ func (e *EventRepo) FindManyByKey(ctx context.Context, key string, pageable data
 
 	return events, datastore.PaginationData(paginatedData.Pagination), nil
 }
+
+func (e *EventRepo) FindExpired(ctx context.Context, tenantID string, before primitive.DateTime, keep int) ([]datastore.Event, error) {
+	filter := bson.M{"document_status": datastore.ActiveDocumentStatus}
+	if tenantID != "" {
+		filter["tenant_id"] = tenantID
+	}
+
+	expired := make([]datastore.Event, 0)
+
+	if keep == 0 {
+		filter["created_at"] = bson.M{"$lt": before}
+
+		cursor, err := e.client.Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": 1}))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := cursor.All(ctx, &expired); err != nil {
+			return nil, err
+		}
+
+		return expired, nil
+	}
+
+	// the events of every key are walked most recent first,
+	// to count how many of them are more recent than each one
+	opts := options.Find().SetSort(bson.D{{Key: "tenant_id", Value: 1}, {Key: "data.key", Value: 1}, {Key: "created_at", Value: -1}})
+
+	cursor, err := e.client.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tenant, key string
+	kept := 0
+	for cursor.Next(ctx) {
+		var event datastore.Event
+		if err := cursor.Decode(&event); err != nil {
+			return nil, err
+		}
+
+		var eventKey string
+		if event.Data != nil {
+			eventKey = event.Data.Key
+		}
+
+		if event.TenantID != tenant || eventKey != key {
+			tenant, key, kept = event.TenantID, eventKey, 0
+		}
+
+		kept++
+		if (before != 0 && event.CreatedAt < before) || kept > keep {
+			expired = append(expired, event)
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].CreatedAt < expired[j].CreatedAt
+	})
+
+	return expired, nil
+}
+
+func (e *EventRepo) DeleteByKey(ctx context.Context, tenantID, key string, generation int64) (int64, error) {
+	filter := bson.M{"tenant_id": tenantID, "data.key": key}
+	if generation != 0 {
+		filter["data.generation"] = generation
+	}
+
+	result, err := e.client.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (e *EventRepo) Delete(ctx context.Context, events []datastore.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	ids := make([]primitive.ObjectID, len(events))
+	for i := range events {
+		ids[i] = events[i].ID
+	}
+
+	_, err := e.client.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
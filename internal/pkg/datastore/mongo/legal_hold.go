@@ -0,0 +1,63 @@
+package mongo
+
+import (
+	"context"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LegalHoldRepo struct {
+	client *mongo.Collection
+}
+
+func NewLegalHoldRepo(db *mongo.Database) *LegalHoldRepo {
+	return &LegalHoldRepo{
+		client: db.Collection(LegalHoldCollection),
+	}
+}
+
+func (l *LegalHoldRepo) Create(ctx context.Context, hold *datastore.LegalHold) error {
+	_, err := l.client.InsertOne(ctx, hold)
+	if mongo.IsDuplicateKeyError(err) {
+		return datastore.ErrDuplicateKey
+	}
+
+	return err
+}
+
+func (l *LegalHoldRepo) FindMany(ctx context.Context, tenantID string) ([]datastore.LegalHold, error) {
+	filter := bson.M{}
+	if tenantID != "" {
+		filter["tenant_id"] = tenantID
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "tenant_id", Value: 1}, {Key: "key", Value: 1}})
+
+	cursor, err := l.client.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	holds := make([]datastore.LegalHold, 0)
+	if err := cursor.All(ctx, &holds); err != nil {
+		return nil, err
+	}
+
+	return holds, nil
+}
+
+func (l *LegalHoldRepo) Delete(ctx context.Context, tenantID, key string) error {
+	result, err := l.client.DeleteOne(ctx, bson.M{"tenant_id": tenantID, "key": key})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return datastore.ErrLegalHoldNotFound
+	}
+
+	return nil
+}
@@ -3,6 +3,7 @@ package mongo
 import (
 	"context"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
@@ -16,12 +17,26 @@ import (
 var (
 	AnswerCollection = "answers"
 	EventCollection  = "events"
+	SchemaCollection = "schemas"
+	APIKeyCollection = "api_keys"
+
+	RoleBindingCollection = "role_bindings"
+	LegalHoldCollection   = "legal_holds"
+	GenerationCollection  = "generations"
 )
 
 type Client struct {
 	DB         *mongo.Database
 	AnswerRepo datastore.AnswerRepository
 	EventRepo  datastore.EventRepository
+	OutboxRepo datastore.OutboxRepository
+	SchemaRepo datastore.SchemaRepository
+	APIKeyRepo datastore.APIKeyRepository
+	RoleRepo   datastore.RoleBindingRepository
+	HoldRepo   datastore.LegalHoldRepository
+
+	// transactions is set when the deployment supports them.
+	transactions bool
 }
 
 func NewMongoRepository(dsn string) (*Client, error) {
@@ -52,26 +67,326 @@ func NewMongoRepository(dsn string) (*Client, error) {
 		DB:         conn,
 		AnswerRepo: NewAnswerRepo(conn),
 		EventRepo:  NewEventRepo(conn),
+		OutboxRepo: NewOutboxRepo(conn),
+		SchemaRepo: NewSchemaRepo(conn),
+		APIKeyRepo: NewAPIKeyRepo(conn),
+		RoleRepo:   NewRoleBindingRepo(conn),
+		HoldRepo:   NewLegalHoldRepo(conn),
 	}
 
-	// Ensure a unique index is created for the key
-	// field on the answer collection
-	c.createUniqueIndex(AnswerCollection, "key")
+	c.transactions = c.supportsTransactions()
+	c.createIndexes()
 
 	return c, nil
 }
 
+func (c *Client) Answers() datastore.AnswerRepository {
+	return c.AnswerRepo
+}
+
+func (c *Client) Events() datastore.EventRepository {
+	return c.EventRepo
+}
+
+func (c *Client) Outbox() datastore.OutboxRepository {
+	return c.OutboxRepo
+}
+
+func (c *Client) Schemas() datastore.SchemaRepository {
+	return c.SchemaRepo
+}
+
+func (c *Client) APIKeys() datastore.APIKeyRepository {
+	return c.APIKeyRepo
+}
+
+func (c *Client) RoleBindings() datastore.RoleBindingRepository {
+	return c.RoleRepo
+}
+
+func (c *Client) LegalHolds() datastore.LegalHoldRepository {
+	return c.HoldRepo
+}
+
+func (c *Client) Close(ctx context.Context) error {
+	return c.DB.Client().Disconnect(ctx)
+}
+
+// createIndexes ensures the unique indexes backing ErrDuplicateKey exist,
+// on the key of active answers and on the version of each schema, both
+// scoped to the tenant, on the prefix of api keys, on the pattern
+// of the role bindings of a subject and on the key of legal holds.
+// It also creates the indexes answers are listed by, one per sort,
+// the text index they are searched by, and sparse indexes on the
+// outbox embedded in answers, by due time, by event and by key.
+func (c *Client) createIndexes() {
+	c.migrateTenants()
+	c.migrateVersions()
+	c.migrateGenerations()
+
+	c.createPartialUniqueIndex(AnswerCollection, bson.M{"document_status": datastore.ActiveDocumentStatus}, "tenant_id", "key")
+	c.createUniqueIndex(SchemaCollection, "tenant_id", "namespace", "version")
+	c.createIndex(AnswerCollection, "expires_at")
+	c.createIndex(AnswerCollection, "tenant_id", "document_status", "key", "generation")
+	c.createIndex(AnswerCollection, "tenant_id", "document_status", "created_at", "key", "generation")
+	c.createIndex(AnswerCollection, "tenant_id", "document_status", "updated_at", "key", "generation")
+	c.createTextIndex(AnswerCollection, "values.value")
+	c.createSparseIndex(AnswerCollection, "outbox.status", "outbox.next_attempt_at")
+	c.createSparseIndex(AnswerCollection, "outbox.event._id")
+	c.createSparseIndex(AnswerCollection, "outbox.event.tenant_id", "outbox.event.data.key")
+	c.createIndex(EventCollection, "tenant_id", "data.key", "created_at")
+	c.createUniqueIndex(APIKeyCollection, "prefix")
+	c.createUniqueIndex(APIKeyCollection, "uid")
+	c.createUniqueIndex(RoleBindingCollection, "tenant_id", "subject", "pattern")
+	c.createUniqueIndex(LegalHoldCollection, "tenant_id", "key")
+	c.createUniqueIndex(GenerationCollection, "tenant_id", "key")
+}
+
+// migrateTenants assigns documents written before tenant scoping to the
+// default tenant and drops the indexes that kept keys unique globally.
+func (c *Client) migrateTenants() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	missing := bson.M{"tenant_id": bson.M{"$exists": false}}
+	backfill := bson.M{"$set": bson.M{"tenant_id": datastore.DefaultTenant}}
+
+	for _, collectionName := range []string{AnswerCollection, EventCollection, SchemaCollection} {
+		_, err := c.DB.Collection(collectionName).UpdateMany(ctx, missing, backfill)
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to assign the default tenant in %s", collectionName)
+		}
+	}
+
+	// pending outbox messages carry a copy of their event
+	_, err := c.DB.Collection(AnswerCollection).UpdateMany(ctx,
+		bson.M{"outbox.event.tenant_id": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"outbox.$[message].event.tenant_id": datastore.DefaultTenant}},
+		options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"message.event.tenant_id": bson.M{"$exists": false}}},
+		}),
+	)
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to assign the default tenant to the outbox in %s", AnswerCollection)
+	}
+
+	legacy := map[string]string{
+		AnswerCollection: "key_1_document_status_1",
+		SchemaCollection: "namespace_1_version_1",
+	}
+	for collectionName, indexName := range legacy {
+		// the index is missing on fresh databases
+		_, _ = c.DB.Collection(collectionName).Indexes().DropOne(ctx, indexName)
+	}
+}
+
+// migrateVersions numbers the answers written before versions were
+// recorded, which have had a version per value.
+func (c *Client) migrateVersions() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := c.DB.Collection(AnswerCollection).UpdateMany(ctx,
+		bson.M{"version": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"version": bson.M{"$size": "$values"}}}}},
+	)
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to number the versions of the answers in %s", AnswerCollection)
+	}
+}
+
+// migrateGenerations numbers the answers written before generations
+// were recorded in the order they were created, and their events from
+// the create events preceding them. It drops the index that kept a
+// single deleted answer per key.
+func (c *Client) migrateGenerations() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	// the index is missing on fresh databases
+	_, _ = c.DB.Collection(AnswerCollection).Indexes().DropOne(ctx, "tenant_id_1_key_1_document_status_1")
+
+	if err := c.numberAnswerGenerations(ctx); err != nil {
+		logrus.WithError(err).Errorf("failed to number the generations of the answers in %s", AnswerCollection)
+	}
+
+	// pending outbox messages belong to the answer they are stored in
+	_, err := c.DB.Collection(AnswerCollection).UpdateMany(ctx,
+		bson.M{"outbox.0": bson.M{"$exists": true}, "outbox.event.data.generation": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"outbox": bson.M{"$map": bson.M{
+			"input": "$outbox",
+			"as":    "message",
+			"in": bson.M{"$mergeObjects": bson.A{"$$message", bson.M{
+				"event": bson.M{"$mergeObjects": bson.A{"$$message.event", bson.M{
+					"data": bson.M{"$mergeObjects": bson.A{"$$message.event.data", bson.M{"generation": "$generation"}}},
+				}}},
+			}}},
+		}}}}}},
+	)
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to number the generations of the outbox in %s", AnswerCollection)
+	}
+
+	if err := c.numberEventGenerations(ctx); err != nil {
+		logrus.WithError(err).Errorf("failed to number the generations of the events in %s", EventCollection)
+	}
+}
+
+func (c *Client) numberAnswerGenerations(ctx context.Context) error {
+	collection := c.DB.Collection(AnswerCollection)
+
+	opts := options.Find().
+		SetProjection(bson.M{"tenant_id": 1, "key": 1, "document_status": 1, "created_at": 1}).
+		SetSort(bson.D{{Key: "tenant_id", Value: 1}, {Key: "key", Value: 1}, {Key: "created_at", Value: 1}})
+
+	cursor, err := collection.Find(ctx, bson.M{"generation": bson.M{"$exists": false}}, opts)
+	if err != nil {
+		return err
+	}
+
+	var answers []datastore.Answer
+	if err := cursor.All(ctx, &answers); err != nil {
+		return err
+	}
 
-func (c *Client) createUniqueIndex(collectionName, fieldName string) bool {
-	unique := true
+	// the active answer of a key is its latest
+	sort.SliceStable(answers, func(i, j int) bool {
+		if answers[i].TenantID != answers[j].TenantID {
+			return answers[i].TenantID < answers[j].TenantID
+		}
+
+		if answers[i].Key != answers[j].Key {
+			return answers[i].Key < answers[j].Key
+		}
+
+		iActive := answers[i].DocumentStatus == datastore.ActiveDocumentStatus
+		if jActive := answers[j].DocumentStatus == datastore.ActiveDocumentStatus; iActive != jActive {
+			return jActive
+		}
+
+		return answers[i].CreatedAt < answers[j].CreatedAt
+	})
+
+	models := make([]mongo.WriteModel, 0, len(answers))
+	for i := range answers {
+		if i == 0 || answers[i].TenantID != answers[i-1].TenantID || answers[i].Key != answers[i-1].Key {
+			answers[i].Generation = 1
+		} else {
+			answers[i].Generation = answers[i-1].Generation + 1
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": answers[i].ID}).
+			SetUpdate(bson.M{"$set": bson.M{"generation": answers[i].Generation}}))
+	}
 
-	createIndexOpts := &options.IndexOptions{Unique: &unique}
+	return bulkWrite(ctx, collection, models)
+}
+
+func (c *Client) numberEventGenerations(ctx context.Context) error {
+	collection := c.DB.Collection(EventCollection)
+
+	opts := options.Find().
+		SetProjection(bson.M{"tenant_id": 1, "event": 1, "data.key": 1, "created_at": 1}).
+		SetSort(bson.D{{Key: "tenant_id", Value: 1}, {Key: "data.key", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := collection.Find(ctx, bson.M{"data": bson.M{"$ne": nil}, "data.generation": bson.M{"$exists": false}}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var models []mongo.WriteModel
+	var tenantID, key string
+	var generation int64
+
+	for cursor.Next(ctx) {
+		var event datastore.Event
+		if err := cursor.Decode(&event); err != nil {
+			return err
+		}
+
+		if event.TenantID != tenantID || event.Data.Key != key {
+			tenantID, key, generation = event.TenantID, event.Data.Key, 0
+		}
+
+		if generation == 0 || event.Type == datastore.CreateEvent {
+			generation++
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": event.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"data.generation": generation}}))
+	}
+
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	return bulkWrite(ctx, collection, models)
+}
+
+// bulkWrite applies models in batches, so that
+// large collections are migrated a part at a time.
+func bulkWrite(ctx context.Context, collection *mongo.Collection, models []mongo.WriteModel) error {
+	const batchSize = 1000
+
+	for start := 0; start < len(models); start += batchSize {
+		end := start + batchSize
+		if end > len(models) {
+			end = len(models)
+		}
+
+		if _, err := collection.BulkWrite(ctx, models[start:end], options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) createIndex(collectionName string, fieldNames ...string) bool {
+	return c.ensureIndex(collectionName, options.Index(), fieldNames...)
+}
+
+func (c *Client) createUniqueIndex(collectionName string, fieldNames ...string) bool {
+	return c.ensureIndex(collectionName, options.Index().SetUnique(true), fieldNames...)
+}
+
+// createSparseIndex creates an index leaving out the documents
+// without any of fieldNames, such as answers with an empty outbox.
+func (c *Client) createSparseIndex(collectionName string, fieldNames ...string) bool {
+	return c.ensureIndex(collectionName, options.Index().SetSparse(true), fieldNames...)
+}
+
+// createPartialUniqueIndex creates a unique index only
+// covering the documents matching filter.
+func (c *Client) createPartialUniqueIndex(collectionName string, filter bson.M, fieldNames ...string) bool {
+	return c.ensureIndex(collectionName, options.Index().SetUnique(true).SetPartialFilterExpression(filter), fieldNames...)
+}
+
+// createTextIndex creates the text index of the collection, which can
+// only have one. Words are matched as they are written, without stemming
+// or stop words, and a language field within a document is ignored.
+func (c *Client) createTextIndex(collectionName string, fieldNames ...string) bool {
+	opts := options.Index().SetDefaultLanguage("none").SetLanguageOverride("search_language")
+	return c.ensureKeys(collectionName, opts, "text", fieldNames...)
+}
+
+func (c *Client) ensureIndex(collectionName string, createIndexOpts *options.IndexOptions, fieldNames ...string) bool {
+	return c.ensureKeys(collectionName, createIndexOpts, 1, fieldNames...)
+}
+
+// ensureKeys creates an index on fieldNames, each of them indexed
+// as kind: 1 for ascending order, -1 for descending order or "text".
+func (c *Client) ensureKeys(collectionName string, createIndexOpts *options.IndexOptions, kind interface{}, fieldNames ...string) bool {
+	keys := bson.D{}
+	for _, fieldName := range fieldNames {
+		keys = append(keys, bson.E{Key: fieldName, Value: kind})
+	}
 
-	mod := mongo.IndexModel{ // index in ascending order or -1 for descending order
-		Keys: bson.D{
-			{Key: fieldName, Value: 1},
-			{Key: "document_status", Value: 1},
-		},
+	mod := mongo.IndexModel{
+		Keys:    keys,
 		Options: createIndexOpts,
 	}
 
@@ -82,7 +397,7 @@ func (c *Client) createUniqueIndex(collectionName, fieldName string) bool {
 
 	_, err := collection.Indexes().CreateOne(ctx, mod)
 	if err != nil {
-		logrus.WithError(err).Errorf("failed to create index on field %s in %s", fieldName, collectionName)
+		logrus.WithError(err).Errorf("failed to create index on fields %s in %s", strings.Join(fieldNames, ", "), collectionName)
 		return false
 	}
 
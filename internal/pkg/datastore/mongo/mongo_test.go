@@ -0,0 +1,35 @@
+//go:build integration
+// +build integration
+
+package mongo
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/datastore/storetest"
+)
+
+func TestMongoStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) datastore.Store {
+		db, err := NewMongoRepository(os.Getenv("TEST_MONGO_DSN"))
+		if err != nil {
+			t.Fatalf("failed to connect to db: %v", err)
+		}
+
+		t.Cleanup(func() {
+			_ = db.Close(context.Background())
+		})
+
+		// start every test from an empty database, dropping it
+		// also drops the unique indexes so they have to be recreated
+		if err := db.DB.Drop(context.Background()); err != nil {
+			t.Fatalf("failed to truncate db: %v", err)
+		}
+		db.createIndexes()
+
+		return db.Store()
+	})
+}
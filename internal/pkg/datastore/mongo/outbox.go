@@ -0,0 +1,92 @@
+package mongo
+
+import (
+	"context"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// OutboxRepo reads the outbox messages embedded in answer documents.
+// Keeping them on the answer lets a mutation and its event be written
+// with a single document update, which mongo applies atomically.
+type OutboxRepo struct {
+	client *mongo.Collection
+}
+
+func NewOutboxRepo(db *mongo.Database) *OutboxRepo {
+	return &OutboxRepo{
+		client: db.Collection(AnswerCollection),
+	}
+}
+
+func (o *OutboxRepo) FindDue(ctx context.Context, now primitive.DateTime, limit int) ([]datastore.OutboxMessage, error) {
+	filter := bson.M{
+		"status":          datastore.PendingOutboxStatus,
+		"next_attempt_at": bson.M{"$lte": now},
+	}
+
+	return o.find(ctx, filter, limit)
+}
+
+func (o *OutboxRepo) FindPendingByKey(ctx context.Context, tenantID, key string) ([]datastore.OutboxMessage, error) {
+	filter := bson.M{
+		"status":          datastore.PendingOutboxStatus,
+		"event.tenant_id": tenantID,
+		"event.data.key":  key,
+	}
+
+	return o.find(ctx, filter, 0)
+}
+
+func (o *OutboxRepo) Update(ctx context.Context, message *datastore.OutboxMessage) error {
+	filter := bson.M{"outbox.event._id": message.Event.ID}
+	update := bson.M{"$set": bson.M{"outbox.$": message}}
+
+	_, err := o.client.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (o *OutboxRepo) Delete(ctx context.Context, id primitive.ObjectID) error {
+	filter := bson.M{"outbox.event._id": id}
+	update := bson.M{"$pull": bson.M{"outbox": bson.M{"event._id": id}}}
+
+	_, err := o.client.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// find unwinds the outbox of every answer holding a message
+// matching filter, which applies to the messages themselves.
+func (o *OutboxRepo) find(ctx context.Context, filter bson.M, limit int) ([]datastore.OutboxMessage, error) {
+	messages := make([]datastore.OutboxMessage, 0)
+
+	prefixed := bson.M{}
+	for k, v := range filter {
+		prefixed["outbox."+k] = v
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"outbox": bson.M{"$elemMatch": filter}}}},
+		{{Key: "$unwind", Value: "$outbox"}},
+		{{Key: "$match", Value: prefixed}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$outbox"}}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}, {Key: "event._id", Value: 1}}}},
+	}
+
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+
+	cursor, err := o.client.Aggregate(ctx, pipeline)
+	if err != nil {
+		return messages, err
+	}
+
+	if err := cursor.All(ctx, &messages); err != nil {
+		return make([]datastore.OutboxMessage, 0), err
+	}
+
+	return messages, nil
+}
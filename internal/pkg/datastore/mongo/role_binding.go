@@ -0,0 +1,79 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RoleBindingRepo struct {
+	client *mongo.Collection
+}
+
+func NewRoleBindingRepo(db *mongo.Database) *RoleBindingRepo {
+	return &RoleBindingRepo{
+		client: db.Collection(RoleBindingCollection),
+	}
+}
+
+func (r *RoleBindingRepo) Create(ctx context.Context, binding *datastore.RoleBinding) error {
+	_, err := r.client.InsertOne(ctx, binding)
+	if mongo.IsDuplicateKeyError(err) {
+		return datastore.ErrDuplicateKey
+	}
+
+	return err
+}
+
+func (r *RoleBindingRepo) FindByUID(ctx context.Context, tenantID, uid string) (*datastore.RoleBinding, error) {
+	binding := &datastore.RoleBinding{}
+
+	err := r.client.FindOne(ctx, bson.M{"tenant_id": tenantID, "uid": uid}).Decode(binding)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, datastore.ErrRoleBindingNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return binding, nil
+}
+
+func (r *RoleBindingRepo) FindMany(ctx context.Context, tenantID string, subjects []string) ([]datastore.RoleBinding, error) {
+	filter := bson.M{"tenant_id": tenantID}
+	if len(subjects) > 0 {
+		filter["subject"] = bson.M{"$in": subjects}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "uid", Value: 1}})
+
+	cursor, err := r.client.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	bindings := make([]datastore.RoleBinding, 0)
+	if err := cursor.All(ctx, &bindings); err != nil {
+		return nil, err
+	}
+
+	return bindings, nil
+}
+
+func (r *RoleBindingRepo) Delete(ctx context.Context, tenantID, uid string) error {
+	result, err := r.client.DeleteOne(ctx, bson.M{"tenant_id": tenantID, "uid": uid})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return datastore.ErrRoleBindingNotFound
+	}
+
+	return nil
+}
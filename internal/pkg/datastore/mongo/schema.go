@@ -0,0 +1,99 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SchemaRepo stores schema versions. Definitions are kept as their
+// JSON text, since JSON Schema keywords such as $ref aren't valid
+// mongo field names.
+type SchemaRepo struct {
+	client *mongo.Collection
+}
+
+func NewSchemaRepo(db *mongo.Database) *SchemaRepo {
+	return &SchemaRepo{
+		client: db.Collection(SchemaCollection),
+	}
+}
+
+func (s *SchemaRepo) Create(ctx context.Context, schema *datastore.Schema) error {
+	_, err := s.client.InsertOne(ctx, schema)
+	if mongo.IsDuplicateKeyError(err) {
+		return datastore.ErrDuplicateKey
+	}
+
+	return err
+}
+
+func (s *SchemaRepo) FindByUID(ctx context.Context, tenantID, uid string) (*datastore.Schema, error) {
+	schema := &datastore.Schema{}
+
+	err := s.client.FindOne(ctx, bson.M{"tenant_id": tenantID, "uid": uid}).Decode(schema)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, datastore.ErrSchemaNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+func (s *SchemaRepo) FindMany(ctx context.Context, tenantID, namespace string) ([]datastore.Schema, error) {
+	filter := bson.M{"tenant_id": tenantID}
+	if namespace != "" {
+		filter["namespace"] = namespace
+	}
+
+	return s.find(ctx, filter)
+}
+
+func (s *SchemaRepo) FindActive(ctx context.Context, tenantID string) ([]datastore.Schema, error) {
+	return s.find(ctx, bson.M{"tenant_id": tenantID, "status": datastore.ActiveSchemaStatus})
+}
+
+func (s *SchemaRepo) UpdateStatus(ctx context.Context, tenantID, uid string, status datastore.SchemaStatus) error {
+	update := bson.M{
+		"$set": bson.M{
+			"status":     status,
+			"updated_at": primitive.NewDateTimeFromTime(time.Now()),
+		},
+	}
+
+	result, err := s.client.UpdateOne(ctx, bson.M{"tenant_id": tenantID, "uid": uid}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return datastore.ErrSchemaNotFound
+	}
+
+	return nil
+}
+
+func (s *SchemaRepo) find(ctx context.Context, filter bson.M) ([]datastore.Schema, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "namespace", Value: 1}, {Key: "version", Value: 1}})
+
+	cursor, err := s.client.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := make([]datastore.Schema, 0)
+	if err := cursor.All(ctx, &schemas); err != nil {
+		return nil, err
+	}
+
+	return schemas, nil
+}
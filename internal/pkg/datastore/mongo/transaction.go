@@ -0,0 +1,67 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TxClient is a Client connected to a deployment that supports
+// transactions, a replica set or a sharded cluster.
+type TxClient struct {
+	*Client
+}
+
+// Store returns c, as a TxClient implementing datastore.Transactor
+// when the deployment supports transactions. Standalone servers
+// don't, every answer mutation is still written in a single document.
+func (c *Client) Store() datastore.Store {
+	if c.transactions {
+		return &TxClient{Client: c}
+	}
+
+	return c
+}
+
+// WithTransaction runs fn in a single transaction. Repository calls
+// made with the context handed to fn take part in it, and nested calls
+// reuse the outer transaction. fn is run again when the transaction
+// fails with a transient error, such as a write conflict.
+func (c *TxClient) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	session, err := c.DB.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
+
+// supportsTransactions reports whether the deployment is a replica set,
+// or a sharded cluster, which only mongos reports itself as.
+func (c *Client) supportsTransactions() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+
+	err := c.DB.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return false
+	}
+
+	return hello.SetName != "" || hello.Msg == "isdbgrid"
+}
@@ -0,0 +1,79 @@
+package datastore
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrInvalidPageable mirrors the error returned by the mongo pager when
+// either the page or the page size is below one.
+var ErrInvalidPageable = errors.New("page or limit cannot be less than 0")
+
+// Validate reports whether the pageable can be used to slice a result set.
+func (p Pageable) Validate() error {
+	if p.Page <= 0 || p.PerPage <= 0 {
+		return ErrInvalidPageable
+	}
+
+	return nil
+}
+
+// Offset returns the number of items to skip to reach the requested page.
+func (p Pageable) Offset() int {
+	if p.Page <= 1 {
+		return 0
+	}
+
+	return (p.Page - 1) * p.PerPage
+}
+
+// Window returns the bounds of the requested page within
+// a result set of n items, suitable for slicing.
+func (p Pageable) Window(n int) (start, end int) {
+	start = p.Offset()
+	if start > n {
+		start = n
+	}
+
+	end = start + p.PerPage
+	if end > n {
+		end = n
+	}
+
+	return start, end
+}
+
+// NewPaginationData builds the pagination metadata for a result set of
+// total items. It follows the same rules as the mongo pager so that every
+// storage backend returns an identical PaginationData shape.
+func NewPaginationData(total int64, pageable Pageable) PaginationData {
+	page := int64(pageable.Page)
+	perPage := int64(pageable.PerPage)
+	totalPage := int64(math.Ceil(float64(total) / float64(perPage)))
+
+	prev, next := page, page+1
+	if page > 1 {
+		prev = page - 1
+	}
+
+	if page == totalPage {
+		next = page
+	}
+
+	data := PaginationData{
+		Total:     total,
+		Page:      page,
+		PerPage:   perPage,
+		TotalPage: totalPage,
+	}
+
+	if page != prev && total > 0 {
+		data.Prev = prev
+	}
+
+	if page != next && total > 0 && page <= totalPage {
+		data.Next = next
+	}
+
+	return data
+}
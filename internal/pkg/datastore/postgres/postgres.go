@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore/sqlstore"
+	"github.com/lib/pq"
+)
+
+// uniqueViolation is the SQLSTATE reported for unique constraint failures.
+const uniqueViolation = "23505"
+
+// NewPostgresRepository connects to the database at dsn and brings
+// its schema up to date. Answer mutations and their events can be
+// written atomically through the client's WithTransaction.
+func NewPostgresRepository(dsn string) (*sqlstore.Client, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	c, err := sqlstore.New(db, dialect{})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+type dialect struct{}
+
+func (dialect) IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
@@ -0,0 +1,47 @@
+//go:build integration
+// +build integration
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/datastore/storetest"
+)
+
+func TestPostgresStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) datastore.Store {
+		dsn := os.Getenv("TEST_POSTGRES_DSN")
+		truncateDB(t, dsn)
+
+		db, err := NewPostgresRepository(dsn)
+		if err != nil {
+			t.Fatalf("failed to connect to db: %v", err)
+		}
+
+		t.Cleanup(func() {
+			_ = db.Close(context.Background())
+		})
+
+		return db
+	})
+}
+
+// truncateDB drops every table, including schema_migrations,
+// so each test starts from a freshly migrated database.
+func truncateDB(t *testing.T, dsn string) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to connect to db: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DROP SCHEMA public CASCADE; CREATE SCHEMA public`)
+	if err != nil {
+		t.Fatalf("failed to truncate db: %v", err)
+	}
+}
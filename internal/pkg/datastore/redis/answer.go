@@ -0,0 +1,198 @@
+package redis
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const keyPrefix = "bequest:answers:"
+
+// AnswerRepo is a read-through cache in front of another
+// AnswerRepository. Writes go to the wrapped repository and
+// invalidate the cached entry. Redis failures are logged and
+// the wrapped repository is used instead.
+type AnswerRepo struct {
+	next   datastore.AnswerRepository
+	client *redis.Client
+	opts   Options
+}
+
+func NewAnswerRepo(next datastore.AnswerRepository, client *redis.Client, opts Options) *AnswerRepo {
+	return &AnswerRepo{
+		next:   next,
+		client: client,
+		opts:   opts,
+	}
+}
+
+func (a *AnswerRepo) Create(ctx context.Context, answer *datastore.Answer) error {
+	err := a.next.Create(ctx, answer)
+	if err != nil {
+		return err
+	}
+
+	// drops a cached "not found" for the key
+	a.invalidateAfterWrite(ctx, cacheKey(answer.TenantID, answer.Key))
+	return nil
+}
+
+func (a *AnswerRepo) FindByKey(ctx context.Context, tenantID, key string) (*datastore.Answer, error) {
+	// reads made inside a transaction must see its own writes
+	if inTransaction(ctx) {
+		return a.next.FindByKey(ctx, tenantID, key)
+	}
+
+	ck := cacheKey(tenantID, key)
+
+	raw, err := a.client.Get(ctx, ck).Bytes()
+	switch {
+	case err == nil:
+		// an empty entry records that the key doesn't exist
+		if len(raw) == 0 {
+			return &datastore.Answer{}, datastore.ErrAnswerNotFound
+		}
+
+		answer := &datastore.Answer{}
+		if err := bson.Unmarshal(raw, answer); err == nil {
+			return answer, nil
+		}
+
+		logrus.WithError(err).Errorf("failed to decode cached answer %s", ck)
+	case !errors.Is(err, redis.Nil):
+		logrus.WithError(err).Warn("failed to read answer from redis")
+		return a.next.FindByKey(ctx, tenantID, key)
+	}
+
+	answer, err := a.next.FindByKey(ctx, tenantID, key)
+	switch {
+	case err == nil:
+		a.set(ctx, ck, answer)
+	case errors.Is(err, datastore.ErrAnswerNotFound) && a.opts.NegativeTTL > 0:
+		a.setNotFound(ctx, ck)
+	}
+
+	return answer, err
+}
+
+// FindManyByPrefix isn't cached, listing is rare
+// and can't tell which keys it will return.
+func (a *AnswerRepo) FindManyByPrefix(ctx context.Context, tenantID, prefix string) ([]datastore.Answer, error) {
+	return a.next.FindManyByPrefix(ctx, tenantID, prefix)
+}
+
+// FindMany isn't cached either, for the same reasons.
+func (a *AnswerRepo) FindMany(ctx context.Context, tenantID string, filter datastore.AnswerFilter) ([]datastore.Answer, error) {
+	return a.next.FindMany(ctx, tenantID, filter)
+}
+
+// Search isn't cached either, results change with every write.
+func (a *AnswerRepo) Search(ctx context.Context, tenantID string, terms []string, limit int) ([]datastore.ScoredAnswer, error) {
+	return a.next.Search(ctx, tenantID, terms, limit)
+}
+
+func (a *AnswerRepo) Update(ctx context.Context, answer *datastore.Answer, value *datastore.Value, version int64) (*datastore.Answer, error) {
+	updated, err := a.next.Update(ctx, answer, value, version)
+	if err != nil {
+		return nil, err
+	}
+
+	a.invalidateAfterWrite(ctx, cacheKey(answer.TenantID, answer.Key))
+	return updated, nil
+}
+
+func (a *AnswerRepo) Delete(ctx context.Context, answer *datastore.Answer, version int64) error {
+	err := a.next.Delete(ctx, answer, version)
+	if err != nil {
+		return err
+	}
+
+	a.invalidateAfterWrite(ctx, cacheKey(answer.TenantID, answer.Key))
+	return nil
+}
+
+// FindDeleted isn't cached, only active answers are.
+func (a *AnswerRepo) FindDeleted(ctx context.Context, tenantID, key string) ([]datastore.Answer, error) {
+	return a.next.FindDeleted(ctx, tenantID, key)
+}
+
+func (a *AnswerRepo) Restore(ctx context.Context, answer *datastore.Answer) error {
+	err := a.next.Restore(ctx, answer)
+	if err != nil {
+		return err
+	}
+
+	// drops a cached "not found" for the key
+	a.invalidateAfterWrite(ctx, cacheKey(answer.TenantID, answer.Key))
+	return nil
+}
+
+// FindDeletedBefore, Purge and LastGeneration only deal with
+// deleted answers, or generations, which are never cached.
+func (a *AnswerRepo) FindDeletedBefore(ctx context.Context, tenantID string, before primitive.DateTime) ([]datastore.Answer, error) {
+	return a.next.FindDeletedBefore(ctx, tenantID, before)
+}
+
+func (a *AnswerRepo) Purge(ctx context.Context, answer *datastore.Answer) error {
+	return a.next.Purge(ctx, answer)
+}
+
+func (a *AnswerRepo) LastGeneration(ctx context.Context, tenantID, key string) (int64, error) {
+	return a.next.LastGeneration(ctx, tenantID, key)
+}
+
+// FindExpired reads from the store, cached answers carry their
+// expiry and are told apart as expired when read.
+func (a *AnswerRepo) FindExpired(ctx context.Context, before primitive.DateTime, limit int) ([]datastore.Answer, error) {
+	return a.next.FindExpired(ctx, before, limit)
+}
+
+func (a *AnswerRepo) set(ctx context.Context, ck string, answer *datastore.Answer) {
+	raw, err := bson.Marshal(answer)
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to encode answer %s", ck)
+		return
+	}
+
+	if err := a.client.Set(ctx, ck, raw, a.opts.TTL).Err(); err != nil {
+		logrus.WithError(err).Warn("failed to cache answer in redis")
+	}
+}
+
+func (a *AnswerRepo) setNotFound(ctx context.Context, ck string) {
+	if err := a.client.Set(ctx, ck, "", a.opts.NegativeTTL).Err(); err != nil {
+		logrus.WithError(err).Warn("failed to cache missing answer in redis")
+	}
+}
+
+// invalidateAfterWrite drops the cached entry ck, or defers it
+// to the end of the transaction carried by ctx.
+func (a *AnswerRepo) invalidateAfterWrite(ctx context.Context, ck string) {
+	if p, ok := ctx.Value(pendingKey{}).(*pending); ok {
+		p.add(ck)
+		return
+	}
+
+	a.invalidate(ctx, ck)
+}
+
+func (a *AnswerRepo) invalidate(ctx context.Context, cacheKeys ...string) {
+	if len(cacheKeys) == 0 {
+		return
+	}
+
+	if err := a.client.Del(ctx, cacheKeys...).Err(); err != nil {
+		logrus.WithError(err).Errorf("failed to invalidate cached answers %v", cacheKeys)
+	}
+}
+
+// cacheKey namespaces key by tenant. Tenant ids can't
+// contain a colon, so two entries never collide.
+func cacheKey(tenantID, key string) string {
+	return keyPrefix + tenantID + ":" + key
+}
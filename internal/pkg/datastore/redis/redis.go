@@ -0,0 +1,165 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+)
+
+// Options configures the answer cache.
+type Options struct {
+	// TTL is how long a found answer stays cached.
+	TTL time.Duration
+
+	// NegativeTTL is how long a missing key is remembered,
+	// zero disables negative caching.
+	NegativeTTL time.Duration
+}
+
+// NewClient connects to the redis instance at dsn. timeout bounds every
+// call that doesn't set its own in the dsn, so an unreachable redis slows
+// requests down by at most that much before they fall back to the store.
+func NewClient(dsn string, timeout time.Duration) (*redis.Client, error) {
+	opts, err := redis.ParseURL(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = timeout
+	}
+
+	if opts.ReadTimeout == 0 {
+		opts.ReadTimeout = timeout
+	}
+
+	if opts.WriteTimeout == 0 {
+		opts.WriteTimeout = timeout
+	}
+
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The cache is optional, answers are served
+	// from the store until redis comes back
+	if err := client.Ping(ctx).Err(); err != nil {
+		logrus.WithError(err).Warn("redis is unreachable, answers will be read from the store")
+	}
+
+	return client, nil
+}
+
+// Store wraps a datastore.Store, serving answer lookups from redis.
+type Store struct {
+	store      datastore.Store
+	client     *redis.Client
+	answerRepo *AnswerRepo
+}
+
+// txStore is returned for stores that support transactions, so that
+// cache invalidation is deferred until the transaction commits.
+type txStore struct {
+	*Store
+	transactor datastore.Transactor
+}
+
+// NewCachedStore returns store with a read-through cache in front of its
+// answer repository. The returned store implements datastore.Transactor
+// whenever store does.
+func NewCachedStore(store datastore.Store, client *redis.Client, opts Options) datastore.Store {
+	s := &Store{
+		store:      store,
+		client:     client,
+		answerRepo: NewAnswerRepo(store.Answers(), client, opts),
+	}
+
+	if transactor, ok := store.(datastore.Transactor); ok {
+		return &txStore{Store: s, transactor: transactor}
+	}
+
+	return s
+}
+
+func (s *Store) Answers() datastore.AnswerRepository {
+	return s.answerRepo
+}
+
+func (s *Store) Events() datastore.EventRepository {
+	return s.store.Events()
+}
+
+func (s *Store) Outbox() datastore.OutboxRepository {
+	return s.store.Outbox()
+}
+
+func (s *Store) Schemas() datastore.SchemaRepository {
+	return s.store.Schemas()
+}
+
+// APIKeys aren't cached, so that revoked keys are
+// rejected by every instance right away.
+func (s *Store) APIKeys() datastore.APIKeyRepository {
+	return s.store.APIKeys()
+}
+
+// RoleBindings aren't cached either, so that
+// revoked roles stop applying right away.
+func (s *Store) RoleBindings() datastore.RoleBindingRepository {
+	return s.store.RoleBindings()
+}
+
+func (s *Store) LegalHolds() datastore.LegalHoldRepository {
+	return s.store.LegalHolds()
+}
+
+func (s *Store) Close(ctx context.Context) error {
+	if err := s.client.Close(); err != nil {
+		logrus.WithError(err).Error("failed to close redis client")
+	}
+
+	return s.store.Close(ctx)
+}
+
+func (s *txStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if inTransaction(ctx) {
+		return s.transactor.WithTransaction(ctx, fn)
+	}
+
+	p := &pending{}
+	ctx = context.WithValue(ctx, pendingKey{}, p)
+
+	err := s.transactor.WithTransaction(ctx, fn)
+
+	// Keys are invalidated once the transaction is over, otherwise a
+	// concurrent read could cache a value that is about to change.
+	// Rolled back transactions only cost a cache miss.
+	s.answerRepo.invalidate(context.Background(), p.keys...)
+
+	return err
+}
+
+type pendingKey struct{}
+
+// pending collects the cache keys written during a transaction.
+type pending struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (p *pending) add(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.keys = append(p.keys, key)
+}
+
+func inTransaction(ctx context.Context) bool {
+	_, ok := ctx.Value(pendingKey{}).(*pending)
+	return ok
+}
@@ -0,0 +1,204 @@
+package redis
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/datastore/memory"
+	"github.com/dotunj/bequest/internal/pkg/datastore/mocks"
+	"github.com/dotunj/bequest/internal/pkg/datastore/sqlite"
+	"github.com/dotunj/bequest/internal/pkg/datastore/storetest"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+var testOptions = Options{TTL: time.Minute, NegativeTTL: time.Minute}
+
+func TestCachedStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) datastore.Store {
+		mr := miniredis.RunT(t)
+
+		client, err := NewClient("redis://"+mr.Addr(), 100*time.Millisecond)
+		require.Nil(t, err)
+
+		store := NewCachedStore(memory.NewMemoryRepository(), client, testOptions)
+		t.Cleanup(func() {
+			_ = store.Close(context.Background())
+		})
+
+		return store
+	})
+}
+
+func TestCachedStore_Transactional(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) datastore.Store {
+		mr := miniredis.RunT(t)
+
+		client, err := NewClient("redis://"+mr.Addr(), 100*time.Millisecond)
+		require.Nil(t, err)
+
+		db, err := sqlite.NewSqliteRepository(filepath.Join(t.TempDir(), "bequest.sqlite"))
+		require.Nil(t, err)
+
+		store := NewCachedStore(db, client, testOptions)
+		t.Cleanup(func() {
+			_ = store.Close(context.Background())
+		})
+
+		return store
+	})
+}
+
+func TestAnswerRepo(t *testing.T) {
+	ctx := context.Background()
+	answer := storetest.NewAnswer("some-key", "some-value")
+
+	tt := []struct {
+		name string
+		fn   func(t *testing.T, mr *miniredis.Miniredis, repo *AnswerRepo, next *mocks.MockAnswerRepository)
+	}{
+		{
+			name: "should_serve_answer_from_cache",
+			fn: func(t *testing.T, mr *miniredis.Miniredis, repo *AnswerRepo, next *mocks.MockAnswerRepository) {
+				next.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Times(1).Return(answer, nil)
+
+				for i := 0; i < 3; i++ {
+					found, err := repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+					require.Nil(t, err)
+					require.Equal(t, answer.Values, found.Values)
+				}
+
+				require.True(t, mr.Exists(cacheKey(datastore.DefaultTenant, "some-key")))
+				require.Equal(t, time.Minute, mr.TTL(cacheKey(datastore.DefaultTenant, "some-key")))
+			},
+		},
+
+		{
+			name: "should_cache_answers_per_tenant",
+			fn: func(t *testing.T, mr *miniredis.Miniredis, repo *AnswerRepo, next *mocks.MockAnswerRepository) {
+				next.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Times(1).Return(answer, nil)
+				next.EXPECT().FindByKey(gomock.Any(), "other-tenant", "some-key").Times(1).Return(&datastore.Answer{}, datastore.ErrAnswerNotFound)
+
+				_, err := repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+				require.Nil(t, err)
+
+				_, err = repo.FindByKey(ctx, "other-tenant", "some-key")
+				require.ErrorIs(t, err, datastore.ErrAnswerNotFound)
+			},
+		},
+
+		{
+			name: "should_cache_missing_answers",
+			fn: func(t *testing.T, mr *miniredis.Miniredis, repo *AnswerRepo, next *mocks.MockAnswerRepository) {
+				next.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Times(1).Return(&datastore.Answer{}, datastore.ErrAnswerNotFound)
+
+				for i := 0; i < 3; i++ {
+					_, err := repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+					require.ErrorIs(t, err, datastore.ErrAnswerNotFound)
+				}
+			},
+		},
+
+		{
+			name: "should_invalidate_on_writes",
+			fn: func(t *testing.T, mr *miniredis.Miniredis, repo *AnswerRepo, next *mocks.MockAnswerRepository) {
+				next.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Times(4).Return(answer, nil)
+				next.EXPECT().Create(gomock.Any(), answer).Return(nil)
+				next.EXPECT().Update(gomock.Any(), answer, gomock.Any(), int64(0)).Return(answer, nil)
+				next.EXPECT().Delete(gomock.Any(), answer, int64(0)).Return(nil)
+
+				writes := []func() error{
+					func() error { return repo.Create(ctx, answer) },
+					func() error {
+						_, err := repo.Update(ctx, answer, &datastore.Value{Value: "new-value"}, 0)
+						return err
+					},
+					func() error { return repo.Delete(ctx, answer, 0) },
+				}
+
+				_, err := repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+				require.Nil(t, err)
+
+				for _, write := range writes {
+					require.True(t, mr.Exists(cacheKey(datastore.DefaultTenant, "some-key")))
+					require.Nil(t, write())
+					require.False(t, mr.Exists(cacheKey(datastore.DefaultTenant, "some-key")))
+
+					_, err := repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+					require.Nil(t, err)
+				}
+			},
+		},
+
+		{
+			name: "should_fall_back_to_store_when_redis_is_down",
+			fn: func(t *testing.T, mr *miniredis.Miniredis, repo *AnswerRepo, next *mocks.MockAnswerRepository) {
+				next.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Times(2).Return(answer, nil)
+				next.EXPECT().Update(gomock.Any(), answer, gomock.Any(), int64(0)).Return(answer, nil)
+
+				mr.Close()
+
+				for i := 0; i < 2; i++ {
+					found, err := repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+					require.Nil(t, err)
+					require.Equal(t, answer.Values, found.Values)
+				}
+
+				_, err := repo.Update(ctx, answer, &datastore.Value{Value: "new-value"}, 0)
+				require.Nil(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mr := miniredis.RunT(t)
+
+			client, err := NewClient("redis://"+mr.Addr(), 100*time.Millisecond)
+			require.Nil(t, err)
+			defer client.Close()
+
+			next := mocks.NewMockAnswerRepository(ctrl)
+			tc.fn(t, mr, NewAnswerRepo(next, client, testOptions), next)
+		})
+	}
+}
+
+func TestCachedStore_InvalidatesAfterCommit(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+
+	client, err := NewClient("redis://"+mr.Addr(), 100*time.Millisecond)
+	require.Nil(t, err)
+
+	db, err := sqlite.NewSqliteRepository(filepath.Join(t.TempDir(), "bequest.sqlite"))
+	require.Nil(t, err)
+
+	store := NewCachedStore(db, client, testOptions)
+	defer store.Close(ctx)
+
+	require.Nil(t, store.Answers().Create(ctx, storetest.NewAnswer("some-key", "some-value")))
+
+	_, err = store.Answers().FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+
+	err = store.(datastore.Transactor).WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := store.Answers().Update(ctx, &datastore.Answer{TenantID: datastore.DefaultTenant, Key: "some-key"}, &datastore.Value{Value: "new-value"}, 0)
+		require.Nil(t, err)
+
+		// the entry is still cached until the transaction commits
+		require.True(t, mr.Exists(cacheKey(datastore.DefaultTenant, "some-key")))
+		return nil
+	})
+	require.Nil(t, err)
+	require.False(t, mr.Exists(cacheKey(datastore.DefaultTenant, "some-key")))
+
+	answer, err := store.Answers().FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Len(t, answer.Values, 2)
+}
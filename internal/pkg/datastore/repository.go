@@ -2,17 +2,166 @@ package datastore
 
 import (
 	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// AnswerRepository stores answers. Reads are scoped to a tenant, writes
+// to the tenant of the answer they are given.
+//
 //go:generate mockgen --source repository.go --destination mocks/repository.go -package mocks
 type AnswerRepository interface {
+	// Create returns ErrDuplicateKey when the key has an active answer,
+	// deleted answers of the key don't get in the way.
 	Create(ctx context.Context, answer *Answer) error
-	FindByKey(ctx context.Context, key string) (*Answer, error)
-	Update(ctx context.Context, answer *Answer, value *Value) (*Answer, error)
-	Delete(ctx context.Context, answer *Answer) error
+	FindByKey(ctx context.Context, tenantID, key string) (*Answer, error)
+	// FindManyByPrefix returns the active answers of the tenant
+	// whose key starts with prefix, ordered by key.
+	FindManyByPrefix(ctx context.Context, tenantID, prefix string) ([]Answer, error)
+	// FindMany returns the answers of the tenant selected by
+	// filter, in the order it sets and up to its limit.
+	FindMany(ctx context.Context, tenantID string, filter AnswerFilter) ([]Answer, error)
+	// Update appends value to the active answer of the key, increments
+	// its version and sets its expiry to that of answer. When version
+	// isn't zero the answer is only updated if it is still the generation
+	// identified by the UID of answer, at that version, ErrVersionMismatch
+	// is returned otherwise. The check and the write are atomic.
+	Update(ctx context.Context, answer *Answer, value *Value, version int64) (*Answer, error)
+	// Delete soft deletes the active answer of the key, under the
+	// same condition as Update when version isn't zero.
+	Delete(ctx context.Context, answer *Answer, version int64) error
+	// FindDeleted returns the deleted answers of the tenant, only those
+	// of key when it isn't empty, ordered by key then most recently
+	// deleted first.
+	FindDeleted(ctx context.Context, tenantID, key string) ([]Answer, error)
+	// Restore makes the deleted answer identified by the UID of answer
+	// active again, without an expiry. It returns ErrDuplicateKey when the
+	// key has an active answer, and ErrAnswerNotFound when the answer isn't
+	// deleted.
+	Restore(ctx context.Context, answer *Answer) error
+	// FindDeletedBefore returns the answers deleted before, of every
+	// tenant when tenantID is empty, ordered by tenant then key.
+	FindDeletedBefore(ctx context.Context, tenantID string, before primitive.DateTime) ([]Answer, error)
+	// Purge permanently removes the deleted answer identified by the
+	// UID of answer, along with its values, keeping its generation as
+	// that of the key for LastGeneration. It returns ErrAnswerNotFound
+	// when the answer isn't deleted.
+	Purge(ctx context.Context, answer *Answer) error
+	// LastGeneration returns the latest generation the key of the tenant
+	// has had, active, deleted or purged, or zero when it had none.
+	LastGeneration(ctx context.Context, tenantID, key string) (int64, error)
+	// FindExpired returns up to limit active answers of every tenant
+	// whose expiry is at or before, soonest to expire first.
+	FindExpired(ctx context.Context, before primitive.DateTime, limit int) ([]Answer, error)
+	// Search returns up to limit of the active answers of the tenant having
+	// a value, current or not, that mentions one of terms, most relevant first.
+	Search(ctx context.Context, tenantID string, terms []string, limit int) ([]ScoredAnswer, error)
 }
 
 type EventRepository interface {
+	// Create returns ErrDuplicateKey when an event with the same
+	// id exists, so that redelivered events are only stored once.
 	Create(ctx context.Context, event *Event) error
-	FindManyByKey(ctx context.Context, key string, pageable Pageable) ([]Event, PaginationData, error)
+	// FindManyByKey returns a page of the events of key, only those of
+	// generation when it isn't zero.
+	FindManyByKey(ctx context.Context, tenantID, key string, generation int64, pageable Pageable) ([]Event, PaginationData, error)
+	// FindExpired returns the events created before, when it isn't
+	// zero, along with those past the keep most recent events of their
+	// key, when keep isn't zero. Events of every tenant are returned
+	// when tenantID is empty.
+	FindExpired(ctx context.Context, tenantID string, before primitive.DateTime, keep int) ([]Event, error)
+	// DeleteByKey permanently removes the events of a generation of
+	// key, of every generation when it is zero, and returns how many
+	// were removed.
+	DeleteByKey(ctx context.Context, tenantID, key string, generation int64) (int64, error)
+	// Delete permanently removes events.
+	Delete(ctx context.Context, events []Event) error
+}
+
+// OutboxRepository gives access to the outbox messages written along
+// with answer mutations. Messages are returned oldest first.
+type OutboxRepository interface {
+	// FindDue returns up to limit pending messages due at or before now.
+	FindDue(ctx context.Context, now primitive.DateTime, limit int) ([]OutboxMessage, error)
+	// FindPendingByKey returns every pending message for an answer.
+	FindPendingByKey(ctx context.Context, tenantID, key string) ([]OutboxMessage, error)
+	Update(ctx context.Context, message *OutboxMessage) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// SchemaRepository stores the versions of the schemas answer values
+// are validated against, each tenant having its own namespaces.
+type SchemaRepository interface {
+	// Create returns ErrDuplicateKey when the version
+	// of the namespace already exists for the tenant.
+	Create(ctx context.Context, schema *Schema) error
+	FindByUID(ctx context.Context, tenantID, uid string) (*Schema, error)
+	// FindMany returns every version of namespace, or of every namespace
+	// when it is empty, ordered by namespace then version.
+	FindMany(ctx context.Context, tenantID, namespace string) ([]Schema, error)
+	// FindActive returns the active version of every namespace.
+	FindActive(ctx context.Context, tenantID string) ([]Schema, error)
+	// UpdateStatus sets the status of the schema identified by uid.
+	UpdateStatus(ctx context.Context, tenantID, uid string, status SchemaStatus) error
+}
+
+// APIKeyRepository stores the API keys of every tenant. Keys are
+// returned oldest first.
+type APIKeyRepository interface {
+	// Create returns ErrDuplicateKey when the prefix is taken.
+	Create(ctx context.Context, key *APIKey) error
+	FindByUID(ctx context.Context, tenantID, uid string) (*APIKey, error)
+	// FindByPrefix looks a key up across tenants, so that the
+	// requests presenting it can be authenticated.
+	FindByPrefix(ctx context.Context, prefix string) (*APIKey, error)
+	FindMany(ctx context.Context, tenantID string) ([]APIKey, error)
+	// Update replaces the key identified by the uid and tenant of
+	// key. It returns ErrDuplicateKey when the new prefix is taken.
+	Update(ctx context.Context, key *APIKey) error
+	// TouchLastUsed records that the key identified by uid was used at.
+	TouchLastUsed(ctx context.Context, uid string, at primitive.DateTime) error
+}
+
+// RoleBindingRepository stores the roles granted within every
+// tenant. Bindings are returned oldest first.
+type RoleBindingRepository interface {
+	// Create returns ErrDuplicateKey when the subject
+	// already has a role on the pattern.
+	Create(ctx context.Context, binding *RoleBinding) error
+	FindByUID(ctx context.Context, tenantID, uid string) (*RoleBinding, error)
+	// FindMany returns the bindings of the tenant, only those
+	// granted to one of subjects when any are given.
+	FindMany(ctx context.Context, tenantID string, subjects []string) ([]RoleBinding, error)
+	Delete(ctx context.Context, tenantID, uid string) error
+}
+
+// LegalHoldRepository stores the keys held from purging. Holds are
+// returned ordered by tenant then key.
+type LegalHoldRepository interface {
+	// Create returns ErrDuplicateKey when the key is already held.
+	Create(ctx context.Context, hold *LegalHold) error
+	// FindMany returns the holds of the tenant, of every
+	// tenant when tenantID is empty.
+	FindMany(ctx context.Context, tenantID string) ([]LegalHold, error)
+	Delete(ctx context.Context, tenantID, key string) error
+}
+
+// Store is implemented by every storage backend and exposes the
+// repositories the services are built on.
+type Store interface {
+	Answers() AnswerRepository
+	Events() EventRepository
+	Outbox() OutboxRepository
+	Schemas() SchemaRepository
+	APIKeys() APIKeyRepository
+	RoleBindings() RoleBindingRepository
+	LegalHolds() LegalHoldRepository
+	Close(ctx context.Context) error
+}
+
+// Transactor is implemented by stores that can apply several repository
+// calls atomically. Calls made with the context handed to fn take part
+// in the transaction, which is rolled back if fn returns an error.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
 }
@@ -0,0 +1,265 @@
+package datastore
+
+import (
+	"container/heap"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// highlightContext is the number of runes kept on
+	// each side of the first mention in a highlight.
+	highlightContext = 40
+
+	highlightStart = "<em>"
+	highlightEnd   = "</em>"
+)
+
+// SearchTerms splits text into the lowercase words it is searched
+// by, the way the mongo text index splits values, without stemming.
+func SearchTerms(text string) []string {
+	seen := make(map[string]bool)
+
+	terms := make([]string, 0)
+	for _, w := range words(text) {
+		if !seen[w.text] {
+			seen[w.text] = true
+			terms = append(terms, w.text)
+		}
+	}
+
+	return terms
+}
+
+// TextMatch is the mention of search terms in a value.
+type TextMatch struct {
+	// Score ranks the values mentioning more of the terms first,
+	// then those mentioning them more densely.
+	Score float64
+
+	// Highlight is the fragment of the value around its first
+	// mention, with every mention of a term set in <em> tags. The
+	// text of the value is HTML-escaped, so it can be shown as HTML.
+	Highlight string
+}
+
+// MatchText returns how value mentions terms, or false when it mentions
+// none of them. Only the strings of a value are searched: the value
+// itself when it is a string, or the strings of a list, which are the
+// values the mongo text index covers.
+func MatchText(value interface{}, terms []string) (TextMatch, bool) {
+	wanted := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		wanted[term] = true
+	}
+
+	var match TextMatch
+
+	mentioned := make(map[string]bool)
+	mentions, total := 0, 0
+
+	for _, text := range searchedStrings(value) {
+		found := words(text)
+		total += len(found)
+
+		var spans []word
+		for _, w := range found {
+			if wanted[w.text] {
+				mentioned[w.text] = true
+				spans = append(spans, w)
+			}
+		}
+
+		if len(spans) > 0 && match.Highlight == "" {
+			match.Highlight = highlight(text, spans)
+		}
+
+		mentions += len(spans)
+	}
+
+	if mentions == 0 {
+		return match, false
+	}
+
+	match.Score = float64(len(mentioned)) + float64(mentions)/float64(total+1)
+	return match, true
+}
+
+// ScoredAnswer is an answer found by a search, along with its relevance.
+type ScoredAnswer struct {
+	Answer Answer
+	Score  float64
+}
+
+// SearchRanking ranks the answers found by a search as they are added,
+// keeping only the limit most relevant, each scored by its most relevant
+// value, so that the backends without a text index can stream answers
+// into it rather than holding every answer of the tenant.
+type SearchRanking struct {
+	terms []string
+	limit int
+	found rankedAnswers
+}
+
+func NewSearchRanking(terms []string, limit int) *SearchRanking {
+	return &SearchRanking{terms: terms, limit: limit}
+}
+
+// Add ranks answer, unless none of its values mentions the terms.
+func (r *SearchRanking) Add(answer Answer) {
+	scored := ScoredAnswer{Answer: answer}
+	for _, value := range answer.Values {
+		if match, ok := MatchText(value.Value, r.terms); ok && match.Score > scored.Score {
+			scored.Score = match.Score
+		}
+	}
+
+	switch {
+	case scored.Score == 0:
+	case r.limit <= 0 || len(r.found) < r.limit:
+		heap.Push(&r.found, scored)
+	case moreRelevant(scored, r.found[0]):
+		// the least relevant answer kept makes room for it
+		r.found[0] = scored
+		heap.Fix(&r.found, 0)
+	}
+}
+
+// Answers returns the answers kept, most relevant first.
+func (r *SearchRanking) Answers() []ScoredAnswer {
+	found := make([]ScoredAnswer, len(r.found))
+	copy(found, r.found)
+
+	sort.Slice(found, func(i, j int) bool {
+		return moreRelevant(found[i], found[j])
+	})
+
+	return found
+}
+
+// moreRelevant orders answers by score, then by key.
+func moreRelevant(a, b ScoredAnswer) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+
+	return a.Answer.Key < b.Answer.Key
+}
+
+// rankedAnswers is a heap holding the least relevant answer first.
+type rankedAnswers []ScoredAnswer
+
+func (h rankedAnswers) Len() int            { return len(h) }
+func (h rankedAnswers) Less(i, j int) bool  { return moreRelevant(h[j], h[i]) }
+func (h rankedAnswers) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *rankedAnswers) Push(x interface{}) { *h = append(*h, x.(ScoredAnswer)) }
+
+func (h *rankedAnswers) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// word is a lowercase word of a text, along with
+// the byte offsets it was found at.
+type word struct {
+	text       string
+	start, end int
+}
+
+func words(text string) []word {
+	var found []word
+
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			found = append(found, word{text: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		found = append(found, word{text: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+
+	return found
+}
+
+func searchedStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var texts []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				texts = append(texts, s)
+			}
+		}
+		return texts
+	default:
+		return nil
+	}
+}
+
+// highlight returns the fragment of text around the first of spans,
+// which are ordered, marking those that fall within it. The text is
+// escaped, only the marks are markup.
+func highlight(text string, spans []word) string {
+	start := runeOffset(text, spans[0].start, -highlightContext)
+	end := runeOffset(text, spans[0].end, highlightContext)
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+
+	last := start
+	for _, span := range spans {
+		if span.end > end {
+			break
+		}
+
+		b.WriteString(html.EscapeString(text[last:span.start]))
+		b.WriteString(highlightStart)
+		b.WriteString(html.EscapeString(text[span.start:span.end]))
+		b.WriteString(highlightEnd)
+		last = span.end
+	}
+
+	b.WriteString(html.EscapeString(text[last:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+
+	return b.String()
+}
+
+// runeOffset returns the byte offset n runes away from
+// offset in text, clamped to the bounds of text.
+func runeOffset(text string, offset, n int) int {
+	for ; n < 0 && offset > 0; n++ {
+		offset--
+		for offset > 0 && !utf8.RuneStart(text[offset]) {
+			offset--
+		}
+	}
+
+	for ; n > 0 && offset < len(text); n-- {
+		offset++
+		for offset < len(text) && !utf8.RuneStart(text[offset]) {
+			offset++
+		}
+	}
+
+	return offset
+}
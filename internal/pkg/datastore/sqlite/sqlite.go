@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore/sqlstore"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// NewSqliteRepository opens the SQLite database at dsn. Answers, their
+// versions and events are kept in plain tables, so the store can be
+// inspected with SQL.
+func NewSqliteRepository(dsn string) (*sqlstore.Client, error) {
+	db, err := sql.Open("sqlite", withPragmas(dsn))
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite serialises writers anyway, a single connection avoids
+	// SQLITE_BUSY errors and lets in-memory databases be shared.
+	db.SetMaxOpenConns(1)
+
+	c, err := sqlstore.New(db, dialect{})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+type dialect struct{}
+
+func (dialect) IsUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+func withPragmas(dsn string) string {
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+
+	return dsn + separator + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+}
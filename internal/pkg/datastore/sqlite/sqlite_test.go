@@ -0,0 +1,50 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/datastore/sqlstore"
+	"github.com/dotunj/bequest/internal/pkg/datastore/storetest"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T, dsn string) *sqlstore.Client {
+	db, err := NewSqliteRepository(dsn)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = db.Close(context.Background())
+	})
+
+	return db
+}
+
+func TestSqliteStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) datastore.Store {
+		return newTestStore(t, filepath.Join(t.TempDir(), "bequest.sqlite"))
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	db := newTestStore(t, ":memory:")
+
+	var count, version int
+	err := db.DB.QueryRowContext(ctx, `SELECT COUNT(*), MAX(version) FROM schema_migrations`).Scan(&count, &version)
+	require.Nil(t, err)
+	require.NotZero(t, count)
+	require.Equal(t, count, version)
+
+	// running the migrations again must be a no-op
+	require.Nil(t, sqlstore.Migrate(ctx, db.DB))
+
+	var recount int
+	err = db.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations`).Scan(&recount)
+	require.Nil(t, err)
+	require.Equal(t, count, recount)
+}
@@ -0,0 +1,609 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AnswerRepo struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func NewAnswerRepo(db *sql.DB, dialect Dialect) *AnswerRepo {
+	return &AnswerRepo{db: db, dialect: dialect}
+}
+
+func (a *AnswerRepo) Create(ctx context.Context, answer *datastore.Answer) error {
+	return runInTx(ctx, a.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO answers (id, uid, tenant_id, key, version, generation, created_at, updated_at, deleted_at, document_status, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			answer.ID.Hex(), answer.UID, answer.TenantID, answer.Key, answer.Version, answer.Generation, answer.CreatedAt,
+			answer.UpdatedAt, nullDateTime(answer.DeletedAt), answer.DocumentStatus, nullDateTime(answer.ExpiresAt))
+		if a.dialect.IsUniqueViolation(err) {
+			return datastore.ErrDuplicateKey
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for i, value := range answer.Values {
+			if err := insertVersion(ctx, tx, answer.ID.Hex(), i+1, &value); err != nil {
+				return err
+			}
+		}
+
+		return insertOutbox(ctx, tx, answer.Outbox)
+	})
+}
+
+func (a *AnswerRepo) FindByKey(ctx context.Context, tenantID, key string) (*datastore.Answer, error) {
+	return findByKey(ctx, conn(ctx, a.db), tenantID, key)
+}
+
+func (a *AnswerRepo) FindManyByPrefix(ctx context.Context, tenantID, prefix string) ([]datastore.Answer, error) {
+	q := conn(ctx, a.db)
+
+	// substr instead of LIKE, so that prefixes
+	// containing wildcards don't need escaping
+	rows, err := q.QueryContext(ctx, `
+SELECT key FROM answers
+WHERE tenant_id = $1 AND substr(key, 1, $2) = $3 AND document_status = $4
+ORDER BY key`, tenantID, utf8.RuneCountInString(prefix), prefix, datastore.ActiveDocumentStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	answers := make([]datastore.Answer, 0, len(keys))
+	for _, key := range keys {
+		answer, err := findByKey(ctx, q, tenantID, key)
+		if err != nil {
+			return nil, err
+		}
+
+		answers = append(answers, *answer)
+	}
+
+	return answers, nil
+}
+
+// FindMany matches the regex of the filter in Go rather than in SQL,
+// where each dialect has its own syntax, reading rows until enough
+// answers match.
+func (a *AnswerRepo) FindMany(ctx context.Context, tenantID string, filter datastore.AnswerFilter) ([]datastore.Answer, error) {
+	var pattern *regexp.Regexp
+	if filter.Regex != "" {
+		var err error
+		if pattern, err = regexp.Compile(filter.Regex); err != nil {
+			return nil, err
+		}
+	}
+
+	status := filter.Status
+	if status == "" {
+		status = datastore.ActiveDocumentStatus
+	}
+
+	args := []interface{}{tenantID, status}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := []string{`tenant_id = $1`, `document_status = $2`}
+	if filter.Prefix != "" {
+		where = append(where, fmt.Sprintf(`substr(key, 1, %s) = %s`, arg(utf8.RuneCountInString(filter.Prefix)), arg(filter.Prefix)))
+	}
+
+	if filter.UpdatedSince != 0 {
+		where = append(where, `updated_at >= `+arg(filter.UpdatedSince))
+	}
+
+	if filter.CreatedBefore != 0 {
+		where = append(where, `created_at < `+arg(filter.CreatedBefore))
+	}
+
+	if filter.ExpiresAfter != 0 {
+		where = append(where, `(expires_at IS NULL OR expires_at > `+arg(filter.ExpiresAfter)+`)`)
+	}
+
+	order, op := "ASC", ">"
+	if filter.Descending {
+		order, op = "DESC", "<"
+	}
+
+	columns := []string{"key", "generation"}
+	if filter.SortBy == datastore.CreatedAtAnswerSort || filter.SortBy == datastore.UpdatedAtAnswerSort {
+		columns = append([]string{string(filter.SortBy)}, columns...)
+	}
+
+	if after := filter.After; after != nil {
+		values := []interface{}{after.Key, after.Generation}
+		if len(columns) == 3 {
+			values = append([]interface{}{after.Time}, values...)
+		}
+
+		// (c1 > v1 OR (c1 = v1 AND (c2 > v2 OR ...))), built inside out
+		placeholders := make([]string, len(values))
+		for i := range values {
+			placeholders[i] = arg(values[i])
+		}
+
+		past := fmt.Sprintf(`%s %s %s`, columns[len(columns)-1], op, placeholders[len(columns)-1])
+		for i := len(columns) - 2; i >= 0; i-- {
+			past = fmt.Sprintf(`(%[1]s %[2]s %[3]s OR (%[1]s = %[3]s AND %[4]s))`, columns[i], op, placeholders[i], past)
+		}
+
+		where = append(where, past)
+	}
+
+	orderBy := make([]string, len(columns))
+	for i, column := range columns {
+		orderBy[i] = column + " " + order
+	}
+
+	query := `SELECT id, key FROM answers WHERE ` + strings.Join(where, ` AND `) + ` ORDER BY ` + strings.Join(orderBy, `, `)
+	if filter.Limit > 0 && pattern == nil {
+		query += ` LIMIT ` + arg(filter.Limit)
+	}
+
+	q := conn(ctx, a.db)
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for (filter.Limit <= 0 || len(ids) < filter.Limit) && rows.Next() {
+		var id, key string
+		if err := rows.Scan(&id, &key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		if pattern == nil || pattern.MatchString(key) {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	answers := make([]datastore.Answer, 0, len(ids))
+	for _, id := range ids {
+		answer, err := findAnswer(ctx, q, `id = $1`, id)
+		if err != nil {
+			return nil, err
+		}
+
+		answers = append(answers, *answer)
+	}
+
+	return answers, nil
+}
+
+func (a *AnswerRepo) Update(ctx context.Context, answer *datastore.Answer, value *datastore.Value, version int64) (*datastore.Answer, error) {
+	var updated *datastore.Answer
+
+	err := runInTx(ctx, a.db, func(tx *sql.Tx) error {
+		// Bumping the version first locks the row for the rest
+		// of the transaction, so concurrent updates can't both
+		// claim the same version number.
+		res, err := tx.ExecContext(ctx, `
+UPDATE answers SET updated_at = $1, version = version + 1, expires_at = $7
+WHERE tenant_id = $2 AND key = $3 AND document_status = $4 AND ($5 = 0 OR (uid = $6 AND version = $5))`,
+			primitive.NewDateTimeFromTime(time.Now()), answer.TenantID, answer.Key, datastore.ActiveDocumentStatus,
+			version, answer.UID, nullDateTime(answer.ExpiresAt))
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			if err != nil {
+				return err
+			}
+
+			if version != 0 {
+				return datastore.ErrVersionMismatch
+			}
+			return datastore.ErrAnswerNotFound
+		}
+
+		updated, err = findByKey(ctx, tx, answer.TenantID, answer.Key)
+		if err != nil {
+			return err
+		}
+
+		if err := insertVersion(ctx, tx, updated.ID.Hex(), int(updated.Version), value); err != nil {
+			return err
+		}
+
+		written := *value
+		written.Version = updated.Version
+
+		updated.Values = append(updated.Values, written)
+		return insertOutbox(ctx, tx, answer.Outbox)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (a *AnswerRepo) Delete(ctx context.Context, answer *datastore.Answer, version int64) error {
+	return runInTx(ctx, a.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+UPDATE answers SET document_status = $1, deleted_at = $2
+WHERE tenant_id = $3 AND key = $4 AND document_status = $5 AND ($6 = 0 OR (uid = $7 AND version = $6))`,
+			datastore.DeletedDocumentStatus, primitive.NewDateTimeFromTime(time.Now()), answer.TenantID, answer.Key,
+			datastore.ActiveDocumentStatus, version, answer.UID)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			if err == nil && version != 0 {
+				return datastore.ErrVersionMismatch
+			}
+			return err
+		}
+
+		return insertOutbox(ctx, tx, answer.Outbox)
+	})
+}
+
+func (a *AnswerRepo) FindDeleted(ctx context.Context, tenantID, key string) ([]datastore.Answer, error) {
+	q := conn(ctx, a.db)
+
+	rows, err := q.QueryContext(ctx, `
+SELECT id FROM answers
+WHERE tenant_id = $1 AND ($2 = '' OR key = $2) AND document_status = $3
+ORDER BY key, deleted_at DESC`, tenantID, key, datastore.DeletedDocumentStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	answers := make([]datastore.Answer, 0, len(ids))
+	for _, id := range ids {
+		answer, err := findAnswer(ctx, q, `id = $1`, id)
+		if err != nil {
+			return nil, err
+		}
+
+		answers = append(answers, *answer)
+	}
+
+	return answers, nil
+}
+
+func (a *AnswerRepo) Restore(ctx context.Context, answer *datastore.Answer) error {
+	return runInTx(ctx, a.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+UPDATE answers SET document_status = $1, deleted_at = NULL, expires_at = NULL
+WHERE tenant_id = $2 AND key = $3 AND uid = $4 AND document_status = $5`,
+			datastore.ActiveDocumentStatus, answer.TenantID, answer.Key, answer.UID, datastore.DeletedDocumentStatus)
+		if a.dialect.IsUniqueViolation(err) {
+			return datastore.ErrDuplicateKey
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			if err != nil {
+				return err
+			}
+			return datastore.ErrAnswerNotFound
+		}
+
+		return insertOutbox(ctx, tx, answer.Outbox)
+	})
+}
+
+func (a *AnswerRepo) FindDeletedBefore(ctx context.Context, tenantID string, before primitive.DateTime) ([]datastore.Answer, error) {
+	q := conn(ctx, a.db)
+
+	rows, err := q.QueryContext(ctx, `
+SELECT id FROM answers
+WHERE ($1 = '' OR tenant_id = $1) AND document_status = $2 AND deleted_at < $3
+ORDER BY tenant_id, key, deleted_at DESC`, tenantID, datastore.DeletedDocumentStatus, before)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	answers := make([]datastore.Answer, 0, len(ids))
+	for _, id := range ids {
+		answer, err := findAnswer(ctx, q, `id = $1`, id)
+		if err != nil {
+			return nil, err
+		}
+
+		answers = append(answers, *answer)
+	}
+
+	return answers, nil
+}
+
+// Purge relies on the answer_versions foreign key
+// to remove the values along with the answer.
+// Purge records the generation of answer in purged_generations
+// before deleting it, the latest one of the key being kept.
+func (a *AnswerRepo) Purge(ctx context.Context, answer *datastore.Answer) error {
+	q := conn(ctx, a.db)
+
+	_, err := q.ExecContext(ctx, `
+INSERT INTO purged_generations (tenant_id, key, generation)
+SELECT tenant_id, key, generation FROM answers
+WHERE tenant_id = $1 AND key = $2 AND uid = $3 AND document_status = $4
+ON CONFLICT (tenant_id, key) DO UPDATE SET generation = excluded.generation
+WHERE purged_generations.generation < excluded.generation`,
+		answer.TenantID, answer.Key, answer.UID, datastore.DeletedDocumentStatus)
+	if err != nil {
+		return err
+	}
+
+	res, err := q.ExecContext(ctx, `
+DELETE FROM answers WHERE tenant_id = $1 AND key = $2 AND uid = $3 AND document_status = $4`,
+		answer.TenantID, answer.Key, answer.UID, datastore.DeletedDocumentStatus)
+	return rowAffected(res, err, datastore.ErrAnswerNotFound)
+}
+
+func (a *AnswerRepo) LastGeneration(ctx context.Context, tenantID, key string) (int64, error) {
+	var generation int64
+
+	err := conn(ctx, a.db).QueryRowContext(ctx, `
+SELECT COALESCE(MAX(generation), 0) FROM (
+	SELECT generation FROM answers WHERE tenant_id = $1 AND key = $2
+	UNION ALL
+	SELECT generation FROM purged_generations WHERE tenant_id = $1 AND key = $2
+) generations`, tenantID, key).Scan(&generation)
+
+	return generation, err
+}
+
+func (a *AnswerRepo) FindExpired(ctx context.Context, before primitive.DateTime, limit int) ([]datastore.Answer, error) {
+	q := conn(ctx, a.db)
+
+	rows, err := q.QueryContext(ctx, `
+SELECT id FROM answers
+WHERE expires_at IS NOT NULL AND expires_at <= $1 AND document_status = $2
+ORDER BY expires_at LIMIT $3`, before, datastore.ActiveDocumentStatus, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	answers := make([]datastore.Answer, 0, len(ids))
+	for _, id := range ids {
+		answer, err := findAnswer(ctx, q, `id = $1`, id)
+		if err != nil {
+			return nil, err
+		}
+
+		answers = append(answers, *answer)
+	}
+
+	return answers, nil
+}
+
+// Search matches the values in Go, as neither dialect has a text
+// search that splits and matches words the way the others do. The
+// answers and their values are read in a single query, ordered by
+// answer, and each answer is ranked once its values are read, so that
+// only the most relevant answers are held at once.
+func (a *AnswerRepo) Search(ctx context.Context, tenantID string, terms []string, limit int) ([]datastore.ScoredAnswer, error) {
+	rows, err := conn(ctx, a.db).QueryContext(ctx, `
+SELECT a.id, a.uid, a.tenant_id, a.key, a.version, a.generation, a.created_at, a.updated_at, a.expires_at,
+	v.version, v.value, v.type, v.author, v.created_at
+FROM answers a JOIN answer_versions v ON v.answer_id = a.id
+WHERE a.tenant_id = $1 AND a.document_status = $2
+ORDER BY a.id, v.version`, tenantID, datastore.ActiveDocumentStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ranking := datastore.NewSearchRanking(terms, limit)
+
+	var answer *datastore.Answer
+	var answerID string
+	for rows.Next() {
+		var id, text string
+		var row datastore.Answer
+		var expiresAt, createdAt sql.NullInt64
+		var value datastore.Value
+
+		err := rows.Scan(&id, &row.UID, &row.TenantID, &row.Key, &row.Version, &row.Generation, &row.CreatedAt, &row.UpdatedAt, &expiresAt,
+			&value.Version, &text, &value.Type, &value.Author, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if answer == nil || id != answerID {
+			if answer != nil {
+				ranking.Add(*answer)
+			}
+
+			row.ID, err = primitive.ObjectIDFromHex(id)
+			if err != nil {
+				return nil, err
+			}
+
+			row.DocumentStatus = datastore.ActiveDocumentStatus
+			row.ExpiresAt = primitive.DateTime(expiresAt.Int64)
+			answer, answerID = &row, id
+		}
+
+		value.CreatedAt = primitive.DateTime(createdAt.Int64)
+
+		value.Value, err = decodeValue(text, value.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		answer.Values = append(answer.Values, value)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if answer != nil {
+		ranking.Add(*answer)
+	}
+
+	return ranking.Answers(), nil
+}
+
+func findByKey(ctx context.Context, q querier, tenantID, key string) (*datastore.Answer, error) {
+	return findAnswer(ctx, q, `tenant_id = $1 AND key = $2 AND document_status = $3`, tenantID, key, datastore.ActiveDocumentStatus)
+}
+
+// findAnswer returns the answer matching where, along with its values.
+func findAnswer(ctx context.Context, q querier, where string, args ...interface{}) (*datastore.Answer, error) {
+	answer := &datastore.Answer{}
+
+	var id string
+	var deletedAt, expiresAt sql.NullInt64
+
+	err := q.QueryRowContext(ctx, `
+SELECT id, uid, tenant_id, key, version, generation, created_at, updated_at, deleted_at, document_status, expires_at
+FROM answers WHERE `+where, args...).
+		Scan(&id, &answer.UID, &answer.TenantID, &answer.Key, &answer.Version, &answer.Generation, &answer.CreatedAt,
+			&answer.UpdatedAt, &deletedAt, &answer.DocumentStatus, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return answer, datastore.ErrAnswerNotFound
+	}
+
+	if err != nil {
+		return answer, err
+	}
+
+	answer.ID, err = primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return answer, err
+	}
+
+	answer.DeletedAt = primitive.DateTime(deletedAt.Int64)
+	answer.ExpiresAt = primitive.DateTime(expiresAt.Int64)
+
+	rows, err := q.QueryContext(ctx, `SELECT version, value, type, author, created_at FROM answer_versions WHERE answer_id = $1 ORDER BY version`, id)
+	if err != nil {
+		return answer, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var text string
+		var createdAt sql.NullInt64
+		var value datastore.Value
+		if err := rows.Scan(&value.Version, &text, &value.Type, &value.Author, &createdAt); err != nil {
+			return answer, err
+		}
+
+		value.CreatedAt = primitive.DateTime(createdAt.Int64)
+
+		value.Value, err = decodeValue(text, value.Type)
+		if err != nil {
+			return answer, err
+		}
+
+		answer.Values = append(answer.Values, value)
+	}
+
+	return answer, rows.Err()
+}
+
+func insertVersion(ctx context.Context, q querier, answerID string, version int, value *datastore.Value) error {
+	text, valueType, err := encodeValue(value.Value, value.Type)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, `INSERT INTO answer_versions (answer_id, version, value, type, author, created_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		answerID, version, text, valueType, value.Author, nullDateTime(value.CreatedAt))
+	return err
+}
+
+func nullDateTime(t primitive.DateTime) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(t), Valid: t != 0}
+}
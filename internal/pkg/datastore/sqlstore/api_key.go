@@ -0,0 +1,148 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type APIKeyRepo struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func NewAPIKeyRepo(db *sql.DB, dialect Dialect) *APIKeyRepo {
+	return &APIKeyRepo{db: db, dialect: dialect}
+}
+
+const apiKeyColumns = `id, uid, tenant_id, name, prefix, hash, scopes, expires_at, last_used_at, revoked_at, created_at, updated_at`
+
+func (a *APIKeyRepo) Create(ctx context.Context, key *datastore.APIKey) error {
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn(ctx, a.db).ExecContext(ctx, `
+INSERT INTO api_keys (`+apiKeyColumns+`)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		key.ID.Hex(), key.UID, key.TenantID, key.Name, key.Prefix, key.Hash, string(scopes),
+		nullDateTime(key.ExpiresAt), nullDateTime(key.LastUsedAt), nullDateTime(key.RevokedAt), key.CreatedAt, key.UpdatedAt)
+	if a.dialect.IsUniqueViolation(err) {
+		return datastore.ErrDuplicateKey
+	}
+
+	return err
+}
+
+func (a *APIKeyRepo) FindByUID(ctx context.Context, tenantID, uid string) (*datastore.APIKey, error) {
+	return a.findOne(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE tenant_id = $1 AND uid = $2`, tenantID, uid)
+}
+
+func (a *APIKeyRepo) FindByPrefix(ctx context.Context, prefix string) (*datastore.APIKey, error) {
+	return a.findOne(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE prefix = $1`, prefix)
+}
+
+func (a *APIKeyRepo) FindMany(ctx context.Context, tenantID string) ([]datastore.APIKey, error) {
+	return a.find(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE tenant_id = $1 ORDER BY created_at, uid`, tenantID)
+}
+
+func (a *APIKeyRepo) Update(ctx context.Context, key *datastore.APIKey) error {
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return err
+	}
+
+	res, err := conn(ctx, a.db).ExecContext(ctx, `
+UPDATE api_keys SET name = $1, prefix = $2, hash = $3, scopes = $4, expires_at = $5, last_used_at = $6, revoked_at = $7, updated_at = $8
+WHERE tenant_id = $9 AND uid = $10`,
+		key.Name, key.Prefix, key.Hash, string(scopes), nullDateTime(key.ExpiresAt), nullDateTime(key.LastUsedAt),
+		nullDateTime(key.RevokedAt), key.UpdatedAt, key.TenantID, key.UID)
+	if a.dialect.IsUniqueViolation(err) {
+		return datastore.ErrDuplicateKey
+	}
+
+	return rowAffected(res, err, datastore.ErrAPIKeyNotFound)
+}
+
+func (a *APIKeyRepo) TouchLastUsed(ctx context.Context, uid string, at primitive.DateTime) error {
+	res, err := conn(ctx, a.db).ExecContext(ctx, `UPDATE api_keys SET last_used_at = $1 WHERE uid = $2`, at, uid)
+	return rowAffected(res, err, datastore.ErrAPIKeyNotFound)
+}
+
+func (a *APIKeyRepo) findOne(ctx context.Context, query string, args ...interface{}) (*datastore.APIKey, error) {
+	keys, err := a.find(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, datastore.ErrAPIKeyNotFound
+	}
+
+	return &keys[0], nil
+}
+
+func (a *APIKeyRepo) find(ctx context.Context, query string, args ...interface{}) ([]datastore.APIKey, error) {
+	keys := make([]datastore.APIKey, 0)
+
+	rows, err := conn(ctx, a.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key datastore.APIKey
+		var id, scopes string
+		var expiresAt, lastUsedAt, revokedAt sql.NullInt64
+
+		err := rows.Scan(&id, &key.UID, &key.TenantID, &key.Name, &key.Prefix, &key.Hash, &scopes,
+			&expiresAt, &lastUsedAt, &revokedAt, &key.CreatedAt, &key.UpdatedAt)
+		if err != nil {
+			return make([]datastore.APIKey, 0), err
+		}
+
+		key.ID, err = primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return make([]datastore.APIKey, 0), err
+		}
+
+		if err := json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+			return make([]datastore.APIKey, 0), err
+		}
+
+		key.ExpiresAt = primitive.DateTime(expiresAt.Int64)
+		key.LastUsedAt = primitive.DateTime(lastUsedAt.Int64)
+		key.RevokedAt = primitive.DateTime(revokedAt.Int64)
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return make([]datastore.APIKey, 0), err
+	}
+
+	return keys, nil
+}
+
+// rowAffected returns missing when the statement that
+// produced res didn't change any row.
+func rowAffected(res sql.Result, err error, missing error) error {
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return missing
+	}
+
+	return nil
+}
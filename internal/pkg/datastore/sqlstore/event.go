@@ -0,0 +1,200 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EventRepo struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func NewEventRepo(db *sql.DB, dialect Dialect) *EventRepo {
+	return &EventRepo{db: db, dialect: dialect}
+}
+
+func (e *EventRepo) Create(ctx context.Context, event *datastore.Event) error {
+	data, err := encodeEventData(event.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn(ctx, e.db).ExecContext(ctx, `
+INSERT INTO events (id, uid, tenant_id, event, key, value, type, generation, version, source_version, actor, created_at, updated_at, deleted_at, document_status)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		event.ID.Hex(), event.UID, event.TenantID, event.Type, data.key, data.value, data.valueType, data.generation, data.version,
+		data.sourceVersion, event.Actor, event.CreatedAt, event.UpdatedAt, nullDateTime(event.DeletedAt), event.DocumentStatus)
+	if e.dialect.IsUniqueViolation(err) {
+		return datastore.ErrDuplicateKey
+	}
+
+	return err
+}
+
+func (e *EventRepo) FindManyByKey(ctx context.Context, tenantID, key string, generation int64, pageable datastore.Pageable) ([]datastore.Event, datastore.PaginationData, error) {
+	events := make([]datastore.Event, 0)
+
+	if err := pageable.Validate(); err != nil {
+		return events, datastore.PaginationData{}, err
+	}
+
+	q := conn(ctx, e.db)
+
+	var total int64
+	err := q.QueryRowContext(ctx, `
+SELECT COUNT(*) FROM events
+WHERE tenant_id = $1 AND key = $2 AND document_status = $3 AND ($4 = 0 OR generation = $4)`,
+		tenantID, key, datastore.ActiveDocumentStatus, generation).Scan(&total)
+	if err != nil {
+		return events, datastore.PaginationData{}, err
+	}
+
+	order := "ASC"
+	if pageable.Sort < 0 {
+		order = "DESC"
+	}
+
+	rows, err := q.QueryContext(ctx, `
+SELECT id, uid, tenant_id, event, key, value, type, generation, version, source_version, actor, created_at, updated_at, deleted_at, document_status
+FROM events WHERE tenant_id = $1 AND key = $2 AND document_status = $3 AND ($4 = 0 OR generation = $4)
+ORDER BY created_at `+order+`, id `+order+`
+LIMIT $5 OFFSET $6`, tenantID, key, datastore.ActiveDocumentStatus, generation, pageable.PerPage, pageable.Offset())
+	if err != nil {
+		return events, datastore.PaginationData{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return make([]datastore.Event, 0), datastore.PaginationData{}, err
+		}
+
+		events = append(events, *event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return make([]datastore.Event, 0), datastore.PaginationData{}, err
+	}
+
+	return events, datastore.NewPaginationData(total, pageable), nil
+}
+
+func (e *EventRepo) FindExpired(ctx context.Context, tenantID string, before primitive.DateTime, keep int) ([]datastore.Event, error) {
+	rows, err := conn(ctx, e.db).QueryContext(ctx, `
+SELECT id, uid, tenant_id, event, key, value, type, generation, version, source_version, actor, created_at, updated_at, deleted_at, document_status
+FROM (
+	SELECT *, ROW_NUMBER() OVER (PARTITION BY tenant_id, key ORDER BY created_at DESC, id DESC) AS position
+	FROM events WHERE ($1 = '' OR tenant_id = $1) AND document_status = $2
+) ranked
+WHERE ($3 <> 0 AND created_at < $3) OR ($4 <> 0 AND position > $4)
+ORDER BY created_at, id`, tenantID, datastore.ActiveDocumentStatus, before, keep)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]datastore.Event, 0)
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, *event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (e *EventRepo) DeleteByKey(ctx context.Context, tenantID, key string, generation int64) (int64, error) {
+	res, err := conn(ctx, e.db).ExecContext(ctx, `
+DELETE FROM events WHERE tenant_id = $1 AND key = $2 AND ($3 = 0 OR generation = $3)`, tenantID, key, generation)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (e *EventRepo) Delete(ctx context.Context, events []datastore.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, len(events))
+	placeholders := make([]string, len(events))
+	for i := range events {
+		args[i] = events[i].ID.Hex()
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	_, err := conn(ctx, e.db).ExecContext(ctx, `DELETE FROM events WHERE id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	return err
+}
+
+func scanEvent(rows *sql.Rows) (*datastore.Event, error) {
+	event := &datastore.Event{Data: &datastore.EventData{}}
+
+	var id, value string
+	var deletedAt sql.NullInt64
+
+	err := rows.Scan(&id, &event.UID, &event.TenantID, &event.Type, &event.Data.Key, &value, &event.Data.Type,
+		&event.Data.Generation, &event.Data.Version, &event.Data.SourceVersion, &event.Actor, &event.CreatedAt, &event.UpdatedAt, &deletedAt, &event.DocumentStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	event.Data.Value, err = decodeValue(value, event.Data.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	event.ID, err = primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	event.DeletedAt = primitive.DateTime(deletedAt.Int64)
+	return event, nil
+}
+
+// eventColumns holds the columns event data is stored in.
+type eventColumns struct {
+	key           string
+	value         string
+	valueType     datastore.ValueType
+	generation    int64
+	version       int64
+	sourceVersion int64
+}
+
+func encodeEventData(data *datastore.EventData) (eventColumns, error) {
+	if data == nil {
+		return eventColumns{}, nil
+	}
+
+	value, valueType, err := encodeValue(data.Value, data.Type)
+	if err != nil {
+		return eventColumns{}, err
+	}
+
+	return eventColumns{
+		key:           data.Key,
+		value:         value,
+		valueType:     valueType,
+		generation:    data.Generation,
+		version:       data.Version,
+		sourceVersion: data.SourceVersion,
+	}, nil
+}
@@ -0,0 +1,69 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LegalHoldRepo struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func NewLegalHoldRepo(db *sql.DB, dialect Dialect) *LegalHoldRepo {
+	return &LegalHoldRepo{db: db, dialect: dialect}
+}
+
+func (l *LegalHoldRepo) Create(ctx context.Context, hold *datastore.LegalHold) error {
+	_, err := conn(ctx, l.db).ExecContext(ctx, `
+INSERT INTO legal_holds (id, tenant_id, key, reason, created_by, created_at)
+VALUES ($1, $2, $3, $4, $5, $6)`,
+		hold.ID.Hex(), hold.TenantID, hold.Key, hold.Reason, hold.CreatedBy, hold.CreatedAt)
+	if l.dialect.IsUniqueViolation(err) {
+		return datastore.ErrDuplicateKey
+	}
+
+	return err
+}
+
+func (l *LegalHoldRepo) FindMany(ctx context.Context, tenantID string) ([]datastore.LegalHold, error) {
+	rows, err := conn(ctx, l.db).QueryContext(ctx, `
+SELECT id, tenant_id, key, reason, created_by, created_at FROM legal_holds
+WHERE ($1 = '' OR tenant_id = $1)
+ORDER BY tenant_id, key`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := make([]datastore.LegalHold, 0)
+	for rows.Next() {
+		var hold datastore.LegalHold
+		var id string
+
+		if err := rows.Scan(&id, &hold.TenantID, &hold.Key, &hold.Reason, &hold.CreatedBy, &hold.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		hold.ID, err = primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, err
+		}
+
+		holds = append(holds, hold)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return holds, nil
+}
+
+func (l *LegalHoldRepo) Delete(ctx context.Context, tenantID, key string) error {
+	res, err := conn(ctx, l.db).ExecContext(ctx, `DELETE FROM legal_holds WHERE tenant_id = $1 AND key = $2`, tenantID, key)
+	return rowAffected(res, err, datastore.ErrLegalHoldNotFound)
+}
@@ -0,0 +1,423 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type migration struct {
+	version int
+	name    string
+	up      string
+}
+
+// migrations are applied in order at startup. Once released a
+// migration must never change, schema changes go in a new entry.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create_answers_and_events",
+		up: `
+CREATE TABLE answers (
+	id              TEXT PRIMARY KEY,
+	uid             TEXT NOT NULL,
+	key             TEXT NOT NULL,
+	created_at      BIGINT NOT NULL,
+	updated_at      BIGINT NOT NULL,
+	deleted_at      BIGINT,
+	document_status TEXT NOT NULL,
+	UNIQUE (key, document_status)
+);
+
+CREATE TABLE answer_versions (
+	answer_id TEXT NOT NULL REFERENCES answers (id) ON DELETE CASCADE,
+	version   INTEGER NOT NULL,
+	value     TEXT NOT NULL,
+	PRIMARY KEY (answer_id, version)
+);
+
+CREATE TABLE events (
+	id              TEXT PRIMARY KEY,
+	uid             TEXT NOT NULL,
+	event           TEXT NOT NULL,
+	key             TEXT NOT NULL,
+	value           TEXT NOT NULL,
+	created_at      BIGINT NOT NULL,
+	updated_at      BIGINT NOT NULL,
+	deleted_at      BIGINT,
+	document_status TEXT NOT NULL
+);
+
+CREATE INDEX events_key_created_at ON events (key, created_at);
+`,
+	},
+	{
+		version: 2,
+		name:    "create_outbox",
+		up: `
+CREATE TABLE outbox (
+	id               TEXT PRIMARY KEY,
+	uid              TEXT NOT NULL,
+	event            TEXT NOT NULL,
+	key              TEXT NOT NULL,
+	value            TEXT NOT NULL,
+	event_created_at BIGINT NOT NULL,
+	status           TEXT NOT NULL,
+	attempts         INTEGER NOT NULL,
+	last_error       TEXT NOT NULL,
+	next_attempt_at  BIGINT NOT NULL,
+	created_at       BIGINT NOT NULL
+);
+
+CREATE INDEX outbox_status_next_attempt_at ON outbox (status, next_attempt_at);
+CREATE INDEX outbox_key ON outbox (key);
+`,
+	},
+	{
+		version: 3,
+		name:    "add_value_types",
+		up: `
+ALTER TABLE answer_versions ADD COLUMN type TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN type TEXT NOT NULL DEFAULT '';
+ALTER TABLE outbox ADD COLUMN type TEXT NOT NULL DEFAULT '';
+`,
+	},
+	{
+		version: 4,
+		name:    "create_schemas",
+		up: `
+CREATE TABLE schemas (
+	id         TEXT PRIMARY KEY,
+	uid        TEXT NOT NULL UNIQUE,
+	namespace  TEXT NOT NULL,
+	version    INTEGER NOT NULL,
+	definition TEXT NOT NULL,
+	status     TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL,
+	UNIQUE (namespace, version)
+);
+
+CREATE INDEX schemas_status ON schemas (status);
+`,
+	},
+	{
+		version: 5,
+		name:    "scope_to_tenants",
+		up: `
+CREATE TABLE answers_v5 (
+	id              TEXT PRIMARY KEY,
+	uid             TEXT NOT NULL,
+	tenant_id       TEXT NOT NULL,
+	key             TEXT NOT NULL,
+	created_at      BIGINT NOT NULL,
+	updated_at      BIGINT NOT NULL,
+	deleted_at      BIGINT,
+	document_status TEXT NOT NULL,
+	UNIQUE (tenant_id, key, document_status)
+);
+
+CREATE TABLE answer_versions_v5 (
+	answer_id TEXT NOT NULL REFERENCES answers_v5 (id) ON DELETE CASCADE,
+	version   INTEGER NOT NULL,
+	value     TEXT NOT NULL,
+	type      TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (answer_id, version)
+);
+
+INSERT INTO answers_v5 (id, uid, tenant_id, key, created_at, updated_at, deleted_at, document_status)
+SELECT id, uid, 'default', key, created_at, updated_at, deleted_at, document_status FROM answers;
+
+INSERT INTO answer_versions_v5 (answer_id, version, value, type)
+SELECT answer_id, version, value, type FROM answer_versions;
+
+DROP TABLE answer_versions;
+DROP TABLE answers;
+ALTER TABLE answers_v5 RENAME TO answers;
+ALTER TABLE answer_versions_v5 RENAME TO answer_versions;
+
+ALTER TABLE events ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+DROP INDEX events_key_created_at;
+CREATE INDEX events_tenant_key_created_at ON events (tenant_id, key, created_at);
+
+ALTER TABLE outbox ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+DROP INDEX outbox_key;
+CREATE INDEX outbox_tenant_key ON outbox (tenant_id, key);
+
+CREATE TABLE schemas_v5 (
+	id         TEXT PRIMARY KEY,
+	uid        TEXT NOT NULL UNIQUE,
+	tenant_id  TEXT NOT NULL,
+	namespace  TEXT NOT NULL,
+	version    INTEGER NOT NULL,
+	definition TEXT NOT NULL,
+	status     TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL,
+	UNIQUE (tenant_id, namespace, version)
+);
+
+INSERT INTO schemas_v5 (id, uid, tenant_id, namespace, version, definition, status, created_at, updated_at)
+SELECT id, uid, 'default', namespace, version, definition, status, created_at, updated_at FROM schemas;
+
+DROP TABLE schemas;
+ALTER TABLE schemas_v5 RENAME TO schemas;
+CREATE INDEX schemas_tenant_status ON schemas (tenant_id, status);
+`,
+	},
+	{
+		version: 6,
+		name:    "record_event_actor",
+		up: `
+ALTER TABLE events ADD COLUMN actor TEXT NOT NULL DEFAULT '';
+ALTER TABLE outbox ADD COLUMN actor TEXT NOT NULL DEFAULT '';
+`,
+	},
+	{
+		version: 7,
+		name:    "create_api_keys",
+		up: `
+CREATE TABLE api_keys (
+	id           TEXT PRIMARY KEY,
+	uid          TEXT NOT NULL UNIQUE,
+	tenant_id    TEXT NOT NULL,
+	name         TEXT NOT NULL,
+	prefix       TEXT NOT NULL UNIQUE,
+	hash         TEXT NOT NULL,
+	scopes       TEXT NOT NULL,
+	expires_at   BIGINT,
+	last_used_at BIGINT,
+	revoked_at   BIGINT,
+	created_at   BIGINT NOT NULL,
+	updated_at   BIGINT NOT NULL
+);
+
+CREATE INDEX api_keys_tenant_created_at ON api_keys (tenant_id, created_at);
+`,
+	},
+	{
+		version: 8,
+		name:    "create_role_bindings",
+		up: `
+CREATE TABLE role_bindings (
+	id         TEXT PRIMARY KEY,
+	uid        TEXT NOT NULL,
+	tenant_id  TEXT NOT NULL,
+	subject    TEXT NOT NULL,
+	role       TEXT NOT NULL,
+	pattern    TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL,
+	UNIQUE (tenant_id, subject, pattern)
+);
+
+CREATE INDEX role_bindings_tenant_uid ON role_bindings (tenant_id, uid);
+`,
+	},
+	{
+		version: 9,
+		name:    "record_answer_version",
+		up: `
+ALTER TABLE answers ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
+
+UPDATE answers SET version = (SELECT COUNT(*) FROM answer_versions WHERE answer_versions.answer_id = answers.id);
+`,
+	},
+	{
+		version: 10,
+		name:    "record_value_created_at",
+		up: `
+ALTER TABLE answer_versions ADD COLUMN created_at BIGINT;
+`,
+	},
+	{
+		version: 11,
+		name:    "record_value_author",
+		up: `
+ALTER TABLE answer_versions ADD COLUMN author TEXT NOT NULL DEFAULT '';
+`,
+	},
+	{
+		version: 12,
+		name:    "record_event_versions",
+		up: `
+ALTER TABLE events ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE events ADD COLUMN source_version BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE outbox ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE outbox ADD COLUMN source_version BIGINT NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		version: 13,
+		name:    "record_answer_generations",
+		up: `
+CREATE TABLE answers_v13 (
+	id              TEXT PRIMARY KEY,
+	uid             TEXT NOT NULL,
+	tenant_id       TEXT NOT NULL,
+	key             TEXT NOT NULL,
+	version         BIGINT NOT NULL DEFAULT 0,
+	generation      BIGINT NOT NULL DEFAULT 0,
+	created_at      BIGINT NOT NULL,
+	updated_at      BIGINT NOT NULL,
+	deleted_at      BIGINT,
+	document_status TEXT NOT NULL
+);
+
+CREATE TABLE answer_versions_v13 (
+	answer_id  TEXT NOT NULL REFERENCES answers_v13 (id) ON DELETE CASCADE,
+	version    INTEGER NOT NULL,
+	value      TEXT NOT NULL,
+	type       TEXT NOT NULL DEFAULT '',
+	created_at BIGINT,
+	author     TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (answer_id, version)
+);
+
+-- generations follow the order answers were created in,
+-- the active answer of a key being its latest
+INSERT INTO answers_v13 (id, uid, tenant_id, key, version, generation, created_at, updated_at, deleted_at, document_status)
+SELECT id, uid, tenant_id, key, version, (
+	SELECT COUNT(*) FROM answers earlier
+	WHERE earlier.tenant_id = answers.tenant_id AND earlier.key = answers.key AND (
+		answers.document_status = 'Active' OR (earlier.document_status <> 'Active' AND (
+			earlier.created_at < answers.created_at OR (earlier.created_at = answers.created_at AND earlier.id <= answers.id))))
+), created_at, updated_at, deleted_at, document_status FROM answers;
+
+INSERT INTO answer_versions_v13 (answer_id, version, value, type, created_at, author)
+SELECT answer_id, version, value, type, created_at, author FROM answer_versions;
+
+DROP TABLE answer_versions;
+DROP TABLE answers;
+ALTER TABLE answers_v13 RENAME TO answers;
+ALTER TABLE answer_versions_v13 RENAME TO answer_versions;
+
+CREATE UNIQUE INDEX answers_tenant_key_active ON answers (tenant_id, key) WHERE document_status = 'Active';
+CREATE INDEX answers_tenant_key_status ON answers (tenant_id, key, document_status);
+
+-- each create event starts a generation
+ALTER TABLE events ADD COLUMN generation BIGINT NOT NULL DEFAULT 0;
+
+UPDATE events SET generation = (
+	SELECT COUNT(*) FROM events earlier
+	WHERE earlier.tenant_id = events.tenant_id AND earlier.key = events.key AND earlier.event = 'create' AND (
+		earlier.created_at < events.created_at OR (earlier.created_at = events.created_at AND earlier.id <= events.id))
+);
+
+UPDATE events SET generation = 1 WHERE generation = 0;
+
+-- pending messages belong to the latest generation of their key
+ALTER TABLE outbox ADD COLUMN generation BIGINT NOT NULL DEFAULT 0;
+
+UPDATE outbox SET generation = COALESCE((
+	SELECT MAX(generation) FROM answers WHERE answers.tenant_id = outbox.tenant_id AND answers.key = outbox.key
+), 0);
+`,
+	},
+	{
+		version: 14,
+		name:    "create_legal_holds",
+		up: `
+CREATE TABLE legal_holds (
+	id         TEXT PRIMARY KEY,
+	tenant_id  TEXT NOT NULL,
+	key        TEXT NOT NULL,
+	reason     TEXT NOT NULL,
+	created_by TEXT NOT NULL DEFAULT '',
+	created_at BIGINT NOT NULL,
+	UNIQUE (tenant_id, key)
+);
+
+CREATE INDEX answers_status_deleted_at ON answers (document_status, deleted_at);
+CREATE INDEX events_created_at ON events (created_at);
+`,
+	},
+	{
+		version: 15,
+		name:    "record_answer_expiry",
+		up: `
+ALTER TABLE answers ADD COLUMN expires_at BIGINT;
+
+CREATE INDEX answers_expires_at ON answers (expires_at) WHERE expires_at IS NOT NULL;
+`,
+	},
+	{
+		version: 16,
+		name:    "index_answer_listing",
+		up: `
+CREATE INDEX answers_tenant_status_created_at ON answers (tenant_id, document_status, created_at, key, generation);
+CREATE INDEX answers_tenant_status_updated_at ON answers (tenant_id, document_status, updated_at, key, generation);
+`,
+	},
+	{
+		version: 17,
+		name:    "record_purged_generations",
+		up: `
+CREATE TABLE purged_generations (
+	tenant_id  TEXT NOT NULL,
+	key        TEXT NOT NULL,
+	generation BIGINT NOT NULL,
+	PRIMARY KEY (tenant_id, key)
+);
+`,
+	},
+}
+
+// Migrate brings the schema up to date, recording every applied
+// migration in the schema_migrations table.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at BIGINT NOT NULL
+)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		if err := applyMigration(ctx, db, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+
+		logrus.Infof("applied migration %d (%s)", m.version, m.name)
+	}
+
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.up); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+		m.version, m.name, time.Now().UnixMilli())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,121 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OutboxRepo struct {
+	db *sql.DB
+}
+
+func NewOutboxRepo(db *sql.DB) *OutboxRepo {
+	return &OutboxRepo{db: db}
+}
+
+const outboxColumns = `id, uid, tenant_id, event, key, value, type, generation, version, source_version, actor, event_created_at, status, attempts, last_error, next_attempt_at, created_at`
+
+func (o *OutboxRepo) FindDue(ctx context.Context, now primitive.DateTime, limit int) ([]datastore.OutboxMessage, error) {
+	return o.find(ctx, `
+SELECT `+outboxColumns+` FROM outbox
+WHERE status = $1 AND next_attempt_at <= $2
+ORDER BY created_at, id
+LIMIT $3`, datastore.PendingOutboxStatus, now, limit)
+}
+
+func (o *OutboxRepo) FindPendingByKey(ctx context.Context, tenantID, key string) ([]datastore.OutboxMessage, error) {
+	return o.find(ctx, `
+SELECT `+outboxColumns+` FROM outbox
+WHERE status = $1 AND tenant_id = $2 AND key = $3
+ORDER BY created_at, id`, datastore.PendingOutboxStatus, tenantID, key)
+}
+
+func (o *OutboxRepo) Update(ctx context.Context, message *datastore.OutboxMessage) error {
+	_, err := conn(ctx, o.db).ExecContext(ctx, `
+UPDATE outbox SET status = $1, attempts = $2, last_error = $3, next_attempt_at = $4
+WHERE id = $5`,
+		message.Status, message.Attempts, message.LastError, message.NextAttemptAt, message.Event.ID.Hex())
+	return err
+}
+
+func (o *OutboxRepo) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := conn(ctx, o.db).ExecContext(ctx, `DELETE FROM outbox WHERE id = $1`, id.Hex())
+	return err
+}
+
+func (o *OutboxRepo) find(ctx context.Context, query string, args ...interface{}) ([]datastore.OutboxMessage, error) {
+	messages := make([]datastore.OutboxMessage, 0)
+
+	rows, err := conn(ctx, o.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return messages, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		message, err := scanOutboxMessage(rows)
+		if err != nil {
+			return make([]datastore.OutboxMessage, 0), err
+		}
+
+		messages = append(messages, *message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return make([]datastore.OutboxMessage, 0), err
+	}
+
+	return messages, nil
+}
+
+func scanOutboxMessage(rows *sql.Rows) (*datastore.OutboxMessage, error) {
+	event := &datastore.Event{Data: &datastore.EventData{}}
+	message := &datastore.OutboxMessage{Event: event}
+
+	var id, value string
+	err := rows.Scan(&id, &event.UID, &event.TenantID, &event.Type, &event.Data.Key, &value, &event.Data.Type, &event.Data.Generation,
+		&event.Data.Version, &event.Data.SourceVersion, &event.Actor, &event.CreatedAt, &message.Status, &message.Attempts, &message.LastError, &message.NextAttemptAt, &message.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	event.Data.Value, err = decodeValue(value, event.Data.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	event.ID, err = primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// outbox events are always fresh, active events
+	event.UpdatedAt = event.CreatedAt
+	event.DocumentStatus = datastore.ActiveDocumentStatus
+
+	return message, nil
+}
+
+func insertOutbox(ctx context.Context, q querier, messages []datastore.OutboxMessage) error {
+	for _, message := range messages {
+		data, err := encodeEventData(message.Event.Data)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.ExecContext(ctx, `
+INSERT INTO outbox (`+outboxColumns+`)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`,
+			message.Event.ID.Hex(), message.Event.UID, message.Event.TenantID, message.Event.Type, data.key, data.value, data.valueType,
+			data.generation, data.version, data.sourceVersion, message.Event.Actor, message.Event.CreatedAt,
+			message.Status, message.Attempts, message.LastError, message.NextAttemptAt, message.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RoleBindingRepo struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func NewRoleBindingRepo(db *sql.DB, dialect Dialect) *RoleBindingRepo {
+	return &RoleBindingRepo{db: db, dialect: dialect}
+}
+
+const roleBindingColumns = `id, uid, tenant_id, subject, role, pattern, created_at, updated_at`
+
+func (r *RoleBindingRepo) Create(ctx context.Context, binding *datastore.RoleBinding) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `
+INSERT INTO role_bindings (`+roleBindingColumns+`)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		binding.ID.Hex(), binding.UID, binding.TenantID, binding.Subject, binding.Role, binding.Pattern,
+		binding.CreatedAt, binding.UpdatedAt)
+	if r.dialect.IsUniqueViolation(err) {
+		return datastore.ErrDuplicateKey
+	}
+
+	return err
+}
+
+func (r *RoleBindingRepo) FindByUID(ctx context.Context, tenantID, uid string) (*datastore.RoleBinding, error) {
+	bindings, err := r.find(ctx, `SELECT `+roleBindingColumns+` FROM role_bindings WHERE tenant_id = $1 AND uid = $2`, tenantID, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bindings) == 0 {
+		return nil, datastore.ErrRoleBindingNotFound
+	}
+
+	return &bindings[0], nil
+}
+
+func (r *RoleBindingRepo) FindMany(ctx context.Context, tenantID string, subjects []string) ([]datastore.RoleBinding, error) {
+	args := []interface{}{tenantID}
+
+	var bySubject string
+	if len(subjects) > 0 {
+		placeholders := make([]string, len(subjects))
+		for i, subject := range subjects {
+			args = append(args, subject)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		bySubject = ` AND subject IN (` + strings.Join(placeholders, ", ") + `)`
+	}
+
+	return r.find(ctx, `SELECT `+roleBindingColumns+` FROM role_bindings WHERE tenant_id = $1`+bySubject+` ORDER BY created_at, uid`, args...)
+}
+
+func (r *RoleBindingRepo) Delete(ctx context.Context, tenantID, uid string) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM role_bindings WHERE tenant_id = $1 AND uid = $2`, tenantID, uid)
+	return rowAffected(res, err, datastore.ErrRoleBindingNotFound)
+}
+
+func (r *RoleBindingRepo) find(ctx context.Context, query string, args ...interface{}) ([]datastore.RoleBinding, error) {
+	bindings := make([]datastore.RoleBinding, 0)
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return bindings, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var binding datastore.RoleBinding
+		var id string
+
+		err := rows.Scan(&id, &binding.UID, &binding.TenantID, &binding.Subject, &binding.Role, &binding.Pattern,
+			&binding.CreatedAt, &binding.UpdatedAt)
+		if err != nil {
+			return make([]datastore.RoleBinding, 0), err
+		}
+
+		binding.ID, err = primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return make([]datastore.RoleBinding, 0), err
+		}
+
+		bindings = append(bindings, binding)
+	}
+
+	if err := rows.Err(); err != nil {
+		return make([]datastore.RoleBinding, 0), err
+	}
+
+	return bindings, nil
+}
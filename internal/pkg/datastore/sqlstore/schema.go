@@ -0,0 +1,119 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SchemaRepo struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func NewSchemaRepo(db *sql.DB, dialect Dialect) *SchemaRepo {
+	return &SchemaRepo{db: db, dialect: dialect}
+}
+
+const schemaColumns = `id, uid, tenant_id, namespace, version, definition, status, created_at, updated_at`
+
+func (s *SchemaRepo) Create(ctx context.Context, schema *datastore.Schema) error {
+	_, err := conn(ctx, s.db).ExecContext(ctx, `
+INSERT INTO schemas (`+schemaColumns+`)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		schema.ID.Hex(), schema.UID, schema.TenantID, schema.Namespace, schema.Version, string(schema.Definition), schema.Status,
+		schema.CreatedAt, schema.UpdatedAt)
+	if s.dialect.IsUniqueViolation(err) {
+		return datastore.ErrDuplicateKey
+	}
+
+	return err
+}
+
+func (s *SchemaRepo) FindByUID(ctx context.Context, tenantID, uid string) (*datastore.Schema, error) {
+	schemas, err := s.find(ctx, `SELECT `+schemaColumns+` FROM schemas WHERE tenant_id = $1 AND uid = $2`, tenantID, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(schemas) == 0 {
+		return nil, datastore.ErrSchemaNotFound
+	}
+
+	return &schemas[0], nil
+}
+
+func (s *SchemaRepo) FindMany(ctx context.Context, tenantID, namespace string) ([]datastore.Schema, error) {
+	if namespace == "" {
+		return s.find(ctx, `SELECT `+schemaColumns+` FROM schemas WHERE tenant_id = $1 ORDER BY namespace, version`, tenantID)
+	}
+
+	return s.find(ctx, `SELECT `+schemaColumns+` FROM schemas WHERE tenant_id = $1 AND namespace = $2 ORDER BY version`,
+		tenantID, namespace)
+}
+
+func (s *SchemaRepo) FindActive(ctx context.Context, tenantID string) ([]datastore.Schema, error) {
+	return s.find(ctx, `SELECT `+schemaColumns+` FROM schemas WHERE tenant_id = $1 AND status = $2 ORDER BY namespace, version`,
+		tenantID, datastore.ActiveSchemaStatus)
+}
+
+func (s *SchemaRepo) UpdateStatus(ctx context.Context, tenantID, uid string, status datastore.SchemaStatus) error {
+	res, err := conn(ctx, s.db).ExecContext(ctx, `UPDATE schemas SET status = $1, updated_at = $2 WHERE tenant_id = $3 AND uid = $4`,
+		status, primitive.NewDateTimeFromTime(time.Now()), tenantID, uid)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return datastore.ErrSchemaNotFound
+	}
+
+	return nil
+}
+
+func (s *SchemaRepo) find(ctx context.Context, query string, args ...interface{}) ([]datastore.Schema, error) {
+	schemas := make([]datastore.Schema, 0)
+
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return schemas, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema datastore.Schema
+		var id, definition string
+
+		err := rows.Scan(&id, &schema.UID, &schema.TenantID, &schema.Namespace, &schema.Version, &definition, &schema.Status,
+			&schema.CreatedAt, &schema.UpdatedAt)
+		if err != nil {
+			return make([]datastore.Schema, 0), err
+		}
+
+		schema.ID, err = primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return make([]datastore.Schema, 0), err
+		}
+
+		schema.Definition = []byte(definition)
+		schemas = append(schemas, schema)
+	}
+
+	if err := rows.Err(); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return schemas, nil
+		}
+		return make([]datastore.Schema, 0), err
+	}
+
+	return schemas, nil
+}
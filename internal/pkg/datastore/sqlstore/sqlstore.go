@@ -0,0 +1,128 @@
+// Package sqlstore implements the repositories on top of database/sql.
+// The queries are shared by the sqlite and postgres backends, which only
+// provide a Dialect for the few things that differ between them.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+)
+
+// Dialect captures the behaviour that differs between SQL databases.
+type Dialect interface {
+	// IsUniqueViolation reports whether err was caused by
+	// a unique or primary key constraint.
+	IsUniqueViolation(err error) bool
+}
+
+type Client struct {
+	DB         *sql.DB
+	AnswerRepo datastore.AnswerRepository
+	EventRepo  datastore.EventRepository
+	OutboxRepo datastore.OutboxRepository
+	SchemaRepo datastore.SchemaRepository
+	APIKeyRepo datastore.APIKeyRepository
+	RoleRepo   datastore.RoleBindingRepository
+	HoldRepo   datastore.LegalHoldRepository
+}
+
+// New migrates db to the latest schema and returns a client backed by it.
+func New(db *sql.DB, dialect Dialect) (*Client, error) {
+	if err := Migrate(context.Background(), db); err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		DB:         db,
+		AnswerRepo: NewAnswerRepo(db, dialect),
+		EventRepo:  NewEventRepo(db, dialect),
+		OutboxRepo: NewOutboxRepo(db),
+		SchemaRepo: NewSchemaRepo(db, dialect),
+		APIKeyRepo: NewAPIKeyRepo(db, dialect),
+		RoleRepo:   NewRoleBindingRepo(db, dialect),
+		HoldRepo:   NewLegalHoldRepo(db, dialect),
+	}
+
+	return c, nil
+}
+
+func (c *Client) Answers() datastore.AnswerRepository {
+	return c.AnswerRepo
+}
+
+func (c *Client) Events() datastore.EventRepository {
+	return c.EventRepo
+}
+
+func (c *Client) Outbox() datastore.OutboxRepository {
+	return c.OutboxRepo
+}
+
+func (c *Client) Schemas() datastore.SchemaRepository {
+	return c.SchemaRepo
+}
+
+func (c *Client) APIKeys() datastore.APIKeyRepository {
+	return c.APIKeyRepo
+}
+
+func (c *Client) RoleBindings() datastore.RoleBindingRepository {
+	return c.RoleRepo
+}
+
+func (c *Client) LegalHolds() datastore.LegalHoldRepository {
+	return c.HoldRepo
+}
+
+func (c *Client) Close(ctx context.Context) error {
+	return c.DB.Close()
+}
+
+// WithTransaction runs fn in a single database transaction. Repository
+// calls made with the context handed to fn take part in it, and nested
+// calls reuse the outer transaction.
+func (c *Client) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return runInTx(ctx, c.DB, func(tx *sql.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+type txKey struct{}
+
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// conn returns the transaction carried by ctx, if any, so
+// that single statements join an ongoing transaction.
+func conn(ctx context.Context, db *sql.DB) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+
+	return db
+}
+
+// runInTx runs fn in the transaction carried by ctx,
+// or in a new one that is committed when fn succeeds.
+func runInTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(tx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
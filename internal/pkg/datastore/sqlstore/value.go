@@ -0,0 +1,35 @@
+package sqlstore
+
+import (
+	"encoding/json"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+)
+
+// encodeValue returns the text and type stored for a value. Strings
+// are stored as is, so that rows written before types were recorded
+// read back unchanged, every other type is stored as JSON.
+func encodeValue(v interface{}, t datastore.ValueType) (string, datastore.ValueType, error) {
+	if s, ok := v.(string); ok {
+		return s, t, nil
+	}
+
+	if t == "" {
+		t = datastore.InferValueType(v)
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(raw), t, nil
+}
+
+func decodeValue(text string, t datastore.ValueType) (interface{}, error) {
+	if t == "" || t == datastore.StringValue {
+		return text, nil
+	}
+
+	return datastore.ParseValue([]byte(text))
+}
@@ -0,0 +1,1424 @@
+// Package storetest holds the behavioral tests every datastore.Store
+// implementation must pass, so that all backends expose the same
+// observable semantics as the mongo backend.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Run executes the suite. newStore must return an empty store
+// every time it is called.
+func Run(t *testing.T, newStore func(t *testing.T) datastore.Store) {
+	tt := []struct {
+		name string
+		fn   func(t *testing.T, db datastore.Store)
+	}{
+		{name: "answer_lifecycle", fn: testAnswerLifecycle},
+		{name: "typed_values", fn: testTypedValues},
+		{name: "value_metadata", fn: testValueMetadata},
+		{name: "answers_by_prefix", fn: testAnswersByPrefix},
+		{name: "restore_answers", fn: testRestoreAnswers},
+		{name: "answer_generations", fn: testAnswerGenerations},
+		{name: "purge_answers", fn: testPurgeAnswers},
+		{name: "expiring_answers", fn: testExpiringAnswers},
+		{name: "list_answers", fn: testListAnswers},
+		{name: "search_answers", fn: testSearchAnswers},
+		{name: "concurrent_answer_updates", fn: testConcurrentAnswerUpdates},
+		{name: "conditional_answer_writes", fn: testConditionalAnswerWrites},
+		{name: "paginated_events", fn: testPaginatedEvents},
+		{name: "duplicate_events", fn: testDuplicateEvents},
+		{name: "rollback_events", fn: testRollbackEvents},
+		{name: "expired_events", fn: testExpiredEvents},
+		{name: "outbox", fn: testOutbox},
+		{name: "schemas", fn: testSchemas},
+		{name: "tenants", fn: testTenants},
+		{name: "api_keys", fn: testAPIKeys},
+		{name: "role_bindings", fn: testRoleBindings},
+		{name: "legal_holds", fn: testLegalHolds},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newStore(t))
+		})
+	}
+
+	t.Run("transactions", func(t *testing.T) {
+		db := newStore(t)
+		if _, ok := db.(datastore.Transactor); !ok {
+			t.Skip("store does not support transactions")
+		}
+
+		testTransactions(t, db)
+	})
+}
+
+func NewAnswer(key, value string) *datastore.Answer {
+	return &datastore.Answer{
+		ID:             primitive.NewObjectID(),
+		UID:            key,
+		TenantID:       datastore.DefaultTenant,
+		Key:            key,
+		Values:         []datastore.Value{{Value: value}},
+		Version:        1,
+		CreatedAt:      primitive.NewDateTimeFromTime(time.Now()),
+		UpdatedAt:      primitive.NewDateTimeFromTime(time.Now()),
+		DocumentStatus: datastore.ActiveDocumentStatus,
+	}
+}
+
+func NewSchema(namespace string, version int, definition string) *datastore.Schema {
+	return &datastore.Schema{
+		ID:         primitive.NewObjectID(),
+		UID:        fmt.Sprintf("%s-%d", namespace, version),
+		TenantID:   datastore.DefaultTenant,
+		Namespace:  namespace,
+		Version:    version,
+		Definition: []byte(definition),
+		Status:     datastore.DraftSchemaStatus,
+		CreatedAt:  primitive.NewDateTimeFromTime(time.Now()),
+		UpdatedAt:  primitive.NewDateTimeFromTime(time.Now()),
+	}
+}
+
+// NewAPIKey returns a key of the default tenant created at createdAt.
+func NewAPIKey(name, prefix string, createdAt time.Time) *datastore.APIKey {
+	at := primitive.NewDateTimeFromTime(createdAt)
+
+	return &datastore.APIKey{
+		ID:        primitive.NewObjectID(),
+		UID:       name,
+		TenantID:  datastore.DefaultTenant,
+		Name:      name,
+		Prefix:    prefix,
+		Hash:      prefix + "-hash",
+		Scopes:    []string{"answers:read"},
+		CreatedAt: at,
+		UpdatedAt: at,
+	}
+}
+
+// NewRoleBinding returns a binding of the default tenant created at createdAt.
+func NewRoleBinding(uid, subject string, role datastore.Role, pattern string, createdAt time.Time) *datastore.RoleBinding {
+	at := primitive.NewDateTimeFromTime(createdAt)
+
+	return &datastore.RoleBinding{
+		ID:        primitive.NewObjectID(),
+		UID:       uid,
+		TenantID:  datastore.DefaultTenant,
+		Subject:   subject,
+		Role:      role,
+		Pattern:   pattern,
+		CreatedAt: at,
+		UpdatedAt: at,
+	}
+}
+
+// NewOutboxMessage returns a pending message for an event created at createdAt.
+func NewOutboxMessage(eventType datastore.EventType, key, value string, createdAt time.Time) datastore.OutboxMessage {
+	at := primitive.NewDateTimeFromTime(createdAt)
+
+	return datastore.OutboxMessage{
+		Event: &datastore.Event{
+			ID:             primitive.NewObjectID(),
+			UID:            fmt.Sprintf("%s-%s", key, eventType),
+			TenantID:       datastore.DefaultTenant,
+			Type:           eventType,
+			Data:           &datastore.EventData{Key: key, Value: value},
+			CreatedAt:      at,
+			UpdatedAt:      at,
+			DocumentStatus: datastore.ActiveDocumentStatus,
+		},
+		Status:        datastore.PendingOutboxStatus,
+		NextAttemptAt: at,
+		CreatedAt:     at,
+	}
+}
+
+func testAnswerLifecycle(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Answers()
+
+	require.Nil(t, repo.Create(ctx, NewAnswer("some-key", "some-value")))
+	require.ErrorIs(t, repo.Create(ctx, NewAnswer("some-key", "other-value")), datastore.ErrDuplicateKey)
+
+	answer, err := repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Equal(t, "some-value", answer.Values[0].Value)
+
+	// mutating the returned answer must not leak into the store
+	answer.Values[0].Value = "mutated"
+
+	answer, err = repo.Update(ctx, answer, &datastore.Value{Value: "new-value"}, 0)
+	require.Nil(t, err)
+	require.Equal(t, []datastore.Value{{Value: "some-value", Version: 1}, {Value: "new-value", Version: 2}}, answer.Values)
+
+	require.Nil(t, repo.Delete(ctx, answer, 0))
+
+	_, err = repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.ErrorIs(t, err, datastore.ErrAnswerNotFound)
+
+	_, err = repo.Update(ctx, answer, &datastore.Value{Value: "newer-value"}, 0)
+	require.ErrorIs(t, err, datastore.ErrAnswerNotFound)
+
+	// the key is free again once the previous answer is soft deleted
+	require.Nil(t, repo.Create(ctx, NewAnswer("some-key", "recreated")))
+
+	answer, err = repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Equal(t, []datastore.Value{{Value: "recreated", Version: 1}}, answer.Values)
+}
+
+func testTypedValues(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Answers()
+
+	values := []datastore.Value{
+		{Value: "legacy-value"},
+		{Value: "some-value", Type: datastore.StringValue},
+		{Value: int64(9007199254740993), Type: datastore.NumberValue},
+		{Value: 12.5, Type: datastore.NumberValue},
+		{Value: true, Type: datastore.BooleanValue},
+		{Value: map[string]interface{}{"limit": int64(10), "nested": map[string]interface{}{"on": false}}, Type: datastore.ObjectValue},
+		{Value: []interface{}{"a", int64(1), []interface{}{}}, Type: datastore.ListValue},
+	}
+
+	answer := NewAnswer("some-key", "")
+	answer.Values = values[:1]
+	require.Nil(t, repo.Create(ctx, answer))
+
+	for i := range values[1:] {
+		_, err := repo.Update(ctx, answer, &values[i+1], 0)
+		require.Nil(t, err)
+	}
+
+	// values are numbered in the order they were written
+	for i := range values {
+		values[i].Version = int64(i + 1)
+	}
+
+	answer, err := repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Equal(t, values, answer.Values)
+	require.Equal(t, datastore.StringValue, answer.Values[0].ValueType())
+
+	event := NewOutboxMessage(datastore.UpdateEvent, "some-key", "", time.Now()).Event
+	event.Data.Value, event.Data.Type = values[5].Value, values[5].Type
+	require.Nil(t, db.Events().Create(ctx, event))
+
+	events, _, err := db.Events().FindManyByKey(ctx, datastore.DefaultTenant, "some-key", 0, datastore.Pageable{Page: 1, PerPage: 10})
+	require.Nil(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, event.Data, events[0].Data)
+}
+
+func testValueMetadata(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Answers()
+
+	createdAt := primitive.NewDateTimeFromTime(time.Now().Add(-time.Hour))
+	updatedAt := primitive.NewDateTimeFromTime(time.Now())
+
+	answer := NewAnswer("some-key", "some-value")
+	answer.Values[0].Author = "some-user"
+	answer.Values[0].CreatedAt = createdAt
+	require.Nil(t, repo.Create(ctx, answer))
+
+	answer, err := repo.Update(ctx, answer, &datastore.Value{Value: "new-value", Author: "other-user", CreatedAt: updatedAt}, 1)
+	require.Nil(t, err)
+
+	// values written before their author and time were recorded
+	// have neither, they are still numbered
+	answer, err = repo.Update(ctx, answer, &datastore.Value{Value: "legacy-value"}, 0)
+	require.Nil(t, err)
+
+	found, err := repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Equal(t, []datastore.Value{
+		{Value: "some-value", Version: 1, Author: "some-user", CreatedAt: createdAt},
+		{Value: "new-value", Version: 2, Author: "other-user", CreatedAt: updatedAt},
+		{Value: "legacy-value", Version: 3},
+	}, found.Values)
+	require.Equal(t, answer.Values, found.Values)
+}
+
+func testAnswersByPrefix(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Answers()
+
+	for _, key := range []string{"billing/b", "billing/a", "billing%", "shipping/a", "billing/deleted"} {
+		require.Nil(t, repo.Create(ctx, NewAnswer(key, key)))
+	}
+
+	deleted, err := repo.FindByKey(ctx, datastore.DefaultTenant, "billing/deleted")
+	require.Nil(t, err)
+	require.Nil(t, repo.Delete(ctx, deleted, 0))
+
+	answers, err := repo.FindManyByPrefix(ctx, datastore.DefaultTenant, "billing/")
+	require.Nil(t, err)
+	require.Len(t, answers, 2)
+	require.Equal(t, "billing/a", answers[0].Key)
+	require.Equal(t, []datastore.Value{{Value: "billing/a", Version: 1}}, answers[0].Values)
+	require.Empty(t, answers[0].Outbox)
+	require.Equal(t, "billing/b", answers[1].Key)
+
+	// prefixes are matched literally
+	answers, err = repo.FindManyByPrefix(ctx, datastore.DefaultTenant, "billing%")
+	require.Nil(t, err)
+	require.Len(t, answers, 1)
+
+	answers, err = repo.FindManyByPrefix(ctx, datastore.DefaultTenant, "")
+	require.Nil(t, err)
+	require.Len(t, answers, 4)
+
+	answers, err = repo.FindManyByPrefix(ctx, datastore.DefaultTenant, "missing/")
+	require.Nil(t, err)
+	require.Empty(t, answers)
+}
+
+func testRestoreAnswers(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Answers()
+
+	for _, key := range []string{"some-key", "other-key", "active-key"} {
+		require.Nil(t, repo.Create(ctx, NewAnswer(key, key)))
+	}
+
+	answer, err := repo.Update(ctx, NewAnswer("some-key", ""), &datastore.Value{Value: "new-value"}, 0)
+	require.Nil(t, err)
+
+	require.Nil(t, repo.Delete(ctx, answer, 0))
+	require.Nil(t, repo.Delete(ctx, NewAnswer("other-key", ""), 0))
+
+	deleted, err := repo.FindDeleted(ctx, datastore.DefaultTenant, "")
+	require.Nil(t, err)
+	require.Len(t, deleted, 2)
+	require.Equal(t, "other-key", deleted[0].Key)
+	require.Equal(t, "some-key", deleted[1].Key)
+	require.Equal(t, datastore.DeletedDocumentStatus, deleted[1].DocumentStatus)
+	require.NotZero(t, deleted[1].DeletedAt)
+	require.Empty(t, deleted[1].Outbox)
+
+	deleted, err = repo.FindDeleted(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Len(t, deleted, 1)
+	require.Equal(t, answer.UID, deleted[0].UID)
+
+	stranger := NewAnswer("some-key", "")
+	stranger.UID = "other-uid"
+	require.ErrorIs(t, repo.Restore(ctx, stranger), datastore.ErrAnswerNotFound)
+
+	restored := &deleted[0]
+	restored.Outbox = []datastore.OutboxMessage{NewOutboxMessage(datastore.RestoreEvent, "some-key", "new-value", time.Now())}
+	require.Nil(t, repo.Restore(ctx, restored))
+
+	found, err := repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Equal(t, answer.UID, found.UID)
+	require.Equal(t, answer.Values, found.Values)
+	require.Equal(t, int64(2), found.Version)
+	require.Equal(t, datastore.ActiveDocumentStatus, found.DocumentStatus)
+	require.Zero(t, found.DeletedAt)
+
+	messages, err := db.Outbox().FindPendingByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, datastore.RestoreEvent, messages[0].Event.Type)
+
+	// restoring twice finds nothing to restore
+	require.ErrorIs(t, repo.Restore(ctx, restored), datastore.ErrAnswerNotFound)
+
+	// a deleted answer can't replace an active one
+	require.Nil(t, repo.Create(ctx, NewAnswer("other-key", "recreated")))
+
+	deleted, err = repo.FindDeleted(ctx, datastore.DefaultTenant, "other-key")
+	require.Nil(t, err)
+	require.Len(t, deleted, 1)
+	require.ErrorIs(t, repo.Restore(ctx, &deleted[0]), datastore.ErrDuplicateKey)
+
+	deleted, err = repo.FindDeleted(ctx, "other-tenant", "")
+	require.Nil(t, err)
+	require.Empty(t, deleted)
+}
+
+func testAnswerGenerations(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Answers()
+
+	for generation := int64(1); generation <= 3; generation++ {
+		answer := NewAnswer("some-key", fmt.Sprint(generation))
+		answer.UID = fmt.Sprintf("some-key-%d", generation)
+		answer.Generation = generation
+
+		message := NewOutboxMessage(datastore.CreateEvent, "some-key", fmt.Sprint(generation), time.Now())
+		message.Event.UID = answer.UID
+		message.Event.Data.Generation = generation
+		answer.Outbox = []datastore.OutboxMessage{message}
+
+		require.Nil(t, repo.Create(ctx, answer))
+		require.Nil(t, db.Events().Create(ctx, message.Event))
+
+		// any number of deleted generations can coexist
+		if generation < 3 {
+			answer.Outbox = nil
+			require.Nil(t, repo.Delete(ctx, answer, 0))
+		}
+	}
+
+	require.ErrorIs(t, repo.Create(ctx, NewAnswer("some-key", "4")), datastore.ErrDuplicateKey)
+
+	found, err := repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Equal(t, int64(3), found.Generation)
+
+	deleted, err := repo.FindDeleted(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Len(t, deleted, 2)
+
+	last, err := repo.LastGeneration(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Equal(t, int64(3), last)
+
+	generations := []int64{deleted[0].Generation, deleted[1].Generation}
+	require.ElementsMatch(t, []int64{1, 2}, generations)
+
+	messages, err := db.Outbox().FindPendingByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Len(t, messages, 3)
+	require.Equal(t, int64(1), messages[0].Event.Data.Generation)
+
+	events, pagination, err := db.Events().FindManyByKey(ctx, datastore.DefaultTenant, "some-key", 0, datastore.Pageable{Page: 1, PerPage: 10, Sort: 1})
+	require.Nil(t, err)
+	require.Len(t, events, 3)
+	require.Equal(t, int64(3), pagination.Total)
+
+	events, pagination, err = db.Events().FindManyByKey(ctx, datastore.DefaultTenant, "some-key", 2, datastore.Pageable{Page: 1, PerPage: 10, Sort: 1})
+	require.Nil(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, "some-key-2", events[0].UID)
+	require.Equal(t, int64(2), events[0].Data.Generation)
+	require.Equal(t, int64(1), pagination.Total)
+
+	// the restored generation keeps its number
+	require.Nil(t, repo.Delete(ctx, found, 0))
+	require.Nil(t, repo.Restore(ctx, &deleted[0]))
+
+	found, err = repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Equal(t, deleted[0].Generation, found.Generation)
+}
+
+func testPurgeAnswers(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Answers()
+
+	for _, key := range []string{"some-key", "other-key", "live-key"} {
+		answer := NewAnswer(key, key)
+		answer.Generation = 2
+		require.Nil(t, repo.Create(ctx, answer))
+	}
+
+	elsewhere := NewAnswer("some-key", "elsewhere")
+	elsewhere.TenantID = "other-tenant"
+	require.Nil(t, repo.Create(ctx, elsewhere))
+
+	for _, answer := range []*datastore.Answer{NewAnswer("some-key", ""), NewAnswer("other-key", ""), elsewhere} {
+		require.Nil(t, repo.Delete(ctx, answer, 0))
+	}
+
+	later := primitive.NewDateTimeFromTime(time.Now().Add(time.Second))
+
+	deleted, err := repo.FindDeletedBefore(ctx, "", later)
+	require.Nil(t, err)
+	require.Len(t, deleted, 3)
+	require.Equal(t, []string{"default/other-key", "default/some-key", "other-tenant/some-key"}, []string{
+		deleted[0].TenantID + "/" + deleted[0].Key,
+		deleted[1].TenantID + "/" + deleted[1].Key,
+		deleted[2].TenantID + "/" + deleted[2].Key,
+	})
+	require.Equal(t, []datastore.Value{{Value: "some-key", Version: 1}}, deleted[1].Values)
+
+	deleted, err = repo.FindDeletedBefore(ctx, datastore.DefaultTenant, later)
+	require.Nil(t, err)
+	require.Len(t, deleted, 2)
+
+	earlier := primitive.NewDateTimeFromTime(time.Now().Add(-time.Hour))
+
+	none, err := repo.FindDeletedBefore(ctx, datastore.DefaultTenant, earlier)
+	require.Nil(t, err)
+	require.Empty(t, none)
+
+	require.Nil(t, repo.Purge(ctx, &deleted[1]))
+	require.ErrorIs(t, repo.Purge(ctx, &deleted[1]), datastore.ErrAnswerNotFound)
+
+	remaining, err := repo.FindDeleted(ctx, datastore.DefaultTenant, "")
+	require.Nil(t, err)
+	require.Len(t, remaining, 1)
+	require.Equal(t, "other-key", remaining[0].Key)
+
+	// active answers are never purged
+	require.ErrorIs(t, repo.Purge(ctx, NewAnswer("live-key", "")), datastore.ErrAnswerNotFound)
+
+	_, err = repo.FindByKey(ctx, datastore.DefaultTenant, "live-key")
+	require.Nil(t, err)
+
+	// the purged generation is still the latest of the key
+	generation, err := repo.LastGeneration(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Equal(t, int64(2), generation)
+
+	generation, err = repo.LastGeneration(ctx, "other-tenant", "some-key")
+	require.Nil(t, err)
+	require.Zero(t, generation)
+
+	generation, err = repo.LastGeneration(ctx, datastore.DefaultTenant, "missing-key")
+	require.Nil(t, err)
+	require.Zero(t, generation)
+
+	// the key can be used again once purged
+	require.Nil(t, repo.Create(ctx, NewAnswer("some-key", "again")))
+
+	generation, err = repo.LastGeneration(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Equal(t, int64(2), generation)
+}
+
+func testExpiringAnswers(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Answers()
+
+	now := time.Now()
+	past := primitive.NewDateTimeFromTime(now.Add(-time.Second))
+	future := primitive.NewDateTimeFromTime(now.Add(time.Hour))
+
+	soon := NewAnswer("soon", "soon")
+	soon.ExpiresAt = past
+
+	sooner := NewAnswer("soon", "elsewhere")
+	sooner.TenantID = "other-tenant"
+	sooner.ExpiresAt = primitive.NewDateTimeFromTime(now.Add(-2 * time.Second))
+
+	later := NewAnswer("later", "later")
+	later.ExpiresAt = future
+
+	for _, answer := range []*datastore.Answer{soon, sooner, later, NewAnswer("never", "never")} {
+		require.Nil(t, repo.Create(ctx, answer))
+	}
+
+	found, err := repo.FindByKey(ctx, datastore.DefaultTenant, "later")
+	require.Nil(t, err)
+	require.Equal(t, future, found.ExpiresAt)
+
+	expired, err := repo.FindExpired(ctx, primitive.NewDateTimeFromTime(now), 10)
+	require.Nil(t, err)
+	require.Len(t, expired, 2)
+	require.Equal(t, "other-tenant", expired[0].TenantID)
+	require.Equal(t, datastore.DefaultTenant, expired[1].TenantID)
+	require.Equal(t, []datastore.Value{{Value: "soon", Version: 1}}, expired[1].Values)
+
+	expired, err = repo.FindExpired(ctx, primitive.NewDateTimeFromTime(now), 1)
+	require.Nil(t, err)
+	require.Len(t, expired, 1)
+	require.Equal(t, "other-tenant", expired[0].TenantID)
+
+	// updates set the expiry of the answer they are given
+	later.ExpiresAt = past
+	updated, err := repo.Update(ctx, later, &datastore.Value{Value: "now"}, 0)
+	require.Nil(t, err)
+	require.Equal(t, past, updated.ExpiresAt)
+
+	expired, err = repo.FindExpired(ctx, primitive.NewDateTimeFromTime(now), 10)
+	require.Nil(t, err)
+	require.Len(t, expired, 3)
+
+	later.ExpiresAt = 0
+	_, err = repo.Update(ctx, later, &datastore.Value{Value: "never"}, 0)
+	require.Nil(t, err)
+
+	found, err = repo.FindByKey(ctx, datastore.DefaultTenant, "later")
+	require.Nil(t, err)
+	require.Zero(t, found.ExpiresAt)
+
+	// deleted answers don't expire, and are restored without an expiry
+	require.Nil(t, repo.Delete(ctx, soon, 1))
+
+	expired, err = repo.FindExpired(ctx, primitive.NewDateTimeFromTime(now), 10)
+	require.Nil(t, err)
+	require.Len(t, expired, 1)
+
+	require.Nil(t, repo.Restore(ctx, soon))
+
+	found, err = repo.FindByKey(ctx, datastore.DefaultTenant, "soon")
+	require.Nil(t, err)
+	require.Zero(t, found.ExpiresAt)
+}
+
+func testListAnswers(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Answers()
+
+	base := time.Now().Add(-time.Hour)
+	at := func(minutes int) primitive.DateTime {
+		return primitive.NewDateTimeFromTime(base.Add(time.Duration(minutes) * time.Minute))
+	}
+
+	for _, a := range []struct {
+		tenantID         string
+		key              string
+		created, updated int
+		expired, deleted bool
+		generation       int64
+	}{
+		{key: "billing.a", created: 1, updated: 5},
+		{key: "billing.b", created: 2, updated: 4},
+		{key: "billing.c", created: 3, updated: 3, expired: true},
+		{key: "accounts.a", created: 4, updated: 4},
+		{key: "billing.d", created: 1, updated: 1, deleted: true, generation: 1},
+		{key: "billing.d", created: 2, updated: 2, deleted: true, generation: 2},
+		{tenantID: "other-tenant", key: "billing.z", created: 1, updated: 1},
+	} {
+		answer := NewAnswer(a.key, a.key)
+		answer.UID = fmt.Sprintf("%s-%d", a.key, a.generation)
+		answer.Generation = a.generation
+		answer.CreatedAt, answer.UpdatedAt = at(a.created), at(a.updated)
+
+		if a.tenantID != "" {
+			answer.TenantID = a.tenantID
+		}
+
+		if a.expired {
+			answer.ExpiresAt = at(30)
+		}
+
+		require.Nil(t, repo.Create(ctx, answer))
+
+		if a.deleted {
+			require.Nil(t, repo.Delete(ctx, answer, 0))
+		}
+	}
+
+	keys := func(filter datastore.AnswerFilter) []string {
+		answers, err := repo.FindMany(ctx, datastore.DefaultTenant, filter)
+		require.Nil(t, err)
+
+		keys := make([]string, len(answers))
+		for i := range answers {
+			keys[i] = fmt.Sprintf("%s/%d", answers[i].Key, answers[i].Generation)
+		}
+
+		return keys
+	}
+
+	require.Equal(t, []string{"accounts.a/0", "billing.a/0", "billing.b/0", "billing.c/0"}, keys(datastore.AnswerFilter{}))
+	require.Equal(t, []string{"billing.a/0", "billing.b/0", "billing.c/0"}, keys(datastore.AnswerFilter{Prefix: "billing."}))
+	require.Equal(t, []string{"billing.a/0", "billing.b/0"}, keys(datastore.AnswerFilter{Regex: `^billing\.[ab]$`}))
+	require.Equal(t, []string{"billing.a/0"}, keys(datastore.AnswerFilter{Regex: `^billing\.[ab]$`, Limit: 1}))
+	require.Equal(t, []string{"accounts.a/0", "billing.a/0", "billing.b/0"}, keys(datastore.AnswerFilter{UpdatedSince: at(4)}))
+	require.Equal(t, []string{"billing.a/0", "billing.b/0"}, keys(datastore.AnswerFilter{CreatedBefore: at(3)}))
+	require.Equal(t, []string{"accounts.a/0", "billing.a/0", "billing.b/0"}, keys(datastore.AnswerFilter{ExpiresAfter: at(30)}))
+
+	// answers updated at the same time are listed by key, in the same direction
+	byUpdate := datastore.AnswerFilter{SortBy: datastore.UpdatedAtAnswerSort, Descending: true, Limit: 2}
+	require.Equal(t, []string{"billing.a/0", "billing.b/0"}, keys(byUpdate))
+
+	found, err := repo.FindMany(ctx, datastore.DefaultTenant, byUpdate)
+	require.Nil(t, err)
+
+	byUpdate.After = datastore.NewAnswerCursor(&found[1], byUpdate.SortBy)
+	require.Equal(t, []string{"accounts.a/0", "billing.c/0"}, keys(byUpdate))
+
+	byCreation := datastore.AnswerFilter{SortBy: datastore.CreatedAtAnswerSort, After: &datastore.AnswerCursor{Time: at(2), Key: "billing.b"}}
+	require.Equal(t, []string{"billing.c/0", "accounts.a/0"}, keys(byCreation))
+
+	deleted := datastore.AnswerFilter{Status: datastore.DeletedDocumentStatus}
+	require.Equal(t, []string{"billing.d/1", "billing.d/2"}, keys(deleted))
+
+	deleted.Descending = true
+	require.Equal(t, []string{"billing.d/2", "billing.d/1"}, keys(deleted))
+
+	deleted.After = &datastore.AnswerCursor{Key: "billing.d", Generation: 2}
+	require.Equal(t, []string{"billing.d/1"}, keys(deleted))
+
+	answers, err := repo.FindMany(ctx, "other-tenant", datastore.AnswerFilter{})
+	require.Nil(t, err)
+	require.Len(t, answers, 1)
+	require.Equal(t, []datastore.Value{{Value: "billing.z", Version: 1}}, answers[0].Values)
+}
+
+func testSearchAnswers(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Answers()
+
+	both := NewAnswer("both", "Refunds are issued within 14 days, refund requests go to billing")
+	history := NewAnswer("history", "refunds are handled by support")
+	list := NewAnswer("list", "")
+	list.Values = []datastore.Value{{Value: []interface{}{"invoices", "refund"}}}
+
+	deleted := NewAnswer("deleted", "refund")
+	other := NewAnswer("other", "refund")
+	other.TenantID = "other-tenant"
+
+	for _, answer := range []*datastore.Answer{both, history, list, deleted, other, NewAnswer("unrelated", "shipping")} {
+		require.Nil(t, repo.Create(ctx, answer))
+	}
+
+	_, err := repo.Update(ctx, history, &datastore.Value{Value: "handled by support"}, 0)
+	require.Nil(t, err)
+	require.Nil(t, repo.Delete(ctx, deleted, 0))
+
+	found, err := repo.Search(ctx, datastore.DefaultTenant, []string{"refund", "billing"}, 0)
+	require.Nil(t, err)
+	require.Len(t, found, 2)
+
+	// mentioning more of the terms ranks first
+	require.Equal(t, "both", found[0].Answer.Key)
+	require.Equal(t, "list", found[1].Answer.Key)
+	require.Greater(t, found[0].Score, found[1].Score)
+	require.Len(t, found[0].Answer.Values, 1)
+
+	// every value of an answer is searched
+	found, err = repo.Search(ctx, datastore.DefaultTenant, []string{"refunds"}, 0)
+	require.Nil(t, err)
+	require.Len(t, found, 2)
+
+	keys := []string{found[0].Answer.Key, found[1].Answer.Key}
+	require.ElementsMatch(t, []string{"both", "history"}, keys)
+
+	// only the most relevant answers are kept
+	found, err = repo.Search(ctx, datastore.DefaultTenant, []string{"refund", "billing"}, 1)
+	require.Nil(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "both", found[0].Answer.Key)
+
+	found, err = repo.Search(ctx, datastore.DefaultTenant, []string{"missing"}, 0)
+	require.Nil(t, err)
+	require.Empty(t, found)
+}
+
+func testConcurrentAnswerUpdates(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Answers()
+
+	answer := NewAnswer("some-key", "0")
+	require.Nil(t, repo.Create(ctx, answer))
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := repo.Update(ctx, answer, &datastore.Value{Value: fmt.Sprint(i)}, 0)
+			require.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	answer, err := repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Len(t, answer.Values, 21)
+	require.Equal(t, int64(21), answer.Version)
+}
+
+func testConditionalAnswerWrites(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Answers()
+
+	answer := NewAnswer("some-key", "some-value")
+	require.Nil(t, repo.Create(ctx, answer))
+
+	updated, err := repo.Update(ctx, answer, &datastore.Value{Value: "new-value"}, 1)
+	require.Nil(t, err)
+	require.Equal(t, int64(2), updated.Version)
+
+	_, err = repo.Update(ctx, answer, &datastore.Value{Value: "stale-value"}, 1)
+	require.ErrorIs(t, err, datastore.ErrVersionMismatch)
+
+	// another generation of the key at the same version doesn't match
+	other := NewAnswer("some-key", "")
+	other.UID = "other-generation"
+	_, err = repo.Update(ctx, other, &datastore.Value{Value: "other-value"}, 2)
+	require.ErrorIs(t, err, datastore.ErrVersionMismatch)
+	require.ErrorIs(t, repo.Delete(ctx, other, 2), datastore.ErrVersionMismatch)
+
+	require.ErrorIs(t, repo.Delete(ctx, answer, 1), datastore.ErrVersionMismatch)
+
+	found, err := repo.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Equal(t, []datastore.Value{{Value: "some-value", Version: 1}, {Value: "new-value", Version: 2}}, found.Values)
+	require.Equal(t, int64(2), found.Version)
+
+	// only one of concurrent writes at the same version succeeds
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := repo.Update(ctx, answer, &datastore.Value{Value: fmt.Sprint(i)}, 2)
+			if err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+				return
+			}
+			require.ErrorIs(t, err, datastore.ErrVersionMismatch)
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, 1, succeeded)
+
+	require.Nil(t, repo.Delete(ctx, answer, 3))
+
+	_, err = repo.Update(ctx, answer, &datastore.Value{Value: "deleted-value"}, 3)
+	require.ErrorIs(t, err, datastore.ErrVersionMismatch)
+}
+
+func testPaginatedEvents(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Events()
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		err := repo.Create(ctx, &datastore.Event{
+			ID:             primitive.NewObjectID(),
+			UID:            fmt.Sprint(i),
+			TenantID:       datastore.DefaultTenant,
+			Type:           datastore.UpdateEvent,
+			Data:           &datastore.EventData{Key: "some-key", Value: fmt.Sprint(i)},
+			Actor:          "some-user",
+			CreatedAt:      primitive.NewDateTimeFromTime(now.Add(time.Duration(i) * time.Second)),
+			UpdatedAt:      primitive.NewDateTimeFromTime(now),
+			DocumentStatus: datastore.ActiveDocumentStatus,
+		})
+		require.Nil(t, err)
+	}
+
+	require.Nil(t, repo.Create(ctx, &datastore.Event{
+		ID:             primitive.NewObjectID(),
+		UID:            "other",
+		TenantID:       datastore.DefaultTenant,
+		Type:           datastore.CreateEvent,
+		Data:           &datastore.EventData{Key: "other-key"},
+		CreatedAt:      primitive.NewDateTimeFromTime(now),
+		UpdatedAt:      primitive.NewDateTimeFromTime(now),
+		DocumentStatus: datastore.ActiveDocumentStatus,
+	}))
+
+	events, pagination, err := repo.FindManyByKey(ctx, datastore.DefaultTenant, "some-key", 0, datastore.Pageable{Page: 1, PerPage: 2, Sort: -1})
+	require.Nil(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, []string{"4", "3"}, []string{events[0].UID, events[1].UID})
+	require.Equal(t, "4", events[0].Data.Value)
+	require.Equal(t, "some-user", events[0].Actor)
+	require.Equal(t, datastore.PaginationData{Total: 5, Page: 1, PerPage: 2, Prev: 0, Next: 2, TotalPage: 3}, pagination)
+
+	events, pagination, err = repo.FindManyByKey(ctx, datastore.DefaultTenant, "some-key", 0, datastore.Pageable{Page: 3, PerPage: 2, Sort: -1})
+	require.Nil(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, "0", events[0].UID)
+	require.Equal(t, datastore.PaginationData{Total: 5, Page: 3, PerPage: 2, Prev: 2, Next: 0, TotalPage: 3}, pagination)
+
+	events, _, err = repo.FindManyByKey(ctx, datastore.DefaultTenant, "some-key", 0, datastore.Pageable{Page: 1, PerPage: 2, Sort: 1})
+	require.Nil(t, err)
+	require.Equal(t, []string{"0", "1"}, []string{events[0].UID, events[1].UID})
+
+	events, pagination, err = repo.FindManyByKey(ctx, datastore.DefaultTenant, "missing-key", 0, datastore.Pageable{Page: 1, PerPage: 2, Sort: -1})
+	require.Nil(t, err)
+	require.NotNil(t, events)
+	require.Empty(t, events)
+	require.Equal(t, int64(0), pagination.Total)
+
+	_, _, err = repo.FindManyByKey(ctx, datastore.DefaultTenant, "some-key", 0, datastore.Pageable{Page: 0, PerPage: 2})
+	require.ErrorIs(t, err, datastore.ErrInvalidPageable)
+}
+
+func testDuplicateEvents(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Events()
+
+	event := NewOutboxMessage(datastore.CreateEvent, "some-key", "some-value", time.Now()).Event
+
+	require.Nil(t, repo.Create(ctx, event))
+	require.ErrorIs(t, repo.Create(ctx, event), datastore.ErrDuplicateKey)
+
+	events, _, err := repo.FindManyByKey(ctx, datastore.DefaultTenant, "some-key", 0, datastore.Pageable{Page: 1, PerPage: 10})
+	require.Nil(t, err)
+	require.Len(t, events, 1)
+}
+
+func testRollbackEvents(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+
+	answer := NewAnswer("some-key", "some-value")
+	require.Nil(t, db.Answers().Create(ctx, answer))
+
+	message := NewOutboxMessage(datastore.RollbackEvent, "some-key", "some-value", time.Now())
+	message.Event.Data.Version, message.Event.Data.SourceVersion = 2, 1
+
+	answer.Outbox = []datastore.OutboxMessage{message}
+	_, err := db.Answers().Update(ctx, answer, &datastore.Value{Value: "some-value"}, 1)
+	require.Nil(t, err)
+
+	// the versions are kept in the outbox, then in the history
+	messages, err := db.Outbox().FindPendingByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, message.Event.Data, messages[0].Event.Data)
+
+	require.Nil(t, db.Events().Create(ctx, messages[0].Event))
+
+	events, _, err := db.Events().FindManyByKey(ctx, datastore.DefaultTenant, "some-key", 0, datastore.Pageable{Page: 1, PerPage: 10})
+	require.Nil(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, datastore.RollbackEvent, events[0].Type)
+	require.Equal(t, message.Event.Data, events[0].Data)
+}
+
+func testExpiredEvents(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Events()
+
+	now := time.Now()
+	at := func(ago int) primitive.DateTime {
+		return primitive.NewDateTimeFromTime(now.Add(-time.Duration(ago) * time.Second))
+	}
+
+	create := func(tenantID, key string, generation int64, ago int) datastore.Event {
+		event := NewOutboxMessage(datastore.UpdateEvent, key, fmt.Sprint(ago), now.Add(-time.Duration(ago)*time.Second)).Event
+		event.UID = fmt.Sprintf("%s-%s-%d", tenantID, key, ago)
+		event.TenantID = tenantID
+		event.Data.Generation = generation
+
+		require.Nil(t, repo.Create(ctx, event))
+		return *event
+	}
+
+	for ago := 5; ago >= 1; ago-- {
+		generation := int64(2)
+		if ago > 3 {
+			generation = 1
+		}
+
+		create(datastore.DefaultTenant, "some-key", generation, ago)
+	}
+
+	other := create(datastore.DefaultTenant, "other-key", 1, 10)
+	create("other-tenant", "some-key", 1, 20)
+
+	uids := func(events []datastore.Event) []string {
+		found := make([]string, len(events))
+		for i, event := range events {
+			found[i] = event.UID
+		}
+		return found
+	}
+
+	expired, err := repo.FindExpired(ctx, datastore.DefaultTenant, at(3), 0)
+	require.Nil(t, err)
+	require.Equal(t, []string{"default-other-key-10", "default-some-key-5", "default-some-key-4"}, uids(expired))
+
+	expired, err = repo.FindExpired(ctx, datastore.DefaultTenant, 0, 2)
+	require.Nil(t, err)
+	require.Equal(t, []string{"default-some-key-5", "default-some-key-4", "default-some-key-3"}, uids(expired))
+
+	// either limit expires an event
+	expired, err = repo.FindExpired(ctx, datastore.DefaultTenant, at(7), 4)
+	require.Nil(t, err)
+	require.Equal(t, []string{"default-other-key-10", "default-some-key-5"}, uids(expired))
+
+	expired, err = repo.FindExpired(ctx, "", at(3), 0)
+	require.Nil(t, err)
+	require.Len(t, expired, 4)
+	require.Equal(t, "other-tenant-some-key-20", expired[0].UID)
+
+	deleted, err := repo.DeleteByKey(ctx, datastore.DefaultTenant, "some-key", 1)
+	require.Nil(t, err)
+	require.Equal(t, int64(2), deleted)
+
+	events, pagination, err := repo.FindManyByKey(ctx, datastore.DefaultTenant, "some-key", 0, datastore.Pageable{Page: 1, PerPage: 10, Sort: 1})
+	require.Nil(t, err)
+	require.Equal(t, int64(3), pagination.Total)
+	require.Equal(t, []string{"default-some-key-3", "default-some-key-2", "default-some-key-1"}, uids(events))
+
+	require.Nil(t, repo.Delete(ctx, []datastore.Event{other}))
+	require.Nil(t, repo.Delete(ctx, nil))
+
+	events, _, err = repo.FindManyByKey(ctx, datastore.DefaultTenant, "other-key", 0, datastore.Pageable{Page: 1, PerPage: 10})
+	require.Nil(t, err)
+	require.Empty(t, events)
+
+	events, _, err = repo.FindManyByKey(ctx, "other-tenant", "some-key", 0, datastore.Pageable{Page: 1, PerPage: 10})
+	require.Nil(t, err)
+	require.Len(t, events, 1)
+}
+
+func testOutbox(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	answers, outbox := db.Answers(), db.Outbox()
+
+	start := time.Now().Add(-time.Minute)
+	now := primitive.NewDateTimeFromTime(time.Now())
+
+	answer := NewAnswer("some-key", "some-value")
+	answer.Outbox = []datastore.OutboxMessage{NewOutboxMessage(datastore.CreateEvent, "some-key", "some-value", start)}
+	require.Nil(t, answers.Create(ctx, answer))
+
+	// the outbox is never returned by reads
+	found, err := answers.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Empty(t, found.Outbox)
+
+	found.Outbox = []datastore.OutboxMessage{NewOutboxMessage(datastore.UpdateEvent, "some-key", "new-value", start.Add(time.Second))}
+	found.Outbox[0].Event.Actor = "some-user"
+	updated, err := answers.Update(ctx, found, &datastore.Value{Value: "new-value"}, 0)
+	require.Nil(t, err)
+	require.Empty(t, updated.Outbox)
+
+	found.Outbox = []datastore.OutboxMessage{NewOutboxMessage(datastore.DeleteEvent, "some-key", "new-value", start.Add(2*time.Second))}
+	require.Nil(t, answers.Delete(ctx, found, 0))
+
+	// a failed mutation doesn't leave its message behind
+	require.Nil(t, answers.Create(ctx, NewAnswer("other-key", "other-value")))
+
+	duplicate := NewAnswer("other-key", "other-value")
+	duplicate.Outbox = []datastore.OutboxMessage{NewOutboxMessage(datastore.CreateEvent, "other-key", "other-value", start)}
+	require.ErrorIs(t, answers.Create(ctx, duplicate), datastore.ErrDuplicateKey)
+
+	messages, err := outbox.FindPendingByKey(ctx, datastore.DefaultTenant, "other-key")
+	require.Nil(t, err)
+	require.Empty(t, messages)
+
+	due, err := outbox.FindDue(ctx, now, 10)
+	require.Nil(t, err)
+	require.Len(t, due, 3)
+	require.Equal(t, []datastore.EventType{datastore.CreateEvent, datastore.UpdateEvent, datastore.DeleteEvent},
+		[]datastore.EventType{due[0].Event.Type, due[1].Event.Type, due[2].Event.Type})
+	require.Equal(t, "new-value", due[1].Event.Data.Value)
+	require.Equal(t, "some-user", due[1].Event.Actor)
+	require.Empty(t, due[0].Event.Actor)
+	require.Equal(t, answer.Outbox[0].Event.ID, due[0].Event.ID)
+
+	limited, err := outbox.FindDue(ctx, now, 2)
+	require.Nil(t, err)
+	require.Len(t, limited, 2)
+
+	// a rescheduled message is pending but not due
+	due[0].Attempts = 1
+	due[0].LastError = "failed"
+	due[0].NextAttemptAt = primitive.NewDateTimeFromTime(time.Now().Add(time.Hour))
+	require.Nil(t, outbox.Update(ctx, &due[0]))
+
+	// a dead message is neither pending nor due
+	due[1].Status = datastore.DeadOutboxStatus
+	require.Nil(t, outbox.Update(ctx, &due[1]))
+
+	messages, err = outbox.FindDue(ctx, now, 10)
+	require.Nil(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, datastore.DeleteEvent, messages[0].Event.Type)
+
+	messages, err = outbox.FindPendingByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Len(t, messages, 2)
+	require.Equal(t, 1, messages[0].Attempts)
+	require.Equal(t, "failed", messages[0].LastError)
+
+	require.Nil(t, outbox.Delete(ctx, due[2].Event.ID))
+
+	messages, err = outbox.FindPendingByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, datastore.CreateEvent, messages[0].Event.Type)
+}
+
+func testSchemas(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.Schemas()
+
+	definition := `{"$schema": "https://json-schema.org/draft/2020-12/schema", "type": "object"}`
+
+	require.Nil(t, repo.Create(ctx, NewSchema("billing/", 2, definition)))
+	require.Nil(t, repo.Create(ctx, NewSchema("billing/", 1, definition)))
+	require.Nil(t, repo.Create(ctx, NewSchema("accounts/", 1, `{"type": "string"}`)))
+	require.ErrorIs(t, repo.Create(ctx, NewSchema("billing/", 1, definition)), datastore.ErrDuplicateKey)
+
+	schema, err := repo.FindByUID(ctx, datastore.DefaultTenant, "billing/-1")
+	require.Nil(t, err)
+	require.Equal(t, "billing/", schema.Namespace)
+	require.Equal(t, 1, schema.Version)
+	require.JSONEq(t, definition, string(schema.Definition))
+	require.Equal(t, datastore.DraftSchemaStatus, schema.Status)
+
+	_, err = repo.FindByUID(ctx, datastore.DefaultTenant, "missing")
+	require.ErrorIs(t, err, datastore.ErrSchemaNotFound)
+
+	schemas, err := repo.FindMany(ctx, datastore.DefaultTenant, "billing/")
+	require.Nil(t, err)
+	require.Len(t, schemas, 2)
+	require.Equal(t, 1, schemas[0].Version)
+	require.Equal(t, 2, schemas[1].Version)
+
+	schemas, err = repo.FindMany(ctx, datastore.DefaultTenant, "")
+	require.Nil(t, err)
+	require.Len(t, schemas, 3)
+	require.Equal(t, "accounts/", schemas[0].Namespace)
+
+	schemas, err = repo.FindActive(ctx, datastore.DefaultTenant)
+	require.Nil(t, err)
+	require.Empty(t, schemas)
+
+	require.Nil(t, repo.UpdateStatus(ctx, datastore.DefaultTenant, "billing/-2", datastore.ActiveSchemaStatus))
+	require.Nil(t, repo.UpdateStatus(ctx, datastore.DefaultTenant, "accounts/-1", datastore.ActiveSchemaStatus))
+	require.ErrorIs(t, repo.UpdateStatus(ctx, datastore.DefaultTenant, "missing", datastore.ActiveSchemaStatus), datastore.ErrSchemaNotFound)
+
+	schemas, err = repo.FindActive(ctx, datastore.DefaultTenant)
+	require.Nil(t, err)
+	require.Len(t, schemas, 2)
+	require.Equal(t, "accounts/-1", schemas[0].UID)
+	require.Equal(t, "billing/-2", schemas[1].UID)
+	require.Equal(t, datastore.ActiveSchemaStatus, schemas[1].Status)
+}
+
+func testAPIKeys(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.APIKeys()
+
+	now := time.Now()
+
+	second := NewAPIKey("second", "prefix-a", now.Add(time.Second))
+	second.Scopes = []string{"answers:read", "answers:write"}
+	second.ExpiresAt = primitive.NewDateTimeFromTime(now.Add(time.Hour))
+	require.Nil(t, repo.Create(ctx, second))
+
+	first := NewAPIKey("first", "prefix-b", now)
+	require.Nil(t, repo.Create(ctx, first))
+
+	other := NewAPIKey("other", "prefix-c", now)
+	other.TenantID = "other-tenant"
+	require.Nil(t, repo.Create(ctx, other))
+
+	// prefixes are unique across tenants
+	duplicate := NewAPIKey("duplicate", "prefix-a", now)
+	duplicate.TenantID = "other-tenant"
+	require.ErrorIs(t, repo.Create(ctx, duplicate), datastore.ErrDuplicateKey)
+
+	key, err := repo.FindByPrefix(ctx, "prefix-a")
+	require.Nil(t, err)
+	require.Equal(t, "second", key.UID)
+	require.Equal(t, "prefix-a-hash", key.Hash)
+	require.Equal(t, []string{"answers:read", "answers:write"}, key.Scopes)
+	require.Equal(t, second.ExpiresAt, key.ExpiresAt)
+	require.Zero(t, key.RevokedAt)
+
+	key, err = repo.FindByPrefix(ctx, "prefix-c")
+	require.Nil(t, err)
+	require.Equal(t, "other-tenant", key.TenantID)
+
+	_, err = repo.FindByPrefix(ctx, "missing")
+	require.ErrorIs(t, err, datastore.ErrAPIKeyNotFound)
+
+	_, err = repo.FindByUID(ctx, datastore.DefaultTenant, "other")
+	require.ErrorIs(t, err, datastore.ErrAPIKeyNotFound)
+
+	keys, err := repo.FindMany(ctx, datastore.DefaultTenant)
+	require.Nil(t, err)
+	require.Equal(t, []string{"first", "second"}, []string{keys[0].UID, keys[1].UID})
+
+	// rotating replaces the prefix, the old one no longer matches
+	key, err = repo.FindByUID(ctx, datastore.DefaultTenant, "second")
+	require.Nil(t, err)
+
+	key.Prefix = "prefix-d"
+	key.Hash = "prefix-d-hash"
+	key.RevokedAt = primitive.NewDateTimeFromTime(now)
+	require.Nil(t, repo.Update(ctx, key))
+
+	_, err = repo.FindByPrefix(ctx, "prefix-a")
+	require.ErrorIs(t, err, datastore.ErrAPIKeyNotFound)
+
+	key, err = repo.FindByPrefix(ctx, "prefix-d")
+	require.Nil(t, err)
+	require.Equal(t, "prefix-d-hash", key.Hash)
+	require.Equal(t, primitive.NewDateTimeFromTime(now), key.RevokedAt)
+
+	key.Prefix = "prefix-b"
+	require.ErrorIs(t, repo.Update(ctx, key), datastore.ErrDuplicateKey)
+
+	other.TenantID = datastore.DefaultTenant
+	require.ErrorIs(t, repo.Update(ctx, other), datastore.ErrAPIKeyNotFound)
+
+	usedAt := primitive.NewDateTimeFromTime(now.Add(time.Minute))
+	require.Nil(t, repo.TouchLastUsed(ctx, "first", usedAt))
+	require.ErrorIs(t, repo.TouchLastUsed(ctx, "missing", usedAt), datastore.ErrAPIKeyNotFound)
+
+	key, err = repo.FindByUID(ctx, datastore.DefaultTenant, "first")
+	require.Nil(t, err)
+	require.Equal(t, usedAt, key.LastUsedAt)
+}
+
+func testRoleBindings(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.RoleBindings()
+
+	now := time.Now()
+
+	require.Nil(t, repo.Create(ctx, NewRoleBinding("second", "some-user", datastore.WriterRole, "billing/*", now.Add(time.Second))))
+	require.Nil(t, repo.Create(ctx, NewRoleBinding("first", "group:billing", datastore.ReaderRole, "*", now)))
+	require.Nil(t, repo.Create(ctx, NewRoleBinding("third", "other-user", datastore.AdminRole, "billing/*", now)))
+
+	// the same subject and pattern can be bound in another tenant
+	other := NewRoleBinding("other", "some-user", datastore.AdminRole, "billing/*", now)
+	other.TenantID = "other-tenant"
+	require.Nil(t, repo.Create(ctx, other))
+
+	duplicate := NewRoleBinding("duplicate", "some-user", datastore.ReaderRole, "billing/*", now)
+	require.ErrorIs(t, repo.Create(ctx, duplicate), datastore.ErrDuplicateKey)
+
+	binding, err := repo.FindByUID(ctx, datastore.DefaultTenant, "second")
+	require.Nil(t, err)
+	require.Equal(t, "some-user", binding.Subject)
+	require.Equal(t, datastore.WriterRole, binding.Role)
+	require.Equal(t, "billing/*", binding.Pattern)
+
+	_, err = repo.FindByUID(ctx, datastore.DefaultTenant, "other")
+	require.ErrorIs(t, err, datastore.ErrRoleBindingNotFound)
+
+	bindings, err := repo.FindMany(ctx, datastore.DefaultTenant, nil)
+	require.Nil(t, err)
+	require.Equal(t, []string{"first", "third", "second"}, bindingUIDs(bindings))
+
+	bindings, err = repo.FindMany(ctx, datastore.DefaultTenant, []string{"some-user", "group:billing"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"first", "second"}, bindingUIDs(bindings))
+
+	bindings, err = repo.FindMany(ctx, "missing-tenant", []string{"some-user"})
+	require.Nil(t, err)
+	require.Empty(t, bindings)
+
+	require.ErrorIs(t, repo.Delete(ctx, datastore.DefaultTenant, "other"), datastore.ErrRoleBindingNotFound)
+	require.Nil(t, repo.Delete(ctx, datastore.DefaultTenant, "second"))
+	require.ErrorIs(t, repo.Delete(ctx, datastore.DefaultTenant, "second"), datastore.ErrRoleBindingNotFound)
+
+	// the pair is free again once deleted
+	require.Nil(t, repo.Create(ctx, duplicate))
+
+	bindings, err = repo.FindMany(ctx, "other-tenant", []string{"some-user"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"other"}, bindingUIDs(bindings))
+}
+
+func testLegalHolds(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	repo := db.LegalHolds()
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	for _, hold := range []datastore.LegalHold{
+		{TenantID: datastore.DefaultTenant, Key: "some-key", Reason: "litigation", CreatedBy: "some-user"},
+		{TenantID: datastore.DefaultTenant, Key: "other-key", Reason: "audit"},
+		{TenantID: "other-tenant", Key: "some-key", Reason: "audit"},
+	} {
+		hold.ID = primitive.NewObjectID()
+		hold.CreatedAt = now
+		require.Nil(t, repo.Create(ctx, &hold))
+	}
+
+	duplicate := &datastore.LegalHold{ID: primitive.NewObjectID(), TenantID: datastore.DefaultTenant, Key: "some-key", CreatedAt: now}
+	require.ErrorIs(t, repo.Create(ctx, duplicate), datastore.ErrDuplicateKey)
+
+	holds, err := repo.FindMany(ctx, datastore.DefaultTenant)
+	require.Nil(t, err)
+	require.Len(t, holds, 2)
+	require.Equal(t, "other-key", holds[0].Key)
+	require.Equal(t, "some-key", holds[1].Key)
+	require.Equal(t, "litigation", holds[1].Reason)
+	require.Equal(t, "some-user", holds[1].CreatedBy)
+	require.Equal(t, now, holds[1].CreatedAt)
+
+	holds, err = repo.FindMany(ctx, "")
+	require.Nil(t, err)
+	require.Len(t, holds, 3)
+	require.Equal(t, "other-tenant", holds[2].TenantID)
+
+	require.Nil(t, repo.Delete(ctx, datastore.DefaultTenant, "some-key"))
+	require.ErrorIs(t, repo.Delete(ctx, datastore.DefaultTenant, "some-key"), datastore.ErrLegalHoldNotFound)
+
+	holds, err = repo.FindMany(ctx, "other-tenant")
+	require.Nil(t, err)
+	require.Len(t, holds, 1)
+
+	holds, err = repo.FindMany(ctx, "missing-tenant")
+	require.Nil(t, err)
+	require.NotNil(t, holds)
+	require.Empty(t, holds)
+}
+
+func bindingUIDs(bindings []datastore.RoleBinding) []string {
+	uids := make([]string, 0, len(bindings))
+	for _, binding := range bindings {
+		uids = append(uids, binding.UID)
+	}
+
+	return uids
+}
+
+func testTenants(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	answers := db.Answers()
+
+	other := NewAnswer("some-key", "other-value")
+	other.TenantID = "other-tenant"
+	other.Outbox = []datastore.OutboxMessage{NewOutboxMessage(datastore.CreateEvent, "some-key", "other-value", time.Now())}
+	other.Outbox[0].Event.TenantID = other.TenantID
+
+	// keys are unique per tenant
+	require.Nil(t, answers.Create(ctx, NewAnswer("some-key", "some-value")))
+	require.Nil(t, answers.Create(ctx, other))
+
+	event := other.Outbox[0].Event
+	other.Outbox = nil
+
+	answer, err := answers.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Equal(t, datastore.DefaultTenant, answer.TenantID)
+	require.Equal(t, "some-value", answer.Values[0].Value)
+
+	_, err = answers.Update(ctx, other, &datastore.Value{Value: "new-value"}, 0)
+	require.Nil(t, err)
+
+	answer, err = answers.FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Len(t, answer.Values, 1)
+
+	found, err := answers.FindManyByPrefix(ctx, "other-tenant", "")
+	require.Nil(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "other-tenant", found[0].TenantID)
+	require.Len(t, found[0].Values, 2)
+
+	require.Nil(t, answers.Delete(ctx, answer, 0))
+
+	_, err = answers.FindByKey(ctx, "other-tenant", "some-key")
+	require.Nil(t, err)
+
+	_, err = answers.FindByKey(ctx, "missing-tenant", "some-key")
+	require.ErrorIs(t, err, datastore.ErrAnswerNotFound)
+
+	// history and pending messages never cross tenants
+	require.Nil(t, db.Events().Create(ctx, event))
+
+	events, _, err := db.Events().FindManyByKey(ctx, datastore.DefaultTenant, "some-key", 0, datastore.Pageable{Page: 1, PerPage: 10})
+	require.Nil(t, err)
+	require.Empty(t, events)
+
+	events, _, err = db.Events().FindManyByKey(ctx, "other-tenant", "some-key", 0, datastore.Pageable{Page: 1, PerPage: 10})
+	require.Nil(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, "other-tenant", events[0].TenantID)
+
+	messages, err := db.Outbox().FindPendingByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Empty(t, messages)
+
+	messages, err = db.Outbox().FindPendingByKey(ctx, "other-tenant", "some-key")
+	require.Nil(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, "other-tenant", messages[0].Event.TenantID)
+
+	// so do schemas, including their versions
+	schemas := db.Schemas()
+
+	schema := NewSchema("billing/", 1, `{"type": "object"}`)
+	require.Nil(t, schemas.Create(ctx, schema))
+
+	otherSchema := NewSchema("billing/", 1, `{"type": "array"}`)
+	otherSchema.UID = "other-tenant-billing/-1"
+	otherSchema.TenantID = "other-tenant"
+	require.Nil(t, schemas.Create(ctx, otherSchema))
+
+	_, err = schemas.FindByUID(ctx, "other-tenant", schema.UID)
+	require.ErrorIs(t, err, datastore.ErrSchemaNotFound)
+	require.ErrorIs(t, schemas.UpdateStatus(ctx, "other-tenant", schema.UID, datastore.ActiveSchemaStatus), datastore.ErrSchemaNotFound)
+
+	require.Nil(t, schemas.UpdateStatus(ctx, "other-tenant", otherSchema.UID, datastore.ActiveSchemaStatus))
+
+	active, err := schemas.FindActive(ctx, datastore.DefaultTenant)
+	require.Nil(t, err)
+	require.Empty(t, active)
+
+	tenantSchemas, err := schemas.FindMany(ctx, "other-tenant", "")
+	require.Nil(t, err)
+	require.Len(t, tenantSchemas, 1)
+	require.JSONEq(t, `{"type": "array"}`, string(tenantSchemas[0].Definition))
+}
+
+func testTransactions(t *testing.T, db datastore.Store) {
+	ctx := context.Background()
+	transactor := db.(datastore.Transactor)
+
+	event := &datastore.Event{
+		ID:             primitive.NewObjectID(),
+		UID:            "some-event",
+		TenantID:       datastore.DefaultTenant,
+		Type:           datastore.CreateEvent,
+		Data:           &datastore.EventData{Key: "some-key", Value: "some-value"},
+		CreatedAt:      primitive.NewDateTimeFromTime(time.Now()),
+		UpdatedAt:      primitive.NewDateTimeFromTime(time.Now()),
+		DocumentStatus: datastore.ActiveDocumentStatus,
+	}
+
+	// a failure after both writes rolls back the answer and its event
+	err := transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := db.Answers().Create(ctx, NewAnswer("some-key", "some-value")); err != nil {
+			return err
+		}
+
+		if err := db.Events().Create(ctx, event); err != nil {
+			return err
+		}
+
+		return errors.New("failed")
+	})
+	require.EqualError(t, err, "failed")
+
+	_, err = db.Answers().FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.ErrorIs(t, err, datastore.ErrAnswerNotFound)
+
+	events, _, err := db.Events().FindManyByKey(ctx, datastore.DefaultTenant, "some-key", 0, datastore.Pageable{Page: 1, PerPage: 10})
+	require.Nil(t, err)
+	require.Empty(t, events)
+
+	err = transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := db.Answers().Create(ctx, NewAnswer("some-key", "some-value")); err != nil {
+			return err
+		}
+
+		// reads inside the transaction see its own writes
+		answer, err := db.Answers().Update(ctx, &datastore.Answer{TenantID: datastore.DefaultTenant, Key: "some-key"}, &datastore.Value{Value: "new-value"}, 0)
+		if err != nil {
+			return err
+		}
+		require.Len(t, answer.Values, 2)
+
+		return db.Events().Create(ctx, event)
+	})
+	require.Nil(t, err)
+
+	answer, err := db.Answers().FindByKey(ctx, datastore.DefaultTenant, "some-key")
+	require.Nil(t, err)
+	require.Len(t, answer.Values, 2)
+
+	events, _, err = db.Events().FindManyByKey(ctx, datastore.DefaultTenant, "some-key", 0, datastore.Pageable{Page: 1, PerPage: 10})
+	require.Nil(t, err)
+	require.Len(t, events, 1)
+}
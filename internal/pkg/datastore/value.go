@@ -0,0 +1,184 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ValueType string
+
+const (
+	StringValue  ValueType = "string"
+	NumberValue  ValueType = "number"
+	BooleanValue ValueType = "boolean"
+	ObjectValue  ValueType = "object"
+	ListValue    ValueType = "list"
+)
+
+var (
+	ErrValueRequired    = errors.New("value is required")
+	ErrInvalidValueType = errors.New("invalid value type")
+)
+
+// NewValue parses the JSON encoded raw into a Value. When declared is
+// empty the type is inferred from the JSON, otherwise both must agree.
+func NewValue(raw json.RawMessage, declared ValueType) (Value, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return Value{}, ErrValueRequired
+	}
+
+	if declared != "" && !declared.Valid() {
+		return Value{}, fmt.Errorf("%w %q", ErrInvalidValueType, declared)
+	}
+
+	v, err := ParseValue(raw)
+	if err != nil {
+		return Value{}, err
+	}
+
+	if v == nil {
+		return Value{}, ErrValueRequired
+	}
+
+	inferred := InferValueType(v)
+	if declared != "" && declared != inferred {
+		return Value{}, fmt.Errorf("%w: value is a %s, not a %s", ErrInvalidValueType, inferred, declared)
+	}
+
+	return Value{Value: v, Type: inferred}, nil
+}
+
+// ParseValue decodes JSON into the Go types values are stored as:
+// string, bool, int64 or float64, map[string]interface{} and
+// []interface{}. Integers keep their precision.
+func ParseValue(raw []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid value: %w", err)
+	}
+
+	return normalizeValue(v), nil
+}
+
+// InferValueType returns the type of a value as produced by ParseValue
+// or read back from a store, or "" for nil.
+func InferValueType(v interface{}) ValueType {
+	switch v.(type) {
+	case string:
+		return StringValue
+	case bool:
+		return BooleanValue
+	case int, int32, int64, float32, float64, json.Number:
+		return NumberValue
+	case map[string]interface{}:
+		return ObjectValue
+	case []interface{}:
+		return ListValue
+	default:
+		return ""
+	}
+}
+
+func (t ValueType) Valid() bool {
+	switch t {
+	case StringValue, NumberValue, BooleanValue, ObjectValue, ListValue:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValueType returns the type of the value. Values written before
+// types were recorded are strings.
+func (v Value) ValueType() ValueType {
+	if v.Type != "" {
+		return v.Type
+	}
+
+	if t := InferValueType(v.Value); t != "" {
+		return t
+	}
+
+	return StringValue
+}
+
+func (v *Value) UnmarshalBSON(data []byte) error {
+	type plain Value
+
+	var p plain
+	if err := bson.Unmarshal(data, &p); err != nil {
+		return err
+	}
+
+	p.Value = normalizeValue(p.Value)
+	*v = Value(p)
+
+	return nil
+}
+
+func (e *EventData) UnmarshalBSON(data []byte) error {
+	type plain EventData
+
+	var p plain
+	if err := bson.Unmarshal(data, &p); err != nil {
+		return err
+	}
+
+	p.Value = normalizeValue(p.Value)
+	*e = EventData(p)
+
+	return nil
+}
+
+// normalizeValue converts the types produced by the JSON and BSON
+// decoders to the ones produced by ParseValue, so values compare
+// and encode the same whichever store they were read from.
+func normalizeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := v.Float64()
+		return f
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case primitive.D:
+		m := make(map[string]interface{}, len(v))
+		for _, e := range v {
+			m[e.Key] = normalizeValue(e.Value)
+		}
+		return m
+	case primitive.M:
+		return normalizeValue(map[string]interface{}(v))
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = normalizeValue(e)
+		}
+		return m
+	case primitive.A:
+		return normalizeValue([]interface{}(v))
+	case []interface{}:
+		l := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			l = append(l, normalizeValue(e))
+		}
+		return l
+	default:
+		return v
+	}
+}
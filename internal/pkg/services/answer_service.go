@@ -2,10 +2,16 @@ package services
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/dotunj/bequest/internal/pkg/auth"
 	"github.com/dotunj/bequest/internal/pkg/datastore"
 	"github.com/dotunj/bequest/internal/pkg/util"
 	"github.com/google/uuid"
@@ -13,45 +19,138 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	ErrDeletedAnswerNotFound = errors.New("no deleted answer with this key")
+	ErrActiveAnswerExists    = errors.New("an active answer with this key already exists, delete it to restore the deleted one")
+	ErrAnswerExists          = errors.New("an active answer with this key already exists")
+	ErrInvalidAnswerStatus   = errors.New("status must be active or deleted")
+	ErrInvalidExpiry         = errors.New("either a positive ttl or an expires_at in the future can be set")
+	ErrInvalidAnswerSort     = errors.New("sort must be key, created_at or updated_at, prefixed with - to sort in descending order")
+	ErrInvalidCursor         = errors.New("cursor is invalid or was returned by a listing with another status or sort")
+	ErrInvalidPerPage        = fmt.Errorf("perPage must be between 1 and %d", maxPerPage)
+	ErrSearchTextRequired    = errors.New("q must contain at least one word to search for")
+	ErrInvalidBatchSize      = fmt.Errorf("a batch must hold between 1 and %d operations", maxBatchSize)
+	ErrInvalidBatchOperation = errors.New("op must be create, update or delete")
+	ErrKeyRequired           = errors.New("key is required")
+	ErrAtomicBatchRequiresTx = errors.New("atomic batches need a store with transactions")
+	ErrOverwriteRequiresTx   = errors.New("overwriting imports need a store with transactions")
+	ErrBatchRolledBack       = errors.New("not applied, another operation of the atomic batch failed")
+)
+
+const (
+	// expiryBatchSize bounds the number of answers expired at once.
+	expiryBatchSize = 100
+
+	// defaultPerPage and maxPerPage bound the pages of answers listed.
+	defaultPerPage = 20
+	maxPerPage     = 100
+
+	// maxBatchSize bounds the number of operations of a batch.
+	maxBatchSize = 1000
+
+	// maxSearchResults bounds the answers a search ranks, so that
+	// its cost doesn't grow with the number of answers found.
+	maxSearchResults = 1000
+)
+
 type AnswerService struct {
-	answerRepo   datastore.AnswerRepository
-	eventService *EventService
+	answerRepo    datastore.AnswerRepository
+	schemaService *SchemaService
+	dispatcher    *OutboxDispatcher
+	transactor    datastore.Transactor
 }
 
-func NewAnswerService(answerRepo datastore.AnswerRepository, eventService *EventService) *AnswerService {
+// NewAnswerService creates an AnswerService. transactor may be nil for
+// stores without transactions, every mutation is still written along
+// with its outbox message in a single write.
+func NewAnswerService(answerRepo datastore.AnswerRepository, schemaService *SchemaService, dispatcher *OutboxDispatcher, transactor datastore.Transactor) *AnswerService {
 	return &AnswerService{
-		answerRepo:   answerRepo,
-		eventService: eventService,
+		answerRepo:    answerRepo,
+		schemaService: schemaService,
+		dispatcher:    dispatcher,
+		transactor:    transactor,
 	}
 }
 
-func (a *AnswerService) CreateAnswer(ctx context.Context, req *datastore.CreateAnswer) (*datastore.Answer, error) {
+func (a *AnswerService) CreateAnswer(ctx context.Context, tenantID string, req *datastore.CreateAnswer) (*datastore.Answer, error) {
+	value, err := datastore.NewValue(req.Value, req.Type)
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusBadRequest, err)
+	}
+
+	if err := a.schemaService.Validate(ctx, tenantID, req.Key, value); err != nil {
+		return nil, err
+	}
+
+	expiresAt, err := expiry(req.Expiry, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	value.Version = 1
+	value.Author = auth.Actor(ctx)
+	value.CreatedAt = now
+
 	answer := &datastore.Answer{
 		ID:             primitive.NewObjectID(),
 		UID:            uuid.NewString(),
+		TenantID:       tenantID,
 		Key:            req.Key,
-		Values:         []datastore.Value{{Value: req.Value}},
-		CreatedAt:      primitive.NewDateTimeFromTime(time.Now()),
-		UpdatedAt:      primitive.NewDateTimeFromTime(time.Now()),
+		Values:         []datastore.Value{value},
+		Version:        1,
+		CreatedAt:      now,
+		UpdatedAt:      now,
 		DocumentStatus: datastore.ActiveDocumentStatus,
+		ExpiresAt:      expiresAt,
 	}
 
-	err := a.answerRepo.Create(ctx, answer)
-	if err != nil {
-		statusCode := http.StatusInternalServerError
-		if errors.Is(err, datastore.ErrDuplicateKey) {
-			statusCode = http.StatusForbidden
-		}
-		return nil, util.NewServiceError(statusCode, err)
+	// an expired answer the reaper hasn't deleted yet
+	// doesn't keep the key from being created again
+	created, err := a.create(ctx, answer, value, datastore.CreateEvent)
+	if hasErrCode(err, http.StatusForbidden) && a.expireStale(ctx, tenantID, req.Key) {
+		created, err = a.create(ctx, answer, value, datastore.CreateEvent)
 	}
 
-	go a.broadcastEvent(answer, datastore.CreateEvent)
+	return created, err
+}
 
-	return answer, nil
+// create writes answer as the next generation of its key,
+// recording an event of eventType with value.
+func (a *AnswerService) create(ctx context.Context, answer *datastore.Answer, value datastore.Value, eventType datastore.EventType) (*datastore.Answer, error) {
+	return a.mutate(ctx, func(ctx context.Context) (*datastore.Answer, error) {
+		// deleted answers of the key keep their generation, as do
+		// purged ones, the new answer comes after the latest of them
+		generation, err := a.answerRepo.LastGeneration(ctx, answer.TenantID, answer.Key)
+		if err != nil {
+			return nil, util.NewServiceError(http.StatusInternalServerError, err)
+		}
+
+		answer.Generation = generation + 1
+
+		answer.Outbox = newOutbox(ctx, eventType, answer, value)
+
+		err = a.answerRepo.Create(ctx, answer)
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+			if errors.Is(err, datastore.ErrDuplicateKey) {
+				statusCode = http.StatusForbidden
+			}
+			return nil, util.NewServiceError(statusCode, err)
+		}
+
+		return answer, nil
+	})
 }
 
-func (a *AnswerService) FindAnswerByKey(ctx context.Context, key string) (*datastore.Answer, error) {
-	answer, err := a.answerRepo.FindByKey(ctx, key)
+// FindAnswerByKey returns the active answer of key, answers
+// whose expiry has passed are not found.
+func (a *AnswerService) FindAnswerByKey(ctx context.Context, tenantID, key string) (*datastore.Answer, error) {
+	answer, err := a.answerRepo.FindByKey(ctx, tenantID, key)
+	if err == nil && answer.Expired(time.Now()) {
+		err = datastore.ErrAnswerNotFound
+	}
+
 	if err != nil {
 		statusCode := http.StatusInternalServerError
 		if errors.Is(err, datastore.ErrAnswerNotFound) {
@@ -63,44 +162,821 @@ func (a *AnswerService) FindAnswerByKey(ctx context.Context, key string) (*datas
 	return answer, nil
 }
 
-func (a *AnswerService) UpdateAnswer(ctx context.Context, key string, req *datastore.UpdateAnswer) (*datastore.Answer, error) {
-	value := &datastore.Value{Value: req.Value}
+// FindAnswerAt returns the answer of key as it was at t, with the
+// value it had then. It fails with a 404 when the answer didn't exist
+// yet, values of previously deleted answers are never returned.
+func (a *AnswerService) FindAnswerAt(ctx context.Context, tenantID, key string, t time.Time) (*datastore.Answer, error) {
+	answer, err := a.FindAnswerByKey(ctx, tenantID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	past, ok := answer.At(t)
+	if !ok {
+		return nil, util.NewServiceError(http.StatusNotFound, fmt.Errorf("%w at %s", datastore.ErrAnswerNotFound, t.Format(time.RFC3339)))
+	}
+
+	return past, nil
+}
+
+// FindAnswerVersions returns a page of the versions of the value of
+// the answer of key, newest first unless pageable sorts ascending.
+func (a *AnswerService) FindAnswerVersions(ctx context.Context, tenantID, key string, pageable datastore.Pageable) ([]datastore.Value, datastore.PaginationData, error) {
+	if err := pageable.Validate(); err != nil {
+		return nil, datastore.PaginationData{}, util.NewServiceError(http.StatusBadRequest, err)
+	}
+
+	answer, err := a.FindAnswerByKey(ctx, tenantID, key)
+	if err != nil {
+		return nil, datastore.PaginationData{}, err
+	}
+
+	versions := answer.Versions()
+	if pageable.Sort < 0 {
+		for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+			versions[i], versions[j] = versions[j], versions[i]
+		}
+	}
+
+	start, end := pageable.Window(len(versions))
+	return versions[start:end], datastore.NewPaginationData(int64(len(versions)), pageable), nil
+}
+
+// FindAnswerVersion returns the answer of key as it was at version.
+// It fails with a 404 when the answer never had that version.
+func (a *AnswerService) FindAnswerVersion(ctx context.Context, tenantID, key string, version int64) (*datastore.Answer, error) {
+	answer, err := a.FindAnswerByKey(ctx, tenantID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	past, ok := answer.AtVersion(version)
+	if !ok {
+		return nil, util.NewServiceError(http.StatusNotFound, fmt.Errorf("%w at version %d", datastore.ErrAnswerNotFound, version))
+	}
+
+	return past, nil
+}
+
+// UpdateAnswer appends a value to the answer of key, keeping its
+// expiry unless req sets one or removes it. When ifMatch holds entity
+// tags, the answer is only updated if it is still at one of them, it
+// fails with a 412 otherwise.
+func (a *AnswerService) UpdateAnswer(ctx context.Context, tenantID, key string, req *datastore.UpdateAnswer, ifMatch []string) (*datastore.Answer, error) {
+	value, err := datastore.NewValue(req.Value, req.Type)
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusBadRequest, err)
+	}
+
+	if err := a.schemaService.Validate(ctx, tenantID, key, value); err != nil {
+		return nil, err
+	}
 
-	answer, err := a.FindAnswerByKey(ctx, key)
+	expiresAt, err := expiry(req.Expiry, time.Now())
 	if err != nil {
 		return nil, err
 	}
 
-	answer, err = a.answerRepo.Update(ctx, answer, value)
+	if req.Persist && expiresAt != 0 {
+		return nil, util.NewServiceError(http.StatusBadRequest, errors.New("persist can't be set along with an expiry"))
+	}
+
+	value.Author = auth.Actor(ctx)
+	value.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+	return a.mutate(ctx, func(ctx context.Context) (*datastore.Answer, error) {
+		answer, err := a.FindAnswerByKey(ctx, tenantID, key)
+		if err != nil {
+			return nil, err
+		}
+
+		version, err := matchVersion(answer, ifMatch)
+		if err != nil {
+			return nil, err
+		}
+
+		if expiresAt != 0 || req.Persist {
+			answer.ExpiresAt = expiresAt
+		}
+
+		answer.Outbox = newOutbox(ctx, datastore.UpdateEvent, answer, value)
+
+		answer, err = a.answerRepo.Update(ctx, answer, &value, version)
+		if err != nil {
+			return nil, writeError(err)
+		}
+
+		return answer, nil
+	})
+}
+
+// DeleteAnswer soft deletes the answer of key, under the
+// same condition as UpdateAnswer when ifMatch isn't empty.
+func (a *AnswerService) DeleteAnswer(ctx context.Context, tenantID, key string, ifMatch []string) error {
+	_, err := a.mutate(ctx, func(ctx context.Context) (*datastore.Answer, error) {
+		answer, err := a.FindAnswerByKey(ctx, tenantID, key)
+		if err != nil {
+			return nil, err
+		}
+
+		version, err := matchVersion(answer, ifMatch)
+		if err != nil {
+			return nil, err
+		}
+
+		answer.Outbox = newOutbox(ctx, datastore.DeleteEvent, answer, answer.Values[len(answer.Values)-1])
+
+		err = a.answerRepo.Delete(ctx, answer, version)
+		if err != nil {
+			return nil, writeError(err)
+		}
+
+		return answer, nil
+	})
+
+	return err
+}
+
+// RestoreAnswer makes the most recently deleted answer of key
+// active again, with the values it had when it was deleted and
+// without an expiry. It fails with a 409 when another answer of
+// key is active.
+func (a *AnswerService) RestoreAnswer(ctx context.Context, tenantID, key string) (*datastore.Answer, error) {
+	restored, err := a.restore(ctx, tenantID, key)
+	if hasErrCode(err, http.StatusConflict) && a.expireStale(ctx, tenantID, key) {
+		restored, err = a.restore(ctx, tenantID, key)
+	}
+
+	return restored, err
+}
+
+func (a *AnswerService) restore(ctx context.Context, tenantID, key string) (*datastore.Answer, error) {
+	return a.mutate(ctx, func(ctx context.Context) (*datastore.Answer, error) {
+		deleted, err := a.answerRepo.FindDeleted(ctx, tenantID, key)
+		if err != nil {
+			return nil, util.NewServiceError(http.StatusInternalServerError, err)
+		}
+
+		if len(deleted) == 0 {
+			return nil, util.NewServiceError(http.StatusNotFound, ErrDeletedAnswerNotFound)
+		}
+
+		answer := &deleted[0]
+		answer.Outbox = newOutbox(ctx, datastore.RestoreEvent, answer, answer.Values[len(answer.Values)-1])
+
+		err = a.answerRepo.Restore(ctx, answer)
+		switch {
+		case errors.Is(err, datastore.ErrDuplicateKey):
+			return nil, util.NewServiceError(http.StatusConflict, ErrActiveAnswerExists)
+		case errors.Is(err, datastore.ErrAnswerNotFound):
+			// restored by another request in between
+			return nil, util.NewServiceError(http.StatusNotFound, ErrDeletedAnswerNotFound)
+		case err != nil:
+			return nil, util.NewServiceError(http.StatusInternalServerError, err)
+		}
+
+		answer.DocumentStatus = datastore.ActiveDocumentStatus
+		answer.DeletedAt = 0
+		answer.ExpiresAt = 0
+
+		return answer, nil
+	})
+}
+
+// ImportAnswer writes answer, whose values and times are kept as they are,
+// as the next generation of its key, recording it with an import event.
+// When the key has an active answer, it fails with a 409 unless overwrite
+// is set, that answer is then deleted first, in the same transaction, so
+// overwrite fails with a 501 on stores without transactions. It reports
+// whether an answer was overwritten.
+//
+// Every value is validated before anything is written. imported, unless
+// nil, is run once the answer is written, within the same transaction on
+// stores with transactions, to write the rest of what was imported along
+// with it. It should only fail when the store does.
+func (a *AnswerService) ImportAnswer(ctx context.Context, answer *datastore.Answer, overwrite bool, imported func(ctx context.Context, answer *datastore.Answer) error) (bool, error) {
+	if overwrite && a.transactor == nil {
+		return false, util.NewServiceError(http.StatusNotImplemented, ErrOverwriteRequiresTx)
+	}
+
+	if err := a.schemaService.Validate(ctx, answer.TenantID, answer.Key, answer.Values...); err != nil {
+		return false, err
+	}
+
+	existing, err := a.answerRepo.FindByKey(ctx, answer.TenantID, answer.Key)
+	switch {
+	case errors.Is(err, datastore.ErrAnswerNotFound):
+		existing = nil
+	case err != nil:
+		return false, util.NewServiceError(http.StatusInternalServerError, err)
+	case existing.Expired(time.Now()):
+		// an expired answer the reaper hasn't deleted yet isn't a conflict
+		if err := a.expire(ctx, existing); err != nil && !hasErrCode(err, http.StatusPreconditionFailed) {
+			return false, err
+		}
+		existing = nil
+	case !overwrite:
+		return false, util.NewServiceError(http.StatusConflict, ErrAnswerExists)
+	}
+
+	_, err = a.mutate(ctx, func(ctx context.Context) (*datastore.Answer, error) {
+		// the answer is only deleted if it is still the one read
+		if existing != nil {
+			if err := a.DeleteAnswer(ctx, answer.TenantID, answer.Key, []string{existing.ETag()}); err != nil {
+				return nil, err
+			}
+		}
+
+		created, err := a.create(ctx, answer, answer.Values[len(answer.Values)-1], datastore.ImportEvent)
+		if err != nil {
+			return nil, err
+		}
+
+		if imported != nil {
+			if err := imported(ctx, created); err != nil {
+				return nil, err
+			}
+		}
+
+		return created, nil
+	})
 	if err != nil {
+		return false, err
+	}
+
+	return existing != nil, nil
+}
+
+// BatchOutcome is the outcome of an operation of a batch, Answer being
+// the answer it wrote, nil for deletes, unless it failed with Err.
+type BatchOutcome struct {
+	Answer *datastore.Answer
+	Err    error
+}
+
+// ExecuteBatch applies the operations of req in order, each as the
+// request it stands for would, recording an event per mutation, and
+// returns their outcomes in the same order. Operations on keys that
+// authorized rejects fail with a 403.
+//
+// An operation failing doesn't keep the next ones from being applied,
+// unless req is atomic: the batch is then applied in a single
+// transaction, rolled back as soon as an operation fails, and every
+// other operation fails with a 424.
+func (a *AnswerService) ExecuteBatch(ctx context.Context, tenantID string, req *datastore.BatchRequest, authorized func(key string) bool) ([]BatchOutcome, error) {
+	if len(req.Operations) == 0 || len(req.Operations) > maxBatchSize {
+		return nil, util.NewServiceError(http.StatusBadRequest, ErrInvalidBatchSize)
+	}
+
+	outcomes := make([]BatchOutcome, len(req.Operations))
+
+	if !req.Atomic {
+		for i := range req.Operations {
+			outcomes[i].Answer, outcomes[i].Err = a.applyOperation(ctx, tenantID, &req.Operations[i], authorized)
+		}
+
+		return outcomes, nil
+	}
+
+	if a.transactor == nil {
+		return nil, util.NewServiceError(http.StatusNotImplemented, ErrAtomicBatchRequiresTx)
+	}
+
+	failed := -1
+	err := a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		// the transaction may be retried from the start
+		failed = -1
+
+		for i := range req.Operations {
+			answer, err := a.applyOperation(ctx, tenantID, &req.Operations[i], authorized)
+			outcomes[i] = BatchOutcome{Answer: answer, Err: err}
+
+			if err != nil {
+				failed = i
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil && failed < 0 {
+		// every operation succeeded, committing failed
 		return nil, util.NewServiceError(http.StatusInternalServerError, err)
 	}
 
-	go a.broadcastEvent(answer, datastore.UpdateEvent)
-	return answer, nil
+	if err != nil {
+		rolledBack := util.NewServiceError(http.StatusFailedDependency, ErrBatchRolledBack)
+		for i := range outcomes {
+			if i != failed {
+				outcomes[i] = BatchOutcome{Err: rolledBack}
+			}
+		}
+
+		return outcomes, nil
+	}
+
+	// the dispatcher was woken up by each mutation, before
+	// their outbox messages could be read
+	a.dispatcher.Notify()
+
+	return outcomes, nil
 }
 
-func (a *AnswerService) DeleteAnswer(ctx context.Context, key string) error {
-	answer, err := a.FindAnswerByKey(ctx, key)
+// applyOperation applies op as CreateAnswer, UpdateAnswer
+// or DeleteAnswer would, once its key is authorized.
+func (a *AnswerService) applyOperation(ctx context.Context, tenantID string, op *datastore.BatchOperation, authorized func(key string) bool) (*datastore.Answer, error) {
+	if op.Key == "" {
+		return nil, util.NewServiceError(http.StatusBadRequest, ErrKeyRequired)
+	}
+
+	if !authorized(op.Key) {
+		return nil, util.NewServiceError(http.StatusForbidden, fmt.Errorf("the %s role is required on this key", datastore.WriterRole))
+	}
+
+	var ifMatch []string
+	if op.IfMatch != "" {
+		ifMatch = []string{op.IfMatch}
+	}
+
+	switch op.Op {
+	case datastore.CreateBatchOperation:
+		return a.CreateAnswer(ctx, tenantID, &datastore.CreateAnswer{
+			Key:    op.Key,
+			Value:  op.Value,
+			Type:   op.Type,
+			Expiry: op.Expiry,
+		})
+	case datastore.UpdateBatchOperation:
+		return a.UpdateAnswer(ctx, tenantID, op.Key, &datastore.UpdateAnswer{
+			Value:   op.Value,
+			Type:    op.Type,
+			Persist: op.Persist,
+			Expiry:  op.Expiry,
+		}, ifMatch)
+	case datastore.DeleteBatchOperation:
+		return nil, a.DeleteAnswer(ctx, tenantID, op.Key, ifMatch)
+	default:
+		return nil, util.NewServiceError(http.StatusBadRequest, ErrInvalidBatchOperation)
+	}
+}
+
+// FindAnswers returns a page of the answers of the tenant selected by
+// query, leaving out those whose key authorized rejects, along with
+// the cursor of the next page. Active answers that have expired are
+// left out too.
+func (a *AnswerService) FindAnswers(ctx context.Context, tenantID string, query *datastore.AnswerQuery, authorized func(key string) bool) ([]datastore.Answer, datastore.CursorData, error) {
+	filter, err := answerFilter(query, time.Now())
 	if err != nil {
-		return err
+		return nil, datastore.CursorData{}, err
 	}
 
-	err = a.answerRepo.Delete(ctx, answer)
+	perPage := query.PerPage
+	if perPage == 0 {
+		perPage = defaultPerPage
+	}
 
+	if perPage < 0 || perPage > maxPerPage {
+		return nil, datastore.CursorData{}, util.NewServiceError(http.StatusBadRequest, ErrInvalidPerPage)
+	}
+
+	// reading one answer past the page tells whether it is the last,
+	// and more are read as long as answers are left out
+	filter.Limit = perPage + 1
+
+	answers := make([]datastore.Answer, 0, filter.Limit)
+	for len(answers) < filter.Limit {
+		found, err := a.answerRepo.FindMany(ctx, tenantID, filter)
+		if err != nil {
+			return nil, datastore.CursorData{}, util.NewServiceError(http.StatusInternalServerError, err)
+		}
+
+		for i := range found {
+			if authorized(found[i].Key) {
+				answers = append(answers, found[i])
+			}
+		}
+
+		if len(found) < filter.Limit {
+			break
+		}
+
+		filter.After = datastore.NewAnswerCursor(&found[len(found)-1], filter.SortBy)
+	}
+
+	cursor := datastore.CursorData{PerPage: int64(perPage)}
+	if len(answers) <= perPage {
+		return answers, cursor, nil
+	}
+
+	answers = answers[:perPage]
+
+	cursor.Next, err = encodeCursor(query, filter, &answers[perPage-1])
 	if err != nil {
-		return util.NewServiceError(http.StatusInternalServerError, err)
+		return nil, datastore.CursorData{}, util.NewServiceError(http.StatusInternalServerError, err)
 	}
 
-	go a.broadcastEvent(answer, datastore.DeleteEvent)
-	return nil
+	return answers, cursor, nil
 }
 
-func (a *AnswerService) broadcastEvent(answer *datastore.Answer, eventType datastore.EventType) {
-	ev := &datastore.AnswerEvent{Answer: answer, Type: eventType}
-	_, err := a.eventService.CreateEvent(context.Background(), ev)
+// SearchAnswers returns a page of the answers of the tenant mentioning
+// the words of query, most relevant first, leaving out those whose key
+// authorized rejects. When a historical value is searched for too, the
+// most recent value mentioning the words is returned. Only the
+// maxSearchResults most relevant answers are ranked.
+func (a *AnswerService) SearchAnswers(ctx context.Context, tenantID string, query *datastore.SearchQuery, pageable datastore.Pageable, authorized func(key string) bool) ([]datastore.SearchResult, datastore.PaginationData, error) {
+	terms := datastore.SearchTerms(query.Text)
+	if len(terms) == 0 {
+		return nil, datastore.PaginationData{}, util.NewServiceError(http.StatusBadRequest, ErrSearchTextRequired)
+	}
+
+	if err := pageable.Validate(); err != nil {
+		return nil, datastore.PaginationData{}, util.NewServiceError(http.StatusBadRequest, err)
+	}
+
+	found, err := a.answerRepo.Search(ctx, tenantID, terms, maxSearchResults)
 	if err != nil {
-		logrus.WithError(err).Errorf("failed to create event")
+		return nil, datastore.PaginationData{}, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	now := time.Now()
+
+	// the store ranks answers by all their values, the ones
+	// only mentioning the words in the past are left out here
+	results := make([]datastore.SearchResult, 0, len(found))
+	for i := range found {
+		answer := &found[i].Answer
+		if answer.Expired(now) || !authorized(answer.Key) {
+			continue
+		}
+
+		if result, ok := searchResult(answer, terms, query.History); ok {
+			result.Score = found[i].Score
+			results = append(results, result)
+		}
+	}
+
+	start, end := pageable.Window(len(results))
+	return results[start:end], datastore.NewPaginationData(int64(len(results)), pageable), nil
+}
+
+// ExpireAnswers deletes the answers of every tenant whose expiry has
+// passed, recording an expire event for each, and returns how many
+// were expired. Answers updated in the meantime are left alone.
+func (a *AnswerService) ExpireAnswers(ctx context.Context) (int, error) {
+	expired := 0
+
+	for {
+		answers, err := a.answerRepo.FindExpired(ctx, primitive.NewDateTimeFromTime(time.Now()), expiryBatchSize)
+		if err != nil {
+			return expired, util.NewServiceError(http.StatusInternalServerError, err)
+		}
+
+		for i := range answers {
+			err := a.expire(ctx, &answers[i])
+			if hasErrCode(err, http.StatusPreconditionFailed) {
+				continue
+			}
+
+			if err != nil {
+				return expired, err
+			}
+
+			expired++
+		}
+
+		if len(answers) < expiryBatchSize {
+			return expired, nil
+		}
+	}
+}
+
+// Reap expires answers every interval, until ctx is cancelled.
+func (a *AnswerService) Reap(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		expired, err := a.ExpireAnswers(ctx)
+		if err != nil {
+			logrus.WithError(err).Error("failed to expire answers")
+		}
+
+		if expired > 0 {
+			logrus.WithField("answers", expired).Info("expired answers")
+		}
+	}
+}
+
+// expire deletes answer, provided it is still at the version it was
+// read at, and records an expire event.
+func (a *AnswerService) expire(ctx context.Context, answer *datastore.Answer) error {
+	_, err := a.mutate(ctx, func(ctx context.Context) (*datastore.Answer, error) {
+		answer.Outbox = newOutbox(ctx, datastore.ExpireEvent, answer, answer.Values[len(answer.Values)-1])
+
+		if err := a.answerRepo.Delete(ctx, answer, answer.Version); err != nil {
+			return nil, writeError(err)
+		}
+
+		return answer, nil
+	})
+
+	return err
+}
+
+// expireStale expires the active answer of key if its expiry has
+// passed, reporting whether it is gone, so that the write it got in
+// the way of can be retried.
+func (a *AnswerService) expireStale(ctx context.Context, tenantID, key string) bool {
+	answer, err := a.answerRepo.FindByKey(ctx, tenantID, key)
+	if err != nil || !answer.Expired(time.Now()) {
+		return false
+	}
+
+	err = a.expire(ctx, answer)
+	return err == nil || hasErrCode(err, http.StatusPreconditionFailed)
+}
+
+// expiry returns when an answer written at now with e expires,
+// or zero when e doesn't set an expiry.
+func expiry(e datastore.Expiry, now time.Time) (primitive.DateTime, error) {
+	switch {
+	case e.TTL == 0 && e.ExpiresAt == nil:
+		return 0, nil
+	case e.TTL > 0 && e.ExpiresAt == nil:
+		return primitive.NewDateTimeFromTime(now.Add(time.Duration(e.TTL) * time.Second)), nil
+	case e.TTL == 0 && e.ExpiresAt.After(now):
+		return primitive.NewDateTimeFromTime(*e.ExpiresAt), nil
+	default:
+		return 0, util.NewServiceError(http.StatusBadRequest, ErrInvalidExpiry)
+	}
+}
+
+// hasErrCode reports whether err is a service error with code.
+func hasErrCode(err error, code int) bool {
+	var serviceErr *util.ServiceError
+	return errors.As(err, &serviceErr) && serviceErr.ErrCode() == code
+}
+
+// rollbackAttempts bounds the retries of a rollback racing with
+// other writes, when the caller didn't make it conditional.
+const rollbackAttempts = 3
+
+// RollbackAnswer appends a value equal to the one the answer of key had
+// at the version selected by req, under the same condition as
+// UpdateAnswer when ifMatch isn't empty.
+func (a *AnswerService) RollbackAnswer(ctx context.Context, tenantID, key string, req *datastore.RollbackAnswer, ifMatch []string) (*datastore.Answer, error) {
+	if (req.Version == 0) == (req.At == nil) {
+		return nil, util.NewServiceError(http.StatusBadRequest, errors.New("either a version or a time to roll back to is required"))
+	}
+
+	for attempt := 1; ; attempt++ {
+		answer, err := a.rollback(ctx, tenantID, key, req, ifMatch)
+
+		// the version written is recorded in the rollback event, so
+		// the write is always conditional, and retried when another
+		// one got in between unless the caller set the condition
+		var serviceErr *util.ServiceError
+		if err != nil && len(ifMatch) == 0 && attempt < rollbackAttempts &&
+			errors.As(err, &serviceErr) && serviceErr.ErrCode() == http.StatusPreconditionFailed {
+			continue
+		}
+
+		return answer, err
+	}
+}
+
+func (a *AnswerService) rollback(ctx context.Context, tenantID, key string, req *datastore.RollbackAnswer, ifMatch []string) (*datastore.Answer, error) {
+	return a.mutate(ctx, func(ctx context.Context) (*datastore.Answer, error) {
+		answer, err := a.FindAnswerByKey(ctx, tenantID, key)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := matchVersion(answer, ifMatch); err != nil {
+			return nil, err
+		}
+
+		var source *datastore.Answer
+		var ok bool
+		if req.At != nil {
+			source, ok = answer.At(*req.At)
+		} else {
+			source, ok = answer.AtVersion(req.Version)
+		}
+
+		if !ok {
+			return nil, util.NewServiceError(http.StatusNotFound, errors.New("the version to roll back to doesn't exist"))
+		}
+
+		value := source.Values[len(source.Values)-1]
+		value.Version = 0
+		value.Author = auth.Actor(ctx)
+		value.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+		if err := a.schemaService.Validate(ctx, tenantID, key, value); err != nil {
+			return nil, err
+		}
+
+		answer.Outbox = newOutbox(ctx, datastore.RollbackEvent, answer, value)
+		answer.Outbox[0].Event.Data.Version = answer.Version + 1
+		answer.Outbox[0].Event.Data.SourceVersion = source.Version
+
+		answer, err = a.answerRepo.Update(ctx, answer, &value, answer.Version)
+		if err != nil {
+			return nil, writeError(err)
+		}
+
+		return answer, nil
+	})
+}
+
+// matchVersion returns the version the answer must still be at when
+// it is written, or zero when ifMatch doesn't restrict it. The match
+// found here is checked again by the repository, atomically with the
+// write, in case the answer changes in between.
+func matchVersion(answer *datastore.Answer, ifMatch []string) (int64, error) {
+	if len(ifMatch) == 0 {
+		return 0, nil
+	}
+
+	for _, tag := range ifMatch {
+		if tag == "*" {
+			return 0, nil
+		}
+
+		if tag == answer.ETag() {
+			return answer.Version, nil
+		}
+	}
+
+	return 0, util.NewServiceError(http.StatusPreconditionFailed, datastore.ErrVersionMismatch)
+}
+
+// writeError maps the errors of conditional writes to a 412.
+func writeError(err error) error {
+	if errors.Is(err, datastore.ErrVersionMismatch) {
+		return util.NewServiceError(http.StatusPreconditionFailed, err)
+	}
+
+	return util.NewServiceError(http.StatusInternalServerError, err)
+}
+
+// mutate applies fn, which writes an answer along with the outbox
+// message recording the change, then wakes the dispatcher up to
+// deliver it. With a transactor fn runs in a single transaction.
+func (a *AnswerService) mutate(ctx context.Context, fn func(ctx context.Context) (*datastore.Answer, error)) (*datastore.Answer, error) {
+	var answer *datastore.Answer
+	var err error
+
+	if a.transactor == nil {
+		answer, err = fn(ctx)
+	} else {
+		err = a.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			answer, err = fn(ctx)
+			return err
+		})
+	}
+
+	if err != nil {
+		var serviceErr *util.ServiceError
+		if !errors.As(err, &serviceErr) {
+			err = util.NewServiceError(http.StatusInternalServerError, err)
+		}
+		return nil, err
+	}
+
+	answer.Outbox = nil
+	a.dispatcher.Notify()
+
+	return answer, nil
+}
+
+// searchResult describes the current value of answer when it mentions
+// terms, or its most recent value that does when history is set.
+func searchResult(answer *datastore.Answer, terms []string, history bool) (datastore.SearchResult, bool) {
+	for i := len(answer.Values) - 1; i >= 0; i-- {
+		current := i == len(answer.Values)-1
+		if !current && !history {
+			break
+		}
+
+		value := answer.Values[i]
+
+		match, ok := datastore.MatchText(value.Value, terms)
+		if !ok {
+			continue
+		}
+
+		return datastore.SearchResult{
+			UID:        answer.UID,
+			Key:        answer.Key,
+			Generation: answer.Generation,
+			Version:    value.Version,
+			Current:    current,
+			Value:      value.Value,
+			Type:       value.ValueType(),
+			Highlight:  match.Highlight,
+			UpdatedAt:  answer.UpdatedAt,
+		}, true
+	}
+
+	return datastore.SearchResult{}, false
+}
+
+// listCursor is the position of the last answer of a page, along with
+// the status and sort of the listing, so that a cursor can't continue
+// another listing.
+type listCursor struct {
+	Status datastore.DocumentStatus `json:"status"`
+	Sort   string                   `json:"sort"`
+	datastore.AnswerCursor
+}
+
+// answerFilter returns the filter selecting the answers query lists,
+// with the active ones that have expired at now left out.
+func answerFilter(query *datastore.AnswerQuery, now time.Time) (datastore.AnswerFilter, error) {
+	filter := datastore.AnswerFilter{
+		Prefix: query.Prefix,
+		Regex:  query.Regex,
+	}
+
+	switch strings.ToLower(query.Status) {
+	case "", "active":
+		filter.Status = datastore.ActiveDocumentStatus
+		filter.ExpiresAfter = primitive.NewDateTimeFromTime(now)
+	case "deleted":
+		filter.Status = datastore.DeletedDocumentStatus
+	default:
+		return filter, util.NewServiceError(http.StatusBadRequest, ErrInvalidAnswerStatus)
+	}
+
+	if filter.Regex != "" {
+		if _, err := regexp.Compile(filter.Regex); err != nil {
+			return filter, util.NewServiceError(http.StatusBadRequest, fmt.Errorf("regex is invalid: %w", err))
+		}
+	}
+
+	if !query.UpdatedSince.IsZero() {
+		filter.UpdatedSince = primitive.NewDateTimeFromTime(query.UpdatedSince)
+	}
+
+	if !query.CreatedBefore.IsZero() {
+		filter.CreatedBefore = primitive.NewDateTimeFromTime(query.CreatedBefore)
+	}
+
+	sort := listSort(query)
+	filter.Descending = strings.HasPrefix(sort, "-")
+	filter.SortBy = datastore.AnswerSort(strings.TrimPrefix(sort, "-"))
+
+	if !filter.SortBy.IsValid() {
+		return filter, util.NewServiceError(http.StatusBadRequest, ErrInvalidAnswerSort)
+	}
+
+	if query.Cursor == "" {
+		return filter, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+	if err != nil {
+		return filter, util.NewServiceError(http.StatusBadRequest, ErrInvalidCursor)
+	}
+
+	var cursor listCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.Status != filter.Status || cursor.Sort != sort {
+		return filter, util.NewServiceError(http.StatusBadRequest, ErrInvalidCursor)
+	}
+
+	filter.After = &cursor.AnswerCursor
+	return filter, nil
+}
+
+// encodeCursor returns the cursor continuing the listing
+// of query after answer, as an opaque string.
+func encodeCursor(query *datastore.AnswerQuery, filter datastore.AnswerFilter, answer *datastore.Answer) (string, error) {
+	raw, err := json.Marshal(listCursor{
+		Status:       filter.Status,
+		Sort:         listSort(query),
+		AnswerCursor: *datastore.NewAnswerCursor(answer, filter.SortBy),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func listSort(query *datastore.AnswerQuery) string {
+	if query.Sort == "" {
+		return string(datastore.KeyAnswerSort)
 	}
 
+	return query.Sort
 }
@@ -2,34 +2,91 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"sync"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/dotunj/bequest/internal/pkg/auth"
 	"github.com/dotunj/bequest/internal/pkg/datastore"
 	"github.com/dotunj/bequest/internal/pkg/datastore/mocks"
 	"github.com/dotunj/bequest/internal/pkg/util"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func provideAnswerService(ctrl *gomock.Controller) *AnswerService {
 	answerRepo := mocks.NewMockAnswerRepository(ctrl)
-	eventRepo := mocks.NewMockEventRepository(ctrl)
-	eventService := NewEventService(answerRepo, eventRepo)
-	answerService := NewAnswerService(answerRepo, eventService)
+	schemaService := NewSchemaService(mocks.NewMockSchemaRepository(ctrl), answerRepo, nil)
+	dispatcher := NewOutboxDispatcher(mocks.NewMockOutboxRepository(ctrl), mocks.NewMockEventRepository(ctrl), OutboxOptions{})
+	answerService := NewAnswerService(answerRepo, schemaService, dispatcher, nil)
 
 	return answerService
 }
 
+func provideTransactionalAnswerService(ctrl *gomock.Controller) *AnswerService {
+	answerRepo := mocks.NewMockAnswerRepository(ctrl)
+	schemaService := NewSchemaService(mocks.NewMockSchemaRepository(ctrl), answerRepo, nil)
+	dispatcher := NewOutboxDispatcher(mocks.NewMockOutboxRepository(ctrl), mocks.NewMockEventRepository(ctrl), OutboxOptions{})
+	answerService := NewAnswerService(answerRepo, schemaService, dispatcher, mocks.NewMockTransactor(ctrl))
+
+	return answerService
+}
+
+// expectSchemas makes schemas the active ones
+// answer values are validated against.
+func expectSchemas(a *AnswerService, schemas ...datastore.Schema) {
+	schemaRepo, _ := a.schemaService.schemaRepo.(*mocks.MockSchemaRepository)
+
+	schemaRepo.EXPECT().FindActive(gomock.Any(), datastore.DefaultTenant).Return(schemas, nil)
+}
+
+// outboxMatcher matches an answer written along with a single
+// pending outbox message recording an event of eventType.
+type outboxMatcher struct {
+	eventType datastore.EventType
+	value     string
+	actor     string
+}
+
+func withOutbox(eventType datastore.EventType, value string) gomock.Matcher {
+	return outboxMatcher{eventType: eventType, value: value}
+}
+
+func withActorOutbox(eventType datastore.EventType, value, actor string) gomock.Matcher {
+	return outboxMatcher{eventType: eventType, value: value, actor: actor}
+}
+
+func (m outboxMatcher) Matches(x interface{}) bool {
+	answer, ok := x.(*datastore.Answer)
+	if !ok || len(answer.Outbox) != 1 {
+		return false
+	}
+
+	message := answer.Outbox[0]
+	return message.Status == datastore.PendingOutboxStatus &&
+		answer.TenantID == datastore.DefaultTenant &&
+		message.Event.TenantID == answer.TenantID &&
+		message.Event.Type == m.eventType &&
+		message.Event.Data.Key == answer.Key &&
+		message.Event.Data.Value == m.value &&
+		message.Event.Actor == m.actor
+}
+
+func (m outboxMatcher) String() string {
+	return fmt.Sprintf("has a pending %s outbox message with value %q by %q", m.eventType, m.value, m.actor)
+}
+
 func TestAnswerService_CreateAnswer(t *testing.T) {
 	type args struct {
 		ctx context.Context
 		req *datastore.CreateAnswer
 	}
 
-	wg := sync.WaitGroup{}
-
 	ctx := context.Background()
 	tt := []struct {
 		name        string
@@ -46,21 +103,40 @@ func TestAnswerService_CreateAnswer(t *testing.T) {
 				ctx: ctx,
 				req: &datastore.CreateAnswer{
 					Key:   "some-key",
-					Value: "some-value",
+					Value: json.RawMessage(`"some-value"`),
 				},
 			},
 			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
 				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
-				eventRepo, _ := a.eventService.eventRepo.(*mocks.MockEventRepository)
 
-				wg.Add(1)
-				answerRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+				answerRepo.EXPECT().LastGeneration(gomock.Any(), datastore.DefaultTenant, "some-key").Return(int64(0), nil)
+				answerRepo.EXPECT().Create(gomock.Any(), withOutbox(datastore.CreateEvent, "some-value")).Return(nil)
+			},
+			wantAnswer: &datastore.Answer{
+				Key:            "some-key",
+				Values:         []datastore.Value{{Value: "some-value"}},
+				DocumentStatus: datastore.ActiveDocumentStatus,
+			},
+		},
 
-				eventRepo.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ *datastore.Event) error {
-					defer wg.Done()
-					return nil
-				})
+		{
+			name: "should_record_the_actor",
+			args: args{
+				ctx: auth.WithPrincipal(ctx, &auth.Principal{Subject: "some-user"}),
+				req: &datastore.CreateAnswer{
+					Key:   "some-key",
+					Value: json.RawMessage(`"some-value"`),
+				},
+			},
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
 
+				answerRepo.EXPECT().LastGeneration(gomock.Any(), datastore.DefaultTenant, "some-key").Return(int64(0), nil)
+				answerRepo.EXPECT().Create(gomock.Any(), withActorOutbox(datastore.CreateEvent, "some-value", "some-user")).Return(nil)
 			},
 			wantAnswer: &datastore.Answer{
 				Key:            "some-key",
@@ -69,24 +145,193 @@ func TestAnswerService_CreateAnswer(t *testing.T) {
 			},
 		},
 
+		{
+			name: "should_create_next_generation_of_deleted_key",
+			args: args{
+				ctx: ctx,
+				req: &datastore.CreateAnswer{
+					Key:   "some-key",
+					Value: json.RawMessage(`"some-value"`),
+				},
+			},
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().LastGeneration(gomock.Any(), datastore.DefaultTenant, "some-key").Return(int64(2), nil)
+				answerRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			wantAnswer: &datastore.Answer{
+				Key:        "some-key",
+				Generation: 3,
+				Values:     []datastore.Value{{Value: "some-value"}},
+			},
+		},
+
+		{
+			name: "should_create_answer_with_inferred_type",
+			args: args{
+				ctx: ctx,
+				req: &datastore.CreateAnswer{
+					Key:   "some-key",
+					Value: json.RawMessage(`{"limit": 10, "tags": ["a", true]}`),
+				},
+			},
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().LastGeneration(gomock.Any(), datastore.DefaultTenant, "some-key").Return(int64(0), nil)
+				answerRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			wantAnswer: &datastore.Answer{
+				Key: "some-key",
+				Values: []datastore.Value{{
+					Value: map[string]interface{}{"limit": int64(10), "tags": []interface{}{"a", true}},
+					Type:  datastore.ObjectValue,
+				}},
+			},
+		},
+
+		{
+			name: "should_create_answer_with_declared_type",
+			args: args{
+				ctx: ctx,
+				req: &datastore.CreateAnswer{
+					Key:   "some-key",
+					Value: json.RawMessage(`12.5`),
+					Type:  datastore.NumberValue,
+				},
+			},
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().LastGeneration(gomock.Any(), datastore.DefaultTenant, "some-key").Return(int64(0), nil)
+				answerRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			wantAnswer: &datastore.Answer{
+				Key:    "some-key",
+				Values: []datastore.Value{{Value: 12.5, Type: datastore.NumberValue}},
+			},
+		},
+
+		{
+			name: "should_fail_to_create_answer_for_mismatched_type",
+			args: args{
+				ctx: ctx,
+				req: &datastore.CreateAnswer{
+					Key:   "some-key",
+					Value: json.RawMessage(`"12"`),
+					Type:  datastore.NumberValue,
+				},
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+			wantErrMsg:  "invalid value type: value is a string, not a number",
+		},
+
+		{
+			name: "should_fail_to_create_answer_without_value",
+			args: args{
+				ctx: ctx,
+				req: &datastore.CreateAnswer{
+					Key:   "some-key",
+					Value: json.RawMessage(`null`),
+				},
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+			wantErrMsg:  datastore.ErrValueRequired.Error(),
+		},
+
 		{
 			name: "should_fail_to_create_answer_for_duplicate_key",
 			args: args{
 				ctx: ctx,
 				req: &datastore.CreateAnswer{
 					Key:   "some-key",
-					Value: "some-value",
+					Value: json.RawMessage(`"some-value"`),
 				},
 			},
 			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
 				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
 
+				answerRepo.EXPECT().LastGeneration(gomock.Any(), datastore.DefaultTenant, "some-key").Return(int64(0), nil)
 				answerRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(datastore.ErrDuplicateKey)
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(&datastore.Answer{Key: "some-key"}, nil)
 			},
 			wantErr:     true,
 			wantErrCode: http.StatusForbidden,
 			wantErrMsg:  datastore.ErrDuplicateKey.Error(),
 		},
+
+		{
+			name: "should_create_answer_over_expired_answer",
+			args: args{
+				ctx: ctx,
+				req: &datastore.CreateAnswer{
+					Key:   "some-key",
+					Value: json.RawMessage(`"some-value"`),
+				},
+			},
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				expired := &datastore.Answer{
+					UID:        "12345",
+					TenantID:   datastore.DefaultTenant,
+					Key:        "some-key",
+					Values:     []datastore.Value{{Value: "old-value"}},
+					Version:    2,
+					Generation: 1,
+					ExpiresAt:  primitive.NewDateTimeFromTime(time.Now().Add(-time.Minute)),
+				}
+
+				gomock.InOrder(
+					answerRepo.EXPECT().LastGeneration(gomock.Any(), datastore.DefaultTenant, "some-key").Return(int64(0), nil),
+					answerRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(datastore.ErrDuplicateKey),
+					answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(expired, nil),
+					answerRepo.EXPECT().Delete(gomock.Any(), withOutbox(datastore.ExpireEvent, "old-value"), int64(2)).Return(nil),
+					answerRepo.EXPECT().LastGeneration(gomock.Any(), datastore.DefaultTenant, "some-key").Return(int64(1), nil),
+					answerRepo.EXPECT().Create(gomock.Any(), withOutbox(datastore.CreateEvent, "some-value")).Return(nil),
+				)
+			},
+			wantAnswer: &datastore.Answer{
+				Key:        "some-key",
+				Values:     []datastore.Value{{Value: "some-value"}},
+				Generation: 2,
+			},
+		},
+
+		{
+			name: "should_fail_to_create_answer_violating_schema",
+			args: args{
+				ctx: ctx,
+				req: &datastore.CreateAnswer{
+					Key:   "billing/limits",
+					Value: json.RawMessage(`{"limit": "10"}`),
+				},
+			},
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a, datastore.Schema{
+					UID:        "12345",
+					Namespace:  "billing/",
+					Version:    2,
+					Definition: []byte(`{"type": "object", "properties": {"limit": {"type": "integer"}}, "required": ["limit", "currency"]}`),
+				})
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusUnprocessableEntity,
+			wantErrMsg:  `value doesn't match version 2 of the "billing/" schema`,
+		},
 	}
 
 	for _, tc := range tt {
@@ -99,8 +344,7 @@ func TestAnswerService_CreateAnswer(t *testing.T) {
 				tc.dbFn(answerService)
 			}
 
-			answer, err := answerService.CreateAnswer(tc.args.ctx, tc.args.req)
-			wg.Wait()
+			answer, err := answerService.CreateAnswer(tc.args.ctx, datastore.DefaultTenant, tc.args.req)
 
 			if tc.wantErr {
 				require.NotNil(t, err)
@@ -115,8 +359,14 @@ func TestAnswerService_CreateAnswer(t *testing.T) {
 			require.NotEmpty(t, answer.UpdatedAt)
 			require.Empty(t, answer.DeletedAt)
 
+			require.Equal(t, datastore.DefaultTenant, answer.TenantID)
 			require.Equal(t, tc.wantAnswer.Key, answer.Key)
 			require.Equal(t, tc.wantAnswer.Values[0].Value, answer.Values[0].Value)
+			require.Equal(t, tc.wantAnswer.Values[0].ValueType(), answer.Values[0].Type)
+
+			if tc.wantAnswer.Generation != 0 {
+				require.Equal(t, tc.wantAnswer.Generation, answer.Generation)
+			}
 		})
 	}
 }
@@ -146,7 +396,7 @@ func TestAnswerService_FindAnswerByKey(t *testing.T) {
 			dbFn: func(a *AnswerService) {
 				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
 
-				answerRepo.EXPECT().FindByKey(gomock.Any(), gomock.Any()).Return(&datastore.Answer{
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(&datastore.Answer{
 					UID:    "12345",
 					Key:    "some-key",
 					Values: []datastore.Value{{Value: "some-value"}},
@@ -168,7 +418,28 @@ func TestAnswerService_FindAnswerByKey(t *testing.T) {
 			dbFn: func(a *AnswerService) {
 				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
 
-				answerRepo.EXPECT().FindByKey(gomock.Any(), gomock.Any()).Return(nil, datastore.ErrAnswerNotFound)
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(nil, datastore.ErrAnswerNotFound)
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusNotFound,
+			wantErrMsg:  datastore.ErrAnswerNotFound.Error(),
+		},
+
+		{
+			name: "should_fail_to_find_expired_answer",
+			args: args{
+				ctx: ctx,
+				key: "some-key",
+			},
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(&datastore.Answer{
+					UID:       "12345",
+					Key:       "some-key",
+					Values:    []datastore.Value{{Value: "some-value"}},
+					ExpiresAt: primitive.NewDateTimeFromTime(time.Now().Add(-time.Second)),
+				}, nil)
 			},
 			wantErr:     true,
 			wantErrCode: http.StatusNotFound,
@@ -186,7 +457,7 @@ func TestAnswerService_FindAnswerByKey(t *testing.T) {
 				tc.dbFn(answerService)
 			}
 
-			answer, err := answerService.FindAnswerByKey(tc.args.ctx, tc.args.key)
+			answer, err := answerService.FindAnswerByKey(tc.args.ctx, datastore.DefaultTenant, tc.args.key)
 
 			if tc.wantErr {
 				require.NotNil(t, err)
@@ -202,80 +473,94 @@ func TestAnswerService_FindAnswerByKey(t *testing.T) {
 	}
 }
 
-func TestAnswerService_UpdateAnswer(t *testing.T) {
-	type args struct {
-		ctx context.Context
-		key string
-		req *datastore.UpdateAnswer
+func TestAnswerService_FindAnswerAt(t *testing.T) {
+	ctx := context.Background()
+
+	created := time.Date(2022, 3, 1, 9, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) primitive.DateTime {
+		return primitive.NewDateTimeFromTime(created.Add(d))
 	}
 
-	wg := sync.WaitGroup{}
+	recorded := &datastore.Answer{
+		UID: "12345",
+		Key: "some-key",
+		Values: []datastore.Value{
+			{Value: "first", CreatedAt: at(0)},
+			{Value: "second", CreatedAt: at(time.Hour)},
+			{Value: "third", CreatedAt: at(2 * time.Hour)},
+		},
+		Version:   3,
+		CreatedAt: at(0),
+		UpdatedAt: at(2 * time.Hour),
+	}
+
+	// written before value times were recorded
+	legacy := &datastore.Answer{
+		UID:       "12345",
+		Key:       "some-key",
+		Values:    []datastore.Value{{Value: "first"}, {Value: "second"}, {Value: "third"}},
+		Version:   3,
+		CreatedAt: at(0),
+		UpdatedAt: at(2 * time.Hour),
+	}
 
-	ctx := context.Background()
 	tt := []struct {
 		name        string
-		args        args
+		answer      *datastore.Answer
+		at          time.Time
 		wantErr     bool
 		wantErrMsg  string
 		wantErrCode int
-		wantAnswer  *datastore.Answer
-		dbFn        func(a *AnswerService)
+		wantValue   string
+		wantVersion int64
 	}{
 		{
-			name: "should_update_answer",
-			args: args{
-				ctx: ctx,
-				key: "some-key",
-				req: &datastore.UpdateAnswer{
-					Value: "new-answer",
-				},
-			},
-			dbFn: func(a *AnswerService) {
-				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
-				eventRepo, _ := a.eventService.eventRepo.(*mocks.MockEventRepository)
+			name:        "should_find_value_effective_at_time",
+			answer:      recorded,
+			at:          created.Add(90 * time.Minute),
+			wantValue:   "second",
+			wantVersion: 2,
+		},
 
-				wg.Add(1)
-				answerRepo.EXPECT().FindByKey(gomock.Any(), gomock.Any()).Return(&datastore.Answer{
-					UID:    "12345",
-					Key:    "some-key",
-					Values: []datastore.Value{{Value: "some-value"}},
-				}, nil)
+		{
+			name:        "should_find_value_written_at_time",
+			answer:      recorded,
+			at:          created.Add(time.Hour),
+			wantValue:   "second",
+			wantVersion: 2,
+		},
 
-				answerRepo.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(&datastore.Answer{
-					UID:    "12345",
-					Key:    "some-key",
-					Values: []datastore.Value{{Value: "some-value"}, {Value: "new-answer"}},
-				}, nil)
+		{
+			name:        "should_find_latest_value",
+			answer:      recorded,
+			at:          created.Add(24 * time.Hour),
+			wantValue:   "third",
+			wantVersion: 3,
+		},
 
-				eventRepo.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ *datastore.Event) error {
-					defer wg.Done()
-					return nil
-				})
-			},
-			wantAnswer: &datastore.Answer{
-				UID:    "12345",
-				Key:    "some-key",
-				Values: []datastore.Value{{Value: "some-value"}, {Value: "new-answer"}},
-			},
+		{
+			name:        "should_date_legacy_values_from_the_value_before_them",
+			answer:      legacy,
+			at:          created.Add(time.Minute),
+			wantValue:   "second",
+			wantVersion: 2,
 		},
 
 		{
-			name: "should_fail_to_update_answer_for_non_existent_key",
-			args: args{
-				ctx: ctx,
-				key: "some-key",
-				req: &datastore.UpdateAnswer{
-					Value: "new-answer",
-				},
-			},
-			dbFn: func(a *AnswerService) {
-				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+			name:        "should_date_latest_legacy_value_from_last_update",
+			answer:      legacy,
+			at:          created.Add(2 * time.Hour),
+			wantValue:   "third",
+			wantVersion: 3,
+		},
 
-				answerRepo.EXPECT().FindByKey(gomock.Any(), gomock.Any()).Return(nil, datastore.ErrAnswerNotFound)
-			},
+		{
+			name:        "should_fail_to_find_answer_before_it_was_created",
+			answer:      recorded,
+			at:          created.Add(-time.Second),
 			wantErr:     true,
 			wantErrCode: http.StatusNotFound,
-			wantErrMsg:  datastore.ErrAnswerNotFound.Error(),
+			wantErrMsg:  "answer not found at 2022-03-01T08:59:59Z",
 		},
 	}
 
@@ -285,88 +570,349 @@ func TestAnswerService_UpdateAnswer(t *testing.T) {
 
 			answerService := provideAnswerService(ctrl)
 
-			if tc.dbFn != nil {
-				tc.dbFn(answerService)
-			}
+			answerRepo, _ := answerService.answerRepo.(*mocks.MockAnswerRepository)
+			answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(tc.answer, nil)
 
-			answer, err := answerService.UpdateAnswer(tc.args.ctx, tc.args.key, tc.args.req)
-			wg.Wait()
+			answer, err := answerService.FindAnswerAt(ctx, datastore.DefaultTenant, "some-key", tc.at)
 
 			if tc.wantErr {
 				require.NotNil(t, err)
 				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
-				require.Equal(t, tc.wantErrMsg, err.(*util.ServiceError).Error())
+				require.Equal(t, tc.wantErrMsg, err.Error())
 				return
 			}
 
 			require.Nil(t, err)
-
-			require.Equal(t, tc.wantAnswer.UID, answer.UID)
-			require.Equal(t, tc.wantAnswer.Key, answer.Key)
-			require.Equal(t, tc.wantAnswer.Values[1].Value, answer.Values[1].Value)
+			require.Equal(t, tc.wantValue, answer.Values[len(answer.Values)-1].Value)
+			require.Equal(t, tc.wantVersion, answer.Version)
+			require.Len(t, tc.answer.Values, 3)
 		})
 	}
 }
 
-func TestAnswerService_DeleteAnswer(t *testing.T) {
-	type args struct {
-		ctx context.Context
-		key string
-	}
+func TestAnswerService_FindAnswerVersions(t *testing.T) {
+	ctx := context.Background()
 
-	wg := sync.WaitGroup{}
+	answer := &datastore.Answer{
+		UID:       "12345",
+		Key:       "some-key",
+		Values:    []datastore.Value{{Value: "first"}, {Value: "second", Author: "some-user"}, {Value: "third"}},
+		Version:   3,
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+		UpdatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
 
-	ctx := context.Background()
 	tt := []struct {
-		name        string
-		args        args
-		wantErr     bool
-		wantErrMsg  string
-		wantErrCode int
-		wantAnswer  *datastore.Answer
-		dbFn        func(a *AnswerService)
+		name         string
+		pageable     datastore.Pageable
+		wantErr      bool
+		wantErrCode  int
+		wantVersions []int64
+		wantTotal    int64
 	}{
 		{
-			name: "should_delete_answer",
-			args: args{
-				ctx: ctx,
-				key: "some-key",
-			},
-			dbFn: func(a *AnswerService) {
-				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
-				eventRepo, _ := a.eventService.eventRepo.(*mocks.MockEventRepository)
-
-				wg.Add(1)
-				answerRepo.EXPECT().FindByKey(gomock.Any(), gomock.Any()).Return(&datastore.Answer{
-					UID:    "12345",
-					Key:    "some-key",
-					Values: []datastore.Value{{Value: "some-value"}},
-				}, nil)
-
-				answerRepo.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil)
+			name:         "should_find_versions_newest_first",
+			pageable:     datastore.Pageable{Page: 1, PerPage: 2, Sort: -1},
+			wantVersions: []int64{3, 2},
+			wantTotal:    3,
+		},
 
-				eventRepo.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ *datastore.Event) error {
-					defer wg.Done()
-					return nil
-				})
-			},
+		{
+			name:         "should_find_last_page_of_versions",
+			pageable:     datastore.Pageable{Page: 2, PerPage: 2, Sort: -1},
+			wantVersions: []int64{1},
+			wantTotal:    3,
 		},
 
 		{
-			name: "should_fail_to_delete_answer_for_non_existent_key",
+			name:         "should_find_versions_oldest_first",
+			pageable:     datastore.Pageable{Page: 1, PerPage: 20, Sort: 1},
+			wantVersions: []int64{1, 2, 3},
+			wantTotal:    3,
+		},
+
+		{
+			name:        "should_fail_to_find_versions_with_invalid_page",
+			pageable:    datastore.Pageable{Page: 0, PerPage: 20},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			answerService := provideAnswerService(ctrl)
+
+			answerRepo, _ := answerService.answerRepo.(*mocks.MockAnswerRepository)
+			answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(answer, nil).MaxTimes(1)
+
+			versions, pagination, err := answerService.FindAnswerVersions(ctx, datastore.DefaultTenant, "some-key", tc.pageable)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, tc.wantTotal, pagination.Total)
+
+			numbers := make([]int64, 0, len(versions))
+			for _, version := range versions {
+				numbers = append(numbers, version.Version)
+				require.NotZero(t, version.CreatedAt)
+			}
+			require.Equal(t, tc.wantVersions, numbers)
+		})
+	}
+}
+
+func TestAnswerService_FindAnswerVersion(t *testing.T) {
+	ctx := context.Background()
+
+	answer := &datastore.Answer{
+		UID:       "12345",
+		Key:       "some-key",
+		Values:    []datastore.Value{{Value: "first"}, {Value: "second", Author: "some-user"}, {Value: "third"}},
+		Version:   3,
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+		UpdatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	tt := []struct {
+		name        string
+		version     int64
+		wantErr     bool
+		wantErrCode int
+		wantValue   string
+	}{
+		{
+			name:      "should_find_version",
+			version:   2,
+			wantValue: "second",
+		},
+
+		{
+			name:        "should_fail_to_find_unknown_version",
+			version:     4,
+			wantErr:     true,
+			wantErrCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			answerService := provideAnswerService(ctrl)
+
+			answerRepo, _ := answerService.answerRepo.(*mocks.MockAnswerRepository)
+			answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(answer, nil)
+
+			past, err := answerService.FindAnswerVersion(ctx, datastore.DefaultTenant, "some-key", tc.version)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, tc.version, past.Version)
+			require.Equal(t, `"12345.2"`, past.ETag())
+
+			latest := past.Values[len(past.Values)-1]
+			require.Equal(t, tc.wantValue, latest.Value)
+			require.Equal(t, "some-user", latest.Author)
+		})
+	}
+}
+
+func TestAnswerService_UpdateAnswer(t *testing.T) {
+	type args struct {
+		ctx     context.Context
+		key     string
+		req     *datastore.UpdateAnswer
+		ifMatch []string
+	}
+
+	ctx := context.Background()
+	tt := []struct {
+		name        string
+		args        args
+		wantErr     bool
+		wantErrMsg  string
+		wantErrCode int
+		wantAnswer  *datastore.Answer
+		dbFn        func(a *AnswerService)
+	}{
+		{
+			name: "should_update_answer",
+			args: args{
+				ctx: ctx,
+				key: "some-key",
+				req: &datastore.UpdateAnswer{
+					Value: json.RawMessage(`"new-answer"`),
+				},
+			},
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(&datastore.Answer{
+					UID:      "12345",
+					TenantID: datastore.DefaultTenant,
+					Key:      "some-key",
+					Values:   []datastore.Value{{Value: "some-value"}},
+				}, nil)
+
+				answerRepo.EXPECT().Update(gomock.Any(), withOutbox(datastore.UpdateEvent, "new-answer"), gomock.Any(), int64(0)).Return(&datastore.Answer{
+					UID:    "12345",
+					Key:    "some-key",
+					Values: []datastore.Value{{Value: "some-value"}, {Value: "new-answer"}},
+				}, nil)
+			},
+			wantAnswer: &datastore.Answer{
+				UID:    "12345",
+				Key:    "some-key",
+				Values: []datastore.Value{{Value: "some-value"}, {Value: "new-answer"}},
+			},
+		},
+
+		{
+			name: "should_update_answer_matching_if_match",
+			args: args{
+				ctx:     ctx,
+				key:     "some-key",
+				req:     &datastore.UpdateAnswer{Value: json.RawMessage(`"new-answer"`)},
+				ifMatch: []string{`"12345.1"`, `"12345.3"`},
+			},
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(&datastore.Answer{
+					UID:      "12345",
+					TenantID: datastore.DefaultTenant,
+					Key:      "some-key",
+					Values:   []datastore.Value{{Value: "some-value"}},
+					Version:  3,
+				}, nil)
+
+				answerRepo.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any(), int64(3)).Return(&datastore.Answer{
+					UID:     "12345",
+					Key:     "some-key",
+					Values:  []datastore.Value{{Value: "some-value"}, {Value: "new-answer"}},
+					Version: 4,
+				}, nil)
+			},
+			wantAnswer: &datastore.Answer{
+				UID:    "12345",
+				Key:    "some-key",
+				Values: []datastore.Value{{Value: "some-value"}, {Value: "new-answer"}},
+			},
+		},
+
+		{
+			name: "should_fail_to_update_answer_not_matching_if_match",
+			args: args{
+				ctx:     ctx,
+				key:     "some-key",
+				req:     &datastore.UpdateAnswer{Value: json.RawMessage(`"new-answer"`)},
+				ifMatch: []string{`"12345.2"`, `W/"12345.3"`},
+			},
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(&datastore.Answer{
+					UID:      "12345",
+					TenantID: datastore.DefaultTenant,
+					Key:      "some-key",
+					Values:   []datastore.Value{{Value: "some-value"}},
+					Version:  3,
+				}, nil)
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusPreconditionFailed,
+			wantErrMsg:  datastore.ErrVersionMismatch.Error(),
+		},
+
+		{
+			name: "should_fail_to_update_answer_changed_since_it_was_read",
+			args: args{
+				ctx:     ctx,
+				key:     "some-key",
+				req:     &datastore.UpdateAnswer{Value: json.RawMessage(`"new-answer"`)},
+				ifMatch: []string{`"12345.3"`},
+			},
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(&datastore.Answer{
+					UID:      "12345",
+					TenantID: datastore.DefaultTenant,
+					Key:      "some-key",
+					Values:   []datastore.Value{{Value: "some-value"}},
+					Version:  3,
+				}, nil)
+
+				answerRepo.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any(), int64(3)).Return(nil, datastore.ErrVersionMismatch)
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusPreconditionFailed,
+			wantErrMsg:  datastore.ErrVersionMismatch.Error(),
+		},
+
+		{
+			name: "should_fail_to_update_answer_for_non_existent_key",
 			args: args{
 				ctx: ctx,
 				key: "some-key",
+				req: &datastore.UpdateAnswer{
+					Value: json.RawMessage(`"new-answer"`),
+				},
 			},
 			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
 				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
 
-				answerRepo.EXPECT().FindByKey(gomock.Any(), gomock.Any()).Return(nil, datastore.ErrAnswerNotFound)
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(nil, datastore.ErrAnswerNotFound)
 			},
 			wantErr:     true,
 			wantErrCode: http.StatusNotFound,
 			wantErrMsg:  datastore.ErrAnswerNotFound.Error(),
 		},
+
+		{
+			name: "should_fail_to_update_answer_violating_schema",
+			args: args{
+				ctx: ctx,
+				key: "some-key",
+				req: &datastore.UpdateAnswer{
+					Value: json.RawMessage(`"new-answer"`),
+				},
+			},
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a, datastore.Schema{
+					UID:        "12345",
+					Namespace:  "some-",
+					Version:    1,
+					Definition: []byte(`{"type": "string", "maxLength": 5}`),
+				})
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusUnprocessableEntity,
+			wantErrMsg:  `value doesn't match version 1 of the "some-" schema`,
+		},
 	}
 
 	for _, tc := range tt {
@@ -379,8 +925,7 @@ func TestAnswerService_DeleteAnswer(t *testing.T) {
 				tc.dbFn(answerService)
 			}
 
-			err := answerService.DeleteAnswer(tc.args.ctx, tc.args.key)
-			wg.Wait()
+			answer, err := answerService.UpdateAnswer(tc.args.ctx, datastore.DefaultTenant, tc.args.key, tc.args.req, tc.args.ifMatch)
 
 			if tc.wantErr {
 				require.NotNil(t, err)
@@ -390,6 +935,1181 @@ func TestAnswerService_DeleteAnswer(t *testing.T) {
 			}
 
 			require.Nil(t, err)
+
+			require.Equal(t, tc.wantAnswer.UID, answer.UID)
+			require.Equal(t, tc.wantAnswer.Key, answer.Key)
+			require.Equal(t, tc.wantAnswer.Values[1].Value, answer.Values[1].Value)
 		})
 	}
 }
+
+// rollbackMatcher matches an answer written along with a rollback
+// event recording the versions written and written back.
+type rollbackMatcher struct {
+	value         string
+	version       int64
+	sourceVersion int64
+}
+
+func withRollback(value string, version, sourceVersion int64) gomock.Matcher {
+	return rollbackMatcher{value: value, version: version, sourceVersion: sourceVersion}
+}
+
+func (m rollbackMatcher) Matches(x interface{}) bool {
+	if !withOutbox(datastore.RollbackEvent, m.value).Matches(x) {
+		return false
+	}
+
+	data := x.(*datastore.Answer).Outbox[0].Event.Data
+	return data.Version == m.version && data.SourceVersion == m.sourceVersion
+}
+
+func (m rollbackMatcher) String() string {
+	return fmt.Sprintf("has a pending rollback outbox message with value %q, from version %d to %d", m.value, m.sourceVersion, m.version)
+}
+
+func TestAnswerService_RollbackAnswer(t *testing.T) {
+	type args struct {
+		ctx     context.Context
+		req     *datastore.RollbackAnswer
+		ifMatch []string
+	}
+
+	ctx := context.Background()
+	created := time.Date(2022, 3, 1, 9, 0, 0, 0, time.UTC)
+	noon := created.Add(3 * time.Hour)
+
+	answer := func() *datastore.Answer {
+		return &datastore.Answer{
+			UID:      "12345",
+			TenantID: datastore.DefaultTenant,
+			Key:      "some-key",
+			Values: []datastore.Value{
+				{Value: "first", CreatedAt: primitive.NewDateTimeFromTime(created)},
+				{Value: "second", CreatedAt: primitive.NewDateTimeFromTime(created.Add(time.Hour))},
+				{Value: "bad-value", CreatedAt: primitive.NewDateTimeFromTime(created.Add(4 * time.Hour))},
+			},
+			Version: 3,
+		}
+	}
+
+	rolledBack := &datastore.Answer{UID: "12345", Key: "some-key", Values: []datastore.Value{{Value: "second"}}, Version: 4}
+
+	tt := []struct {
+		name        string
+		args        args
+		wantErr     bool
+		wantErrMsg  string
+		wantErrCode int
+		dbFn        func(a *AnswerService)
+	}{
+		{
+			name: "should_rollback_answer_to_version",
+			args: args{ctx: ctx, req: &datastore.RollbackAnswer{Version: 1}},
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(answer(), nil)
+				answerRepo.EXPECT().Update(gomock.Any(), withRollback("first", 4, 1), gomock.Any(), int64(3)).Return(rolledBack, nil)
+			},
+		},
+
+		{
+			name: "should_rollback_answer_to_time",
+			args: args{ctx: ctx, req: &datastore.RollbackAnswer{At: &noon}, ifMatch: []string{`"12345.3"`}},
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(answer(), nil)
+				answerRepo.EXPECT().Update(gomock.Any(), withRollback("second", 4, 2), gomock.Any(), int64(3)).Return(rolledBack, nil)
+			},
+		},
+
+		{
+			name: "should_retry_rollback_racing_with_update",
+			args: args{ctx: ctx, req: &datastore.RollbackAnswer{Version: 2}},
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+				expectSchemas(a)
+
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				updated := answer()
+				updated.Values = append(updated.Values, datastore.Value{Value: "other-value"})
+				updated.Version = 4
+
+				gomock.InOrder(
+					answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(answer(), nil),
+					answerRepo.EXPECT().Update(gomock.Any(), withRollback("second", 4, 2), gomock.Any(), int64(3)).Return(nil, datastore.ErrVersionMismatch),
+					answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(updated, nil),
+					answerRepo.EXPECT().Update(gomock.Any(), withRollback("second", 5, 2), gomock.Any(), int64(4)).Return(rolledBack, nil),
+				)
+			},
+		},
+
+		{
+			name: "should_fail_to_rollback_answer_changed_since_it_was_read",
+			args: args{ctx: ctx, req: &datastore.RollbackAnswer{Version: 2}, ifMatch: []string{`"12345.3"`}},
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(answer(), nil)
+				answerRepo.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any(), int64(3)).Return(nil, datastore.ErrVersionMismatch)
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusPreconditionFailed,
+			wantErrMsg:  datastore.ErrVersionMismatch.Error(),
+		},
+
+		{
+			name: "should_fail_to_rollback_answer_to_unknown_version",
+			args: args{ctx: ctx, req: &datastore.RollbackAnswer{Version: 4}},
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(answer(), nil)
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusNotFound,
+			wantErrMsg:  "the version to roll back to doesn't exist",
+		},
+
+		{
+			name:        "should_fail_to_rollback_answer_to_both_version_and_time",
+			args:        args{ctx: ctx, req: &datastore.RollbackAnswer{Version: 1, At: &noon}},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+			wantErrMsg:  "either a version or a time to roll back to is required",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			answerService := provideAnswerService(ctrl)
+
+			if tc.dbFn != nil {
+				tc.dbFn(answerService)
+			}
+
+			answer, err := answerService.RollbackAnswer(tc.args.ctx, datastore.DefaultTenant, "some-key", tc.args.req, tc.args.ifMatch)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				require.Equal(t, tc.wantErrMsg, err.(*util.ServiceError).Error())
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, rolledBack.Version, answer.Version)
+		})
+	}
+}
+
+func TestAnswerService_DeleteAnswer(t *testing.T) {
+	type args struct {
+		ctx     context.Context
+		key     string
+		ifMatch []string
+	}
+
+	ctx := context.Background()
+	tt := []struct {
+		name        string
+		args        args
+		wantErr     bool
+		wantErrMsg  string
+		wantErrCode int
+		wantAnswer  *datastore.Answer
+		dbFn        func(a *AnswerService)
+	}{
+		{
+			name: "should_delete_answer",
+			args: args{
+				ctx: ctx,
+				key: "some-key",
+			},
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(&datastore.Answer{
+					UID:      "12345",
+					TenantID: datastore.DefaultTenant,
+					Key:      "some-key",
+					Values:   []datastore.Value{{Value: "some-value"}},
+				}, nil)
+
+				answerRepo.EXPECT().Delete(gomock.Any(), withOutbox(datastore.DeleteEvent, "some-value"), int64(0)).Return(nil)
+			},
+		},
+
+		{
+			name: "should_delete_answer_matching_any_tag",
+			args: args{
+				ctx:     ctx,
+				key:     "some-key",
+				ifMatch: []string{"*"},
+			},
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(&datastore.Answer{
+					UID:      "12345",
+					TenantID: datastore.DefaultTenant,
+					Key:      "some-key",
+					Values:   []datastore.Value{{Value: "some-value"}},
+					Version:  1,
+				}, nil)
+
+				answerRepo.EXPECT().Delete(gomock.Any(), gomock.Any(), int64(0)).Return(nil)
+			},
+		},
+
+		{
+			name: "should_fail_to_delete_answer_changed_since_it_was_read",
+			args: args{
+				ctx:     ctx,
+				key:     "some-key",
+				ifMatch: []string{`"12345.1"`},
+			},
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(&datastore.Answer{
+					UID:      "12345",
+					TenantID: datastore.DefaultTenant,
+					Key:      "some-key",
+					Values:   []datastore.Value{{Value: "some-value"}},
+					Version:  1,
+				}, nil)
+
+				answerRepo.EXPECT().Delete(gomock.Any(), gomock.Any(), int64(1)).Return(datastore.ErrVersionMismatch)
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusPreconditionFailed,
+			wantErrMsg:  datastore.ErrVersionMismatch.Error(),
+		},
+
+		{
+			name: "should_fail_to_delete_answer_for_non_existent_key",
+			args: args{
+				ctx: ctx,
+				key: "some-key",
+			},
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(nil, datastore.ErrAnswerNotFound)
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusNotFound,
+			wantErrMsg:  datastore.ErrAnswerNotFound.Error(),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			answerService := provideAnswerService(ctrl)
+
+			if tc.dbFn != nil {
+				tc.dbFn(answerService)
+			}
+
+			err := answerService.DeleteAnswer(tc.args.ctx, datastore.DefaultTenant, tc.args.key, tc.args.ifMatch)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				require.Equal(t, tc.wantErrMsg, err.(*util.ServiceError).Error())
+				return
+			}
+
+			require.Nil(t, err)
+		})
+	}
+}
+
+func TestAnswerService_RestoreAnswer(t *testing.T) {
+	ctx := context.Background()
+	tt := []struct {
+		name        string
+		wantErr     bool
+		wantErrMsg  string
+		wantErrCode int
+		dbFn        func(a *AnswerService)
+	}{
+		{
+			name: "should_restore_most_recently_deleted_answer",
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindDeleted(gomock.Any(), datastore.DefaultTenant, "some-key").Return([]datastore.Answer{
+					{
+						UID:            "12345",
+						TenantID:       datastore.DefaultTenant,
+						Key:            "some-key",
+						Values:         []datastore.Value{{Value: "old-value"}, {Value: "some-value"}},
+						DocumentStatus: datastore.DeletedDocumentStatus,
+						DeletedAt:      primitive.NewDateTimeFromTime(time.Now()),
+					},
+					{
+						UID:            "67890",
+						TenantID:       datastore.DefaultTenant,
+						Key:            "some-key",
+						Values:         []datastore.Value{{Value: "older-value"}},
+						DocumentStatus: datastore.DeletedDocumentStatus,
+					},
+				}, nil)
+
+				answerRepo.EXPECT().Restore(gomock.Any(), withOutbox(datastore.RestoreEvent, "some-value")).Return(nil)
+			},
+		},
+
+		{
+			name: "should_fail_to_restore_answer_without_deleted_answer",
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindDeleted(gomock.Any(), datastore.DefaultTenant, "some-key").Return(nil, nil)
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusNotFound,
+			wantErrMsg:  ErrDeletedAnswerNotFound.Error(),
+		},
+
+		{
+			name: "should_fail_to_restore_answer_over_active_answer",
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindDeleted(gomock.Any(), datastore.DefaultTenant, "some-key").Return([]datastore.Answer{
+					{
+						UID:      "12345",
+						TenantID: datastore.DefaultTenant,
+						Key:      "some-key",
+						Values:   []datastore.Value{{Value: "some-value"}},
+					},
+				}, nil)
+
+				answerRepo.EXPECT().Restore(gomock.Any(), gomock.Any()).Return(datastore.ErrDuplicateKey)
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(&datastore.Answer{Key: "some-key"}, nil)
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusConflict,
+			wantErrMsg:  ErrActiveAnswerExists.Error(),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			answerService := provideAnswerService(ctrl)
+
+			if tc.dbFn != nil {
+				tc.dbFn(answerService)
+			}
+
+			answer, err := answerService.RestoreAnswer(ctx, datastore.DefaultTenant, "some-key")
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				require.Equal(t, tc.wantErrMsg, err.(*util.ServiceError).Error())
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, "12345", answer.UID)
+			require.Equal(t, datastore.ActiveDocumentStatus, answer.DocumentStatus)
+			require.Zero(t, answer.DeletedAt)
+			require.Nil(t, answer.Outbox)
+		})
+	}
+}
+
+func TestAnswerService_FindAnswers(t *testing.T) {
+	ctx := context.Background()
+
+	cursor, err := encodeCursor(&datastore.AnswerQuery{Sort: "-updated_at"}, datastore.AnswerFilter{
+		Status: datastore.ActiveDocumentStatus,
+		SortBy: datastore.UpdatedAtAnswerSort,
+	}, &datastore.Answer{Key: "b", UpdatedAt: 10})
+	require.Nil(t, err)
+
+	tt := []struct {
+		name        string
+		query       datastore.AnswerQuery
+		wantKeys    []string
+		wantNext    bool
+		wantErr     bool
+		wantErrMsg  string
+		wantErrCode int
+		dbFn        func(a *AnswerService)
+	}{
+		{
+			name:     "should_find_unexpired_active_answers_by_key",
+			wantKeys: []string{"a"},
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ string, filter datastore.AnswerFilter) ([]datastore.Answer, error) {
+						require.Equal(t, datastore.ActiveDocumentStatus, filter.Status)
+						require.Equal(t, datastore.KeyAnswerSort, filter.SortBy)
+						require.False(t, filter.Descending)
+						require.NotZero(t, filter.ExpiresAfter)
+						require.Equal(t, 21, filter.Limit)
+						return []datastore.Answer{{Key: "a"}}, nil
+					})
+			},
+		},
+
+		{
+			name:     "should_find_deleted_answers",
+			query:    datastore.AnswerQuery{Status: "deleted", Prefix: "billing.", Regex: "^billing"},
+			wantKeys: []string{"billing.a"},
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, datastore.AnswerFilter{
+					Status: datastore.DeletedDocumentStatus,
+					Prefix: "billing.",
+					Regex:  "^billing",
+					SortBy: datastore.KeyAnswerSort,
+					Limit:  21,
+				}).Return([]datastore.Answer{{Key: "billing.a"}}, nil)
+			},
+		},
+
+		{
+			name:     "should_return_cursor_of_next_page",
+			query:    datastore.AnswerQuery{Sort: "-updated_at", PerPage: 2},
+			wantKeys: []string{"a", "b"},
+			wantNext: true,
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ string, filter datastore.AnswerFilter) ([]datastore.Answer, error) {
+						require.Equal(t, datastore.UpdatedAtAnswerSort, filter.SortBy)
+						require.True(t, filter.Descending)
+						require.Equal(t, 3, filter.Limit)
+						return []datastore.Answer{{Key: "a"}, {Key: "b"}, {Key: "c"}}, nil
+					})
+			},
+		},
+
+		{
+			name:     "should_continue_from_cursor",
+			query:    datastore.AnswerQuery{Sort: "-updated_at", Cursor: cursor},
+			wantKeys: []string{"c"},
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ string, filter datastore.AnswerFilter) ([]datastore.Answer, error) {
+						require.Equal(t, &datastore.AnswerCursor{Time: 10, Key: "b"}, filter.After)
+						return []datastore.Answer{{Key: "c"}}, nil
+					})
+			},
+		},
+
+		{
+			name:     "should_read_on_past_unauthorized_answers",
+			query:    datastore.AnswerQuery{PerPage: 2},
+			wantKeys: []string{"a", "b"},
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				gomock.InOrder(
+					answerRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, gomock.Any()).
+						Return([]datastore.Answer{{Key: "a"}, {Key: "hidden"}, {Key: "b"}}, nil),
+					answerRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, gomock.Any()).
+						DoAndReturn(func(_ context.Context, _ string, filter datastore.AnswerFilter) ([]datastore.Answer, error) {
+							require.Equal(t, &datastore.AnswerCursor{Key: "b"}, filter.After)
+							return []datastore.Answer{}, nil
+						}),
+				)
+			},
+		},
+
+		{
+			name:        "should_fail_to_find_answers_with_unknown_status",
+			query:       datastore.AnswerQuery{Status: "archived"},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+			wantErrMsg:  ErrInvalidAnswerStatus.Error(),
+		},
+
+		{
+			name:        "should_fail_to_find_answers_with_unknown_sort",
+			query:       datastore.AnswerQuery{Sort: "-value"},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+			wantErrMsg:  ErrInvalidAnswerSort.Error(),
+		},
+
+		{
+			name:        "should_fail_to_find_answers_with_invalid_regex",
+			query:       datastore.AnswerQuery{Regex: "billing.("},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+			wantErrMsg:  "regex is invalid: error parsing regexp: missing closing ): `billing.(`",
+		},
+
+		{
+			name:        "should_fail_to_find_answers_with_invalid_cursor",
+			query:       datastore.AnswerQuery{Cursor: "not-a-cursor"},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+			wantErrMsg:  ErrInvalidCursor.Error(),
+		},
+
+		{
+			name:        "should_fail_to_find_answers_with_cursor_of_another_sort",
+			query:       datastore.AnswerQuery{Sort: "updated_at", Cursor: cursor},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+			wantErrMsg:  ErrInvalidCursor.Error(),
+		},
+
+		{
+			name:        "should_fail_to_find_answers_with_too_large_page",
+			query:       datastore.AnswerQuery{PerPage: 101},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+			wantErrMsg:  ErrInvalidPerPage.Error(),
+		},
+
+		{
+			name:        "should_fail_to_find_answers",
+			wantErr:     true,
+			wantErrCode: http.StatusInternalServerError,
+			wantErrMsg:  "failed",
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(nil, errors.New("failed"))
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			answerService := provideAnswerService(ctrl)
+
+			if tc.dbFn != nil {
+				tc.dbFn(answerService)
+			}
+
+			authorized := func(key string) bool { return key != "hidden" }
+
+			answers, page, err := answerService.FindAnswers(ctx, datastore.DefaultTenant, &tc.query, authorized)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				require.Equal(t, tc.wantErrMsg, err.(*util.ServiceError).Error())
+				return
+			}
+
+			require.Nil(t, err)
+
+			keys := make([]string, len(answers))
+			for i := range answers {
+				keys[i] = answers[i].Key
+			}
+
+			require.Equal(t, tc.wantKeys, keys)
+			require.Equal(t, tc.wantNext, page.Next != "")
+		})
+	}
+}
+
+func TestAnswerService_SearchAnswers(t *testing.T) {
+	ctx := context.Background()
+
+	found := []datastore.ScoredAnswer{
+		{Score: 2, Answer: datastore.Answer{Key: "current", Values: []datastore.Value{{Value: "shipping", Version: 1}, {Value: "refund policy", Version: 2}}}},
+		{Score: 1.5, Answer: datastore.Answer{Key: "past", Values: []datastore.Value{{Value: "refund", Version: 1}, {Value: "none", Version: 2}}}},
+		{Score: 1, Answer: datastore.Answer{Key: "hidden", Values: []datastore.Value{{Value: "refund", Version: 1}}}},
+		{Score: 1, Answer: datastore.Answer{Key: "expired", ExpiresAt: 1, Values: []datastore.Value{{Value: "refund", Version: 1}}}},
+	}
+
+	tt := []struct {
+		name        string
+		query       datastore.SearchQuery
+		pageable    datastore.Pageable
+		wantKeys    []string
+		wantCurrent []bool
+		wantTotal   int64
+		wantErr     bool
+		wantErrMsg  string
+		wantErrCode int
+		dbFn        func(a *AnswerService)
+	}{
+		{
+			name:        "should_search_current_values",
+			query:       datastore.SearchQuery{Text: "Refund!"},
+			pageable:    datastore.Pageable{Page: 1, PerPage: 10},
+			wantKeys:    []string{"current"},
+			wantCurrent: []bool{true},
+			wantTotal:   1,
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().Search(gomock.Any(), datastore.DefaultTenant, []string{"refund"}, maxSearchResults).Return(found, nil)
+			},
+		},
+
+		{
+			name:        "should_search_historical_values",
+			query:       datastore.SearchQuery{Text: "refund", History: true},
+			pageable:    datastore.Pageable{Page: 1, PerPage: 10},
+			wantKeys:    []string{"current", "past"},
+			wantCurrent: []bool{true, false},
+			wantTotal:   2,
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().Search(gomock.Any(), datastore.DefaultTenant, []string{"refund"}, maxSearchResults).Return(found, nil)
+			},
+		},
+
+		{
+			name:        "should_page_results",
+			query:       datastore.SearchQuery{Text: "refund", History: true},
+			pageable:    datastore.Pageable{Page: 2, PerPage: 1},
+			wantKeys:    []string{"past"},
+			wantCurrent: []bool{false},
+			wantTotal:   2,
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().Search(gomock.Any(), datastore.DefaultTenant, []string{"refund"}, maxSearchResults).Return(found, nil)
+			},
+		},
+
+		{
+			name:        "should_fail_to_search_without_words",
+			query:       datastore.SearchQuery{Text: " ?! "},
+			pageable:    datastore.Pageable{Page: 1, PerPage: 10},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+			wantErrMsg:  ErrSearchTextRequired.Error(),
+		},
+
+		{
+			name:        "should_fail_to_search_with_invalid_page",
+			query:       datastore.SearchQuery{Text: "refund"},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+			wantErrMsg:  datastore.ErrInvalidPageable.Error(),
+		},
+
+		{
+			name:        "should_fail_to_search",
+			query:       datastore.SearchQuery{Text: "refund"},
+			pageable:    datastore.Pageable{Page: 1, PerPage: 10},
+			wantErr:     true,
+			wantErrCode: http.StatusInternalServerError,
+			wantErrMsg:  "failed",
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().Search(gomock.Any(), datastore.DefaultTenant, []string{"refund"}, maxSearchResults).Return(nil, errors.New("failed"))
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			answerService := provideAnswerService(ctrl)
+
+			if tc.dbFn != nil {
+				tc.dbFn(answerService)
+			}
+
+			authorized := func(key string) bool { return key != "hidden" }
+
+			results, pagination, err := answerService.SearchAnswers(ctx, datastore.DefaultTenant, &tc.query, tc.pageable, authorized)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				require.Equal(t, tc.wantErrMsg, err.(*util.ServiceError).Error())
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, tc.wantTotal, pagination.Total)
+
+			keys := make([]string, len(results))
+			current := make([]bool, len(results))
+			for i := range results {
+				keys[i], current[i] = results[i].Key, results[i].Current
+				require.Contains(t, results[i].Highlight, "<em>")
+			}
+
+			require.Equal(t, tc.wantKeys, keys)
+			require.Equal(t, tc.wantCurrent, current)
+		})
+	}
+}
+
+func TestAnswerService_ExecuteBatch(t *testing.T) {
+	ctx := context.Background()
+
+	authorized := func(key string) bool {
+		return !strings.HasPrefix(key, "secret.")
+	}
+
+	// passThrough runs transactions, nested ones included, as given
+	passThrough := func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+
+	operations := []datastore.BatchOperation{
+		{Op: datastore.CreateBatchOperation, Key: "a", Value: json.RawMessage(`"some-value"`)},
+		{Op: datastore.UpdateBatchOperation, Key: "b", Value: json.RawMessage(`"new-value"`)},
+		{Op: datastore.DeleteBatchOperation, Key: "c", IfMatch: `"12345.1"`},
+	}
+
+	// expectOperations expects the writes of operations, the
+	// update failing with a 404 when updateFails is set
+	expectOperations := func(a *AnswerService, updateFails bool) {
+		expectSchemas(a)
+		expectSchemas(a)
+
+		answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+		answerRepo.EXPECT().LastGeneration(gomock.Any(), datastore.DefaultTenant, "a").Return(int64(0), nil)
+		answerRepo.EXPECT().Create(gomock.Any(), withOutbox(datastore.CreateEvent, "some-value")).Return(nil)
+
+		if updateFails {
+			answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "b").Return(nil, datastore.ErrAnswerNotFound)
+			return
+		}
+
+		answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "b").Return(&datastore.Answer{
+			UID:      "67890",
+			TenantID: datastore.DefaultTenant,
+			Key:      "b",
+			Values:   []datastore.Value{{Value: "some-value"}},
+			Version:  1,
+		}, nil)
+		answerRepo.EXPECT().Update(gomock.Any(), withOutbox(datastore.UpdateEvent, "new-value"), gomock.Any(), int64(0)).Return(&datastore.Answer{
+			UID:     "67890",
+			Key:     "b",
+			Values:  []datastore.Value{{Value: "some-value"}, {Value: "new-value"}},
+			Version: 2,
+		}, nil)
+
+		answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "c").Return(&datastore.Answer{
+			UID:      "12345",
+			TenantID: datastore.DefaultTenant,
+			Key:      "c",
+			Values:   []datastore.Value{{Value: "some-value"}},
+			Version:  1,
+		}, nil)
+		answerRepo.EXPECT().Delete(gomock.Any(), withOutbox(datastore.DeleteEvent, "some-value"), int64(1)).Return(nil)
+	}
+
+	tt := []struct {
+		name          string
+		transactional bool
+		req           datastore.BatchRequest
+		wantKeys      []string
+		wantCodes     []int
+		wantErr       bool
+		wantErrMsg    string
+		wantErrCode   int
+		dbFn          func(a *AnswerService)
+	}{
+		{
+			name:      "should_apply_operations_in_order",
+			req:       datastore.BatchRequest{Operations: operations},
+			wantKeys:  []string{"a", "b", ""},
+			wantCodes: []int{0, 0, 0},
+			dbFn: func(a *AnswerService) {
+				expectOperations(a, false)
+			},
+		},
+
+		{
+			name: "should_apply_operations_past_those_failing",
+			req: datastore.BatchRequest{Operations: []datastore.BatchOperation{
+				{Op: datastore.CreateBatchOperation, Key: "secret.a", Value: json.RawMessage(`"some-value"`)},
+				{Op: "upsert", Key: "a", Value: json.RawMessage(`"some-value"`)},
+				{Op: datastore.DeleteBatchOperation},
+				{Op: datastore.DeleteBatchOperation, Key: "c"},
+			}},
+			wantKeys:  []string{"", "", "", ""},
+			wantCodes: []int{http.StatusForbidden, http.StatusBadRequest, http.StatusBadRequest, 0},
+			dbFn: func(a *AnswerService) {
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "c").Return(&datastore.Answer{
+					UID:      "12345",
+					TenantID: datastore.DefaultTenant,
+					Key:      "c",
+					Values:   []datastore.Value{{Value: "some-value"}},
+				}, nil)
+				answerRepo.EXPECT().Delete(gomock.Any(), gomock.Any(), int64(0)).Return(nil)
+			},
+		},
+
+		{
+			name:        "should_fail_empty_batch",
+			req:         datastore.BatchRequest{},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+			wantErrMsg:  ErrInvalidBatchSize.Error(),
+		},
+
+		{
+			name:        "should_fail_batch_too_large",
+			req:         datastore.BatchRequest{Operations: make([]datastore.BatchOperation, maxBatchSize+1)},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+			wantErrMsg:  ErrInvalidBatchSize.Error(),
+		},
+
+		{
+			name:        "should_fail_atomic_batch_without_transactions",
+			req:         datastore.BatchRequest{Atomic: true, Operations: operations},
+			wantErr:     true,
+			wantErrCode: http.StatusNotImplemented,
+			wantErrMsg:  ErrAtomicBatchRequiresTx.Error(),
+		},
+
+		{
+			name:          "should_apply_atomic_batch_in_one_transaction",
+			transactional: true,
+			req:           datastore.BatchRequest{Atomic: true, Operations: operations},
+			wantKeys:      []string{"a", "b", ""},
+			wantCodes:     []int{0, 0, 0},
+			dbFn: func(a *AnswerService) {
+				transactor, _ := a.transactor.(*mocks.MockTransactor)
+
+				// the batch, then each of its mutations
+				transactor.EXPECT().WithTransaction(gomock.Any(), gomock.Any()).DoAndReturn(passThrough).Times(4)
+
+				expectOperations(a, false)
+			},
+		},
+
+		{
+			name:          "should_roll_back_atomic_batch_when_an_operation_fails",
+			transactional: true,
+			req:           datastore.BatchRequest{Atomic: true, Operations: operations},
+			wantKeys:      []string{"", "", ""},
+			wantCodes:     []int{http.StatusFailedDependency, http.StatusNotFound, http.StatusFailedDependency},
+			dbFn: func(a *AnswerService) {
+				transactor, _ := a.transactor.(*mocks.MockTransactor)
+
+				transactor.EXPECT().WithTransaction(gomock.Any(), gomock.Any()).DoAndReturn(passThrough).Times(3)
+
+				expectOperations(a, true)
+			},
+		},
+
+		{
+			name:          "should_fail_atomic_batch_when_commit_fails",
+			transactional: true,
+			req:           datastore.BatchRequest{Atomic: true, Operations: operations},
+			dbFn: func(a *AnswerService) {
+				transactor, _ := a.transactor.(*mocks.MockTransactor)
+
+				transactor.EXPECT().WithTransaction(gomock.Any(), gomock.Any()).Return(errors.New("commit failed"))
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusInternalServerError,
+			wantErrMsg:  "commit failed",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			answerService := provideAnswerService(ctrl)
+			if tc.transactional {
+				answerService = provideTransactionalAnswerService(ctrl)
+			}
+
+			if tc.dbFn != nil {
+				tc.dbFn(answerService)
+			}
+
+			outcomes, err := answerService.ExecuteBatch(ctx, datastore.DefaultTenant, &tc.req, authorized)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				require.Equal(t, tc.wantErrMsg, err.(*util.ServiceError).Error())
+				return
+			}
+
+			require.Nil(t, err)
+			require.Len(t, outcomes, len(tc.wantCodes))
+
+			for i, outcome := range outcomes {
+				if tc.wantCodes[i] != 0 {
+					require.Equal(t, tc.wantCodes[i], outcome.Err.(*util.ServiceError).ErrCode(), i)
+					require.Nil(t, outcome.Answer)
+					continue
+				}
+
+				require.Nil(t, outcome.Err, i)
+
+				if tc.wantKeys[i] == "" {
+					require.Nil(t, outcome.Answer)
+					continue
+				}
+
+				require.Equal(t, tc.wantKeys[i], outcome.Answer.Key)
+				require.Empty(t, outcome.Answer.Outbox)
+			}
+		})
+	}
+}
+
+func TestAnswerService_CreateAnswer_WithTransactor(t *testing.T) {
+	ctx := context.Background()
+	tt := []struct {
+		name        string
+		wantErr     bool
+		wantErrMsg  string
+		wantErrCode int
+		dbFn        func(a *AnswerService)
+	}{
+		{
+			name: "should_create_answer_and_outbox_in_one_transaction",
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+				transactor, _ := a.transactor.(*mocks.MockTransactor)
+
+				transactor.EXPECT().WithTransaction(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, fn func(ctx context.Context) error) error {
+					return fn(ctx)
+				})
+
+				answerRepo.EXPECT().LastGeneration(gomock.Any(), datastore.DefaultTenant, "some-key").Return(int64(0), nil)
+				answerRepo.EXPECT().Create(gomock.Any(), withOutbox(datastore.CreateEvent, "some-value")).Return(nil)
+			},
+		},
+
+		{
+			name: "should_fail_to_create_answer_when_write_fails",
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
+				answerRepo, _ := a.answerRepo.(*mocks.MockAnswerRepository)
+				transactor, _ := a.transactor.(*mocks.MockTransactor)
+
+				transactor.EXPECT().WithTransaction(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, fn func(ctx context.Context) error) error {
+					return fn(ctx)
+				})
+
+				answerRepo.EXPECT().LastGeneration(gomock.Any(), datastore.DefaultTenant, "some-key").Return(int64(0), nil)
+				answerRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(errors.New("failed"))
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusInternalServerError,
+			wantErrMsg:  "failed",
+		},
+
+		{
+			name: "should_fail_to_create_answer_when_commit_fails",
+			dbFn: func(a *AnswerService) {
+				expectSchemas(a)
+
+				transactor, _ := a.transactor.(*mocks.MockTransactor)
+
+				transactor.EXPECT().WithTransaction(gomock.Any(), gomock.Any()).Return(errors.New("commit failed"))
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusInternalServerError,
+			wantErrMsg:  "commit failed",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			answerService := provideTransactionalAnswerService(ctrl)
+
+			if tc.dbFn != nil {
+				tc.dbFn(answerService)
+			}
+
+			answer, err := answerService.CreateAnswer(ctx, datastore.DefaultTenant, &datastore.CreateAnswer{Key: "some-key", Value: json.RawMessage(`"some-value"`)})
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				require.Equal(t, tc.wantErrMsg, err.(*util.ServiceError).Error())
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, "some-key", answer.Key)
+			require.Empty(t, answer.Outbox)
+		})
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Now()
+	future := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+
+	tt := []struct {
+		name    string
+		expiry  datastore.Expiry
+		want    primitive.DateTime
+		wantErr bool
+	}{
+		{name: "should_not_expire", expiry: datastore.Expiry{}},
+		{name: "should_expire_after_ttl", expiry: datastore.Expiry{TTL: 60}, want: primitive.NewDateTimeFromTime(now.Add(time.Minute))},
+		{name: "should_expire_at_time", expiry: datastore.Expiry{ExpiresAt: &future}, want: primitive.NewDateTimeFromTime(future)},
+		{name: "should_reject_negative_ttl", expiry: datastore.Expiry{TTL: -1}, wantErr: true},
+		{name: "should_reject_past_time", expiry: datastore.Expiry{ExpiresAt: &past}, wantErr: true},
+		{name: "should_reject_ttl_and_time", expiry: datastore.Expiry{TTL: 60, ExpiresAt: &future}, wantErr: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			expiresAt, err := expiry(tc.expiry, now)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, http.StatusBadRequest, err.(*util.ServiceError).ErrCode())
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, tc.want, expiresAt)
+		})
+	}
+}
+
+func TestAnswerService_UpdateAnswer_Expiry(t *testing.T) {
+	ctx := context.Background()
+
+	current := primitive.NewDateTimeFromTime(time.Now().Add(time.Hour))
+
+	tt := []struct {
+		name        string
+		req         *datastore.UpdateAnswer
+		wantExpiry  func(expiresAt primitive.DateTime) bool
+		wantErr     bool
+		wantErrCode int
+	}{
+		{
+			name:       "should_keep_expiry",
+			req:        &datastore.UpdateAnswer{Value: json.RawMessage(`"new-value"`)},
+			wantExpiry: func(expiresAt primitive.DateTime) bool { return expiresAt == current },
+		},
+
+		{
+			name: "should_set_expiry",
+			req:  &datastore.UpdateAnswer{Value: json.RawMessage(`"new-value"`), Expiry: datastore.Expiry{TTL: 10}},
+			wantExpiry: func(expiresAt primitive.DateTime) bool {
+				return expiresAt != current && expiresAt.Time().Before(time.Now().Add(11*time.Second))
+			},
+		},
+
+		{
+			name:       "should_remove_expiry",
+			req:        &datastore.UpdateAnswer{Value: json.RawMessage(`"new-value"`), Persist: true},
+			wantExpiry: func(expiresAt primitive.DateTime) bool { return expiresAt == 0 },
+		},
+
+		{
+			name:        "should_fail_to_persist_with_expiry",
+			req:         &datastore.UpdateAnswer{Value: json.RawMessage(`"new-value"`), Persist: true, Expiry: datastore.Expiry{TTL: 10}},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			answerService := provideAnswerService(ctrl)
+			expectSchemas(answerService)
+
+			answerRepo, _ := answerService.answerRepo.(*mocks.MockAnswerRepository)
+
+			if !tc.wantErr {
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(&datastore.Answer{
+					UID:       "12345",
+					TenantID:  datastore.DefaultTenant,
+					Key:       "some-key",
+					Values:    []datastore.Value{{Value: "some-value"}},
+					Version:   1,
+					ExpiresAt: current,
+				}, nil)
+
+				answerRepo.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any(), int64(0)).DoAndReturn(
+					func(ctx context.Context, answer *datastore.Answer, value *datastore.Value, version int64) (*datastore.Answer, error) {
+						require.True(t, tc.wantExpiry(answer.ExpiresAt), "unexpected expiry %v", answer.ExpiresAt.Time())
+						return answer, nil
+					})
+			}
+
+			_, err := answerService.UpdateAnswer(ctx, datastore.DefaultTenant, "some-key", tc.req, nil)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				return
+			}
+
+			require.Nil(t, err)
+		})
+	}
+}
+
+func TestAnswerService_ExpireAnswers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	answerService := provideAnswerService(ctrl)
+	answerRepo, _ := answerService.answerRepo.(*mocks.MockAnswerRepository)
+
+	expiresAt := primitive.NewDateTimeFromTime(time.Now().Add(-time.Second))
+	expired := []datastore.Answer{
+		{UID: "12345", TenantID: datastore.DefaultTenant, Key: "some-key", Values: []datastore.Value{{Value: "some-value"}}, Version: 1, ExpiresAt: expiresAt},
+		{UID: "67890", TenantID: datastore.DefaultTenant, Key: "other-key", Values: []datastore.Value{{Value: "other-value"}}, Version: 3, ExpiresAt: expiresAt},
+	}
+
+	answerRepo.EXPECT().FindExpired(gomock.Any(), gomock.Any(), expiryBatchSize).Return(expired, nil)
+	answerRepo.EXPECT().Delete(gomock.Any(), withOutbox(datastore.ExpireEvent, "some-value"), int64(1)).Return(nil)
+
+	// updated since it was read, with a later expiry
+	answerRepo.EXPECT().Delete(gomock.Any(), withOutbox(datastore.ExpireEvent, "other-value"), int64(3)).Return(datastore.ErrVersionMismatch)
+
+	n, err := answerService.ExpireAnswers(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 1, n)
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/auth"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/util"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+	ErrAPIKeyRevoked  = errors.New("api key is revoked")
+	ErrScopeForbidden = errors.New("can't grant a scope the caller doesn't have")
+)
+
+// lastUsedResolution bounds how often using a key is recorded,
+// so that busy keys don't cost a write on every request.
+const lastUsedResolution = time.Minute
+
+// APIKeyService issues the api keys services authenticate with, and
+// authenticates the requests presenting them. Keys are read from the
+// store on every request, so a revoked or expired key is rejected by
+// every instance right away.
+type APIKeyService struct {
+	apiKeyRepo datastore.APIKeyRepository
+}
+
+func NewAPIKeyService(apiKeyRepo datastore.APIKeyRepository) *APIKeyService {
+	return &APIKeyService{apiKeyRepo: apiKeyRepo}
+}
+
+func (a *APIKeyService) CreateAPIKey(ctx context.Context, tenantID string, req *datastore.CreateAPIKey) (*datastore.IssuedAPIKey, error) {
+	if err := validateScopes(ctx, req.Scopes); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	apiKey := &datastore.APIKey{
+		ID:        primitive.NewObjectID(),
+		UID:       uuid.NewString(),
+		TenantID:  tenantID,
+		Name:      req.Name,
+		Scopes:    dedupScopes(req.Scopes),
+		CreatedAt: primitive.NewDateTimeFromTime(now),
+		UpdatedAt: primitive.NewDateTimeFromTime(now),
+	}
+
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(now) {
+			return nil, util.NewServiceError(http.StatusBadRequest, errors.New("expires_at must be in the future"))
+		}
+		apiKey.ExpiresAt = primitive.NewDateTimeFromTime(*req.ExpiresAt)
+	}
+
+	key, err := assignKey(apiKey)
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	if err := a.apiKeyRepo.Create(ctx, apiKey); err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	return &datastore.IssuedAPIKey{APIKey: apiKey, Key: key}, nil
+}
+
+func (a *APIKeyService) FindAPIKeys(ctx context.Context, tenantID string) ([]datastore.APIKey, error) {
+	keys, err := a.apiKeyRepo.FindMany(ctx, tenantID)
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	return keys, nil
+}
+
+func (a *APIKeyService) FindAPIKeyByUID(ctx context.Context, tenantID, uid string) (*datastore.APIKey, error) {
+	apiKey, err := a.apiKeyRepo.FindByUID(ctx, tenantID, uid)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, datastore.ErrAPIKeyNotFound) {
+			statusCode = http.StatusNotFound
+		}
+		return nil, util.NewServiceError(statusCode, err)
+	}
+
+	return apiKey, nil
+}
+
+// RotateAPIKey replaces the key identified by uid with a new one,
+// keeping its name, scopes and expiry. The old key stops working
+// right away. Like a new key, it can only be rotated by a caller
+// having all its scopes.
+func (a *APIKeyService) RotateAPIKey(ctx context.Context, tenantID, uid string) (*datastore.IssuedAPIKey, error) {
+	apiKey, err := a.FindAPIKeyByUID(ctx, tenantID, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if apiKey.RevokedAt != 0 {
+		return nil, util.NewServiceError(http.StatusConflict, ErrAPIKeyRevoked)
+	}
+
+	if err := validateScopes(ctx, apiKey.Scopes); err != nil {
+		return nil, err
+	}
+
+	key, err := assignKey(apiKey)
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	apiKey.LastUsedAt = 0
+	apiKey.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+	if err := a.apiKeyRepo.Update(ctx, apiKey); err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	return &datastore.IssuedAPIKey{APIKey: apiKey, Key: key}, nil
+}
+
+// RevokeAPIKey revokes the key identified by uid. Revoked keys are
+// kept, so that the history of who used them can still be looked up.
+func (a *APIKeyService) RevokeAPIKey(ctx context.Context, tenantID, uid string) (*datastore.APIKey, error) {
+	apiKey, err := a.FindAPIKeyByUID(ctx, tenantID, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if apiKey.RevokedAt != 0 {
+		return apiKey, nil
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	apiKey.RevokedAt = now
+	apiKey.UpdatedAt = now
+
+	if err := a.apiKeyRepo.Update(ctx, apiKey); err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	return apiKey, nil
+}
+
+// Authenticate returns the principal of the api key presented by a
+// request, it fails with a 401 for unknown, revoked or expired keys.
+func (a *APIKeyService) Authenticate(ctx context.Context, key string) (*auth.Principal, error) {
+	prefix, ok := auth.APIKeyPrefix(key)
+	if !ok {
+		return nil, util.NewServiceError(http.StatusUnauthorized, ErrInvalidAPIKey)
+	}
+
+	apiKey, err := a.apiKeyRepo.FindByPrefix(ctx, prefix)
+	if errors.Is(err, datastore.ErrAPIKeyNotFound) {
+		return nil, util.NewServiceError(http.StatusUnauthorized, ErrInvalidAPIKey)
+	}
+
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	now := time.Now()
+	if !auth.MatchAPIKey(key, apiKey.Hash) || apiKey.RevokedAt != 0 ||
+		(apiKey.ExpiresAt != 0 && !apiKey.ExpiresAt.Time().After(now)) {
+		return nil, util.NewServiceError(http.StatusUnauthorized, ErrInvalidAPIKey)
+	}
+
+	if now.Sub(apiKey.LastUsedAt.Time()) >= lastUsedResolution {
+		err := a.apiKeyRepo.TouchLastUsed(ctx, apiKey.UID, primitive.NewDateTimeFromTime(now))
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to record the use of api key %s", apiKey.UID)
+		}
+	}
+
+	return &auth.Principal{
+		Subject:  "api_key:" + apiKey.UID,
+		TenantID: apiKey.TenantID,
+		Scopes:   apiKey.Scopes,
+	}, nil
+}
+
+// assignKey gives apiKey a new random key, which is returned.
+func assignKey(apiKey *datastore.APIKey) (string, error) {
+	key, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		return "", err
+	}
+
+	apiKey.Prefix = prefix
+	apiKey.Hash = auth.HashAPIKey(key)
+
+	return key, nil
+}
+
+// validateScopes checks that scopes are known, and that the caller
+// has them, so that a key can't be used to issue a more powerful one.
+func validateScopes(ctx context.Context, scopes []string) error {
+	if len(scopes) == 0 {
+		return util.NewServiceError(http.StatusBadRequest, errors.New("at least one scope is required"))
+	}
+
+	principal, authenticated := auth.PrincipalFrom(ctx)
+
+	for _, scope := range scopes {
+		if !auth.IsScope(scope) {
+			return util.NewServiceError(http.StatusBadRequest, fmt.Errorf("unknown scope %q", scope))
+		}
+
+		if authenticated && !principal.HasScope(scope) {
+			return util.NewServiceError(http.StatusForbidden, ErrScopeForbidden)
+		}
+	}
+
+	return nil
+}
+
+func dedupScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+	deduped := make([]string, 0, len(scopes))
+
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			deduped = append(deduped, scope)
+		}
+	}
+
+	return deduped
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/auth"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/datastore/mocks"
+	"github.com/dotunj/bequest/internal/pkg/util"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func provideAPIKeyService(ctrl *gomock.Controller) *APIKeyService {
+	apiKeyRepo := mocks.NewMockAPIKeyRepository(ctrl)
+
+	return NewAPIKeyService(apiKeyRepo)
+}
+
+func TestAPIKeyService_CreateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	past := time.Now().Add(-time.Hour)
+
+	tt := []struct {
+		name        string
+		ctx         context.Context
+		req         *datastore.CreateAPIKey
+		wantErr     bool
+		wantErrCode int
+		wantScopes  []string
+		dbFn        func(a *APIKeyService)
+	}{
+		{
+			name: "should_create_api_key",
+			ctx:  ctx,
+			req:  &datastore.CreateAPIKey{Name: "billing", Scopes: []string{auth.ScopeAnswersRead, auth.ScopeAnswersRead}},
+			dbFn: func(a *APIKeyService) {
+				apiKeyRepo, _ := a.apiKeyRepo.(*mocks.MockAPIKeyRepository)
+
+				apiKeyRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			wantScopes: []string{auth.ScopeAnswersRead},
+		},
+
+		{
+			name:        "should_fail_to_create_api_key_without_scopes",
+			ctx:         ctx,
+			req:         &datastore.CreateAPIKey{Name: "billing"},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+		},
+
+		{
+			name:        "should_fail_to_create_api_key_with_unknown_scope",
+			ctx:         ctx,
+			req:         &datastore.CreateAPIKey{Name: "billing", Scopes: []string{"answers:everything"}},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+		},
+
+		{
+			name:        "should_fail_to_create_expired_api_key",
+			ctx:         ctx,
+			req:         &datastore.CreateAPIKey{Name: "billing", Scopes: []string{auth.ScopeAnswersRead}, ExpiresAt: &past},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+		},
+
+		{
+			name: "should_fail_to_grant_scope_the_caller_lacks",
+			ctx: auth.WithPrincipal(ctx, &auth.Principal{
+				Subject: "api_key:admin",
+				Scopes:  []string{auth.ScopeAPIKeys, auth.ScopeAnswersRead},
+			}),
+			req:         &datastore.CreateAPIKey{Name: "billing", Scopes: []string{auth.ScopeAnswersWrite}},
+			wantErr:     true,
+			wantErrCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			apiKeyService := provideAPIKeyService(ctrl)
+
+			if tc.dbFn != nil {
+				tc.dbFn(apiKeyService)
+			}
+
+			issued, err := apiKeyService.CreateAPIKey(tc.ctx, datastore.DefaultTenant, tc.req)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, datastore.DefaultTenant, issued.TenantID)
+			require.Equal(t, tc.wantScopes, issued.Scopes)
+
+			prefix, ok := auth.APIKeyPrefix(issued.Key)
+			require.True(t, ok)
+			require.Equal(t, prefix, issued.Prefix)
+			require.True(t, auth.MatchAPIKey(issued.Key, issued.Hash))
+		})
+	}
+}
+
+func TestAPIKeyService_Authenticate(t *testing.T) {
+	ctx := context.Background()
+
+	key, prefix, err := auth.NewAPIKey()
+	require.Nil(t, err)
+
+	now := time.Now()
+	newAPIKey := func() *datastore.APIKey {
+		return &datastore.APIKey{
+			UID:        "some-uid",
+			TenantID:   "acme",
+			Prefix:     prefix,
+			Hash:       auth.HashAPIKey(key),
+			Scopes:     []string{auth.ScopeAnswersRead},
+			LastUsedAt: primitive.NewDateTimeFromTime(now.Add(-time.Hour)),
+		}
+	}
+
+	tt := []struct {
+		name        string
+		key         string
+		wantErr     bool
+		wantErrCode int
+		dbFn        func(a *APIKeyService)
+	}{
+		{
+			name: "should_authenticate_api_key",
+			key:  key,
+			dbFn: func(a *APIKeyService) {
+				apiKeyRepo, _ := a.apiKeyRepo.(*mocks.MockAPIKeyRepository)
+
+				apiKeyRepo.EXPECT().FindByPrefix(gomock.Any(), prefix).Return(newAPIKey(), nil)
+				apiKeyRepo.EXPECT().TouchLastUsed(gomock.Any(), "some-uid", gomock.Any()).Return(nil)
+			},
+		},
+
+		{
+			name: "should_not_record_recent_use_again",
+			key:  key,
+			dbFn: func(a *APIKeyService) {
+				apiKeyRepo, _ := a.apiKeyRepo.(*mocks.MockAPIKeyRepository)
+
+				apiKey := newAPIKey()
+				apiKey.LastUsedAt = primitive.NewDateTimeFromTime(now)
+
+				apiKeyRepo.EXPECT().FindByPrefix(gomock.Any(), prefix).Return(apiKey, nil)
+			},
+		},
+
+		{
+			name:        "should_reject_malformed_api_key",
+			key:         "not-a-key",
+			wantErr:     true,
+			wantErrCode: http.StatusUnauthorized,
+		},
+
+		{
+			name:    "should_reject_unknown_api_key",
+			key:     key,
+			wantErr: true,
+			dbFn: func(a *APIKeyService) {
+				apiKeyRepo, _ := a.apiKeyRepo.(*mocks.MockAPIKeyRepository)
+
+				apiKeyRepo.EXPECT().FindByPrefix(gomock.Any(), prefix).Return(nil, datastore.ErrAPIKeyNotFound)
+			},
+			wantErrCode: http.StatusUnauthorized,
+		},
+
+		{
+			name:    "should_reject_api_key_with_wrong_secret",
+			key:     prefix + "_wrong-secret",
+			wantErr: true,
+			dbFn: func(a *APIKeyService) {
+				apiKeyRepo, _ := a.apiKeyRepo.(*mocks.MockAPIKeyRepository)
+
+				apiKeyRepo.EXPECT().FindByPrefix(gomock.Any(), prefix).Return(newAPIKey(), nil)
+			},
+			wantErrCode: http.StatusUnauthorized,
+		},
+
+		{
+			name:    "should_reject_revoked_api_key",
+			key:     key,
+			wantErr: true,
+			dbFn: func(a *APIKeyService) {
+				apiKeyRepo, _ := a.apiKeyRepo.(*mocks.MockAPIKeyRepository)
+
+				apiKey := newAPIKey()
+				apiKey.RevokedAt = primitive.NewDateTimeFromTime(now)
+
+				apiKeyRepo.EXPECT().FindByPrefix(gomock.Any(), prefix).Return(apiKey, nil)
+			},
+			wantErrCode: http.StatusUnauthorized,
+		},
+
+		{
+			name:    "should_reject_expired_api_key",
+			key:     key,
+			wantErr: true,
+			dbFn: func(a *APIKeyService) {
+				apiKeyRepo, _ := a.apiKeyRepo.(*mocks.MockAPIKeyRepository)
+
+				apiKey := newAPIKey()
+				apiKey.ExpiresAt = primitive.NewDateTimeFromTime(now.Add(-time.Second))
+
+				apiKeyRepo.EXPECT().FindByPrefix(gomock.Any(), prefix).Return(apiKey, nil)
+			},
+			wantErrCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			apiKeyService := provideAPIKeyService(ctrl)
+
+			if tc.dbFn != nil {
+				tc.dbFn(apiKeyService)
+			}
+
+			principal, err := apiKeyService.Authenticate(ctx, tc.key)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, &auth.Principal{
+				Subject:  "api_key:some-uid",
+				TenantID: "acme",
+				Scopes:   []string{auth.ScopeAnswersRead},
+			}, principal)
+		})
+	}
+}
+
+func TestAPIKeyService_RotateAPIKey(t *testing.T) {
+	ctx := context.Background()
+
+	tt := []struct {
+		name        string
+		ctx         context.Context
+		revoked     bool
+		wantErr     bool
+		wantErrCode int
+	}{
+		{name: "should_rotate_api_key", ctx: ctx},
+		{name: "should_fail_to_rotate_revoked_api_key", ctx: ctx, revoked: true, wantErr: true, wantErrCode: http.StatusConflict},
+		{
+			name: "should_fail_to_rotate_api_key_with_scope_the_caller_lacks",
+			ctx: auth.WithPrincipal(ctx, &auth.Principal{
+				Subject: "api_key:admin",
+				Scopes:  []string{auth.ScopeAPIKeys},
+			}),
+			wantErr:     true,
+			wantErrCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			apiKeyService := provideAPIKeyService(ctrl)
+			apiKeyRepo, _ := apiKeyService.apiKeyRepo.(*mocks.MockAPIKeyRepository)
+
+			existing := &datastore.APIKey{
+				UID:      "some-uid",
+				TenantID: datastore.DefaultTenant,
+				Scopes:   []string{auth.ScopeAnswersRead, auth.ScopeAnswersWrite},
+				Prefix:   "bq_000000000000",
+				Hash:     "old-hash",
+			}
+			if tc.revoked {
+				existing.RevokedAt = primitive.NewDateTimeFromTime(time.Now())
+			}
+
+			apiKeyRepo.EXPECT().FindByUID(gomock.Any(), datastore.DefaultTenant, "some-uid").Return(existing, nil)
+			if !tc.wantErr {
+				apiKeyRepo.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
+			}
+
+			issued, err := apiKeyService.RotateAPIKey(tc.ctx, datastore.DefaultTenant, "some-uid")
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, "some-uid", issued.UID)
+			require.NotEqual(t, "bq_000000000000", issued.Prefix)
+			require.True(t, auth.MatchAPIKey(issued.Key, issued.Hash))
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/dotunj/bequest/internal/pkg/auth"
 	"github.com/dotunj/bequest/internal/pkg/datastore"
 	"github.com/dotunj/bequest/internal/pkg/util"
 	"github.com/google/uuid"
@@ -15,17 +16,33 @@ import (
 type EventService struct {
 	answerRepo datastore.AnswerRepository
 	eventRepo  datastore.EventRepository
+	dispatcher *OutboxDispatcher
 }
 
-func NewEventService(answerRepo datastore.AnswerRepository, eventRepo datastore.EventRepository) *EventService {
+func NewEventService(answerRepo datastore.AnswerRepository, eventRepo datastore.EventRepository, dispatcher *OutboxDispatcher) *EventService {
 	return &EventService{
 		answerRepo: answerRepo,
 		eventRepo:  eventRepo,
+		dispatcher: dispatcher,
 	}
 }
 
-func (e *EventService) FindHistoryByKey(ctx context.Context, key string, pageable datastore.Pageable) ([]datastore.Event, datastore.PaginationData, error) {
-	answer, err := e.answerRepo.FindByKey(ctx, key)
+// FindHistoryByKey returns a page of the events of key, only those of
+// generation when it isn't zero. The history of a key stays available
+// after it is deleted. Pending events of the key are delivered first,
+// it fails with a 500 when they can't be.
+func (e *EventService) FindHistoryByKey(ctx context.Context, tenantID, key string, generation int64, pageable datastore.Pageable) ([]datastore.Event, datastore.PaginationData, error) {
+	answer, err := e.answerRepo.FindByKey(ctx, tenantID, key)
+	if errors.Is(err, datastore.ErrAnswerNotFound) {
+		var deleted []datastore.Answer
+		deleted, err = e.answerRepo.FindDeleted(ctx, tenantID, key)
+		if err == nil && len(deleted) == 0 {
+			err = datastore.ErrAnswerNotFound
+		} else if err == nil {
+			answer = &deleted[0]
+		}
+	}
+
 	if err != nil {
 		statusCode := http.StatusInternalServerError
 		if errors.Is(err, datastore.ErrAnswerNotFound) {
@@ -34,34 +51,40 @@ func (e *EventService) FindHistoryByKey(ctx context.Context, key string, pageabl
 		return nil, datastore.PaginationData{}, util.NewServiceError(statusCode, err)
 	}
 
-	events, pagination, err := e.eventRepo.FindManyByKey(ctx, answer.Key, pageable)
+	// Events still in the outbox are delivered first, so the
+	// history always covers every change made to the answer
+	err = e.dispatcher.DispatchKey(ctx, answer.TenantID, answer.Key)
+	if err != nil {
+		return nil, datastore.PaginationData{}, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	events, pagination, err := e.eventRepo.FindManyByKey(ctx, answer.TenantID, answer.Key, generation, pageable)
 	if err != nil {
-		return nil, datastore.PaginationData{}, err
+		return nil, datastore.PaginationData{}, util.NewServiceError(http.StatusInternalServerError, err)
 	}
 
 	return events, pagination, nil
 }
 
-func (e *EventService) CreateEvent(ctx context.Context, answerEvent *datastore.AnswerEvent) (*datastore.Event, error) {
-	answer := answerEvent.Answer
-
+// newOutbox returns the outbox recording a change to answer, to be
+// written along with the change itself.
+func newOutbox(ctx context.Context, eventType datastore.EventType, answer *datastore.Answer, value datastore.Value) []datastore.OutboxMessage {
 	event := &datastore.Event{
-		ID:   primitive.NewObjectID(),
-		UID:  uuid.NewString(),
-		Type: answerEvent.Type,
+		ID:       primitive.NewObjectID(),
+		UID:      uuid.NewString(),
+		TenantID: answer.TenantID,
+		Type:     eventType,
+		Actor:    auth.Actor(ctx),
 		Data: &datastore.EventData{
-			Key:   answer.Key,
-			Value: answer.Values[len(answer.Values)-1].Value,
+			Key:        answer.Key,
+			Value:      value.Value,
+			Type:       value.ValueType(),
+			Generation: answer.Generation,
 		},
 		CreatedAt:      primitive.NewDateTimeFromTime(time.Now()),
 		UpdatedAt:      primitive.NewDateTimeFromTime(time.Now()),
 		DocumentStatus: datastore.ActiveDocumentStatus,
 	}
 
-	err := e.eventRepo.Create(ctx, event)
-	if err != nil {
-		return nil, util.NewServiceError(http.StatusInternalServerError, err)
-	}
-
-	return event, nil
+	return []datastore.OutboxMessage{newOutboxMessage(event)}
 }
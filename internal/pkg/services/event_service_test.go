@@ -17,115 +17,18 @@ func provideEventService(ctrl *gomock.Controller) *EventService {
 	answerRepo := mocks.NewMockAnswerRepository(ctrl)
 	eventRepo := mocks.NewMockEventRepository(ctrl)
 
-	eventService := NewEventService(answerRepo, eventRepo)
-	return eventService
-}
-
-func TestEventService_CreateEvent(t *testing.T) {
-	type args struct {
-		ctx   context.Context
-		event *datastore.AnswerEvent
-	}
+	dispatcher := NewOutboxDispatcher(mocks.NewMockOutboxRepository(ctrl), eventRepo, OutboxOptions{})
 
-	ctx := context.Background()
-	tt := []struct {
-		name        string
-		args        args
-		wantErr     bool
-		wantErrMsg  string
-		wantErrCode int
-		wantEvent   *datastore.Event
-		dbFn        func(e *EventService)
-	}{
-		{
-			name: "should_create_event",
-			args: args{
-				ctx: ctx,
-				event: &datastore.AnswerEvent{
-					Answer: &datastore.Answer{
-						UID:    "12345",
-						Key:    "some-key",
-						Values: []datastore.Value{{Value: "some-value"}},
-					},
-					Type: datastore.CreateEvent,
-				},
-			},
-			dbFn: func(e *EventService) {
-				eventRepo, _ := e.eventRepo.(*mocks.MockEventRepository)
-
-				eventRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
-			},
-			wantEvent: &datastore.Event{
-				Type: datastore.CreateEvent,
-				Data: &datastore.EventData{
-					Key:   "some-key",
-					Value: "some-value",
-				},
-			},
-		},
-
-		{
-			name: "should_fail_to_create_event",
-			args: args{
-				ctx: ctx,
-				event: &datastore.AnswerEvent{
-					Answer: &datastore.Answer{
-						UID:    "12345",
-						Key:    "some-key",
-						Values: []datastore.Value{{Value: "some-value"}},
-					},
-					Type: datastore.CreateEvent,
-				},
-			},
-			dbFn: func(e *EventService) {
-				eventRepo, _ := e.eventRepo.(*mocks.MockEventRepository)
-
-				eventRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(errors.New("failed"))
-			},
-			wantErr:     true,
-			wantErrCode: http.StatusInternalServerError,
-			wantErrMsg:  "failed",
-		},
-	}
-
-	for _, tc := range tt {
-		t.Run(tc.name, func(t *testing.T) {
-			ctrl := gomock.NewController(t)
-
-			eventService := provideEventService(ctrl)
-
-			if tc.dbFn != nil {
-				tc.dbFn(eventService)
-			}
-
-			event, err := eventService.CreateEvent(tc.args.ctx, tc.args.event)
-
-			if tc.wantErr {
-				require.NotNil(t, err)
-				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
-				require.Equal(t, tc.wantErrMsg, err.(*util.ServiceError).Error())
-				return
-			}
-
-			require.Nil(t, err)
-			require.NotEmpty(t, event.UID)
-			require.NotEmpty(t, event.CreatedAt)
-			require.NotEmpty(t, event.UpdatedAt)
-			require.Empty(t, event.DeletedAt)
-
-			require.Equal(t, tc.wantEvent.Type, event.Type)
-			require.Equal(t, tc.wantEvent.Data.Key, event.Data.Key)
-			require.Equal(t, tc.wantEvent.Data.Value, event.Data.Value)
-
-		})
-	}
+	eventService := NewEventService(answerRepo, eventRepo, dispatcher)
+	return eventService
 }
 
 func TestEventService_FindHistoryByKey(t *testing.T) {
 	type args struct {
-		ctx      context.Context
-		key      string
-		pageable datastore.Pageable
+		ctx        context.Context
+		key        string
+		generation int64
+		pageable   datastore.Pageable
 	}
 
 	ctx := context.Background()
@@ -134,6 +37,9 @@ func TestEventService_FindHistoryByKey(t *testing.T) {
 		name               string
 		args               args
 		dbFn               func(e *EventService)
+		wantErr            bool
+		wantErrMsg         string
+		wantErrCode        int
 		wantEvents         []datastore.Event
 		wantPaginationData datastore.PaginationData
 	}{
@@ -152,13 +58,17 @@ func TestEventService_FindHistoryByKey(t *testing.T) {
 
 				answerRepo, _ := e.answerRepo.(*mocks.MockAnswerRepository)
 				eventRepo, _ := e.eventRepo.(*mocks.MockEventRepository)
+				outboxRepo, _ := e.dispatcher.outboxRepo.(*mocks.MockOutboxRepository)
 
-				answerRepo.EXPECT().FindByKey(gomock.Any(), gomock.Any()).Return(&datastore.Answer{
-					UID: "12345",
-					Key: "some-key",
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(&datastore.Answer{
+					UID:      "12345",
+					TenantID: datastore.DefaultTenant,
+					Key:      "some-key",
 				}, nil)
 
-				eventRepo.EXPECT().FindManyByKey(gomock.Any(), gomock.Any(), gomock.Any()).Return([]datastore.Event{
+				outboxRepo.EXPECT().FindPendingByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return([]datastore.OutboxMessage{}, nil)
+
+				eventRepo.EXPECT().FindManyByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any(), int64(0), gomock.Any()).Return([]datastore.Event{
 					{UID: "12345"},
 					{UID: "123456"},
 				}, datastore.PaginationData{
@@ -183,6 +93,121 @@ func TestEventService_FindHistoryByKey(t *testing.T) {
 				TotalPage: 3,
 			},
 		},
+
+		{
+			name: "should_deliver_pending_events_before_reading_history",
+			args: args{
+				ctx:      ctx,
+				key:      "some-key",
+				pageable: datastore.Pageable{Page: 1, PerPage: 10, Sort: -1},
+			},
+			dbFn: func(e *EventService) {
+				answerRepo, _ := e.answerRepo.(*mocks.MockAnswerRepository)
+				eventRepo, _ := e.eventRepo.(*mocks.MockEventRepository)
+				outboxRepo, _ := e.dispatcher.outboxRepo.(*mocks.MockOutboxRepository)
+
+				message := newOutbox(context.Background(), datastore.UpdateEvent, &datastore.Answer{TenantID: datastore.DefaultTenant, Key: "some-key"}, datastore.Value{Value: "new-value"})[0]
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(&datastore.Answer{TenantID: datastore.DefaultTenant, Key: "some-key"}, nil)
+
+				gomock.InOrder(
+					outboxRepo.EXPECT().FindPendingByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return([]datastore.OutboxMessage{message}, nil),
+					eventRepo.EXPECT().Create(gomock.Any(), message.Event).Return(nil),
+					outboxRepo.EXPECT().Delete(gomock.Any(), message.Event.ID).Return(nil),
+					eventRepo.EXPECT().FindManyByKey(gomock.Any(), datastore.DefaultTenant, "some-key", int64(0), gomock.Any()).Return([]datastore.Event{*message.Event}, datastore.PaginationData{Total: 1}, nil),
+				)
+			},
+			wantPaginationData: datastore.PaginationData{Total: 1},
+		},
+
+		{
+			name: "should_find_history_of_generation_of_deleted_key",
+			args: args{
+				ctx:        ctx,
+				key:        "some-key",
+				generation: 2,
+				pageable:   datastore.Pageable{Page: 1, PerPage: 10, Sort: -1},
+			},
+			dbFn: func(e *EventService) {
+				answerRepo, _ := e.answerRepo.(*mocks.MockAnswerRepository)
+				eventRepo, _ := e.eventRepo.(*mocks.MockEventRepository)
+				outboxRepo, _ := e.dispatcher.outboxRepo.(*mocks.MockOutboxRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(nil, datastore.ErrAnswerNotFound)
+				answerRepo.EXPECT().FindDeleted(gomock.Any(), datastore.DefaultTenant, "some-key").Return([]datastore.Answer{
+					{TenantID: datastore.DefaultTenant, Key: "some-key", Generation: 2},
+					{TenantID: datastore.DefaultTenant, Key: "some-key", Generation: 1},
+				}, nil)
+
+				outboxRepo.EXPECT().FindPendingByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return([]datastore.OutboxMessage{}, nil)
+				eventRepo.EXPECT().FindManyByKey(gomock.Any(), datastore.DefaultTenant, "some-key", int64(2), gomock.Any()).Return([]datastore.Event{{UID: "12345"}}, datastore.PaginationData{Total: 1}, nil)
+			},
+			wantEvents:         []datastore.Event{{UID: "12345"}},
+			wantPaginationData: datastore.PaginationData{Total: 1},
+		},
+
+		{
+			name: "should_fail_to_find_history_of_unknown_key",
+			args: args{
+				ctx:      ctx,
+				key:      "some-key",
+				pageable: datastore.Pageable{Page: 1, PerPage: 10, Sort: -1},
+			},
+			dbFn: func(e *EventService) {
+				answerRepo, _ := e.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(nil, datastore.ErrAnswerNotFound)
+				answerRepo.EXPECT().FindDeleted(gomock.Any(), datastore.DefaultTenant, "some-key").Return(nil, nil)
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusNotFound,
+			wantErrMsg:  datastore.ErrAnswerNotFound.Error(),
+		},
+
+		{
+			name: "should_fail_to_find_history_when_events_are_not_read",
+			args: args{
+				ctx:      ctx,
+				key:      "some-key",
+				pageable: datastore.Pageable{Page: 1, PerPage: 10, Sort: -1},
+			},
+			dbFn: func(e *EventService) {
+				answerRepo, _ := e.answerRepo.(*mocks.MockAnswerRepository)
+				eventRepo, _ := e.eventRepo.(*mocks.MockEventRepository)
+				outboxRepo, _ := e.dispatcher.outboxRepo.(*mocks.MockOutboxRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return(&datastore.Answer{TenantID: datastore.DefaultTenant, Key: "some-key"}, nil)
+				outboxRepo.EXPECT().FindPendingByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return([]datastore.OutboxMessage{}, nil)
+				eventRepo.EXPECT().FindManyByKey(gomock.Any(), datastore.DefaultTenant, "some-key", int64(0), gomock.Any()).
+					Return(nil, datastore.PaginationData{}, errors.New("failed"))
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusInternalServerError,
+			wantErrMsg:  "failed",
+		},
+
+		{
+			name: "should_fail_to_find_history_when_pending_events_are_not_delivered",
+			args: args{
+				ctx:      ctx,
+				key:      "some-key",
+				pageable: datastore.Pageable{Page: 1, PerPage: 10, Sort: -1},
+			},
+			dbFn: func(e *EventService) {
+				answerRepo, _ := e.answerRepo.(*mocks.MockAnswerRepository)
+				eventRepo, _ := e.eventRepo.(*mocks.MockEventRepository)
+				outboxRepo, _ := e.dispatcher.outboxRepo.(*mocks.MockOutboxRepository)
+
+				message := newOutbox(context.Background(), datastore.UpdateEvent, &datastore.Answer{TenantID: datastore.DefaultTenant, Key: "some-key"}, datastore.Value{Value: "new-value"})[0]
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(&datastore.Answer{TenantID: datastore.DefaultTenant, Key: "some-key"}, nil)
+				outboxRepo.EXPECT().FindPendingByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return([]datastore.OutboxMessage{message}, nil)
+				eventRepo.EXPECT().Create(gomock.Any(), message.Event).Return(errors.New("failed"))
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusInternalServerError,
+			wantErrMsg:  "failed",
+		},
 	}
 
 	for _, tc := range tt {
@@ -195,10 +220,19 @@ func TestEventService_FindHistoryByKey(t *testing.T) {
 				tc.dbFn(eventService)
 			}
 
-			events, paginationData, err := eventService.FindHistoryByKey(tc.args.ctx, tc.args.key, tc.args.pageable)
+			events, paginationData, err := eventService.FindHistoryByKey(tc.args.ctx, datastore.DefaultTenant, tc.args.key, tc.args.generation, tc.args.pageable)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				require.Equal(t, tc.wantErrMsg, err.(*util.ServiceError).Error())
+				return
+			}
 
 			require.Nil(t, err)
-			require.Equal(t, tc.wantEvents, events)
+			if tc.wantEvents != nil {
+				require.Equal(t, tc.wantEvents, events)
+			}
 			require.Equal(t, tc.wantPaginationData, paginationData)
 		})
 	}
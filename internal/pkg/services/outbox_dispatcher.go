@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const outboxShutdownTimeout = 5 * time.Second
+
+// Sink receives the events dispatched from the outbox. A message is
+// delivered to every sink again until all of them accepted it, so
+// Publish must be idempotent.
+type Sink interface {
+	Publish(ctx context.Context, event *datastore.Event) error
+}
+
+// OutboxOptions configures the dispatcher, zero values fall back to defaults.
+type OutboxOptions struct {
+	// PollInterval is how often due messages are looked up.
+	PollInterval time.Duration
+
+	// BatchSize is the number of messages read per lookup.
+	BatchSize int
+
+	// MaxAttempts is the number of failed deliveries
+	// after which a message is dead-lettered.
+	MaxAttempts int
+
+	// MinBackoff and MaxBackoff bound the delay before a failed
+	// delivery is retried, which doubles on every attempt.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func (o OutboxOptions) withDefaults() OutboxOptions {
+	if o.PollInterval <= 0 {
+		o.PollInterval = time.Second
+	}
+
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 10
+	}
+
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = time.Second
+	}
+
+	if o.MaxBackoff < o.MinBackoff {
+		o.MaxBackoff = o.MinBackoff
+	}
+
+	return o
+}
+
+// backoff returns the delay before the next delivery of
+// a message that already failed attempts times.
+func (o OutboxOptions) backoff(attempts int) time.Duration {
+	backoff := o.MinBackoff
+	for i := 1; i < attempts && backoff < o.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > o.MaxBackoff {
+		backoff = o.MaxBackoff
+	}
+
+	return backoff
+}
+
+// OutboxDispatcher moves the events written to the outbox along with
+// answer mutations into the events collection and any other sinks.
+type OutboxDispatcher struct {
+	outboxRepo datastore.OutboxRepository
+	sinks      []Sink
+	opts       OutboxOptions
+	notify     chan struct{}
+}
+
+// NewOutboxDispatcher creates a dispatcher delivering events to the
+// events repository first, then to every extra sink.
+func NewOutboxDispatcher(outboxRepo datastore.OutboxRepository, eventRepo datastore.EventRepository, opts OutboxOptions, sinks ...Sink) *OutboxDispatcher {
+	return &OutboxDispatcher{
+		outboxRepo: outboxRepo,
+		sinks:      append([]Sink{&eventSink{eventRepo: eventRepo}}, sinks...),
+		opts:       opts.withDefaults(),
+		notify:     make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes the dispatcher up, so that freshly
+// written events don't wait for the next poll.
+func (d *OutboxDispatcher) Notify() {
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run dispatches due messages until ctx is cancelled, then makes a
+// last pass so that events written before shutdown are delivered.
+func (d *OutboxDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			ctx, cancel := context.WithTimeout(context.Background(), outboxShutdownTimeout)
+			defer cancel()
+
+			if err := d.DispatchDue(ctx); err != nil {
+				logrus.WithError(err).Error("failed to dispatch outbox on shutdown")
+			}
+			return
+		case <-ticker.C:
+		case <-d.notify:
+		}
+
+		if err := d.DispatchDue(ctx); err != nil {
+			logrus.WithError(err).Error("failed to dispatch outbox")
+		}
+	}
+}
+
+// DispatchDue delivers every message that is due. Failed deliveries
+// are rescheduled, an error is only returned when the outbox itself
+// can't be read or written.
+func (d *OutboxDispatcher) DispatchDue(ctx context.Context) error {
+	for {
+		messages, err := d.outboxRepo.FindDue(ctx, primitive.NewDateTimeFromTime(time.Now()), d.opts.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for i := range messages {
+			if err := d.dispatch(ctx, &messages[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(messages) < d.opts.BatchSize {
+			return nil
+		}
+	}
+}
+
+// DispatchKey delivers the pending messages of an answer of tenantID
+// right away, regardless of their backoff, failing if any of them isn't
+// delivered. Failures are left for the background dispatch to reschedule.
+func (d *OutboxDispatcher) DispatchKey(ctx context.Context, tenantID, key string) error {
+	messages, err := d.outboxRepo.FindPendingByKey(ctx, tenantID, key)
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		if err := d.publish(ctx, message.Event); err != nil {
+			return err
+		}
+
+		if err := d.outboxRepo.Delete(ctx, message.Event.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *OutboxDispatcher) dispatch(ctx context.Context, message *datastore.OutboxMessage) error {
+	err := d.publish(ctx, message.Event)
+	if err == nil {
+		return d.outboxRepo.Delete(ctx, message.Event.ID)
+	}
+
+	message.Attempts++
+	message.LastError = err.Error()
+
+	log := logrus.WithError(err).WithField("event", message.Event.UID).WithField("attempts", message.Attempts)
+	if message.Attempts >= d.opts.MaxAttempts {
+		message.Status = datastore.DeadOutboxStatus
+		log.Error("giving up on outbox message, moved to dead letter")
+	} else {
+		message.NextAttemptAt = primitive.NewDateTimeFromTime(time.Now().Add(d.opts.backoff(message.Attempts)))
+		log.Warn("failed to dispatch outbox message, will retry")
+	}
+
+	return d.outboxRepo.Update(ctx, message)
+}
+
+func (d *OutboxDispatcher) publish(ctx context.Context, event *datastore.Event) error {
+	for _, sink := range d.sinks {
+		if err := sink.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// eventSink stores dispatched events in the events collection.
+type eventSink struct {
+	eventRepo datastore.EventRepository
+}
+
+func (s *eventSink) Publish(ctx context.Context, event *datastore.Event) error {
+	err := s.eventRepo.Create(ctx, event)
+	if errors.Is(err, datastore.ErrDuplicateKey) {
+		// delivered before, the outbox message just wasn't removed
+		return nil
+	}
+
+	return err
+}
+
+func newOutboxMessage(event *datastore.Event) datastore.OutboxMessage {
+	return datastore.OutboxMessage{
+		Event:         event,
+		Status:        datastore.PendingOutboxStatus,
+		NextAttemptAt: event.CreatedAt,
+		CreatedAt:     event.CreatedAt,
+	}
+}
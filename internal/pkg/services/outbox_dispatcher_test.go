@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/datastore/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+type sinkFunc func(ctx context.Context, event *datastore.Event) error
+
+func (f sinkFunc) Publish(ctx context.Context, event *datastore.Event) error {
+	return f(ctx, event)
+}
+
+func TestOutboxDispatcher_DispatchDue(t *testing.T) {
+	ctx := context.Background()
+	opts := OutboxOptions{BatchSize: 10, MaxAttempts: 3, MinBackoff: time.Minute, MaxBackoff: time.Hour}
+
+	tt := []struct {
+		name     string
+		attempts int
+		sink     sinkFunc
+		dbFn     func(outboxRepo *mocks.MockOutboxRepository, eventRepo *mocks.MockEventRepository, message datastore.OutboxMessage)
+	}{
+		{
+			name: "should_deliver_event_and_remove_message",
+			dbFn: func(outboxRepo *mocks.MockOutboxRepository, eventRepo *mocks.MockEventRepository, message datastore.OutboxMessage) {
+				gomock.InOrder(
+					eventRepo.EXPECT().Create(gomock.Any(), message.Event).Return(nil),
+					outboxRepo.EXPECT().Delete(gomock.Any(), message.Event.ID).Return(nil),
+				)
+			},
+		},
+
+		{
+			name: "should_remove_message_for_event_delivered_before",
+			dbFn: func(outboxRepo *mocks.MockOutboxRepository, eventRepo *mocks.MockEventRepository, message datastore.OutboxMessage) {
+				eventRepo.EXPECT().Create(gomock.Any(), message.Event).Return(datastore.ErrDuplicateKey)
+				outboxRepo.EXPECT().Delete(gomock.Any(), message.Event.ID).Return(nil)
+			},
+		},
+
+		{
+			name: "should_reschedule_failed_delivery",
+			dbFn: func(outboxRepo *mocks.MockOutboxRepository, eventRepo *mocks.MockEventRepository, message datastore.OutboxMessage) {
+				eventRepo.EXPECT().Create(gomock.Any(), message.Event).Return(errors.New("failed"))
+				outboxRepo.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, m *datastore.OutboxMessage) error {
+					require.Equal(t, datastore.PendingOutboxStatus, m.Status)
+					require.Equal(t, 1, m.Attempts)
+					require.Equal(t, "failed", m.LastError)
+					require.WithinDuration(t, time.Now().Add(time.Minute), m.NextAttemptAt.Time(), time.Second)
+					return nil
+				})
+			},
+		},
+
+		{
+			name: "should_reschedule_when_an_extra_sink_fails",
+			sink: func(ctx context.Context, event *datastore.Event) error {
+				return errors.New("sink failed")
+			},
+			dbFn: func(outboxRepo *mocks.MockOutboxRepository, eventRepo *mocks.MockEventRepository, message datastore.OutboxMessage) {
+				eventRepo.EXPECT().Create(gomock.Any(), message.Event).Return(nil)
+				outboxRepo.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, m *datastore.OutboxMessage) error {
+					require.Equal(t, "sink failed", m.LastError)
+					return nil
+				})
+			},
+		},
+
+		{
+			name:     "should_dead_letter_after_max_attempts",
+			attempts: 2,
+			dbFn: func(outboxRepo *mocks.MockOutboxRepository, eventRepo *mocks.MockEventRepository, message datastore.OutboxMessage) {
+				eventRepo.EXPECT().Create(gomock.Any(), message.Event).Return(errors.New("failed"))
+				outboxRepo.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, m *datastore.OutboxMessage) error {
+					require.Equal(t, datastore.DeadOutboxStatus, m.Status)
+					require.Equal(t, 3, m.Attempts)
+					return nil
+				})
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			outboxRepo := mocks.NewMockOutboxRepository(ctrl)
+			eventRepo := mocks.NewMockEventRepository(ctrl)
+
+			var sinks []Sink
+			if tc.sink != nil {
+				sinks = append(sinks, tc.sink)
+			}
+
+			dispatcher := NewOutboxDispatcher(outboxRepo, eventRepo, opts, sinks...)
+
+			message := newOutbox(context.Background(), datastore.CreateEvent, &datastore.Answer{TenantID: datastore.DefaultTenant, Key: "some-key"}, datastore.Value{Value: "some-value"})[0]
+			message.Attempts = tc.attempts
+
+			outboxRepo.EXPECT().FindDue(gomock.Any(), gomock.Any(), 10).Return([]datastore.OutboxMessage{message}, nil)
+			tc.dbFn(outboxRepo, eventRepo, message)
+
+			require.Nil(t, dispatcher.DispatchDue(ctx))
+		})
+	}
+}
+
+func TestOutboxDispatcher_DispatchDue_ReadsEveryBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	outboxRepo := mocks.NewMockOutboxRepository(ctrl)
+	eventRepo := mocks.NewMockEventRepository(ctrl)
+
+	dispatcher := NewOutboxDispatcher(outboxRepo, eventRepo, OutboxOptions{BatchSize: 2})
+
+	first := append(
+		newOutbox(context.Background(), datastore.CreateEvent, &datastore.Answer{TenantID: datastore.DefaultTenant, Key: "a"}, datastore.Value{Value: "a"}),
+		newOutbox(context.Background(), datastore.CreateEvent, &datastore.Answer{TenantID: datastore.DefaultTenant, Key: "b"}, datastore.Value{Value: "b"})...,
+	)
+	second := newOutbox(context.Background(), datastore.CreateEvent, &datastore.Answer{TenantID: datastore.DefaultTenant, Key: "c"}, datastore.Value{Value: "c"})
+
+	gomock.InOrder(
+		outboxRepo.EXPECT().FindDue(gomock.Any(), gomock.Any(), 2).Return(first, nil),
+		outboxRepo.EXPECT().FindDue(gomock.Any(), gomock.Any(), 2).Return(second, nil),
+	)
+
+	eventRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(3).Return(nil)
+	outboxRepo.EXPECT().Delete(gomock.Any(), gomock.Any()).Times(3).Return(nil)
+
+	require.Nil(t, dispatcher.DispatchDue(context.Background()))
+}
+
+func TestOutboxDispatcher_Run_DeliversOnShutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	outboxRepo := mocks.NewMockOutboxRepository(ctrl)
+	eventRepo := mocks.NewMockEventRepository(ctrl)
+
+	dispatcher := NewOutboxDispatcher(outboxRepo, eventRepo, OutboxOptions{PollInterval: time.Hour})
+
+	message := newOutbox(context.Background(), datastore.CreateEvent, &datastore.Answer{TenantID: datastore.DefaultTenant, Key: "some-key"}, datastore.Value{Value: "some-value"})[0]
+
+	outboxRepo.EXPECT().FindDue(gomock.Any(), gomock.Any(), gomock.Any()).Return([]datastore.OutboxMessage{message}, nil)
+	eventRepo.EXPECT().Create(gomock.Any(), message.Event).Return(nil)
+	outboxRepo.EXPECT().Delete(gomock.Any(), message.Event.ID).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dispatcher.Run(ctx)
+}
+
+func TestOutboxOptions_Backoff(t *testing.T) {
+	opts := OutboxOptions{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	backoffs := make([]time.Duration, 0)
+	for attempts := 1; attempts <= 6; attempts++ {
+		backoffs = append(backoffs, opts.backoff(attempts))
+	}
+
+	require.Equal(t, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second,
+	}, backoffs)
+}
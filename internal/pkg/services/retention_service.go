@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/auth"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/util"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// retentionBatchSize bounds the number of events deleted at once.
+const retentionBatchSize = 500
+
+var ErrLegalHoldExists = errors.New("the key is already on legal hold")
+
+// errOutboxUndelivered marks the deleted answers left for the next
+// run, their outbox failing to deliver.
+var errOutboxUndelivered = errors.New("the outbox of the answer isn't delivered")
+
+// RetentionPolicy configures what is purged, every limit is disabled
+// when zero.
+type RetentionPolicy struct {
+	// DeletedAnswers is how long deleted answers are kept,
+	// they are purged along with their history afterwards.
+	DeletedAnswers time.Duration
+
+	// HistoryAge is how long events are kept, and HistoryVersions
+	// the number of most recent events kept for every key. An event
+	// is purged as soon as it is past either limit.
+	HistoryAge      time.Duration
+	HistoryVersions int
+}
+
+// Enabled reports whether the policy purges anything.
+func (p RetentionPolicy) Enabled() bool {
+	return p.DeletedAnswers > 0 || p.HistoryAge > 0 || p.HistoryVersions > 0
+}
+
+// RetentionService purges deleted answers and old history according
+// to the retention policy, except for the keys on legal hold.
+type RetentionService struct {
+	answerRepo datastore.AnswerRepository
+	eventRepo  datastore.EventRepository
+	holdRepo   datastore.LegalHoldRepository
+	dispatcher *OutboxDispatcher
+	transactor datastore.Transactor
+	policy     RetentionPolicy
+}
+
+// NewRetentionService creates a RetentionService, transactor may be nil
+// for stores without transactions.
+func NewRetentionService(answerRepo datastore.AnswerRepository, eventRepo datastore.EventRepository, holdRepo datastore.LegalHoldRepository, dispatcher *OutboxDispatcher, transactor datastore.Transactor, policy RetentionPolicy) *RetentionService {
+	return &RetentionService{
+		answerRepo: answerRepo,
+		eventRepo:  eventRepo,
+		holdRepo:   holdRepo,
+		dispatcher: dispatcher,
+		transactor: transactor,
+		policy:     policy,
+	}
+}
+
+// Run applies the policy to every tenant every interval,
+// until ctx is cancelled.
+func (r *RetentionService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := r.Purge(ctx, "")
+		if err != nil {
+			logrus.WithError(err).Error("failed to apply the retention policy")
+			continue
+		}
+
+		if len(report.Answers) > 0 || report.Events > 0 {
+			logrus.WithField("answers", len(report.Answers)).WithField("events", report.Events).
+				Info("purged deleted answers and history past retention")
+		}
+	}
+}
+
+// Report returns what applying the policy to the tenant would purge,
+// without purging anything.
+func (r *RetentionService) Report(ctx context.Context, tenantID string) (*datastore.RetentionReport, error) {
+	return r.apply(ctx, tenantID, true)
+}
+
+// Purge applies the policy to the tenant, or to every tenant when
+// tenantID is empty. Holds placed while it runs apply from the next run.
+func (r *RetentionService) Purge(ctx context.Context, tenantID string) (*datastore.RetentionReport, error) {
+	return r.apply(ctx, tenantID, false)
+}
+
+func (r *RetentionService) apply(ctx context.Context, tenantID string, dryRun bool) (*datastore.RetentionReport, error) {
+	report := &datastore.RetentionReport{
+		DryRun:      dryRun,
+		Answers:     make([]datastore.PurgedAnswer, 0),
+		HeldAnswers: make([]datastore.PurgedAnswer, 0),
+	}
+
+	holds, err := r.holdRepo.FindMany(ctx, tenantID)
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	held := make(map[[2]string]bool, len(holds))
+	for _, hold := range holds {
+		held[[2]string{hold.TenantID, hold.Key}] = true
+	}
+
+	now := time.Now()
+
+	// a dry run leaves the history of the answers it would purge in
+	// place, it mustn't be counted once more as expired below
+	purged := make(map[generationKey]bool)
+
+	if r.policy.DeletedAnswers > 0 {
+		before := primitive.NewDateTimeFromTime(now.Add(-r.policy.DeletedAnswers))
+
+		answers, err := r.answerRepo.FindDeletedBefore(ctx, tenantID, before)
+		if err != nil {
+			return nil, util.NewServiceError(http.StatusInternalServerError, err)
+		}
+
+		for i := range answers {
+			answer := &answers[i]
+			entry := datastore.PurgedAnswer{
+				TenantID:   answer.TenantID,
+				Key:        answer.Key,
+				UID:        answer.UID,
+				Generation: answer.Generation,
+				DeletedAt:  answer.DeletedAt,
+			}
+
+			if dryRun || held[[2]string{answer.TenantID, answer.Key}] {
+				entry.Events, err = r.countEvents(ctx, answer)
+			} else {
+				entry.Events, err = r.purgeAnswer(ctx, answer)
+			}
+
+			if errors.Is(err, datastore.ErrAnswerNotFound) {
+				// restored or purged by someone else in between
+				continue
+			}
+
+			if errors.Is(err, errOutboxUndelivered) {
+				// one stuck message mustn't hold up the other answers
+				logrus.WithError(err).Warnf("skipped purging %s of tenant %s", answer.Key, answer.TenantID)
+				continue
+			}
+
+			if err != nil {
+				return nil, util.NewServiceError(http.StatusInternalServerError, err)
+			}
+
+			if held[[2]string{answer.TenantID, answer.Key}] {
+				report.HeldAnswers = append(report.HeldAnswers, entry)
+				continue
+			}
+
+			purged[generationKey{answer.TenantID, answer.Key, answer.Generation}] = true
+			report.Answers = append(report.Answers, entry)
+		}
+	}
+
+	if r.policy.HistoryAge <= 0 && r.policy.HistoryVersions <= 0 {
+		return report, nil
+	}
+
+	var before primitive.DateTime
+	if r.policy.HistoryAge > 0 {
+		before = primitive.NewDateTimeFromTime(now.Add(-r.policy.HistoryAge))
+	}
+
+	events, err := r.eventRepo.FindExpired(ctx, tenantID, before, r.policy.HistoryVersions)
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	expired := make([]datastore.Event, 0, len(events))
+	for _, event := range events {
+		var key string
+		var generation int64
+		if event.Data != nil {
+			key, generation = event.Data.Key, event.Data.Generation
+		}
+
+		switch {
+		case held[[2]string{event.TenantID, key}]:
+			report.HeldEvents++
+		case !purged[generationKey{event.TenantID, key, generation}]:
+			expired = append(expired, event)
+		}
+	}
+
+	report.Events = int64(len(expired))
+	if dryRun {
+		return report, nil
+	}
+
+	for start := 0; start < len(expired); start += retentionBatchSize {
+		end := start + retentionBatchSize
+		if end > len(expired) {
+			end = len(expired)
+		}
+
+		if err := r.eventRepo.Delete(ctx, expired[start:end]); err != nil {
+			return nil, util.NewServiceError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return report, nil
+}
+
+// purgeAnswer removes the history of answer, then answer, so that a
+// failure in between leaves no history without its answer to purge it
+// by. The store keeps the purged generation, so that the next answer of
+// the key never takes its number.
+func (r *RetentionService) purgeAnswer(ctx context.Context, answer *datastore.Answer) (int64, error) {
+	// events left in the outbox would be delivered once the
+	// answer is gone, bringing part of its history back
+	if err := r.dispatcher.DispatchKey(ctx, answer.TenantID, answer.Key); err != nil {
+		return 0, fmt.Errorf("%w: %v", errOutboxUndelivered, err)
+	}
+
+	var events int64
+
+	purge := func(ctx context.Context) error {
+		// without a transaction to roll the history back, an answer
+		// restored since it was found must be left alone beforehand
+		if r.transactor == nil {
+			if err := r.checkDeleted(ctx, answer); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		events, err = r.eventRepo.DeleteByKey(ctx, answer.TenantID, answer.Key, answer.Generation)
+		if err != nil {
+			return err
+		}
+
+		return r.answerRepo.Purge(ctx, answer)
+	}
+
+	if r.transactor == nil {
+		return events, purge(ctx)
+	}
+
+	return events, r.transactor.WithTransaction(ctx, purge)
+}
+
+// checkDeleted fails with ErrAnswerNotFound unless answer is still deleted.
+func (r *RetentionService) checkDeleted(ctx context.Context, answer *datastore.Answer) error {
+	deleted, err := r.answerRepo.FindDeleted(ctx, answer.TenantID, answer.Key)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deleted {
+		if d.UID == answer.UID {
+			return nil
+		}
+	}
+
+	return datastore.ErrAnswerNotFound
+}
+
+func (r *RetentionService) countEvents(ctx context.Context, answer *datastore.Answer) (int64, error) {
+	_, pagination, err := r.eventRepo.FindManyByKey(ctx, answer.TenantID, answer.Key, answer.Generation, datastore.Pageable{Page: 1, PerPage: 1})
+	return pagination.Total, err
+}
+
+// CreateLegalHold holds key from purging, whether it has answers yet
+// or not, until the hold is deleted.
+func (r *RetentionService) CreateLegalHold(ctx context.Context, tenantID, key string, req *datastore.CreateLegalHold) (*datastore.LegalHold, error) {
+	hold := &datastore.LegalHold{
+		ID:        primitive.NewObjectID(),
+		TenantID:  tenantID,
+		Key:       key,
+		Reason:    req.Reason,
+		CreatedBy: auth.Actor(ctx),
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	err := r.holdRepo.Create(ctx, hold)
+	if errors.Is(err, datastore.ErrDuplicateKey) {
+		return nil, util.NewServiceError(http.StatusConflict, ErrLegalHoldExists)
+	}
+
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	return hold, nil
+}
+
+func (r *RetentionService) FindLegalHolds(ctx context.Context, tenantID string) ([]datastore.LegalHold, error) {
+	holds, err := r.holdRepo.FindMany(ctx, tenantID)
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	return holds, nil
+}
+
+// DeleteLegalHold lifts the hold on key, which is purged
+// by the next run if it is past retention.
+func (r *RetentionService) DeleteLegalHold(ctx context.Context, tenantID, key string) error {
+	err := r.holdRepo.Delete(ctx, tenantID, key)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, datastore.ErrLegalHoldNotFound) {
+			statusCode = http.StatusNotFound
+		}
+		return util.NewServiceError(statusCode, err)
+	}
+
+	return nil
+}
+
+// generationKey identifies a generation of a key of a tenant.
+type generationKey struct {
+	tenantID   string
+	key        string
+	generation int64
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/auth"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/datastore/mocks"
+	"github.com/dotunj/bequest/internal/pkg/util"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testRetentionPolicy = RetentionPolicy{
+	DeletedAnswers:  30 * 24 * time.Hour,
+	HistoryVersions: 2,
+}
+
+func provideRetentionService(ctrl *gomock.Controller, transactor datastore.Transactor) *RetentionService {
+	answerRepo := mocks.NewMockAnswerRepository(ctrl)
+	eventRepo := mocks.NewMockEventRepository(ctrl)
+	holdRepo := mocks.NewMockLegalHoldRepository(ctrl)
+	dispatcher := NewOutboxDispatcher(mocks.NewMockOutboxRepository(ctrl), eventRepo, OutboxOptions{})
+
+	return NewRetentionService(answerRepo, eventRepo, holdRepo, dispatcher, transactor, testRetentionPolicy)
+}
+
+// expectNoPending expects the outbox of key to be flushed before its
+// answer is purged, with nothing left to deliver.
+func expectNoPending(r *RetentionService, key string) {
+	outboxRepo, _ := r.dispatcher.outboxRepo.(*mocks.MockOutboxRepository)
+
+	outboxRepo.EXPECT().FindPendingByKey(gomock.Any(), datastore.DefaultTenant, key).Return(nil, nil)
+}
+
+func retentionEvent(key string, generation int64) datastore.Event {
+	return datastore.Event{
+		ID:       primitive.NewObjectID(),
+		TenantID: datastore.DefaultTenant,
+		Data:     &datastore.EventData{Key: key, Generation: generation},
+	}
+}
+
+func TestRetentionService_Purge(t *testing.T) {
+	ctx := context.Background()
+
+	deleted := []datastore.Answer{
+		{TenantID: datastore.DefaultTenant, Key: "held-key", UID: "held-uid", Generation: 1},
+		{TenantID: datastore.DefaultTenant, Key: "some-key", UID: "some-uid", Generation: 1},
+	}
+
+	held := []datastore.LegalHold{
+		{TenantID: datastore.DefaultTenant, Key: "held-key"},
+	}
+
+	heldEvent, expiredEvent := retentionEvent("held-key", 2), retentionEvent("other-key", 1)
+
+	tt := []struct {
+		name        string
+		wantReport  *datastore.RetentionReport
+		wantErr     bool
+		wantErrCode int
+		dbFn        func(r *RetentionService)
+	}{
+		{
+			name: "should_purge_deleted_answers_and_expired_history",
+			wantReport: &datastore.RetentionReport{
+				Answers: []datastore.PurgedAnswer{
+					{TenantID: datastore.DefaultTenant, Key: "some-key", UID: "some-uid", Generation: 1, Events: 3},
+				},
+				Events: 1,
+				HeldAnswers: []datastore.PurgedAnswer{
+					{TenantID: datastore.DefaultTenant, Key: "held-key", UID: "held-uid", Generation: 1, Events: 2},
+				},
+				HeldEvents: 1,
+			},
+			dbFn: func(r *RetentionService) {
+				answerRepo, _ := r.answerRepo.(*mocks.MockAnswerRepository)
+				eventRepo, _ := r.eventRepo.(*mocks.MockEventRepository)
+				holdRepo, _ := r.holdRepo.(*mocks.MockLegalHoldRepository)
+
+				holdRepo.EXPECT().FindMany(gomock.Any(), "").Return(held, nil)
+				answerRepo.EXPECT().FindDeletedBefore(gomock.Any(), "", gomock.Any()).Return(deleted, nil)
+
+				eventRepo.EXPECT().FindManyByKey(gomock.Any(), datastore.DefaultTenant, "held-key", int64(1), gomock.Any()).
+					Return(nil, datastore.PaginationData{Total: 2}, nil)
+
+				expectNoPending(r, "some-key")
+				gomock.InOrder(
+					answerRepo.EXPECT().FindDeleted(gomock.Any(), datastore.DefaultTenant, "some-key").Return(deleted[1:], nil),
+					eventRepo.EXPECT().DeleteByKey(gomock.Any(), datastore.DefaultTenant, "some-key", int64(1)).Return(int64(3), nil),
+					answerRepo.EXPECT().Purge(gomock.Any(), &deleted[1]).Return(nil),
+				)
+
+				eventRepo.EXPECT().FindExpired(gomock.Any(), "", primitive.DateTime(0), 2).
+					Return([]datastore.Event{heldEvent, expiredEvent}, nil)
+				eventRepo.EXPECT().Delete(gomock.Any(), []datastore.Event{expiredEvent}).Return(nil)
+			},
+		},
+
+		{
+			name: "should_skip_answer_restored_in_between",
+			wantReport: &datastore.RetentionReport{
+				Answers:     []datastore.PurgedAnswer{},
+				HeldAnswers: []datastore.PurgedAnswer{},
+			},
+			dbFn: func(r *RetentionService) {
+				answerRepo, _ := r.answerRepo.(*mocks.MockAnswerRepository)
+				eventRepo, _ := r.eventRepo.(*mocks.MockEventRepository)
+				holdRepo, _ := r.holdRepo.(*mocks.MockLegalHoldRepository)
+
+				holdRepo.EXPECT().FindMany(gomock.Any(), "").Return(nil, nil)
+				answerRepo.EXPECT().FindDeletedBefore(gomock.Any(), "", gomock.Any()).Return(deleted[1:], nil)
+				expectNoPending(r, "some-key")
+
+				// its history is left alone
+				answerRepo.EXPECT().FindDeleted(gomock.Any(), datastore.DefaultTenant, "some-key").Return(nil, nil)
+
+				eventRepo.EXPECT().FindExpired(gomock.Any(), "", primitive.DateTime(0), 2).Return(nil, nil)
+			},
+		},
+
+		{
+			name: "should_skip_answer_whose_outbox_is_not_delivered",
+			wantReport: &datastore.RetentionReport{
+				Answers:     []datastore.PurgedAnswer{},
+				HeldAnswers: []datastore.PurgedAnswer{},
+			},
+			dbFn: func(r *RetentionService) {
+				answerRepo, _ := r.answerRepo.(*mocks.MockAnswerRepository)
+				eventRepo, _ := r.eventRepo.(*mocks.MockEventRepository)
+				holdRepo, _ := r.holdRepo.(*mocks.MockLegalHoldRepository)
+				outboxRepo, _ := r.dispatcher.outboxRepo.(*mocks.MockOutboxRepository)
+
+				message := newOutbox(context.Background(), datastore.DeleteEvent, &deleted[1], datastore.Value{Value: "some-value"})[0]
+
+				holdRepo.EXPECT().FindMany(gomock.Any(), "").Return(nil, nil)
+				answerRepo.EXPECT().FindDeletedBefore(gomock.Any(), "", gomock.Any()).Return(deleted[1:], nil)
+				outboxRepo.EXPECT().FindPendingByKey(gomock.Any(), datastore.DefaultTenant, "some-key").Return([]datastore.OutboxMessage{message}, nil)
+				eventRepo.EXPECT().Create(gomock.Any(), message.Event).Return(errors.New("failed"))
+
+				eventRepo.EXPECT().FindExpired(gomock.Any(), "", primitive.DateTime(0), 2).Return(nil, nil)
+			},
+		},
+
+		{
+			name:        "should_fail_to_find_deleted_answers",
+			wantErr:     true,
+			wantErrCode: http.StatusInternalServerError,
+			dbFn: func(r *RetentionService) {
+				answerRepo, _ := r.answerRepo.(*mocks.MockAnswerRepository)
+				holdRepo, _ := r.holdRepo.(*mocks.MockLegalHoldRepository)
+
+				holdRepo.EXPECT().FindMany(gomock.Any(), "").Return(nil, nil)
+				answerRepo.EXPECT().FindDeletedBefore(gomock.Any(), "", gomock.Any()).Return(nil, errors.New("failed"))
+			},
+		},
+
+		{
+			name:        "should_fail_to_delete_history",
+			wantErr:     true,
+			wantErrCode: http.StatusInternalServerError,
+			dbFn: func(r *RetentionService) {
+				answerRepo, _ := r.answerRepo.(*mocks.MockAnswerRepository)
+				eventRepo, _ := r.eventRepo.(*mocks.MockEventRepository)
+				holdRepo, _ := r.holdRepo.(*mocks.MockLegalHoldRepository)
+
+				holdRepo.EXPECT().FindMany(gomock.Any(), "").Return(nil, nil)
+				answerRepo.EXPECT().FindDeletedBefore(gomock.Any(), "", gomock.Any()).Return(deleted[1:], nil)
+				expectNoPending(r, "some-key")
+				answerRepo.EXPECT().FindDeleted(gomock.Any(), datastore.DefaultTenant, "some-key").Return(deleted[1:], nil)
+				eventRepo.EXPECT().DeleteByKey(gomock.Any(), datastore.DefaultTenant, "some-key", int64(1)).Return(int64(0), errors.New("failed"))
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			retentionService := provideRetentionService(ctrl, nil)
+
+			if tc.dbFn != nil {
+				tc.dbFn(retentionService)
+			}
+
+			report, err := retentionService.Purge(ctx, "")
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, tc.wantReport, report)
+		})
+	}
+}
+
+func TestRetentionService_Purge_WithTransactor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	retentionService := provideRetentionService(ctrl, mocks.NewMockTransactor(ctrl))
+	retentionService.policy = RetentionPolicy{DeletedAnswers: time.Hour}
+
+	answerRepo, _ := retentionService.answerRepo.(*mocks.MockAnswerRepository)
+	eventRepo, _ := retentionService.eventRepo.(*mocks.MockEventRepository)
+	holdRepo, _ := retentionService.holdRepo.(*mocks.MockLegalHoldRepository)
+	transactor, _ := retentionService.transactor.(*mocks.MockTransactor)
+
+	deleted := datastore.Answer{TenantID: datastore.DefaultTenant, Key: "some-key", UID: "some-uid", Generation: 2}
+
+	holdRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant).Return(nil, nil)
+	answerRepo.EXPECT().FindDeletedBefore(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return([]datastore.Answer{deleted}, nil)
+
+	expectNoPending(retentionService, "some-key")
+	transactor.EXPECT().WithTransaction(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	})
+
+	answerRepo.EXPECT().Purge(gomock.Any(), &deleted).Return(nil)
+	eventRepo.EXPECT().DeleteByKey(gomock.Any(), datastore.DefaultTenant, "some-key", int64(2)).Return(int64(1), nil)
+
+	report, err := retentionService.Purge(context.Background(), datastore.DefaultTenant)
+	require.Nil(t, err)
+	require.Len(t, report.Answers, 1)
+	require.Equal(t, int64(1), report.Answers[0].Events)
+}
+
+func TestRetentionService_Report(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	retentionService := provideRetentionService(ctrl, nil)
+
+	answerRepo, _ := retentionService.answerRepo.(*mocks.MockAnswerRepository)
+	eventRepo, _ := retentionService.eventRepo.(*mocks.MockEventRepository)
+	holdRepo, _ := retentionService.holdRepo.(*mocks.MockLegalHoldRepository)
+
+	deleted := datastore.Answer{TenantID: datastore.DefaultTenant, Key: "some-key", UID: "some-uid", Generation: 1}
+
+	holdRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant).Return(nil, nil)
+	answerRepo.EXPECT().FindDeletedBefore(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return([]datastore.Answer{deleted}, nil)
+	eventRepo.EXPECT().FindManyByKey(gomock.Any(), datastore.DefaultTenant, "some-key", int64(1), datastore.Pageable{Page: 1, PerPage: 1}).
+		Return(nil, datastore.PaginationData{Total: 3}, nil)
+
+	// the history of the answer is already counted along with it
+	eventRepo.EXPECT().FindExpired(gomock.Any(), datastore.DefaultTenant, primitive.DateTime(0), 2).
+		Return([]datastore.Event{retentionEvent("some-key", 1), retentionEvent("other-key", 1)}, nil)
+
+	report, err := retentionService.Report(context.Background(), datastore.DefaultTenant)
+	require.Nil(t, err)
+
+	require.Equal(t, &datastore.RetentionReport{
+		DryRun: true,
+		Answers: []datastore.PurgedAnswer{
+			{TenantID: datastore.DefaultTenant, Key: "some-key", UID: "some-uid", Generation: 1, Events: 3},
+		},
+		Events:      1,
+		HeldAnswers: []datastore.PurgedAnswer{},
+	}, report)
+}
+
+func TestRetentionService_CreateLegalHold(t *testing.T) {
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "some-user"})
+
+	tt := []struct {
+		name        string
+		wantErr     bool
+		wantErrMsg  string
+		wantErrCode int
+		dbFn        func(r *RetentionService)
+	}{
+		{
+			name: "should_create_legal_hold",
+			dbFn: func(r *RetentionService) {
+				holdRepo, _ := r.holdRepo.(*mocks.MockLegalHoldRepository)
+
+				holdRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+			},
+		},
+
+		{
+			name:        "should_fail_on_held_key",
+			wantErr:     true,
+			wantErrMsg:  ErrLegalHoldExists.Error(),
+			wantErrCode: http.StatusConflict,
+			dbFn: func(r *RetentionService) {
+				holdRepo, _ := r.holdRepo.(*mocks.MockLegalHoldRepository)
+
+				holdRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(datastore.ErrDuplicateKey)
+			},
+		},
+
+		{
+			name:        "should_fail_to_create_legal_hold",
+			wantErr:     true,
+			wantErrMsg:  "failed",
+			wantErrCode: http.StatusInternalServerError,
+			dbFn: func(r *RetentionService) {
+				holdRepo, _ := r.holdRepo.(*mocks.MockLegalHoldRepository)
+
+				holdRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(errors.New("failed"))
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			retentionService := provideRetentionService(ctrl, nil)
+
+			if tc.dbFn != nil {
+				tc.dbFn(retentionService)
+			}
+
+			hold, err := retentionService.CreateLegalHold(ctx, datastore.DefaultTenant, "some-key", &datastore.CreateLegalHold{Reason: "litigation"})
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				require.Equal(t, tc.wantErrMsg, err.(*util.ServiceError).Error())
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, "some-key", hold.Key)
+			require.Equal(t, "litigation", hold.Reason)
+			require.Equal(t, "some-user", hold.CreatedBy)
+		})
+	}
+}
+
+func TestRetentionService_DeleteLegalHold(t *testing.T) {
+	tt := []struct {
+		name        string
+		wantErr     bool
+		wantErrCode int
+		dbFn        func(r *RetentionService)
+	}{
+		{
+			name: "should_delete_legal_hold",
+			dbFn: func(r *RetentionService) {
+				holdRepo, _ := r.holdRepo.(*mocks.MockLegalHoldRepository)
+
+				holdRepo.EXPECT().Delete(gomock.Any(), datastore.DefaultTenant, "some-key").Return(nil)
+			},
+		},
+
+		{
+			name:        "should_fail_on_key_without_hold",
+			wantErr:     true,
+			wantErrCode: http.StatusNotFound,
+			dbFn: func(r *RetentionService) {
+				holdRepo, _ := r.holdRepo.(*mocks.MockLegalHoldRepository)
+
+				holdRepo.EXPECT().Delete(gomock.Any(), datastore.DefaultTenant, "some-key").Return(datastore.ErrLegalHoldNotFound)
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			retentionService := provideRetentionService(ctrl, nil)
+
+			if tc.dbFn != nil {
+				tc.dbFn(retentionService)
+			}
+
+			err := retentionService.DeleteLegalHold(context.Background(), datastore.DefaultTenant, "some-key")
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				return
+			}
+
+			require.Nil(t, err)
+		})
+	}
+}
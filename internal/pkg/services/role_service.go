@@ -0,0 +1,300 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/auth"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/util"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrRoleBindingExists = errors.New("the subject already has a role on this pattern")
+	ErrRoleForbidden     = errors.New("can't manage the role bindings of keys the caller doesn't administer")
+)
+
+// RoleService decides which answers a principal may read or write,
+// from the roles bound to its subjects on patterns of keys. Roles are
+// additive, a principal has the highest role bound to any of its
+// subjects on a pattern matching the key.
+type RoleService struct {
+	roleRepo datastore.RoleBindingRepository
+	admins   map[string]bool
+}
+
+// NewRoleService returns a service treating adminSubjects as
+// admins on every key of every tenant.
+func NewRoleService(roleRepo datastore.RoleBindingRepository, adminSubjects []string) *RoleService {
+	admins := make(map[string]bool, len(adminSubjects))
+	for _, subject := range adminSubjects {
+		admins[subject] = true
+	}
+
+	return &RoleService{roleRepo: roleRepo, admins: admins}
+}
+
+// IsAdmin reports whether principal is one of the admins of every key
+// of every tenant, which alone may choose the tenant they act for.
+func (r *RoleService) IsAdmin(principal *auth.Principal) bool {
+	return r.admins[principal.Subject]
+}
+
+// Authorize fails with a 403 unless the principal of ctx has role on
+// key. Anonymous requests are allowed, they are only accepted when
+// authentication is disabled.
+func (r *RoleService) Authorize(ctx context.Context, tenantID, key string, role datastore.Role) error {
+	authorized, err := r.Authorizer(ctx, tenantID, role)
+	if err != nil {
+		return err
+	}
+
+	if !authorized(key) {
+		return util.NewServiceError(http.StatusForbidden, fmt.Errorf("the %s role is required on this key", role))
+	}
+
+	return nil
+}
+
+// Authorizer returns a function reporting whether the principal of
+// ctx has role on a key, to check many keys with a single lookup of
+// its bindings.
+func (r *RoleService) Authorizer(ctx context.Context, tenantID string, role datastore.Role) (func(key string) bool, error) {
+	principal, ok := auth.PrincipalFrom(ctx)
+	if !ok || r.admins[principal.Subject] {
+		return func(string) bool { return true }, nil
+	}
+
+	bindings, err := r.roleRepo.FindMany(ctx, tenantID, principal.Subjects())
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	patterns := make([]string, 0, len(bindings))
+	for _, binding := range bindings {
+		if binding.Role.Includes(role) {
+			patterns = append(patterns, binding.Pattern)
+		}
+	}
+
+	return func(key string) bool {
+		for _, p := range patterns {
+			if matchPattern(p, key) {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+// AuthorizePattern fails with a 403 unless the principal of ctx is an
+// admin of every key pattern matches, "*" requiring a tenant admin.
+func (r *RoleService) AuthorizePattern(ctx context.Context, tenantID, pattern string) error {
+	administered, err := r.administered(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+
+	if !administered(pattern) {
+		return util.NewServiceError(http.StatusForbidden, fmt.Errorf("the %s role is required on %s", datastore.AdminRole, pattern))
+	}
+
+	return nil
+}
+
+// CreateRoleBinding binds a role on a pattern, which the
+// caller must be an admin of.
+func (r *RoleService) CreateRoleBinding(ctx context.Context, tenantID string, req *datastore.CreateRoleBinding) (*datastore.RoleBinding, error) {
+	if !req.Role.IsValid() {
+		return nil, util.NewServiceError(http.StatusBadRequest, fmt.Errorf("unknown role %q", req.Role))
+	}
+
+	if err := validatePattern(req.Pattern); err != nil {
+		return nil, util.NewServiceError(http.StatusBadRequest, err)
+	}
+
+	administered, err := r.administered(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !administered(req.Pattern) {
+		return nil, util.NewServiceError(http.StatusForbidden, ErrRoleForbidden)
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+
+	binding := &datastore.RoleBinding{
+		ID:        primitive.NewObjectID(),
+		UID:       uuid.NewString(),
+		TenantID:  tenantID,
+		Subject:   req.Subject,
+		Role:      req.Role,
+		Pattern:   req.Pattern,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	err = r.roleRepo.Create(ctx, binding)
+	if errors.Is(err, datastore.ErrDuplicateKey) {
+		return nil, util.NewServiceError(http.StatusConflict, ErrRoleBindingExists)
+	}
+
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	return binding, nil
+}
+
+// FindRoleBindings returns the bindings on the patterns the caller
+// administers, only those of subject when it isn't empty.
+func (r *RoleService) FindRoleBindings(ctx context.Context, tenantID, subject string) ([]datastore.RoleBinding, error) {
+	administered, err := r.administered(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var subjects []string
+	if subject != "" {
+		subjects = []string{subject}
+	}
+
+	bindings, err := r.roleRepo.FindMany(ctx, tenantID, subjects)
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	found := make([]datastore.RoleBinding, 0, len(bindings))
+	for _, binding := range bindings {
+		if administered(binding.Pattern) {
+			found = append(found, binding)
+		}
+	}
+
+	return found, nil
+}
+
+func (r *RoleService) FindRoleBindingByUID(ctx context.Context, tenantID, uid string) (*datastore.RoleBinding, error) {
+	binding, err := r.roleRepo.FindByUID(ctx, tenantID, uid)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, datastore.ErrRoleBindingNotFound) {
+			statusCode = http.StatusNotFound
+		}
+		return nil, util.NewServiceError(statusCode, err)
+	}
+
+	administered, err := r.administered(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !administered(binding.Pattern) {
+		return nil, util.NewServiceError(http.StatusForbidden, ErrRoleForbidden)
+	}
+
+	return binding, nil
+}
+
+// DeleteRoleBinding removes the binding identified by uid,
+// the role it granted is revoked right away.
+func (r *RoleService) DeleteRoleBinding(ctx context.Context, tenantID, uid string) (*datastore.RoleBinding, error) {
+	binding, err := r.FindRoleBindingByUID(ctx, tenantID, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.roleRepo.Delete(ctx, tenantID, uid)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, datastore.ErrRoleBindingNotFound) {
+			statusCode = http.StatusNotFound
+		}
+		return nil, util.NewServiceError(statusCode, err)
+	}
+
+	return binding, nil
+}
+
+// administered returns a function reporting whether the caller is an
+// admin of every key a pattern matches.
+func (r *RoleService) administered(ctx context.Context, tenantID string) (func(pattern string) bool, error) {
+	principal, ok := auth.PrincipalFrom(ctx)
+	if !ok || r.admins[principal.Subject] {
+		return func(string) bool { return true }, nil
+	}
+
+	bindings, err := r.roleRepo.FindMany(ctx, tenantID, principal.Subjects())
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	patterns := make([]string, 0, len(bindings))
+	for _, binding := range bindings {
+		if binding.Role.Includes(datastore.AdminRole) {
+			patterns = append(patterns, binding.Pattern)
+		}
+	}
+
+	return func(pattern string) bool {
+		for _, p := range patterns {
+			if coversPattern(p, pattern) {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+// validatePattern checks that pattern is a key, or a prefix
+// followed by a single '*'.
+func validatePattern(pattern string) error {
+	if pattern == "" {
+		return errors.New("the pattern can't be empty")
+	}
+
+	if i := strings.IndexByte(pattern, '*'); i != -1 && i != len(pattern)-1 {
+		return errors.New("the pattern may only end with '*'")
+	}
+
+	return nil
+}
+
+// matchPattern reports whether key matches pattern.
+func matchPattern(pattern, key string) bool {
+	if prefix, ok := wildcardPrefix(pattern); ok {
+		return strings.HasPrefix(key, prefix)
+	}
+
+	return pattern == key
+}
+
+// coversPattern reports whether every key matching inner matches outer.
+func coversPattern(outer, inner string) bool {
+	prefix, ok := wildcardPrefix(outer)
+	if !ok {
+		return outer == inner
+	}
+
+	innerPrefix, _ := wildcardPrefix(inner)
+	return strings.HasPrefix(innerPrefix, prefix)
+}
+
+// wildcardPrefix returns the prefix of a pattern ending with '*',
+// or the pattern itself when it is a key.
+func wildcardPrefix(pattern string) (string, bool) {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.TrimSuffix(pattern, "*"), true
+	}
+
+	return pattern, false
+}
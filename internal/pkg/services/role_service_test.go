@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/dotunj/bequest/internal/pkg/auth"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/datastore/mocks"
+	"github.com/dotunj/bequest/internal/pkg/util"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func provideRoleService(ctrl *gomock.Controller) *RoleService {
+	roleRepo := mocks.NewMockRoleBindingRepository(ctrl)
+
+	return NewRoleService(roleRepo, []string{"root"})
+}
+
+func TestRoleService_Authorize(t *testing.T) {
+	ctx := context.Background()
+
+	user := auth.WithPrincipal(ctx, &auth.Principal{Subject: "some-user", Groups: []string{"billing"}})
+	subjects := []string{"some-user", "group:billing"}
+
+	bindings := []datastore.RoleBinding{
+		{Subject: "some-user", Role: datastore.ReaderRole, Pattern: "*"},
+		{Subject: "group:billing", Role: datastore.WriterRole, Pattern: "billing/*"},
+		{Subject: "some-user", Role: datastore.AdminRole, Pattern: "limits"},
+	}
+
+	tt := []struct {
+		name        string
+		ctx         context.Context
+		key         string
+		role        datastore.Role
+		wantErr     bool
+		wantErrCode int
+		dbFn        func(r *RoleService)
+	}{
+		{
+			name: "should_authorize_anonymous_request",
+			ctx:  ctx,
+			key:  "billing/limit",
+			role: datastore.WriterRole,
+		},
+
+		{
+			name: "should_authorize_admin_subject",
+			ctx:  auth.WithPrincipal(ctx, &auth.Principal{Subject: "root"}),
+			key:  "billing/limit",
+			role: datastore.AdminRole,
+		},
+
+		{
+			name: "should_authorize_group_role_on_prefix",
+			ctx:  user,
+			key:  "billing/limit",
+			role: datastore.WriterRole,
+			dbFn: func(r *RoleService) {
+				roleRepo, _ := r.roleRepo.(*mocks.MockRoleBindingRepository)
+
+				roleRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, subjects).Return(bindings, nil)
+			},
+		},
+
+		{
+			name: "should_authorize_lower_role",
+			ctx:  user,
+			key:  "limits",
+			role: datastore.WriterRole,
+			dbFn: func(r *RoleService) {
+				roleRepo, _ := r.roleRepo.(*mocks.MockRoleBindingRepository)
+
+				roleRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, subjects).Return(bindings, nil)
+			},
+		},
+
+		{
+			name:        "should_forbid_role_outside_the_prefix",
+			ctx:         user,
+			key:         "accounts/limit",
+			role:        datastore.WriterRole,
+			wantErr:     true,
+			wantErrCode: http.StatusForbidden,
+			dbFn: func(r *RoleService) {
+				roleRepo, _ := r.roleRepo.(*mocks.MockRoleBindingRepository)
+
+				roleRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, subjects).Return(bindings, nil)
+			},
+		},
+
+		{
+			name:        "should_forbid_principal_without_bindings",
+			ctx:         auth.WithPrincipal(ctx, &auth.Principal{Subject: "other-user"}),
+			key:         "limits",
+			role:        datastore.ReaderRole,
+			wantErr:     true,
+			wantErrCode: http.StatusForbidden,
+			dbFn: func(r *RoleService) {
+				roleRepo, _ := r.roleRepo.(*mocks.MockRoleBindingRepository)
+
+				roleRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, []string{"other-user"}).Return([]datastore.RoleBinding{}, nil)
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			roleService := provideRoleService(ctrl)
+
+			if tc.dbFn != nil {
+				tc.dbFn(roleService)
+			}
+
+			err := roleService.Authorize(tc.ctx, datastore.DefaultTenant, tc.key, tc.role)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				return
+			}
+
+			require.Nil(t, err)
+		})
+	}
+}
+
+func TestRoleService_Authorizer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	roleService := provideRoleService(ctrl)
+	roleRepo, _ := roleService.roleRepo.(*mocks.MockRoleBindingRepository)
+
+	roleRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, []string{"some-user"}).Return([]datastore.RoleBinding{
+		{Subject: "some-user", Role: datastore.ReaderRole, Pattern: "billing/*"},
+		{Subject: "some-user", Role: datastore.WriterRole, Pattern: "limits"},
+	}, nil).Times(1)
+
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "some-user"})
+
+	authorized, err := roleService.Authorizer(ctx, datastore.DefaultTenant, datastore.ReaderRole)
+	require.Nil(t, err)
+
+	require.True(t, authorized("billing/limit"))
+	require.True(t, authorized("limits"))
+	require.False(t, authorized("accounts/limit"))
+}
+
+func TestRoleService_AuthorizePattern(t *testing.T) {
+	ctx := context.Background()
+
+	user := auth.WithPrincipal(ctx, &auth.Principal{Subject: "some-user"})
+
+	tt := []struct {
+		name        string
+		ctx         context.Context
+		pattern     string
+		bindings    []datastore.RoleBinding
+		wantErr     bool
+		wantErrCode int
+	}{
+		{
+			name:    "should_authorize_anonymous_request",
+			ctx:     ctx,
+			pattern: "*",
+		},
+
+		{
+			name:    "should_authorize_tenant_admin",
+			ctx:     user,
+			pattern: "*",
+			bindings: []datastore.RoleBinding{
+				{Subject: "some-user", Role: datastore.AdminRole, Pattern: "*"},
+			},
+		},
+
+		{
+			name:    "should_authorize_prefix_admin_on_narrower_pattern",
+			ctx:     user,
+			pattern: "billing/limits/*",
+			bindings: []datastore.RoleBinding{
+				{Subject: "some-user", Role: datastore.AdminRole, Pattern: "billing/*"},
+			},
+		},
+
+		{
+			name:    "should_forbid_prefix_admin_on_every_key",
+			ctx:     user,
+			pattern: "*",
+			bindings: []datastore.RoleBinding{
+				{Subject: "some-user", Role: datastore.AdminRole, Pattern: "billing/*"},
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusForbidden,
+		},
+
+		{
+			name:    "should_forbid_tenant_writer",
+			ctx:     user,
+			pattern: "*",
+			bindings: []datastore.RoleBinding{
+				{Subject: "some-user", Role: datastore.WriterRole, Pattern: "*"},
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			roleService := provideRoleService(ctrl)
+
+			if tc.bindings != nil {
+				roleRepo, _ := roleService.roleRepo.(*mocks.MockRoleBindingRepository)
+
+				roleRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, []string{"some-user"}).Return(tc.bindings, nil)
+			}
+
+			err := roleService.AuthorizePattern(tc.ctx, datastore.DefaultTenant, tc.pattern)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				return
+			}
+
+			require.Nil(t, err)
+		})
+	}
+}
+
+func TestRoleService_CreateRoleBinding(t *testing.T) {
+	ctx := context.Background()
+
+	billingAdmin := auth.WithPrincipal(ctx, &auth.Principal{Subject: "billing-admin"})
+	adminBindings := []datastore.RoleBinding{
+		{Subject: "billing-admin", Role: datastore.AdminRole, Pattern: "billing/*"},
+		{Subject: "billing-admin", Role: datastore.WriterRole, Pattern: "*"},
+	}
+
+	tt := []struct {
+		name        string
+		ctx         context.Context
+		req         *datastore.CreateRoleBinding
+		wantErr     bool
+		wantErrCode int
+		dbFn        func(r *RoleService)
+	}{
+		{
+			name: "should_create_role_binding",
+			ctx:  ctx,
+			req:  &datastore.CreateRoleBinding{Subject: "some-user", Role: datastore.WriterRole, Pattern: "billing/*"},
+			dbFn: func(r *RoleService) {
+				roleRepo, _ := r.roleRepo.(*mocks.MockRoleBindingRepository)
+
+				roleRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+			},
+		},
+
+		{
+			name: "should_create_role_binding_within_administered_prefix",
+			ctx:  billingAdmin,
+			req:  &datastore.CreateRoleBinding{Subject: "some-user", Role: datastore.AdminRole, Pattern: "billing/invoices/*"},
+			dbFn: func(r *RoleService) {
+				roleRepo, _ := r.roleRepo.(*mocks.MockRoleBindingRepository)
+
+				roleRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, []string{"billing-admin"}).Return(adminBindings, nil)
+				roleRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+			},
+		},
+
+		{
+			name:        "should_fail_to_create_role_binding_outside_administered_prefix",
+			ctx:         billingAdmin,
+			req:         &datastore.CreateRoleBinding{Subject: "some-user", Role: datastore.ReaderRole, Pattern: "billing*"},
+			wantErr:     true,
+			wantErrCode: http.StatusForbidden,
+			dbFn: func(r *RoleService) {
+				roleRepo, _ := r.roleRepo.(*mocks.MockRoleBindingRepository)
+
+				roleRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, []string{"billing-admin"}).Return(adminBindings, nil)
+			},
+		},
+
+		{
+			name:        "should_fail_to_create_role_binding_with_unknown_role",
+			ctx:         ctx,
+			req:         &datastore.CreateRoleBinding{Subject: "some-user", Role: "owner", Pattern: "*"},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+		},
+
+		{
+			name:        "should_fail_to_create_role_binding_with_inner_wildcard",
+			ctx:         ctx,
+			req:         &datastore.CreateRoleBinding{Subject: "some-user", Role: datastore.ReaderRole, Pattern: "billing/*/limit"},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+		},
+
+		{
+			name:        "should_fail_to_create_duplicate_role_binding",
+			ctx:         ctx,
+			req:         &datastore.CreateRoleBinding{Subject: "some-user", Role: datastore.ReaderRole, Pattern: "*"},
+			wantErr:     true,
+			wantErrCode: http.StatusConflict,
+			dbFn: func(r *RoleService) {
+				roleRepo, _ := r.roleRepo.(*mocks.MockRoleBindingRepository)
+
+				roleRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(datastore.ErrDuplicateKey)
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			roleService := provideRoleService(ctrl)
+
+			if tc.dbFn != nil {
+				tc.dbFn(roleService)
+			}
+
+			binding, err := roleService.CreateRoleBinding(tc.ctx, datastore.DefaultTenant, tc.req)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				return
+			}
+
+			require.Nil(t, err)
+			require.NotEmpty(t, binding.UID)
+			require.Equal(t, tc.req.Pattern, binding.Pattern)
+		})
+	}
+}
+
+func TestCoversPattern(t *testing.T) {
+	tt := []struct {
+		outer, inner string
+		want         bool
+	}{
+		{outer: "*", inner: "billing/*", want: true},
+		{outer: "billing/*", inner: "billing/*", want: true},
+		{outer: "billing/*", inner: "billing/limit", want: true},
+		{outer: "billing/*", inner: "billing*", want: false},
+		{outer: "billing/limit", inner: "billing/limit", want: true},
+		{outer: "billing/limit", inner: "billing/limit*", want: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.outer+" "+tc.inner, func(t *testing.T) {
+			require.Equal(t, tc.want, coversPattern(tc.outer, tc.inner))
+		})
+	}
+}
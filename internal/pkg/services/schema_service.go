@@ -0,0 +1,372 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/util"
+	"github.com/google/uuid"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidSchema      = errors.New("invalid schema")
+	ErrSchemaNotActivated = errors.New("existing answers don't match the schema, activate it with force to ignore them")
+)
+
+// SchemaValidationError lists every part of a value that doesn't
+// match the schema of the namespace its answer belongs to.
+type SchemaValidationError struct {
+	Namespace  string                      `json:"namespace"`
+	Version    int                         `json:"version"`
+	Violations []datastore.SchemaViolation `json:"violations"`
+}
+
+func (e *SchemaValidationError) Error() string {
+	return fmt.Sprintf("value doesn't match version %d of the %q schema", e.Version, e.Namespace)
+}
+
+// SchemaService manages the schemas answer values are validated
+// against. A schema applies to the answers whose key starts with
+// its namespace, the longest matching namespace winning.
+type SchemaService struct {
+	schemaRepo datastore.SchemaRepository
+	answerRepo datastore.AnswerRepository
+	transactor datastore.Transactor
+
+	// compiled caches compiled schemas by uid,
+	// which is safe since definitions never change
+	compiled sync.Map
+}
+
+// NewSchemaService creates a SchemaService. transactor may be nil for
+// stores without transactions, activating a version then briefly
+// leaves two versions of its namespace active, the newest one wins.
+func NewSchemaService(schemaRepo datastore.SchemaRepository, answerRepo datastore.AnswerRepository, transactor datastore.Transactor) *SchemaService {
+	return &SchemaService{
+		schemaRepo: schemaRepo,
+		answerRepo: answerRepo,
+		transactor: transactor,
+	}
+}
+
+// CreateSchema adds a draft version to a namespace,
+// which isn't enforced until it is activated.
+func (s *SchemaService) CreateSchema(ctx context.Context, tenantID string, req *datastore.CreateSchema) (*datastore.Schema, error) {
+	if _, err := compileSchema(req.Definition); err != nil {
+		return nil, util.NewServiceError(http.StatusBadRequest, fmt.Errorf("%w: %v", ErrInvalidSchema, err))
+	}
+
+	versions, err := s.schemaRepo.FindMany(ctx, tenantID, req.Namespace)
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	version := 1
+	if len(versions) > 0 {
+		version = versions[len(versions)-1].Version + 1
+	}
+
+	schema := &datastore.Schema{
+		ID:         primitive.NewObjectID(),
+		UID:        uuid.NewString(),
+		TenantID:   tenantID,
+		Namespace:  req.Namespace,
+		Version:    version,
+		Definition: req.Definition,
+		Status:     datastore.DraftSchemaStatus,
+		CreatedAt:  primitive.NewDateTimeFromTime(time.Now()),
+		UpdatedAt:  primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	err = s.schemaRepo.Create(ctx, schema)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, datastore.ErrDuplicateKey) {
+			// another version was created concurrently
+			statusCode = http.StatusConflict
+		}
+		return nil, util.NewServiceError(statusCode, err)
+	}
+
+	return schema, nil
+}
+
+func (s *SchemaService) FindSchemas(ctx context.Context, tenantID, namespace string) ([]datastore.Schema, error) {
+	schemas, err := s.schemaRepo.FindMany(ctx, tenantID, namespace)
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	return schemas, nil
+}
+
+func (s *SchemaService) FindSchemaByUID(ctx context.Context, tenantID, uid string) (*datastore.Schema, error) {
+	schema, err := s.schemaRepo.FindByUID(ctx, tenantID, uid)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, datastore.ErrSchemaNotFound) {
+			statusCode = http.StatusNotFound
+		}
+		return nil, util.NewServiceError(statusCode, err)
+	}
+
+	return schema, nil
+}
+
+// TestSchema validates the existing answers the schema would
+// apply to once active against it, without enforcing anything.
+func (s *SchemaService) TestSchema(ctx context.Context, tenantID, uid string) (*datastore.SchemaTestResult, error) {
+	schema, err := s.FindSchemaByUID(ctx, tenantID, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.test(ctx, schema)
+}
+
+// ActivateSchema enforces a version of a namespace in place of the
+// active one. Unless force is set, activation fails when existing
+// answers don't match the version, listing them.
+func (s *SchemaService) ActivateSchema(ctx context.Context, tenantID, uid string, force bool) (*datastore.Schema, error) {
+	schema, err := s.FindSchemaByUID(ctx, tenantID, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if schema.Status == datastore.ActiveSchemaStatus {
+		return schema, nil
+	}
+
+	if !force {
+		result, err := s.test(ctx, schema)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(result.Violations) > 0 {
+			return nil, util.NewServiceErrorWithData(http.StatusUnprocessableEntity, ErrSchemaNotActivated, result)
+		}
+	}
+
+	err = s.inTransaction(ctx, func(ctx context.Context) error {
+		// the new version goes first, so that the namespace is never
+		// left without an active version when there's no transaction
+		if err := s.schemaRepo.UpdateStatus(ctx, tenantID, schema.UID, datastore.ActiveSchemaStatus); err != nil {
+			return err
+		}
+
+		versions, err := s.schemaRepo.FindMany(ctx, tenantID, schema.Namespace)
+		if err != nil {
+			return err
+		}
+
+		for _, version := range versions {
+			if version.UID == schema.UID || version.Status != datastore.ActiveSchemaStatus {
+				continue
+			}
+
+			if err := s.schemaRepo.UpdateStatus(ctx, tenantID, version.UID, datastore.InactiveSchemaStatus); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	return s.FindSchemaByUID(ctx, tenantID, uid)
+}
+
+// DeactivateSchema stops enforcing a version. Answers of its namespace
+// fall back to the schema of a shorter namespace, if any.
+func (s *SchemaService) DeactivateSchema(ctx context.Context, tenantID, uid string) (*datastore.Schema, error) {
+	schema, err := s.FindSchemaByUID(ctx, tenantID, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if schema.Status != datastore.ActiveSchemaStatus {
+		return schema, nil
+	}
+
+	if err := s.schemaRepo.UpdateStatus(ctx, tenantID, uid, datastore.InactiveSchemaStatus); err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	return s.FindSchemaByUID(ctx, tenantID, uid)
+}
+
+// Validate checks values against the active schema of tenantID that applies
+// to key, failing with a SchemaValidationError listing every violation of
+// the first value that doesn't match it.
+func (s *SchemaService) Validate(ctx context.Context, tenantID, key string, values ...datastore.Value) error {
+	active, err := s.schemaRepo.FindActive(ctx, tenantID)
+	if err != nil {
+		return util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	schema := governingSchema(active, key)
+	if schema == nil {
+		return nil
+	}
+
+	for _, value := range values {
+		violations, err := s.validate(schema, value)
+		if err != nil {
+			return util.NewServiceError(http.StatusInternalServerError, err)
+		}
+
+		if len(violations) > 0 {
+			validationErr := &SchemaValidationError{
+				Namespace:  schema.Namespace,
+				Version:    schema.Version,
+				Violations: violations,
+			}
+			return util.NewServiceErrorWithData(http.StatusUnprocessableEntity, validationErr, validationErr)
+		}
+	}
+
+	return nil
+}
+
+// test validates the latest value of the answers schema would apply to
+// if it were active, skipping those governed by a longer namespace.
+func (s *SchemaService) test(ctx context.Context, schema *datastore.Schema) (*datastore.SchemaTestResult, error) {
+	active, err := s.schemaRepo.FindActive(ctx, schema.TenantID)
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	answers, err := s.answerRepo.FindManyByPrefix(ctx, schema.TenantID, schema.Namespace)
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	// the tested version takes the place of its namespace's active one
+	candidates := []datastore.Schema{*schema}
+	for _, other := range active {
+		if other.Namespace != schema.Namespace {
+			candidates = append(candidates, other)
+		}
+	}
+
+	result := &datastore.SchemaTestResult{Violations: make([]datastore.SchemaViolation, 0)}
+
+	for _, answer := range answers {
+		if governing := governingSchema(candidates, answer.Key); governing.UID != schema.UID {
+			continue
+		}
+
+		violations, err := s.validate(schema, answer.Values[len(answer.Values)-1])
+		if err != nil {
+			return nil, util.NewServiceError(http.StatusInternalServerError, err)
+		}
+
+		for _, violation := range violations {
+			violation.Key = answer.Key
+			result.Violations = append(result.Violations, violation)
+		}
+
+		result.Checked++
+	}
+
+	return result, nil
+}
+
+func (s *SchemaService) validate(schema *datastore.Schema, value datastore.Value) ([]datastore.SchemaViolation, error) {
+	compiled, ok := s.compiled.Load(schema.UID)
+	if !ok {
+		c, err := compileSchema(schema.Definition)
+		if err != nil {
+			return nil, err
+		}
+
+		compiled, _ = s.compiled.LoadOrStore(schema.UID, c)
+	}
+
+	err := compiled.(*jsonschema.Schema).Validate(value.Value)
+
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		return violations(validationErr, nil), nil
+	}
+
+	return nil, err
+}
+
+func (s *SchemaService) inTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.transactor == nil {
+		return fn(ctx)
+	}
+
+	return s.transactor.WithTransaction(ctx, fn)
+}
+
+// governingSchema returns the schema with the longest namespace key
+// starts with, preferring the newest version of a namespace, or nil.
+func governingSchema(schemas []datastore.Schema, key string) *datastore.Schema {
+	var governing *datastore.Schema
+
+	for i := range schemas {
+		schema := &schemas[i]
+		if !strings.HasPrefix(key, schema.Namespace) {
+			continue
+		}
+
+		if governing == nil || len(schema.Namespace) > len(governing.Namespace) ||
+			(schema.Namespace == governing.Namespace && schema.Version > governing.Version) {
+			governing = schema
+		}
+	}
+
+	return governing
+}
+
+// compileSchema compiles a JSON Schema, defaulting to draft 2020-12.
+// References are only resolved within the definition, so that schemas
+// can't make the service read files or fetch URLs.
+func compileSchema(definition []byte) (*jsonschema.Schema, error) {
+	const url = "schema.json"
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.AssertFormat = true
+	compiler.LoadURL = func(s string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("can't resolve %s, only references within the schema are supported", s)
+	}
+
+	if err := compiler.AddResource(url, bytes.NewReader(definition)); err != nil {
+		return nil, err
+	}
+
+	return compiler.Compile(url)
+}
+
+// violations flattens the tree of validation errors into
+// its leaves, which describe the actual mismatches.
+func violations(err *jsonschema.ValidationError, found []datastore.SchemaViolation) []datastore.SchemaViolation {
+	if len(err.Causes) == 0 {
+		return append(found, datastore.SchemaViolation{
+			Path:    err.InstanceLocation,
+			Message: err.Message,
+		})
+	}
+
+	for _, cause := range err.Causes {
+		found = violations(cause, found)
+	}
+
+	return found
+}
@@ -0,0 +1,384 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/datastore/mocks"
+	"github.com/dotunj/bequest/internal/pkg/util"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+const limitsSchema = `{
+	"type": "object",
+	"properties": {
+		"limit": {"type": "integer", "minimum": 0},
+		"currency": {"type": "string", "enum": ["EUR", "USD"]}
+	},
+	"required": ["limit"]
+}`
+
+func provideSchemaService(ctrl *gomock.Controller) *SchemaService {
+	schemaRepo := mocks.NewMockSchemaRepository(ctrl)
+	answerRepo := mocks.NewMockAnswerRepository(ctrl)
+
+	return NewSchemaService(schemaRepo, answerRepo, nil)
+}
+
+func TestSchemaService_CreateSchema(t *testing.T) {
+	ctx := context.Background()
+	tt := []struct {
+		name        string
+		req         *datastore.CreateSchema
+		wantErr     bool
+		wantErrMsg  string
+		wantErrCode int
+		wantVersion int
+		dbFn        func(s *SchemaService)
+	}{
+		{
+			name: "should_create_first_version",
+			req:  &datastore.CreateSchema{Namespace: "billing/", Definition: json.RawMessage(limitsSchema)},
+			dbFn: func(s *SchemaService) {
+				schemaRepo, _ := s.schemaRepo.(*mocks.MockSchemaRepository)
+
+				schemaRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, "billing/").Return([]datastore.Schema{}, nil)
+				schemaRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			wantVersion: 1,
+		},
+
+		{
+			name: "should_create_next_version",
+			req:  &datastore.CreateSchema{Namespace: "billing/", Definition: json.RawMessage(limitsSchema)},
+			dbFn: func(s *SchemaService) {
+				schemaRepo, _ := s.schemaRepo.(*mocks.MockSchemaRepository)
+
+				schemaRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, "billing/").Return([]datastore.Schema{{Version: 1}, {Version: 2}}, nil)
+				schemaRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			wantVersion: 3,
+		},
+
+		{
+			name:        "should_fail_to_create_invalid_schema",
+			req:         &datastore.CreateSchema{Namespace: "billing/", Definition: json.RawMessage(`{"type": "integer", "minimum": "0"}`)},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+		},
+
+		{
+			name:        "should_fail_to_create_schema_with_external_reference",
+			req:         &datastore.CreateSchema{Namespace: "billing/", Definition: json.RawMessage(`{"$ref": "file:///etc/passwd"}`)},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+		},
+
+		{
+			name: "should_fail_to_create_concurrent_version",
+			req:  &datastore.CreateSchema{Namespace: "billing/", Definition: json.RawMessage(limitsSchema)},
+			dbFn: func(s *SchemaService) {
+				schemaRepo, _ := s.schemaRepo.(*mocks.MockSchemaRepository)
+
+				schemaRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, "billing/").Return([]datastore.Schema{}, nil)
+				schemaRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(datastore.ErrDuplicateKey)
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusConflict,
+			wantErrMsg:  datastore.ErrDuplicateKey.Error(),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			schemaService := provideSchemaService(ctrl)
+
+			if tc.dbFn != nil {
+				tc.dbFn(schemaService)
+			}
+
+			schema, err := schemaService.CreateSchema(ctx, datastore.DefaultTenant, tc.req)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				if tc.wantErrMsg != "" {
+					require.Equal(t, tc.wantErrMsg, err.(*util.ServiceError).Error())
+				}
+				return
+			}
+
+			require.Nil(t, err)
+			require.NotEmpty(t, schema.UID)
+			require.Equal(t, tc.req.Namespace, schema.Namespace)
+			require.Equal(t, tc.wantVersion, schema.Version)
+			require.Equal(t, datastore.DraftSchemaStatus, schema.Status)
+		})
+	}
+}
+
+func TestSchemaService_TestSchema(t *testing.T) {
+	ctx := context.Background()
+
+	draft := datastore.Schema{UID: "draft", TenantID: datastore.DefaultTenant, Namespace: "billing/", Version: 2, Definition: []byte(limitsSchema), Status: datastore.DraftSchemaStatus}
+
+	tt := []struct {
+		name           string
+		wantErr        bool
+		wantErrCode    int
+		wantChecked    int
+		wantViolations []datastore.SchemaViolation
+		dbFn           func(s *SchemaService)
+	}{
+		{
+			name: "should_report_answers_violating_schema",
+			dbFn: func(s *SchemaService) {
+				schemaRepo, _ := s.schemaRepo.(*mocks.MockSchemaRepository)
+				answerRepo, _ := s.answerRepo.(*mocks.MockAnswerRepository)
+
+				schemaRepo.EXPECT().FindByUID(gomock.Any(), datastore.DefaultTenant, "draft").Return(&draft, nil)
+				schemaRepo.EXPECT().FindActive(gomock.Any(), datastore.DefaultTenant).Return([]datastore.Schema{
+					// replaced by the draft, so it doesn't shadow it
+					{UID: "active", TenantID: datastore.DefaultTenant, Namespace: "billing/", Version: 1, Definition: []byte(`true`)},
+					{UID: "invoices", Namespace: "billing/invoices/", Version: 1, Definition: []byte(`true`)},
+				}, nil)
+				answerRepo.EXPECT().FindManyByPrefix(gomock.Any(), datastore.DefaultTenant, "billing/").Return([]datastore.Answer{
+					{Key: "billing/a", Values: []datastore.Value{{Value: "old"}, {Value: map[string]interface{}{"limit": int64(10)}}}},
+					{Key: "billing/b", Values: []datastore.Value{{Value: map[string]interface{}{"limit": int64(-1), "currency": "GBP"}}}},
+					{Key: "billing/invoices/c", Values: []datastore.Value{{Value: "governed by a longer namespace"}}},
+				}, nil)
+			},
+			wantChecked: 2,
+			wantViolations: []datastore.SchemaViolation{
+				{Key: "billing/b", Path: "/limit", Message: "must be >= 0 but found -1"},
+				{Key: "billing/b", Path: "/currency", Message: `value must be one of "EUR", "USD"`},
+			},
+		},
+
+		{
+			name: "should_fail_to_test_non_existent_schema",
+			dbFn: func(s *SchemaService) {
+				schemaRepo, _ := s.schemaRepo.(*mocks.MockSchemaRepository)
+
+				schemaRepo.EXPECT().FindByUID(gomock.Any(), datastore.DefaultTenant, "draft").Return(nil, datastore.ErrSchemaNotFound)
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			schemaService := provideSchemaService(ctrl)
+
+			if tc.dbFn != nil {
+				tc.dbFn(schemaService)
+			}
+
+			result, err := schemaService.TestSchema(ctx, datastore.DefaultTenant, "draft")
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, tc.wantChecked, result.Checked)
+			require.ElementsMatch(t, tc.wantViolations, result.Violations)
+		})
+	}
+}
+
+func TestSchemaService_ActivateSchema(t *testing.T) {
+	ctx := context.Background()
+
+	draft := datastore.Schema{UID: "draft", TenantID: datastore.DefaultTenant, Namespace: "billing/", Version: 2, Definition: []byte(limitsSchema), Status: datastore.DraftSchemaStatus}
+	active := datastore.Schema{UID: "active", TenantID: datastore.DefaultTenant, Namespace: "billing/", Version: 1, Definition: []byte(`true`), Status: datastore.ActiveSchemaStatus}
+	invalid := datastore.Answer{Key: "billing/a", Values: []datastore.Value{{Value: "not an object"}}}
+
+	tt := []struct {
+		name        string
+		force       bool
+		wantErr     bool
+		wantErrMsg  string
+		wantErrCode int
+		dbFn        func(s *SchemaService)
+	}{
+		{
+			name: "should_activate_schema_and_deactivate_previous_version",
+			dbFn: func(s *SchemaService) {
+				schemaRepo, _ := s.schemaRepo.(*mocks.MockSchemaRepository)
+				answerRepo, _ := s.answerRepo.(*mocks.MockAnswerRepository)
+
+				schemaRepo.EXPECT().FindByUID(gomock.Any(), datastore.DefaultTenant, "draft").Return(&draft, nil)
+				schemaRepo.EXPECT().FindActive(gomock.Any(), datastore.DefaultTenant).Return([]datastore.Schema{active}, nil)
+				answerRepo.EXPECT().FindManyByPrefix(gomock.Any(), datastore.DefaultTenant, "billing/").Return([]datastore.Answer{}, nil)
+
+				activated := draft
+				activated.Status = datastore.ActiveSchemaStatus
+
+				gomock.InOrder(
+					schemaRepo.EXPECT().UpdateStatus(gomock.Any(), datastore.DefaultTenant, "draft", datastore.ActiveSchemaStatus).Return(nil),
+					schemaRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, "billing/").Return([]datastore.Schema{active, activated}, nil),
+					schemaRepo.EXPECT().UpdateStatus(gomock.Any(), datastore.DefaultTenant, "active", datastore.InactiveSchemaStatus).Return(nil),
+					schemaRepo.EXPECT().FindByUID(gomock.Any(), datastore.DefaultTenant, "draft").Return(&activated, nil),
+				)
+			},
+		},
+
+		{
+			name: "should_fail_to_activate_schema_violated_by_existing_answers",
+			dbFn: func(s *SchemaService) {
+				schemaRepo, _ := s.schemaRepo.(*mocks.MockSchemaRepository)
+				answerRepo, _ := s.answerRepo.(*mocks.MockAnswerRepository)
+
+				schemaRepo.EXPECT().FindByUID(gomock.Any(), datastore.DefaultTenant, "draft").Return(&draft, nil)
+				schemaRepo.EXPECT().FindActive(gomock.Any(), datastore.DefaultTenant).Return([]datastore.Schema{}, nil)
+				answerRepo.EXPECT().FindManyByPrefix(gomock.Any(), datastore.DefaultTenant, "billing/").Return([]datastore.Answer{invalid}, nil)
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusUnprocessableEntity,
+			wantErrMsg:  ErrSchemaNotActivated.Error(),
+		},
+
+		{
+			name:  "should_force_activation_of_schema_violated_by_existing_answers",
+			force: true,
+			dbFn: func(s *SchemaService) {
+				schemaRepo, _ := s.schemaRepo.(*mocks.MockSchemaRepository)
+
+				activated := draft
+				activated.Status = datastore.ActiveSchemaStatus
+
+				gomock.InOrder(
+					schemaRepo.EXPECT().FindByUID(gomock.Any(), datastore.DefaultTenant, "draft").Return(&draft, nil),
+					schemaRepo.EXPECT().UpdateStatus(gomock.Any(), datastore.DefaultTenant, "draft", datastore.ActiveSchemaStatus).Return(nil),
+					schemaRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, "billing/").Return([]datastore.Schema{activated}, nil),
+					schemaRepo.EXPECT().FindByUID(gomock.Any(), datastore.DefaultTenant, "draft").Return(&activated, nil),
+				)
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			schemaService := provideSchemaService(ctrl)
+
+			if tc.dbFn != nil {
+				tc.dbFn(schemaService)
+			}
+
+			schema, err := schemaService.ActivateSchema(ctx, datastore.DefaultTenant, "draft", tc.force)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				require.Equal(t, tc.wantErrMsg, err.(*util.ServiceError).Error())
+
+				result := err.(*util.ServiceError).Data().(*datastore.SchemaTestResult)
+				require.Equal(t, 1, result.Checked)
+				require.Equal(t, []datastore.SchemaViolation{{Key: "billing/a", Path: "", Message: "expected object, but got string"}}, result.Violations)
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, datastore.ActiveSchemaStatus, schema.Status)
+		})
+	}
+}
+
+func TestSchemaService_Validate(t *testing.T) {
+	ctx := context.Background()
+
+	schemas := []datastore.Schema{
+		{UID: "strings", Namespace: "", Version: 1, Definition: []byte(`{"type": "string"}`)},
+		{UID: "billing", Namespace: "billing/", Version: 3, Definition: []byte(limitsSchema)},
+	}
+
+	tt := []struct {
+		name           string
+		key            string
+		value          interface{}
+		schemas        []datastore.Schema
+		wantViolations *SchemaValidationError
+	}{
+		{
+			name:  "should_accept_value_without_schema",
+			key:   "billing/limits",
+			value: int64(10),
+		},
+
+		{
+			name:    "should_accept_value_matching_longest_namespace",
+			key:     "billing/limits",
+			value:   map[string]interface{}{"limit": int64(10), "currency": "EUR"},
+			schemas: schemas,
+		},
+
+		{
+			name:    "should_list_every_violation",
+			key:     "billing/limits",
+			value:   map[string]interface{}{"currency": "GBP"},
+			schemas: schemas,
+			wantViolations: &SchemaValidationError{
+				Namespace: "billing/",
+				Version:   3,
+				Violations: []datastore.SchemaViolation{
+					{Path: "", Message: "missing properties: 'limit'"},
+					{Path: "/currency", Message: `value must be one of "EUR", "USD"`},
+				},
+			},
+		},
+
+		{
+			name:    "should_fall_back_to_shorter_namespace",
+			key:     "accounts/limits",
+			value:   int64(10),
+			schemas: schemas,
+			wantViolations: &SchemaValidationError{
+				Namespace: "",
+				Version:   1,
+				Violations: []datastore.SchemaViolation{
+					{Path: "", Message: "expected string, but got number"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			schemaService := provideSchemaService(ctrl)
+
+			schemaRepo, _ := schemaService.schemaRepo.(*mocks.MockSchemaRepository)
+			schemaRepo.EXPECT().FindActive(gomock.Any(), datastore.DefaultTenant).Return(tc.schemas, nil)
+
+			err := schemaService.Validate(ctx, datastore.DefaultTenant, tc.key, datastore.Value{Value: tc.value})
+
+			if tc.wantViolations != nil {
+				require.NotNil(t, err)
+				require.Equal(t, http.StatusUnprocessableEntity, err.(*util.ServiceError).ErrCode())
+
+				got := err.(*util.ServiceError).Data().(*SchemaValidationError)
+				require.Equal(t, tc.wantViolations.Namespace, got.Namespace)
+				require.Equal(t, tc.wantViolations.Version, got.Version)
+				require.ElementsMatch(t, tc.wantViolations.Violations, got.Violations)
+				return
+			}
+
+			require.Nil(t, err)
+		})
+	}
+}
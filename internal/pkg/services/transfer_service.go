@@ -0,0 +1,395 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/auth"
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/util"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidConflictPolicy = errors.New("on_conflict must be skip, overwrite or fail")
+	ErrMalformedRecord       = errors.New("malformed record")
+	ErrRecordExpired         = errors.New("the expiry of the record has passed")
+	ErrEventTypeRequired     = errors.New("every event needs a type")
+)
+
+const (
+	// historyPageSize bounds the number of events read at once.
+	historyPageSize = 100
+
+	// importProgressInterval is the number of records
+	// read between two progress reports of an import.
+	importProgressInterval = 500
+
+	// maxImportFailures bounds the failures listed by an import
+	// report, the ones past it are only counted.
+	maxImportFailures = 100
+)
+
+// RecordReader reads the records of an import one at a time, returning
+// io.EOF after the last one. A record that can't be decoded is reported
+// with an error wrapping ErrMalformedRecord, reading then goes on with
+// the next record.
+type RecordReader interface {
+	Read() (*datastore.AnswerRecord, error)
+}
+
+// TransferService exports the answers of a tenant and imports them,
+// into the same tenant or another one, or into another instance.
+type TransferService struct {
+	answerService *AnswerService
+	eventService  *EventService
+	eventRepo     datastore.EventRepository
+}
+
+func NewTransferService(answerService *AnswerService, eventService *EventService, eventRepo datastore.EventRepository) *TransferService {
+	return &TransferService{
+		answerService: answerService,
+		eventService:  eventService,
+		eventRepo:     eventRepo,
+	}
+}
+
+// ExportAnswers passes the active answers of the tenant selected by
+// query to emit one at a time, in key order, leaving out those whose key
+// authorized rejects and those that have expired. Errors returned before
+// the first answer is emitted are those of query.
+func (t *TransferService) ExportAnswers(ctx context.Context, tenantID string, query *datastore.ExportQuery, authorized func(key string) bool, emit func(record *datastore.AnswerRecord) error) error {
+	listing := &datastore.AnswerQuery{Prefix: query.Prefix, Regex: query.Regex, PerPage: maxPerPage}
+
+	for {
+		answers, cursor, err := t.answerService.FindAnswers(ctx, tenantID, listing, authorized)
+		if err != nil {
+			return err
+		}
+
+		for i := range answers {
+			record, err := t.record(ctx, &answers[i], query)
+			if err != nil {
+				return err
+			}
+
+			if err := emit(record); err != nil {
+				return err
+			}
+		}
+
+		if cursor.Next == "" {
+			return nil
+		}
+
+		listing.Cursor = cursor.Next
+	}
+}
+
+// record returns the record of answer, along with its
+// versions and history when query includes them.
+func (t *TransferService) record(ctx context.Context, answer *datastore.Answer, query *datastore.ExportQuery) (*datastore.AnswerRecord, error) {
+	latest := answer.Values[len(answer.Values)-1]
+
+	value, err := json.Marshal(latest.Value)
+	if err != nil {
+		return nil, util.NewServiceError(http.StatusInternalServerError, err)
+	}
+
+	record := &datastore.AnswerRecord{
+		Key:       answer.Key,
+		Value:     value,
+		Type:      latest.ValueType(),
+		Version:   answer.Version,
+		CreatedAt: answer.CreatedAt,
+		UpdatedAt: answer.UpdatedAt,
+		ExpiresAt: answer.ExpiresAt,
+	}
+
+	if query.History {
+		for _, version := range answer.Versions() {
+			value, err := json.Marshal(version.Value)
+			if err != nil {
+				return nil, util.NewServiceError(http.StatusInternalServerError, err)
+			}
+
+			record.Versions = append(record.Versions, datastore.VersionRecord{
+				Version:   version.Version,
+				Value:     value,
+				Type:      version.ValueType(),
+				Author:    version.Author,
+				CreatedAt: version.CreatedAt,
+			})
+		}
+	}
+
+	if query.Events {
+		record.Events, err = t.history(ctx, answer)
+	}
+
+	return record, err
+}
+
+// history returns the events of the generation of answer, oldest first.
+func (t *TransferService) history(ctx context.Context, answer *datastore.Answer) ([]datastore.Event, error) {
+	var events []datastore.Event
+	for page := 1; ; page++ {
+		pageable := datastore.Pageable{Page: page, PerPage: historyPageSize, Sort: 1}
+
+		found, pagination, err := t.eventService.FindHistoryByKey(ctx, answer.TenantID, answer.Key, answer.Generation, pageable)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, found...)
+
+		if int64(page) >= pagination.TotalPage {
+			return events, nil
+		}
+	}
+}
+
+// ImportAnswers imports the records read from records into the tenant,
+// applying policy to the keys that already have an active answer, and
+// returns the report of the import. Every answer imported is recorded
+// in its history by an import event, after the events of its record.
+//
+// Records of keys authorized rejects fail with a 403, and invalid ones
+// with a 400, without stopping the import. Records are validated as a
+// whole before anything is written, so that a failing record never
+// overwrites an answer. When the import is stopped, by the fail policy
+// or because records can no longer be read, the records imported until
+// then are kept. progress, unless nil, is passed the report every
+// importProgressInterval records. The overwrite policy fails with a 501
+// on stores without transactions.
+func (t *TransferService) ImportAnswers(ctx context.Context, tenantID string, policy datastore.ConflictPolicy, records RecordReader, authorized func(key string) bool, progress func(report *datastore.ImportReport)) (*datastore.ImportReport, error) {
+	if policy == "" {
+		policy = datastore.SkipConflictPolicy
+	}
+
+	if !policy.IsValid() {
+		return nil, util.NewServiceError(http.StatusBadRequest, ErrInvalidConflictPolicy)
+	}
+
+	if policy == datastore.OverwriteConflictPolicy && t.answerService.transactor == nil {
+		return nil, util.NewServiceError(http.StatusNotImplemented, ErrOverwriteRequiresTx)
+	}
+
+	report := &datastore.ImportReport{Failures: make([]datastore.ImportError, 0)}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			report.Error = err.Error()
+			return report, nil
+		}
+
+		record, err := records.Read()
+		if errors.Is(err, io.EOF) {
+			report.Done = true
+			return report, nil
+		}
+
+		if err != nil && !errors.Is(err, ErrMalformedRecord) {
+			report.Error = err.Error()
+			return report, nil
+		}
+
+		report.Records++
+
+		if err == nil {
+			err = t.importRecord(ctx, tenantID, record, policy, authorized, report)
+		} else {
+			err = util.NewServiceError(http.StatusBadRequest, err)
+		}
+
+		if err != nil {
+			report.Failed++
+
+			if len(report.Failures) < maxImportFailures {
+				status, message := util.NewServiceErrResponse(err)
+
+				failure := datastore.ImportError{Record: report.Records, Status: status, Error: message}
+				if record != nil {
+					failure.Key = record.Key
+				}
+
+				report.Failures = append(report.Failures, failure)
+			}
+
+			if policy == datastore.FailConflictPolicy && hasErrCode(err, http.StatusConflict) {
+				report.Error = err.Error()
+				return report, nil
+			}
+		}
+
+		if progress != nil && report.Records%importProgressInterval == 0 {
+			progress(report)
+		}
+	}
+}
+
+// importRecord imports record, counting it in report unless it fails.
+func (t *TransferService) importRecord(ctx context.Context, tenantID string, record *datastore.AnswerRecord, policy datastore.ConflictPolicy, authorized func(key string) bool, report *datastore.ImportReport) error {
+	if record.Key == "" {
+		return util.NewServiceError(http.StatusBadRequest, ErrKeyRequired)
+	}
+
+	if !authorized(record.Key) {
+		return util.NewServiceError(http.StatusForbidden, fmt.Errorf("the %s role is required on this key", datastore.WriterRole))
+	}
+
+	answer, err := importedAnswer(ctx, tenantID, record, time.Now())
+	if err != nil {
+		return err
+	}
+
+	events, err := importedEvents(record.Events, time.Now())
+	if err != nil {
+		return err
+	}
+
+	overwritten, err := t.answerService.ImportAnswer(ctx, answer, policy == datastore.OverwriteConflictPolicy, func(ctx context.Context, answer *datastore.Answer) error {
+		for i := range events {
+			events[i].TenantID = answer.TenantID
+			events[i].Data.Key = answer.Key
+			events[i].Data.Generation = answer.Generation
+
+			if err := t.eventRepo.Create(ctx, &events[i]); err != nil {
+				return util.NewServiceError(http.StatusInternalServerError, err)
+			}
+		}
+
+		return nil
+	})
+
+	switch {
+	case policy == datastore.SkipConflictPolicy && hasErrCode(err, http.StatusConflict):
+		report.Skipped++
+	case err != nil:
+		return err
+	case overwritten:
+		report.Overwritten++
+	default:
+		report.Created++
+	}
+
+	return nil
+}
+
+// importedEvents returns events as they are written into the history of
+// an imported answer, to be given its tenant, key and generation. Their
+// values are decoded from JSON like the values of answers.
+func importedEvents(events []datastore.Event, now time.Time) ([]datastore.Event, error) {
+	timestamp := primitive.NewDateTimeFromTime(now)
+
+	imported := make([]datastore.Event, 0, len(events))
+	for _, event := range events {
+		if event.Type == "" {
+			return nil, util.NewServiceError(http.StatusBadRequest, ErrEventTypeRequired)
+		}
+
+		data := datastore.EventData{}
+		if event.Data != nil {
+			data = *event.Data
+
+			raw, err := json.Marshal(data.Value)
+			if err != nil {
+				return nil, util.NewServiceError(http.StatusBadRequest, err)
+			}
+
+			if data.Value, err = datastore.ParseValue(raw); err != nil {
+				return nil, util.NewServiceError(http.StatusBadRequest, err)
+			}
+		}
+
+		event.ID = primitive.NewObjectID()
+		event.UID = uuid.NewString()
+		event.Data = &data
+		event.DeletedAt = 0
+		event.DocumentStatus = datastore.ActiveDocumentStatus
+
+		if event.CreatedAt == 0 {
+			event.CreatedAt = timestamp
+		}
+
+		if event.UpdatedAt == 0 {
+			event.UpdatedAt = event.CreatedAt
+		}
+
+		imported = append(imported, event)
+	}
+
+	return imported, nil
+}
+
+// importedAnswer returns the answer of the tenant record describes,
+// to be written at now.
+func importedAnswer(ctx context.Context, tenantID string, record *datastore.AnswerRecord, now time.Time) (*datastore.Answer, error) {
+	timestamp := primitive.NewDateTimeFromTime(now)
+
+	versions := record.Versions
+	if len(versions) == 0 {
+		// the value written by the import itself
+		versions = []datastore.VersionRecord{{
+			Value:     record.Value,
+			Type:      record.Type,
+			Author:    auth.Actor(ctx),
+			CreatedAt: record.UpdatedAt,
+		}}
+	}
+
+	values := make([]datastore.Value, 0, len(versions))
+	for i, version := range versions {
+		value, err := datastore.NewValue(version.Value, version.Type)
+		if err != nil {
+			return nil, util.NewServiceError(http.StatusBadRequest, err)
+		}
+
+		// versions are numbered in the order they are listed,
+		// like stores number the values of an answer
+		value.Version = int64(i + 1)
+		value.Author = version.Author
+		value.CreatedAt = version.CreatedAt
+
+		if value.CreatedAt == 0 {
+			value.CreatedAt = timestamp
+		}
+
+		values = append(values, value)
+	}
+
+	if record.ExpiresAt != 0 && record.ExpiresAt <= timestamp {
+		return nil, util.NewServiceError(http.StatusBadRequest, ErrRecordExpired)
+	}
+
+	current := values[len(values)-1]
+
+	answer := &datastore.Answer{
+		ID:             primitive.NewObjectID(),
+		UID:            uuid.NewString(),
+		TenantID:       tenantID,
+		Key:            record.Key,
+		Values:         values,
+		Version:        current.Version,
+		CreatedAt:      record.CreatedAt,
+		UpdatedAt:      record.UpdatedAt,
+		DocumentStatus: datastore.ActiveDocumentStatus,
+		ExpiresAt:      record.ExpiresAt,
+	}
+
+	if answer.CreatedAt == 0 {
+		answer.CreatedAt = values[0].CreatedAt
+	}
+
+	if answer.UpdatedAt == 0 {
+		answer.UpdatedAt = current.CreatedAt
+	}
+
+	return answer, nil
+}
@@ -0,0 +1,491 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dotunj/bequest/internal/pkg/datastore"
+	"github.com/dotunj/bequest/internal/pkg/datastore/mocks"
+	"github.com/dotunj/bequest/internal/pkg/util"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func provideTransferService(ctrl *gomock.Controller, answerService *AnswerService) *TransferService {
+	eventRepo := mocks.NewMockEventRepository(ctrl)
+	eventService := NewEventService(answerService.answerRepo, eventRepo, answerService.dispatcher)
+
+	return NewTransferService(answerService, eventService, eventRepo)
+}
+
+// sliceReader reads records, then the error of the read past them,
+// io.EOF unless err is set. Malformed records are nil records.
+type sliceReader struct {
+	records []*datastore.AnswerRecord
+	err     error
+	read    int
+}
+
+func (r *sliceReader) Read() (*datastore.AnswerRecord, error) {
+	if r.read >= len(r.records) {
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, io.EOF
+	}
+
+	record := r.records[r.read]
+	r.read++
+
+	if record == nil {
+		return nil, fmt.Errorf("%w: unexpected end of JSON input", ErrMalformedRecord)
+	}
+
+	return record, nil
+}
+
+func TestTransferService_ImportAnswers(t *testing.T) {
+	ctx := context.Background()
+
+	authorized := func(key string) bool {
+		return !strings.HasPrefix(key, "secret.")
+	}
+
+	existing := &datastore.Answer{
+		UID:      "12345",
+		TenantID: datastore.DefaultTenant,
+		Key:      "b",
+		Values:   []datastore.Value{{Value: "old-value"}},
+		Version:  1,
+	}
+
+	records := func() []*datastore.AnswerRecord {
+		return []*datastore.AnswerRecord{
+			{Key: "a", Value: json.RawMessage(`"some-value"`)},
+			{Key: "b", Value: json.RawMessage(`"new-value"`)},
+		}
+	}
+
+	tt := []struct {
+		name        string
+		policy      datastore.ConflictPolicy
+		records     []*datastore.AnswerRecord
+		readErr     error
+		wantReport  datastore.ImportReport
+		wantCodes   []int
+		wantErr     bool
+		wantErrMsg  string
+		wantErrCode int
+		// transactional provides a store with transactions
+		transactional bool
+		dbFn          func(s *TransferService)
+	}{
+		{
+			name:       "should_skip_existing_answers_by_default",
+			records:    records(),
+			wantReport: datastore.ImportReport{Records: 2, Created: 1, Skipped: 1, Done: true},
+			dbFn: func(s *TransferService) {
+				expectSchemas(s.answerService)
+				expectSchemas(s.answerService)
+
+				answerRepo, _ := s.answerService.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "a").Return(nil, datastore.ErrAnswerNotFound)
+				answerRepo.EXPECT().LastGeneration(gomock.Any(), datastore.DefaultTenant, "a").Return(int64(0), nil)
+				answerRepo.EXPECT().Create(gomock.Any(), withOutbox(datastore.ImportEvent, "some-value")).Return(nil)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "b").Return(existing, nil)
+			},
+		},
+
+		{
+			name:          "should_overwrite_existing_answers",
+			policy:        datastore.OverwriteConflictPolicy,
+			records:       records()[1:],
+			wantReport:    datastore.ImportReport{Records: 1, Overwritten: 1, Done: true},
+			transactional: true,
+			dbFn: func(s *TransferService) {
+				expectSchemas(s.answerService)
+
+				answerRepo, _ := s.answerService.answerRepo.(*mocks.MockAnswerRepository)
+				transactor, _ := s.answerService.transactor.(*mocks.MockTransactor)
+
+				transactor.EXPECT().WithTransaction(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, fn func(ctx context.Context) error) error {
+						return fn(ctx)
+					}).AnyTimes()
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "b").Return(existing, nil).Times(2)
+				answerRepo.EXPECT().Delete(gomock.Any(), withOutbox(datastore.DeleteEvent, "old-value"), int64(1)).Return(nil)
+				answerRepo.EXPECT().LastGeneration(gomock.Any(), datastore.DefaultTenant, "b").Return(int64(1), nil)
+				answerRepo.EXPECT().Create(gomock.Any(), withOutbox(datastore.ImportEvent, "new-value")).
+					DoAndReturn(func(_ context.Context, answer *datastore.Answer) error {
+						require.Equal(t, int64(2), answer.Generation)
+						return nil
+					})
+			},
+		},
+
+		{
+			name:        "should_refuse_to_overwrite_without_transactions",
+			policy:      datastore.OverwriteConflictPolicy,
+			records:     records()[1:],
+			wantErr:     true,
+			wantErrCode: http.StatusNotImplemented,
+			wantErrMsg:  ErrOverwriteRequiresTx.Error(),
+		},
+
+		{
+			name:       "should_stop_at_the_first_conflict_with_the_fail_policy",
+			policy:     datastore.FailConflictPolicy,
+			records:    append(records()[1:], records()[0]),
+			wantReport: datastore.ImportReport{Records: 1, Failed: 1},
+			wantCodes:  []int{http.StatusConflict},
+			dbFn: func(s *TransferService) {
+				expectSchemas(s.answerService)
+
+				answerRepo, _ := s.answerService.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "b").Return(existing, nil)
+			},
+		},
+
+		{
+			name: "should_import_versions_and_events",
+			records: []*datastore.AnswerRecord{{
+				Key: "a",
+				Versions: []datastore.VersionRecord{
+					{Version: 4, Value: json.RawMessage(`"first-value"`), Author: "alice"},
+					{Version: 7, Value: json.RawMessage(`"some-value"`), Author: "bob"},
+				},
+				Events: []datastore.Event{{
+					UID:  "67890",
+					Type: datastore.UpdateEvent,
+					Data: &datastore.EventData{Key: "other", Value: "some-value", Generation: 3},
+				}},
+			}},
+			wantReport: datastore.ImportReport{Records: 1, Created: 1, Done: true},
+			dbFn: func(s *TransferService) {
+				expectSchemas(s.answerService)
+
+				answerRepo, _ := s.answerService.answerRepo.(*mocks.MockAnswerRepository)
+				eventRepo, _ := s.eventRepo.(*mocks.MockEventRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "a").Return(nil, datastore.ErrAnswerNotFound)
+				answerRepo.EXPECT().LastGeneration(gomock.Any(), datastore.DefaultTenant, "a").Return(int64(0), nil)
+				answerRepo.EXPECT().Create(gomock.Any(), withOutbox(datastore.ImportEvent, "some-value")).
+					DoAndReturn(func(_ context.Context, answer *datastore.Answer) error {
+						require.Len(t, answer.Values, 2)
+						require.Equal(t, int64(2), answer.Version)
+						require.Equal(t, "alice", answer.Values[0].Author)
+						require.Equal(t, int64(1), answer.Values[0].Version)
+						return nil
+					})
+
+				eventRepo.EXPECT().Create(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, event *datastore.Event) error {
+						require.NotEqual(t, "67890", event.UID)
+						require.Equal(t, datastore.DefaultTenant, event.TenantID)
+						require.Equal(t, "a", event.Data.Key)
+						require.Equal(t, int64(1), event.Data.Generation)
+						require.NotZero(t, event.CreatedAt)
+						return nil
+					})
+			},
+		},
+
+		{
+			name:          "should_not_overwrite_with_an_invalid_event",
+			policy:        datastore.OverwriteConflictPolicy,
+			transactional: true,
+			records: []*datastore.AnswerRecord{{
+				Key:    "b",
+				Value:  json.RawMessage(`"new-value"`),
+				Events: []datastore.Event{{Type: datastore.CreateEvent}, {}},
+			}},
+			wantReport: datastore.ImportReport{Records: 1, Failed: 1, Done: true},
+			wantCodes:  []int{http.StatusBadRequest},
+		},
+
+		{
+			name:          "should_not_overwrite_with_a_version_breaking_the_schema",
+			policy:        datastore.OverwriteConflictPolicy,
+			transactional: true,
+			records: []*datastore.AnswerRecord{{
+				Key: "b",
+				Versions: []datastore.VersionRecord{
+					{Value: json.RawMessage(`"much-too-long"`)},
+					{Value: json.RawMessage(`"new"`)},
+				},
+			}},
+			wantReport: datastore.ImportReport{Records: 1, Failed: 1, Done: true},
+			wantCodes:  []int{http.StatusUnprocessableEntity},
+			dbFn: func(s *TransferService) {
+				expectSchemas(s.answerService, datastore.Schema{
+					UID:        "12345",
+					Namespace:  "b",
+					Version:    1,
+					Definition: []byte(`{"type": "string", "maxLength": 5}`),
+				})
+			},
+		},
+
+		{
+			name: "should_report_failing_records_and_go_on",
+			records: []*datastore.AnswerRecord{
+				{Key: "secret.a", Value: json.RawMessage(`"some-value"`)},
+				nil,
+				{Value: json.RawMessage(`"some-value"`)},
+				{Key: "c", Value: json.RawMessage(`"some-value"`), Type: datastore.NumberValue},
+				{Key: "d", Value: json.RawMessage(`"some-value"`), ExpiresAt: primitive.NewDateTimeFromTime(time.Now().Add(-time.Hour))},
+				{Key: "a", Value: json.RawMessage(`"some-value"`)},
+			},
+			wantReport: datastore.ImportReport{Records: 6, Created: 1, Failed: 5, Done: true},
+			wantCodes:  []int{http.StatusForbidden, http.StatusBadRequest, http.StatusBadRequest, http.StatusBadRequest, http.StatusBadRequest},
+			dbFn: func(s *TransferService) {
+				expectSchemas(s.answerService)
+
+				answerRepo, _ := s.answerService.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "a").Return(nil, datastore.ErrAnswerNotFound)
+				answerRepo.EXPECT().LastGeneration(gomock.Any(), datastore.DefaultTenant, "a").Return(int64(0), nil)
+				answerRepo.EXPECT().Create(gomock.Any(), withOutbox(datastore.ImportEvent, "some-value")).Return(nil)
+			},
+		},
+
+		{
+			name:       "should_stop_when_records_can_no_longer_be_read",
+			records:    records()[:0],
+			readErr:    errors.New("unexpected EOF"),
+			wantReport: datastore.ImportReport{Error: "unexpected EOF"},
+		},
+
+		{
+			name:        "should_fail_invalid_conflict_policy",
+			policy:      "merge",
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+			wantErrMsg:  ErrInvalidConflictPolicy.Error(),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			answerService := provideAnswerService(ctrl)
+			if tc.transactional {
+				answerService = provideTransactionalAnswerService(ctrl)
+			}
+
+			transferService := provideTransferService(ctrl, answerService)
+
+			if tc.dbFn != nil {
+				tc.dbFn(transferService)
+			}
+
+			reader := &sliceReader{records: tc.records, err: tc.readErr}
+
+			report, err := transferService.ImportAnswers(ctx, datastore.DefaultTenant, tc.policy, reader, authorized, nil)
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				require.Equal(t, tc.wantErrMsg, err.(*util.ServiceError).Error())
+				return
+			}
+
+			require.Nil(t, err)
+
+			codes := make([]int, 0, len(report.Failures))
+			for _, failure := range report.Failures {
+				codes = append(codes, failure.Status)
+			}
+
+			if tc.wantCodes == nil {
+				tc.wantCodes = []int{}
+			}
+			require.Equal(t, tc.wantCodes, codes)
+
+			if report.Error != "" {
+				require.Contains(t, report.Error, tc.wantReport.Error)
+			}
+
+			report.Failures, report.Error = nil, tc.wantReport.Error
+			require.Equal(t, tc.wantReport, *report)
+		})
+	}
+}
+
+func TestTransferService_ImportAnswers_ReportsProgress(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	transferService := provideTransferService(ctrl, provideAnswerService(ctrl))
+
+	// records without a key fail without reaching the store
+	records := make([]*datastore.AnswerRecord, importProgressInterval*2+1)
+	for i := range records {
+		records[i] = &datastore.AnswerRecord{}
+	}
+
+	var reported []int
+	report, err := transferService.ImportAnswers(context.Background(), datastore.DefaultTenant, "", &sliceReader{records: records}, func(string) bool { return true }, func(report *datastore.ImportReport) {
+		reported = append(reported, report.Records)
+	})
+
+	require.Nil(t, err)
+	require.Equal(t, []int{importProgressInterval, importProgressInterval * 2}, reported)
+	require.True(t, report.Done)
+	require.Equal(t, len(records), report.Failed)
+	require.Len(t, report.Failures, maxImportFailures)
+}
+
+func TestTransferService_ExportAnswers(t *testing.T) {
+	ctx := context.Background()
+
+	authorized := func(key string) bool {
+		return !strings.HasPrefix(key, "secret.")
+	}
+
+	answers := []datastore.Answer{
+		{
+			TenantID:   datastore.DefaultTenant,
+			Key:        "a",
+			Generation: 2,
+			Values:     []datastore.Value{{Value: "first-value", Author: "alice"}, {Value: float64(10)}},
+			Version:    2,
+		},
+		{
+			TenantID: datastore.DefaultTenant,
+			Key:      "secret.b",
+			Values:   []datastore.Value{{Value: "some-value"}},
+			Version:  1,
+		},
+	}
+
+	tt := []struct {
+		name        string
+		query       datastore.ExportQuery
+		wantRecords []datastore.AnswerRecord
+		wantErr     bool
+		wantErrMsg  string
+		wantErrCode int
+		// transactional provides a store with transactions
+		transactional bool
+		dbFn          func(s *TransferService)
+	}{
+		{
+			name:  "should_export_authorized_answers",
+			query: datastore.ExportQuery{Prefix: "a"},
+			wantRecords: []datastore.AnswerRecord{
+				{Key: "a", Value: json.RawMessage(`10`), Type: datastore.NumberValue, Version: 2},
+			},
+			dbFn: func(s *TransferService) {
+				answerRepo, _ := s.answerService.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ string, filter datastore.AnswerFilter) ([]datastore.Answer, error) {
+						if filter.Prefix != "a" || filter.Status != datastore.ActiveDocumentStatus ||
+							filter.ExpiresAfter == 0 || filter.Limit != maxPerPage+1 {
+							return nil, errors.New("unexpected filter")
+						}
+						return answers, nil
+					})
+			},
+		},
+
+		{
+			name:  "should_export_versions_and_events",
+			query: datastore.ExportQuery{History: true, Events: true},
+			wantRecords: []datastore.AnswerRecord{
+				{
+					Key:     "a",
+					Value:   json.RawMessage(`10`),
+					Type:    datastore.NumberValue,
+					Version: 2,
+					Versions: []datastore.VersionRecord{
+						{Version: 1, Value: json.RawMessage(`"first-value"`), Type: datastore.StringValue, Author: "alice"},
+						{Version: 2, Value: json.RawMessage(`10`), Type: datastore.NumberValue},
+					},
+					Events: []datastore.Event{{UID: "12345"}, {UID: "67890"}},
+				},
+			},
+			dbFn: func(s *TransferService) {
+				answerRepo, _ := s.answerService.answerRepo.(*mocks.MockAnswerRepository)
+				outboxRepo, _ := s.answerService.dispatcher.outboxRepo.(*mocks.MockOutboxRepository)
+				eventRepo, _ := s.eventRepo.(*mocks.MockEventRepository)
+
+				answerRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(answers, nil)
+				answerRepo.EXPECT().FindByKey(gomock.Any(), datastore.DefaultTenant, "a").Return(&answers[0], nil).Times(2)
+				outboxRepo.EXPECT().FindPendingByKey(gomock.Any(), datastore.DefaultTenant, "a").Return(nil, nil).Times(2)
+
+				eventRepo.EXPECT().FindManyByKey(gomock.Any(), datastore.DefaultTenant, "a", int64(2), datastore.Pageable{Page: 1, PerPage: historyPageSize, Sort: 1}).
+					Return([]datastore.Event{{UID: "12345"}}, datastore.PaginationData{TotalPage: 2}, nil)
+				eventRepo.EXPECT().FindManyByKey(gomock.Any(), datastore.DefaultTenant, "a", int64(2), datastore.Pageable{Page: 2, PerPage: historyPageSize, Sort: 1}).
+					Return([]datastore.Event{{UID: "67890"}}, datastore.PaginationData{TotalPage: 2}, nil)
+			},
+		},
+
+		{
+			name:        "should_fail_invalid_regex",
+			query:       datastore.ExportQuery{Regex: "("},
+			wantErr:     true,
+			wantErrCode: http.StatusBadRequest,
+		},
+
+		{
+			name: "should_fail_to_find_answers",
+			dbFn: func(s *TransferService) {
+				answerRepo, _ := s.answerService.answerRepo.(*mocks.MockAnswerRepository)
+
+				answerRepo.EXPECT().FindMany(gomock.Any(), datastore.DefaultTenant, gomock.Any()).Return(nil, errors.New("failed"))
+			},
+			wantErr:     true,
+			wantErrCode: http.StatusInternalServerError,
+			wantErrMsg:  "failed",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			answerService := provideAnswerService(ctrl)
+			if tc.transactional {
+				answerService = provideTransactionalAnswerService(ctrl)
+			}
+
+			transferService := provideTransferService(ctrl, answerService)
+
+			if tc.dbFn != nil {
+				tc.dbFn(transferService)
+			}
+
+			records := make([]datastore.AnswerRecord, 0)
+			err := transferService.ExportAnswers(ctx, datastore.DefaultTenant, &tc.query, authorized, func(record *datastore.AnswerRecord) error {
+				records = append(records, *record)
+				return nil
+			})
+
+			if tc.wantErr {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantErrCode, err.(*util.ServiceError).ErrCode())
+				if tc.wantErrMsg != "" {
+					require.Equal(t, tc.wantErrMsg, err.(*util.ServiceError).Error())
+				}
+				return
+			}
+
+			require.Nil(t, err)
+			require.Equal(t, tc.wantRecords, records)
+		})
+	}
+}
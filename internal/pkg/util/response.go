@@ -5,12 +5,19 @@ import "net/http"
 type ServiceError struct {
 	errCode int
 	errMsg  error
+	data    interface{}
 }
 
 func NewServiceError(errCode int, errMsg error) *ServiceError {
 	return &ServiceError{errCode: errCode, errMsg: errMsg}
 }
 
+// NewServiceErrorWithData creates a ServiceError carrying
+// details about the failure for the client, next to its message.
+func NewServiceErrorWithData(errCode int, errMsg error, data interface{}) *ServiceError {
+	return &ServiceError{errCode: errCode, errMsg: errMsg, data: data}
+}
+
 func (s *ServiceError) Error() string {
 	return s.errMsg.Error()
 }
@@ -19,6 +26,10 @@ func (s *ServiceError) ErrCode() int {
 	return s.errCode
 }
 
+func (s *ServiceError) Data() interface{} {
+	return s.data
+}
+
 func NewServiceErrResponse(err error) (int, string) {
 	var msg string
 	statusCode := http.StatusBadRequest